@@ -0,0 +1,133 @@
+package main
+
+import (
+	"FranzMQ/constants"
+	"encoding/json"
+	"net/http"
+	"strconv"
+)
+
+// adminConfig returns the settings the broker was started with, keyed like
+// the -section.key flags
+//
+// GET /admin/config
+func adminConfig(w http.ResponseWriter, r *http.Request) {
+	_, span := constants.Tracer.Start(r.Context(), "adminConfig GET")
+	defer span.End()
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	jsonResponse(w, http.StatusOK, brokerConfig.Values())
+}
+
+type reassignRequest struct {
+	Topic      string        `json:"topic"`
+	Partitions map[int][]int `json:"partitions"` // The new replicas by partition, the first is the preferred leader
+	Throttle   int           `json:"throttle"`   // Bytes per second the new replicas copy at, 0 for no limit
+}
+
+// reassignments lists the partitions moving between brokers, or moves
+// partitions of a topic to other brokers
+//
+// GET /reassignments
+// POST /reassignments
+func reassignments(w http.ResponseWriter, r *http.Request) {
+	ctx, span := constants.Tracer.Start(r.Context(), "reassignments "+r.Method)
+	defer span.End()
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if cluster == nil {
+		jsonResponse(w, http.StatusBadRequest, "Reassignments require etcd_endpoints or quorum")
+		return
+	}
+	if r.Method == http.MethodGet {
+		jsonResponse(w, http.StatusOK, cluster.Reassignments())
+		return
+	}
+
+	var req reassignRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonResponse(w, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+	if err := cluster.Reassign(ctx, req.Topic, req.Partitions, req.Throttle); err != nil {
+		jsonResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	jsonResponse(w, http.StatusAccepted, "Reassignment started")
+}
+
+type decommissionRequest struct {
+	Throttle int `json:"throttle"` // Bytes per second the new replicas copy at, 0 for no limit
+}
+
+// decommissionBroker moves every partition off a broker so it can be retired
+//
+// POST /brokers/{id}/decommission
+func decommissionBroker(w http.ResponseWriter, r *http.Request) {
+	ctx, span := constants.Tracer.Start(r.Context(), "decommissionBroker POST")
+	defer span.End()
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if cluster == nil {
+		jsonResponse(w, http.StatusBadRequest, "Decommissioning requires etcd_endpoints or quorum")
+		return
+	}
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		jsonResponse(w, http.StatusBadRequest, "Invalid broker id")
+		return
+	}
+	var req decommissionRequest
+	if r.ContentLength > 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			jsonResponse(w, http.StatusBadRequest, "Invalid JSON")
+			return
+		}
+	}
+	moved, err := cluster.Decommission(ctx, id, req.Throttle)
+	if err != nil {
+		jsonResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	jsonResponse(w, http.StatusAccepted, map[string]int{"moving": moved})
+}
+
+type electLeadersRequest struct {
+	Topic      string `json:"topic"`      // Every topic when empty
+	Partitions []int  `json:"partitions"` // Every partition of the topic when empty
+}
+
+// electLeaders moves leadership back to the preferred replica of partitions
+//
+// POST /elect-leaders
+func electLeaders(w http.ResponseWriter, r *http.Request) {
+	ctx, span := constants.Tracer.Start(r.Context(), "electLeaders POST")
+	defer span.End()
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if cluster == nil {
+		jsonResponse(w, http.StatusBadRequest, "Leader elections require etcd_endpoints or quorum")
+		return
+	}
+	var req electLeadersRequest
+	if r.ContentLength > 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			jsonResponse(w, http.StatusBadRequest, "Invalid JSON")
+			return
+		}
+	}
+	elections, err := cluster.ElectPreferredLeaders(ctx, req.Topic, req.Partitions)
+	if err != nil {
+		jsonResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	jsonResponse(w, http.StatusAccepted, map[string]int{"elections": elections})
+}
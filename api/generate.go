@@ -0,0 +1,10 @@
+// Package api holds the protobuf definition of the FranzMQ gRPC services and
+// the code generated from it: messages, gRPC stubs and the grpc-gateway
+// reverse proxy that serves the same services as HTTP/JSON.
+//
+// Regenerate with protoc-gen-go, protoc-gen-go-grpc and
+// protoc-gen-grpc-gateway installed and GOOGLEAPIS_DIR pointing at a checkout
+// of github.com/googleapis/googleapis for google/api/annotations.proto.
+package api
+
+//go:generate protoc -I .. -I $GOOGLEAPIS_DIR --go_out=.. --go_opt=paths=source_relative --go-grpc_out=.. --go-grpc_opt=paths=source_relative --grpc-gateway_out=.. --grpc-gateway_opt=paths=source_relative api/franzmq.proto
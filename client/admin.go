@@ -0,0 +1,563 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Offsets accepted by ListOffset besides a timestamp
+const (
+	LatestOffset   int64 = latestTimestamp
+	EarliestOffset int64 = earliestTimestamp
+)
+
+type TopicConfig struct {
+	Partitions  int
+	Replicas    int
+	Compression string
+	DataType    string
+}
+
+type PartitionDescription struct {
+	Partition      int
+	EarliestOffset int
+	LatestOffset   int // Offset the next record will get
+}
+
+type TopicDescription struct {
+	Name       string
+	Partitions []PartitionDescription
+}
+
+type GroupMemberDescription struct {
+	MemberID   string
+	ClientID   string
+	Assignment []TopicPartition
+}
+
+type GroupDescription struct {
+	GroupID    string
+	State      string
+	Generation int
+	Protocol   string
+	LeaderID   string
+	Members    []GroupMemberDescription
+	Offsets    map[TopicPartition]int // Committed offsets
+}
+
+// BrokerMetadata is the binary listener of a broker of the cluster
+type BrokerMetadata struct {
+	ID   int
+	Host string
+	Port int
+	Rack string
+}
+
+// Addr returns the host:port address of the broker
+func (b BrokerMetadata) Addr() string {
+	return net.JoinHostPort(b.Host, strconv.Itoa(b.Port))
+}
+
+type PartitionMetadata struct {
+	Partition      int
+	Leader         int // -1 while none of the replicas is up
+	Replicas       []int
+	InSyncReplicas []int // Empty when the broker asked holds no replica
+}
+
+type TopicMetadata struct {
+	Name       string
+	Partitions []PartitionMetadata
+}
+
+type ClusterMetadata struct {
+	Brokers []BrokerMetadata
+	Topics  []TopicMetadata
+}
+
+// Broker returns the broker with the id, false if the metadata lacks it
+func (m ClusterMetadata) Broker(id int) (BrokerMetadata, bool) {
+	for _, b := range m.Brokers {
+		if b.ID == id {
+			return b, true
+		}
+	}
+	return BrokerMetadata{}, false
+}
+
+// Reassignment is the progress of a partition moving to other brokers
+type Reassignment struct {
+	Topic          string
+	Partition      int
+	State          string // pending, copying while the new replicas catch up, then electing
+	Throttle       int    // Bytes per second the new replicas copy at, 0 for no limit
+	Replicas       []int  // Where the partition is now
+	Target         []int
+	Adding         []int
+	Removing       []int
+	InSyncReplicas []int
+}
+
+// Client runs one request at a time against a broker, for administration and
+// for reading partitions directly without a group
+type Client struct {
+	conn *conn
+}
+
+// NewClient returns a client for the broker at addr, the connection is
+// opened on the first request
+func NewClient(addr string) *Client {
+	return &Client{conn: newConn(addr)}
+}
+
+func (c *Client) Close() error {
+	return c.conn.close()
+}
+
+func (c *Client) CreateTopic(ctx context.Context, name string, config TopicConfig) error {
+	e := encoder{}
+	e.putString(name)
+	e.putInt32(int32(config.Partitions))
+	e.putInt32(int32(config.Replicas))
+	e.putString(config.Compression)
+	e.putString(config.DataType)
+	_, err := c.conn.roundTrip(ctx, apiCreateTopic, e.buf)
+	return err
+}
+
+// DeleteTopic removes a topic with all its messages and committed offsets
+func (c *Client) DeleteTopic(ctx context.Context, name string) error {
+	e := encoder{}
+	e.putString(name)
+	_, err := c.conn.roundTrip(ctx, apiDeleteTopic, e.buf)
+	return err
+}
+
+// CreatePartitions grows a topic to count partitions
+func (c *Client) CreatePartitions(ctx context.Context, name string, count int) error {
+	e := encoder{}
+	e.putString(name)
+	e.putInt32(int32(count))
+	_, err := c.conn.roundTrip(ctx, apiCreatePartitions, e.buf)
+	return err
+}
+
+// ConfigEntry is one setting of a topic
+type ConfigEntry struct {
+	Name     string
+	Value    string
+	Default  bool // Not set on the topic, Value is the broker default
+	ReadOnly bool
+	Doc      string
+}
+
+// DescribeConfigs returns every setting of a topic
+func (c *Client) DescribeConfigs(ctx context.Context, name string) ([]ConfigEntry, error) {
+	e := encoder{}
+	e.putString(name)
+	d, err := c.conn.roundTrip(ctx, apiDescribeConfigs, e.buf)
+	if err != nil {
+		return nil, err
+	}
+
+	count := int(d.int32())
+	entries := make([]ConfigEntry, 0, count)
+	for i := 0; i < count && d.err == nil; i++ {
+		entry := ConfigEntry{Name: d.string(), Value: d.string()}
+		flags := d.int16()
+		entry.Default, entry.ReadOnly = flags&1 != 0, flags&2 != 0
+		entry.Doc = d.string()
+		entries = append(entries, entry)
+	}
+	return entries, d.err
+}
+
+// AlterConfigs changes settings of a topic, an empty value resets a setting
+// to its default. The broker rejects the whole change if any value is invalid.
+func (c *Client) AlterConfigs(ctx context.Context, name string, changes map[string]string) error {
+	e := encoder{}
+	e.putString(name)
+	e.putInt32(int32(len(changes)))
+	for key, value := range changes {
+		e.putString(key)
+		e.putString(value)
+	}
+	_, err := c.conn.roundTrip(ctx, apiAlterConfigs, e.buf)
+	return err
+}
+
+// ListTopics returns the partition count of every topic
+func (c *Client) ListTopics(ctx context.Context) (map[string]int, error) {
+	e := encoder{}
+	e.putInt32(0) // all topics
+	d, err := c.conn.roundTrip(ctx, apiMetadata, e.buf)
+	if err != nil {
+		return nil, err
+	}
+
+	topics := make(map[string]int)
+	count := int(d.int32())
+	for i := 0; i < count && d.err == nil; i++ {
+		topics[d.string()] = int(d.int32())
+	}
+	return topics, d.err
+}
+
+// Metadata returns the brokers of the cluster and the leader, replicas and
+// in-sync replicas of every partition of the topics, of all topics when none
+// are named. Send produces and fetches to the leader of a partition, and ask
+// again once a broker answers IsNotLeader.
+func (c *Client) Metadata(ctx context.Context, topics ...string) (ClusterMetadata, error) {
+	e := encoder{}
+	e.putInt32(int32(len(topics)))
+	for _, name := range topics {
+		e.putString(name)
+	}
+	d, err := c.conn.roundTrip(ctx, apiClusterMetadata, e.buf)
+	if err != nil {
+		return ClusterMetadata{}, err
+	}
+
+	ids := func() []int {
+		count := int(d.int32())
+		ids := make([]int, 0, max(count, 0))
+		for i := 0; i < count && d.err == nil; i++ {
+			ids = append(ids, int(d.int32()))
+		}
+		return ids
+	}
+	m := ClusterMetadata{}
+	count := int(d.int32())
+	for i := 0; i < count && d.err == nil; i++ {
+		m.Brokers = append(m.Brokers, BrokerMetadata{ID: int(d.int32()), Host: d.string(), Port: int(d.int32()), Rack: d.string()})
+	}
+	count = int(d.int32())
+	for i := 0; i < count && d.err == nil; i++ {
+		t := TopicMetadata{Name: d.string()}
+		partitions := int(d.int32())
+		for p := 0; p < partitions && d.err == nil; p++ {
+			t.Partitions = append(t.Partitions, PartitionMetadata{Partition: int(d.int32()), Leader: int(d.int32()), Replicas: ids(), InSyncReplicas: ids()})
+		}
+		m.Topics = append(m.Topics, t)
+	}
+	return m, d.err
+}
+
+// DescribeTopic returns the offset range of every partition of a topic
+func (c *Client) DescribeTopic(ctx context.Context, name string) (TopicDescription, error) {
+	partitions, err := c.conn.partitions(ctx, name)
+	if err != nil {
+		return TopicDescription{}, err
+	}
+
+	desc := TopicDescription{Name: name}
+	for p := 0; p < partitions; p++ {
+		earliest, err := c.ListOffset(ctx, name, p, EarliestOffset)
+		if err != nil {
+			return TopicDescription{}, err
+		}
+		latest, err := c.ListOffset(ctx, name, p, LatestOffset)
+		if err != nil {
+			return TopicDescription{}, err
+		}
+		desc.Partitions = append(desc.Partitions, PartitionDescription{Partition: p, EarliestOffset: earliest, LatestOffset: latest})
+	}
+	return desc, nil
+}
+
+// ListOffset resolves EarliestOffset, LatestOffset or a unix nanosecond
+// timestamp to an offset of a partition
+func (c *Client) ListOffset(ctx context.Context, topicName string, partition int, timestamp int64) (int, error) {
+	e := encoder{}
+	e.putString(topicName)
+	e.putInt32(int32(partition))
+	e.putInt64(timestamp)
+	d, err := c.conn.roundTrip(ctx, apiListOffsets, e.buf)
+	if err != nil {
+		return 0, err
+	}
+	offset := int(d.int64())
+	return offset, d.err
+}
+
+// Fetch reads a partition from offset, waiting up to maxWait for records
+// when there are none yet. It returns the offset to fetch next.
+func (c *Client) Fetch(ctx context.Context, topicName string, partition, offset int, maxWait time.Duration) ([]Record, int, error) {
+	e := encoder{}
+	e.putString(topicName)
+	e.putInt32(int32(partition))
+	e.putInt64(int64(offset))
+	e.putInt32(defaultFetchMaxBytes)
+	e.putInt32(1)
+	e.putInt32(int32(maxWait / time.Millisecond))
+	d, err := c.conn.roundTrip(ctx, apiFetch, e.buf)
+	if err != nil {
+		return nil, 0, err
+	}
+	return decodeRecords(d, TopicPartition{Topic: topicName, Partition: partition})
+}
+
+// Produce writes one record to a partition right away, without the batching
+// of Producer
+func (c *Client) Produce(ctx context.Context, topicName string, partition int, value []byte) (RecordMetadata, error) {
+	results, err := c.ProduceBatch(ctx, topicName, partition, [][]byte{value})
+	if err != nil {
+		return RecordMetadata{}, err
+	}
+	return results[0], nil
+}
+
+// ProduceBatch writes records to a partition right away in one request, in
+// the order given
+func (c *Client) ProduceBatch(ctx context.Context, topicName string, partition int, values [][]byte) ([]RecordMetadata, error) {
+	records := encoder{}
+	records.putInt32(int32(len(values)))
+	for _, value := range values {
+		records.putString("")
+		records.putBytes(value)
+	}
+
+	e := encoder{}
+	e.putString(topicName)
+	e.putInt32(int32(partition))
+	e.putInt16(int16(CompressionNone))
+	e.putBytes(records.buf)
+	d, err := c.conn.roundTrip(ctx, apiProduceBatch, e.buf)
+	if err != nil {
+		return nil, err
+	}
+	count := int(d.int32())
+	if count != len(values) && d.err == nil {
+		return nil, fmt.Errorf("broker acknowledged %d records instead of %d", count, len(values))
+	}
+	results := make([]RecordMetadata, 0, count)
+	for i := 0; i < count && d.err == nil; i++ {
+		results = append(results, RecordMetadata{Topic: topicName, Partition: int(d.int32()), Offset: int(d.int64()), Timestamp: d.int64()})
+	}
+	return results, d.err
+}
+
+// ReplicaFetchResult is what the leader of a partition returns a follower
+type ReplicaFetchResult struct {
+	Records        []Record
+	HighWatermark  int
+	InSyncReplicas []int
+	LeaderEpochs   []LeaderEpoch
+}
+
+// LeaderEpoch is the first offset a partition got under a leader epoch
+type LeaderEpoch struct {
+	Epoch       int
+	StartOffset int
+}
+
+// ReplicaFetch reads a partition from its leader on behalf of the follower
+// replicaID, past the high watermark. The leader refuses it unless its leader
+// epoch is leaderEpoch.
+func (c *Client) ReplicaFetch(ctx context.Context, topicName string, partition, replicaID, leaderEpoch, offset int, maxWait time.Duration) (ReplicaFetchResult, error) {
+	e := encoder{}
+	e.putString(topicName)
+	e.putInt32(int32(partition))
+	e.putInt32(int32(replicaID))
+	e.putInt64(int64(offset))
+	e.putInt32(defaultFetchMaxBytes)
+	e.putInt32(int32(maxWait / time.Millisecond))
+	e.putInt32(int32(leaderEpoch))
+	d, err := c.conn.roundTrip(ctx, apiReplicaFetch, e.buf)
+	if err != nil {
+		return ReplicaFetchResult{}, err
+	}
+	result := ReplicaFetchResult{HighWatermark: int(d.int64())}
+	if result.Records, _, err = decodeRecords(d, TopicPartition{Topic: topicName, Partition: partition}); err != nil {
+		return ReplicaFetchResult{}, err
+	}
+	count := int(d.int32())
+	for i := 0; i < count && d.err == nil; i++ {
+		result.InSyncReplicas = append(result.InSyncReplicas, int(d.int32()))
+	}
+	count = int(d.int32())
+	for i := 0; i < count && d.err == nil; i++ {
+		result.LeaderEpochs = append(result.LeaderEpochs, LeaderEpoch{Epoch: int(d.int32()), StartOffset: int(d.int64())})
+	}
+	return result, d.err
+}
+
+// OffsetForLeaderEpoch asks the leader of a partition for the largest leader
+// epoch not above leaderEpoch and the offset it ends at, where a replica
+// that wrote up to leaderEpoch parts from the leader. Both are -1 when the
+// leader knows no such epoch.
+func (c *Client) OffsetForLeaderEpoch(ctx context.Context, topicName string, partition, leaderEpoch int) (int, int, error) {
+	e := encoder{}
+	e.putString(topicName)
+	e.putInt32(int32(partition))
+	e.putInt32(int32(leaderEpoch))
+	d, err := c.conn.roundTrip(ctx, apiOffsetForEpoch, e.buf)
+	if err != nil {
+		return 0, 0, err
+	}
+	epoch, endOffset := int(d.int32()), int(d.int64())
+	return epoch, endOffset, d.err
+}
+
+// ReassignPartitions moves partitions of a topic to the replicas given by
+// partition, the first becomes the preferred leader. The new replicas copy at
+// up to throttle bytes per second, 0 for no limit. It returns once the
+// controller got the request, follow the moves with ListReassignments.
+func (c *Client) ReassignPartitions(ctx context.Context, topicName string, partitions map[int][]int, throttle int) error {
+	e := encoder{}
+	e.putString(topicName)
+	e.putInt64(int64(throttle))
+	e.putInt32(int32(len(partitions)))
+	for p, replicas := range partitions {
+		e.putInt32(int32(p))
+		e.putInt32(int32(len(replicas)))
+		for _, id := range replicas {
+			e.putInt32(int32(id))
+		}
+	}
+	_, err := c.conn.roundTrip(ctx, apiReassignPartitions, e.buf)
+	return err
+}
+
+// ListReassignments returns the partitions still moving
+func (c *Client) ListReassignments(ctx context.Context) ([]Reassignment, error) {
+	d, err := c.conn.roundTrip(ctx, apiListReassignments, nil)
+	if err != nil {
+		return nil, err
+	}
+	ids := func() []int {
+		count := int(d.int32())
+		ids := make([]int, 0, max(count, 0))
+		for i := 0; i < count && d.err == nil; i++ {
+			ids = append(ids, int(d.int32()))
+		}
+		return ids
+	}
+	reassignments := []Reassignment{}
+	count := int(d.int32())
+	for i := 0; i < count && d.err == nil; i++ {
+		r := Reassignment{Topic: d.string(), Partition: int(d.int32()), State: d.string(), Throttle: int(d.int64())}
+		r.Replicas, r.Target, r.Adding, r.Removing, r.InSyncReplicas = ids(), ids(), ids(), ids(), ids()
+		reassignments = append(reassignments, r)
+	}
+	return reassignments, d.err
+}
+
+// DecommissionBroker moves every partition off a broker so it can be retired,
+// at up to throttle bytes per second. Returns the number of partitions moving.
+func (c *Client) DecommissionBroker(ctx context.Context, brokerID, throttle int) (int, error) {
+	e := encoder{}
+	e.putInt32(int32(brokerID))
+	e.putInt64(int64(throttle))
+	d, err := c.conn.roundTrip(ctx, apiDecommissionBroker, e.buf)
+	if err != nil {
+		return 0, err
+	}
+	moved := int(d.int32())
+	return moved, d.err
+}
+
+// ElectPreferredLeaders moves leadership of the partitions of a topic back
+// to their preferred replica, the first of the assignment, where it is in
+// sync. All partitions when none are given, every topic when topicName is
+// empty. Returns the number of partitions not led by their preferred replica.
+func (c *Client) ElectPreferredLeaders(ctx context.Context, topicName string, partitions ...int) (int, error) {
+	e := encoder{}
+	e.putString(topicName)
+	e.putInt32(int32(len(partitions)))
+	for _, p := range partitions {
+		e.putInt32(int32(p))
+	}
+	d, err := c.conn.roundTrip(ctx, apiElectLeaders, e.buf)
+	if err != nil {
+		return 0, err
+	}
+	elections := int(d.int32())
+	return elections, d.err
+}
+
+// RaftMessage passes a message of the metadata quorum's Raft log to the broker
+func (c *Client) RaftMessage(ctx context.Context, message []byte) error {
+	e := encoder{}
+	e.putBytes(message)
+	_, err := c.conn.roundTrip(ctx, apiRaftMessage, e.buf)
+	return err
+}
+
+func (c *Client) ListGroups(ctx context.Context) ([]string, error) {
+	d, err := c.conn.roundTrip(ctx, apiListGroups, nil)
+	if err != nil {
+		return nil, err
+	}
+	count := int(d.int32())
+	names := make([]string, 0, count)
+	for i := 0; i < count && d.err == nil; i++ {
+		names = append(names, d.string())
+	}
+	return names, d.err
+}
+
+func (c *Client) DescribeGroup(ctx context.Context, groupID string) (GroupDescription, error) {
+	e := encoder{}
+	e.putString(groupID)
+	d, err := c.conn.roundTrip(ctx, apiDescribeGroup, e.buf)
+	if err != nil {
+		return GroupDescription{}, err
+	}
+
+	desc := GroupDescription{GroupID: groupID, Offsets: make(map[TopicPartition]int)}
+	desc.State = d.string()
+	desc.Generation = int(d.int32())
+	d.string() // protocol type
+	desc.Protocol = d.string()
+	desc.LeaderID = d.string()
+	count := int(d.int32())
+	for i := 0; i < count && d.err == nil; i++ {
+		m := GroupMemberDescription{MemberID: d.string(), ClientID: d.string()}
+		if assignment := d.bytes(); len(assignment) > 0 {
+			// Assignments of other client libraries are not decoded
+			json.Unmarshal(assignment, &m.Assignment)
+		}
+		desc.Members = append(desc.Members, m)
+	}
+	count = int(d.int32())
+	for i := 0; i < count && d.err == nil; i++ {
+		tp := TopicPartition{Topic: d.string(), Partition: int(d.int32())}
+		desc.Offsets[tp] = int(d.int64())
+	}
+	return desc, d.err
+}
+
+// CommitOffset sets the committed offset of a group, use it to reset a group
+// that has no active members
+func (c *Client) CommitOffset(ctx context.Context, groupID string, tp TopicPartition, offset int) error {
+	e := encoder{}
+	e.putString(groupID)
+	e.putInt32(-1) // generation, committed without membership
+	e.putString("")
+	e.putString(tp.Topic)
+	e.putInt32(int32(tp.Partition))
+	e.putInt64(int64(offset))
+	_, err := c.conn.roundTrip(ctx, apiOffsetCommit, e.buf)
+	return err
+}
+
+// SortedPartitions returns the keys of an offsets map ordered by topic and partition
+func SortedPartitions(offsets map[TopicPartition]int) []TopicPartition {
+	tps := make([]TopicPartition, 0, len(offsets))
+	for tp := range offsets {
+		tps = append(tps, tp)
+	}
+	sort.Slice(tps, func(i, j int) bool {
+		if tps[i].Topic != tps[j].Topic {
+			return tps[i].Topic < tps[j].Topic
+		}
+		return tps[i].Partition < tps[j].Partition
+	})
+	return tps
+}
@@ -0,0 +1,205 @@
+package client
+
+import (
+	"FranzMQ/client/clienttest"
+	"FranzMQ/constants"
+	"FranzMQ/storage"
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestProducer_BatchesAndCompresses(t *testing.T) {
+	broker := clienttest.NewBroker(t)
+	topicName := "client_producer_test"
+	broker.CreateTopic(topicName, 2)
+
+	producer, err := NewProducer(ProducerConfig{Addr: broker.Addr(), BatchSize: 4, Compression: CompressionZstd})
+	if err != nil {
+		t.Fatalf("new producer failed: %v", err)
+	}
+
+	var (
+		mu      sync.Mutex
+		results = map[string]RecordMetadata{}
+	)
+	for i := 0; i < 10; i++ {
+		key := "key-" + strconv.Itoa(i)
+		err := producer.ProduceAsync(topicName, key, []byte(`{"n":`+strconv.Itoa(i)+`}`), func(meta RecordMetadata, err error) {
+			if err != nil {
+				t.Errorf("produce failed: %v", err)
+				return
+			}
+			mu.Lock()
+			results[key] = meta
+			mu.Unlock()
+		})
+		if err != nil {
+			t.Fatalf("produce async failed: %v", err)
+		}
+	}
+	if err := producer.Close(); err != nil {
+		t.Fatalf("close failed: %v", err)
+	}
+
+	if len(results) != 10 {
+		t.Fatalf("Expected 10 acknowledged records but got %d", len(results))
+	}
+	for key, meta := range results {
+		if expected := HashPartitioner(key, 2); meta.Partition != expected {
+			t.Errorf("Expected %s on partition %d but got %d", key, expected, meta.Partition)
+		}
+	}
+
+	if _, err := producer.Produce(context.Background(), topicName, "key", []byte("{}")); err != ErrProducerClosed {
+		t.Errorf("Expected ErrProducerClosed but got %v", err)
+	}
+}
+
+func TestConsumer_GroupRebalanceAndCommit(t *testing.T) {
+	broker := clienttest.NewBroker(t)
+	topicName := "client_consumer_test"
+	broker.CreateTopic(topicName, 2)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	producer, err := NewProducer(ProducerConfig{Addr: broker.Addr(), Partitioner: RoundRobinPartitioner()})
+	if err != nil {
+		t.Fatalf("new producer failed: %v", err)
+	}
+	defer producer.Close()
+	for i := 0; i < 6; i++ {
+		if _, err := producer.Produce(ctx, topicName, "", []byte(strconv.Itoa(i))); err != nil {
+			t.Fatalf("produce failed: %v", err)
+		}
+	}
+
+	config := ConsumerConfig{
+		Addr:              broker.Addr(),
+		GroupID:           "client-test-group",
+		Topics:            []string{topicName},
+		HeartbeatInterval: 50 * time.Millisecond,
+		MaxWait:           50 * time.Millisecond,
+	}
+	revoked := 0
+	first := config
+	first.OnRevoked = func([]TopicPartition) { revoked++ }
+	consumerA, err := NewConsumer(first)
+	if err != nil {
+		t.Fatalf("new consumer failed: %v", err)
+	}
+	defer consumerA.Close()
+
+	seen := 0
+	for seen < 6 {
+		records, err := consumerA.Poll(ctx)
+		if err != nil {
+			t.Fatalf("poll failed: %v", err)
+		}
+		seen += len(records)
+	}
+	if len(consumerA.Assignment()) != 2 {
+		t.Fatalf("Expected a lone consumer to own both partitions, got %v", consumerA.Assignment())
+	}
+
+	// A second member splits the partitions, consumerA keeps polling so it notices the rebalance
+	consumerB, err := NewConsumer(config)
+	if err != nil {
+		t.Fatalf("new consumer failed: %v", err)
+	}
+	defer consumerB.Close()
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := consumerB.Poll(ctx)
+		done <- err
+	}()
+	for len(consumerA.Assignment()) != 1 {
+		if _, err := consumerA.Poll(ctx); err != nil {
+			t.Fatalf("poll failed: %v", err)
+		}
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("second consumer poll failed: %v", err)
+	}
+	if revoked == 0 {
+		t.Errorf("Expected OnRevoked to run on rebalance")
+	}
+	if a, b := consumerA.Assignment(), consumerB.Assignment(); len(b) != 1 || a[0] == b[0] {
+		t.Errorf("Expected the partitions to be split, got %v and %v", a, b)
+	}
+
+	// Everything consumerA read was committed before it gave up a partition
+	if err := consumerA.Commit(ctx); err != nil {
+		t.Fatalf("commit failed: %v", err)
+	}
+	records, err := consumerB.Poll(ctx)
+	if err != nil {
+		t.Fatalf("poll failed: %v", err)
+	}
+	if len(records) != 0 {
+		t.Errorf("Expected committed records not to be redelivered, got %d", len(records))
+	}
+}
+
+func TestClient_TopicsOffsetsAndGroups(t *testing.T) {
+	broker := clienttest.NewBroker(t)
+	topicName := "client_admin_test"
+	storage.RemoveAll(constants.FilesDir + topicName)
+	defer storage.RemoveAll(constants.FilesDir + topicName)
+	defer storage.RemoveAll(constants.GroupsDir)
+	ctx := context.Background()
+
+	c := NewClient(broker.Addr())
+	defer c.Close()
+	if err := c.CreateTopic(ctx, topicName, TopicConfig{Partitions: 2}); err != nil {
+		t.Fatalf("create topic failed: %v", err)
+	}
+	if err := c.CreateTopic(ctx, topicName, TopicConfig{Partitions: 2}); err == nil {
+		t.Errorf("Expected creating an existing topic to fail")
+	}
+
+	producer, err := NewProducer(ProducerConfig{Addr: broker.Addr(), Partitioner: func(string, int) int { return 1 }})
+	if err != nil {
+		t.Fatalf("new producer failed: %v", err)
+	}
+	producer.Produce(ctx, topicName, "", []byte(`"before"`))
+	middle := time.Now().UnixNano()
+	producer.Produce(ctx, topicName, "", []byte(`"after"`))
+	producer.Close()
+
+	desc, err := c.DescribeTopic(ctx, topicName)
+	if err != nil {
+		t.Fatalf("describe failed: %v", err)
+	}
+	if len(desc.Partitions) != 2 || desc.Partitions[1].EarliestOffset != 1 || desc.Partitions[1].LatestOffset != 3 {
+		t.Errorf("Unexpected topic description %+v", desc)
+	}
+	// The index is flushed after the produce is acknowledged
+	var offset int
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if offset, err = c.ListOffset(ctx, topicName, 1, middle); err != nil || offset == 2 {
+			break
+		}
+	}
+	if err != nil || offset != 2 {
+		t.Errorf("Expected offset 2 for the middle timestamp but got %d, %v", offset, err)
+	}
+
+	if err := c.CommitOffset(ctx, "client-admin-group", TopicPartition{Topic: topicName, Partition: 1}, 2); err != nil {
+		t.Fatalf("commit failed: %v", err)
+	}
+	group, err := c.DescribeGroup(ctx, "client-admin-group")
+	if err != nil {
+		t.Fatalf("describe group failed: %v", err)
+	}
+	if group.State != "Empty" || group.Offsets[TopicPartition{Topic: topicName, Partition: 1}] != 2 {
+		t.Errorf("Unexpected group description %+v", group)
+	}
+	if _, err := c.DescribeGroup(ctx, "client-missing-group"); err == nil {
+		t.Errorf("Expected an error describing an unknown group")
+	}
+}
@@ -0,0 +1,63 @@
+// Package clienttest runs an in-process FranzMQ broker for unit tests of code
+// using the client package.
+package clienttest
+
+import (
+	"FranzMQ/constants"
+	"FranzMQ/producer"
+	"FranzMQ/protocol"
+	"FranzMQ/storage"
+	"FranzMQ/topic"
+	"net"
+	"sync"
+	"testing"
+)
+
+var writerOnce sync.Once
+
+// Broker serves the binary protocol on a random local port. Topics are kept
+// in memory, nothing is written to the test's directory.
+type Broker struct {
+	t      testing.TB
+	server *protocol.Server
+	addr   string
+}
+
+// NewBroker starts a broker that is stopped when the test ends
+func NewBroker(t testing.TB) *Broker {
+	t.Helper()
+	writerOnce.Do(func() {
+		storage.SetBackend(storage.NewMemoryBackend())
+		go producer.GlobalWriterThread(producer.GlobalLogWriterQueue)
+		go producer.GlobalWriterThread(producer.GlobalIndexWriterQueue)
+	})
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen failed: %v", err)
+	}
+	server := protocol.NewServer()
+	go server.Serve(listener)
+	t.Cleanup(func() { server.Close() })
+
+	return &Broker{t: t, server: server, addr: listener.Addr().String()}
+}
+
+// Addr is the address to pass to client.ProducerConfig and client.ConsumerConfig
+func (b *Broker) Addr() string {
+	return b.addr
+}
+
+// CreateTopic creates a topic, replacing leftovers of an earlier run, and
+// deletes it and its group offsets when the test ends
+func (b *Broker) CreateTopic(name string, partitions int) {
+	b.t.Helper()
+	storage.RemoveAll(constants.FilesDir + name)
+	if _, err := topic.CreateAtTopic(name, topic.Config{NumOfPartition: partitions}); err != nil {
+		b.t.Fatalf("create topic failed: %v", err)
+	}
+	b.t.Cleanup(func() {
+		storage.RemoveAll(constants.FilesDir + name)
+		storage.RemoveAll(constants.GroupsDir)
+	})
+}
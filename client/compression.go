@@ -0,0 +1,48 @@
+package client
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression of produced batches on the wire, records are stored uncompressed
+type Compression int16
+
+const (
+	CompressionNone   Compression = 0
+	CompressionGzip   Compression = 1
+	CompressionSnappy Compression = 2
+	CompressionZstd   Compression = 3
+)
+
+func compress(codec Compression, data []byte) ([]byte, error) {
+	switch codec {
+	case CompressionNone:
+		return data, nil
+	case CompressionGzip:
+		var buf bytes.Buffer
+		writer := gzip.NewWriter(&buf)
+		if _, err := writer.Write(data); err != nil {
+			return nil, err
+		}
+		if err := writer.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	case CompressionSnappy:
+		return snappy.Encode(nil, data), nil
+	case CompressionZstd:
+		writer, err := zstd.NewWriter(nil)
+		if err != nil {
+			return nil, err
+		}
+		defer writer.Close()
+		return writer.EncodeAll(data, nil), nil
+	default:
+		return nil, fmt.Errorf("unsupported compression codec %d", codec)
+	}
+}
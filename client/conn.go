@@ -0,0 +1,279 @@
+// Package client is the Go client for FranzMQ. It talks to the broker's binary
+// protocol (port 9090 by default) and provides a batching Producer and a
+// group-aware Consumer.
+//
+//	producer, err := client.NewProducer(client.ProducerConfig{Addr: "localhost:9090"})
+//	...
+//	meta, err := producer.Produce(ctx, "orders", "customer-1", []byte(`{"total":10}`))
+//
+// Use the clienttest package to run an in-process broker in unit tests.
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// API keys and error codes of the binary protocol, see the protocol package
+const (
+	apiFetch              int16 = 1
+	apiMetadata           int16 = 2
+	apiListOffsets        int16 = 3
+	apiOffsetCommit       int16 = 4
+	apiOffsetFetch        int16 = 5
+	apiProduceBatch       int16 = 6
+	apiJoinGroup          int16 = 7
+	apiSyncGroup          int16 = 8
+	apiHeartbeat          int16 = 9
+	apiLeaveGroup         int16 = 10
+	apiCreateTopic        int16 = 11
+	apiListGroups         int16 = 12
+	apiDescribeGroup      int16 = 13
+	apiDeleteTopic        int16 = 14
+	apiCreatePartitions   int16 = 15
+	apiDescribeConfigs    int16 = 16
+	apiAlterConfigs       int16 = 17
+	apiReplicaFetch       int16 = 18
+	apiRaftMessage        int16 = 19
+	apiClusterMetadata    int16 = 20
+	apiReassignPartitions int16 = 21
+	apiListReassignments  int16 = 22
+	apiDecommissionBroker int16 = 23
+	apiElectLeaders       int16 = 24
+	apiOffsetForEpoch     int16 = 25
+
+	errUnknownTopicOrPartition int16 = 3
+	errRebalanceInProgress     int16 = 5
+	errUnknownMemberID         int16 = 6
+	errIllegalGeneration       int16 = 7
+	errNotLeader               int16 = 8
+	errNotEnoughReplicas       int16 = 9
+	errFencedLeaderEpoch       int16 = 10
+
+	latestTimestamp   int64 = -1
+	earliestTimestamp int64 = -2
+)
+
+const dialTimeout = 10 * time.Second
+
+// BrokerError is an error code returned by the broker
+type BrokerError struct {
+	Code    int16
+	Message string
+}
+
+func (e *BrokerError) Error() string {
+	return fmt.Sprintf("broker error %d: %s", e.Code, e.Message)
+}
+
+// IsNotLeader reports whether the broker refused a request because another
+// broker leads the partition
+func IsNotLeader(err error) bool {
+	return errorCode(err) == errNotLeader
+}
+
+// IsNotEnoughReplicas reports whether the broker refused a produce because
+// fewer replicas than min.insync.replicas are in sync
+func IsNotEnoughReplicas(err error) bool {
+	return errorCode(err) == errNotEnoughReplicas
+}
+
+// IsFencedLeaderEpoch reports whether the broker refused a replica fetch
+// because the follower knows another leader epoch than the leader
+func IsFencedLeaderEpoch(err error) bool {
+	return errorCode(err) == errFencedLeaderEpoch
+}
+
+func errorCode(err error) int16 {
+	if brokerErr, ok := err.(*BrokerError); ok {
+		return brokerErr.Code
+	}
+	return -1
+}
+
+// conn is one broker connection running a request at a time. It redials
+// lazily after a network error.
+type conn struct {
+	mu            sync.Mutex
+	addr          string
+	netConn       net.Conn
+	reader        *bufio.Reader
+	correlationID int32
+}
+
+func newConn(addr string) *conn {
+	return &conn{addr: addr}
+}
+
+// Send a request and wait for its response body, the context deadline
+// applies to the whole exchange
+func (c *conn) roundTrip(ctx context.Context, apiKey int16, body []byte) (*decoder, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if c.netConn == nil {
+		dialer := net.Dialer{Timeout: dialTimeout}
+		netConn, err := dialer.DialContext(ctx, "tcp", c.addr)
+		if err != nil {
+			return nil, err
+		}
+		c.netConn, c.reader = netConn, bufio.NewReader(netConn)
+	}
+	deadline, _ := ctx.Deadline() // Zero clears an earlier deadline
+	c.netConn.SetDeadline(deadline)
+
+	c.correlationID++
+	e := encoder{buf: make([]byte, 0, 12+len(body))}
+	e.putInt32(int32(8 + len(body)))
+	e.putInt16(apiKey)
+	e.putInt16(0) // api version
+	e.putInt32(c.correlationID)
+	e.buf = append(e.buf, body...)
+
+	frame, err := c.exchange(e.buf)
+	if err != nil {
+		c.netConn.Close()
+		c.netConn = nil
+		return nil, err
+	}
+
+	d := &decoder{buf: frame}
+	if correlationID := d.int32(); correlationID != c.correlationID {
+		c.netConn.Close()
+		c.netConn = nil
+		return nil, fmt.Errorf("unexpected correlation id %d, want %d", correlationID, c.correlationID)
+	}
+	if code := d.int16(); code != 0 {
+		return nil, &BrokerError{Code: code, Message: d.string()}
+	}
+	return d, nil
+}
+
+func (c *conn) exchange(request []byte) ([]byte, error) {
+	if _, err := c.netConn.Write(request); err != nil {
+		return nil, err
+	}
+	var sizeBuf [4]byte
+	if _, err := io.ReadFull(c.reader, sizeBuf[:]); err != nil {
+		return nil, err
+	}
+	frame := make([]byte, binary.BigEndian.Uint32(sizeBuf[:]))
+	if _, err := io.ReadFull(c.reader, frame); err != nil {
+		return nil, err
+	}
+	return frame, nil
+}
+
+func (c *conn) close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.netConn == nil {
+		return nil
+	}
+	err := c.netConn.Close()
+	c.netConn = nil
+	return err
+}
+
+// Metadata returns the partition count of a topic
+func (c *conn) partitions(ctx context.Context, topicName string) (int, error) {
+	e := encoder{}
+	e.putInt32(1)
+	e.putString(topicName)
+	d, err := c.roundTrip(ctx, apiMetadata, e.buf)
+	if err != nil {
+		return 0, err
+	}
+	d.int32() // topic count
+	d.string()
+	partitions := int(d.int32())
+	return partitions, d.err
+}
+
+// Big-endian writer, strings are int16 length prefixed and byte arrays int32 length prefixed
+type encoder struct {
+	buf []byte
+}
+
+func (e *encoder) putInt16(v int16) {
+	e.buf = binary.BigEndian.AppendUint16(e.buf, uint16(v))
+}
+
+func (e *encoder) putInt32(v int32) {
+	e.buf = binary.BigEndian.AppendUint32(e.buf, uint32(v))
+}
+
+func (e *encoder) putInt64(v int64) {
+	e.buf = binary.BigEndian.AppendUint64(e.buf, uint64(v))
+}
+
+func (e *encoder) putString(v string) {
+	e.putInt16(int16(len(v)))
+	e.buf = append(e.buf, v...)
+}
+
+func (e *encoder) putBytes(v []byte) {
+	e.putInt32(int32(len(v)))
+	e.buf = append(e.buf, v...)
+}
+
+// Big-endian reader, the first short read sticks in err
+type decoder struct {
+	buf []byte
+	off int
+	err error
+}
+
+func (d *decoder) next(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n < 0 || d.off+n > len(d.buf) {
+		d.err = fmt.Errorf("malformed response: need %d bytes at %d, have %d", n, d.off, len(d.buf))
+		return nil
+	}
+	b := d.buf[d.off : d.off+n]
+	d.off += n
+	return b
+}
+
+func (d *decoder) int16() int16 {
+	b := d.next(2)
+	if b == nil {
+		return 0
+	}
+	return int16(binary.BigEndian.Uint16(b))
+}
+
+func (d *decoder) int32() int32 {
+	b := d.next(4)
+	if b == nil {
+		return 0
+	}
+	return int32(binary.BigEndian.Uint32(b))
+}
+
+func (d *decoder) int64() int64 {
+	b := d.next(8)
+	if b == nil {
+		return 0
+	}
+	return int64(binary.BigEndian.Uint64(b))
+}
+
+func (d *decoder) string() string {
+	return string(d.next(int(d.int16())))
+}
+
+func (d *decoder) bytes() []byte {
+	return d.next(int(d.int32()))
+}
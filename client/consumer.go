@@ -0,0 +1,639 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	defaultClientID           = "franzmq-go"
+	defaultSessionTimeout     = 10 * time.Second
+	defaultHeartbeatInterval  = 3 * time.Second
+	defaultAutoCommitInterval = 5 * time.Second
+	defaultMaxWait            = 500 * time.Millisecond
+	defaultFetchMaxBytes      = 1024 * 1024
+	rejoinBackoff             = 100 * time.Millisecond
+
+	consumerProtocolType = "consumer"
+	rangeAssignor        = "range"
+)
+
+var ErrConsumerClosed = errors.New("consumer is closed")
+
+type TopicPartition struct {
+	Topic     string
+	Partition int
+}
+
+// Record is a consumed message. Value is the stored JSON, messages produced
+// as plain text come back as a JSON string.
+type Record struct {
+	Topic     string
+	Partition int
+	Offset    int
+	Timestamp int64 // Unix nanoseconds
+	Value     []byte
+}
+
+type ConsumerConfig struct {
+	Addr               string // Broker binary protocol address
+	GroupID            string
+	ClientID           string // "franzmq-go" by default
+	Topics             []string
+	SessionTimeout     time.Duration // 10s by default
+	HeartbeatInterval  time.Duration // 3s by default
+	DisableAutoCommit  bool
+	AutoCommitInterval time.Duration // 5s by default
+	ResetToLatest      bool          // Start partitions without a committed offset at the end instead of the beginning
+	MaxWait            time.Duration // How long Poll waits for new records, 500ms by default
+	MaxBytes           int           // Per partition fetch size, 1MB by default
+	// Fetch each partition from a replica in this rack when it has one,
+	// instead of through the broker at Addr. See the brokers' cluster.rack.
+	Rack string
+
+	// Rebalance callbacks, run from Poll. OnRevoked runs after the revoked
+	// partitions were auto-committed.
+	OnAssigned func(partitions []TopicPartition)
+	OnRevoked  func(partitions []TopicPartition)
+}
+
+// Consumer reads the partitions the group assigns it. Group requests and
+// commits share one connection, fetches use another so a long poll never
+// delays a heartbeat. With a rack, partitions with a replica in it are
+// fetched from that replica's broker over a connection of its own. Poll must
+// be called from a single goroutine.
+type Consumer struct {
+	config      ConsumerConfig
+	coordinator *conn
+	fetcher     *conn
+	nearby      map[int]*conn          // By broker id, of the replicas in the rack
+	replicaOf   map[TopicPartition]int // Broker in the rack each partition is fetched from
+
+	mu         sync.Mutex
+	memberID   string
+	generation int
+	rejoin     bool
+	assigned   []TopicPartition
+	positions  map[TopicPartition]int // Next offset to fetch
+	committed  map[TopicPartition]int
+	lastCommit time.Time
+	next       int // Partition the next long poll waits on
+
+	closeOnce sync.Once
+	stop      chan struct{}
+	done      chan struct{}
+}
+
+// NewConsumer returns a consumer that joins config.GroupID on its first Poll
+func NewConsumer(config ConsumerConfig) (*Consumer, error) {
+	if config.Addr == "" {
+		return nil, errors.New("broker address is required")
+	}
+	if config.GroupID == "" {
+		return nil, errors.New("group id is required")
+	}
+	if len(config.Topics) == 0 {
+		return nil, errors.New("at least one topic is required")
+	}
+	if config.ClientID == "" {
+		config.ClientID = defaultClientID
+	}
+	if config.SessionTimeout <= 0 {
+		config.SessionTimeout = defaultSessionTimeout
+	}
+	if config.HeartbeatInterval <= 0 {
+		config.HeartbeatInterval = defaultHeartbeatInterval
+	}
+	if config.AutoCommitInterval <= 0 {
+		config.AutoCommitInterval = defaultAutoCommitInterval
+	}
+	if config.MaxWait <= 0 {
+		config.MaxWait = defaultMaxWait
+	}
+	if config.MaxBytes <= 0 {
+		config.MaxBytes = defaultFetchMaxBytes
+	}
+
+	c := &Consumer{
+		config:      config,
+		coordinator: newConn(config.Addr),
+		fetcher:     newConn(config.Addr),
+		nearby:      make(map[int]*conn),
+		replicaOf:   make(map[TopicPartition]int),
+		rejoin:      true,
+		positions:   make(map[TopicPartition]int),
+		committed:   make(map[TopicPartition]int),
+		stop:        make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+	go c.heartbeatLoop()
+	return c, nil
+}
+
+// Poll returns the next records of the assigned partitions, waiting up to
+// MaxWait when there are none. It joins or rejoins the group first when
+// needed and auto-commits what earlier polls returned.
+func (c *Consumer) Poll(ctx context.Context) ([]Record, error) {
+	select {
+	case <-c.stop:
+		return nil, ErrConsumerClosed
+	default:
+	}
+
+	c.mu.Lock()
+	rejoin := c.rejoin
+	c.mu.Unlock()
+	if rejoin {
+		if err := c.rebalance(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	c.mu.Lock()
+	commitDue := time.Since(c.lastCommit) >= c.config.AutoCommitInterval
+	c.mu.Unlock()
+	if !c.config.DisableAutoCommit && commitDue {
+		if err := c.Commit(ctx); err != nil {
+			log.Println("Auto-commit for group", c.config.GroupID, "failed:", err)
+		}
+	}
+
+	c.mu.Lock()
+	assigned := append([]TopicPartition(nil), c.assigned...)
+	c.mu.Unlock()
+	if len(assigned) == 0 {
+		// More consumers than partitions, wait for the next rebalance
+		select {
+		case <-time.After(c.config.MaxWait):
+			return nil, nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	// Take what is already there, and long poll one partition, rotating, when nothing is
+	records := []Record{}
+	for _, tp := range assigned {
+		fetched, err := c.fetch(ctx, tp, 0)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, fetched...)
+	}
+	if len(records) == 0 {
+		c.next = (c.next + 1) % len(assigned)
+		return c.fetch(ctx, assigned[c.next], c.config.MaxWait)
+	}
+	return records, nil
+}
+
+// Commit stores the position of every assigned partition for the group
+func (c *Consumer) Commit(ctx context.Context) error {
+	c.mu.Lock()
+	positions := make(map[TopicPartition]int, len(c.positions))
+	for tp, offset := range c.positions {
+		if c.committed[tp] != offset {
+			positions[tp] = offset
+		}
+	}
+	memberID, generation := c.memberID, c.generation
+	c.mu.Unlock()
+
+	for tp, offset := range positions {
+		e := encoder{}
+		e.putString(c.config.GroupID)
+		e.putInt32(int32(generation))
+		e.putString(memberID)
+		e.putString(tp.Topic)
+		e.putInt32(int32(tp.Partition))
+		e.putInt64(int64(offset))
+		if _, err := c.coordinator.roundTrip(ctx, apiOffsetCommit, e.buf); err != nil {
+			// Fenced out by a rebalance, the partitions may belong to someone else now
+			switch errorCode(err) {
+			case errUnknownMemberID:
+				c.mu.Lock()
+				c.memberID, c.rejoin = "", true
+				c.mu.Unlock()
+			case errIllegalGeneration, errRebalanceInProgress:
+				c.mu.Lock()
+				c.rejoin = true
+				c.mu.Unlock()
+			}
+			return err
+		}
+		c.mu.Lock()
+		c.committed[tp] = offset
+		c.mu.Unlock()
+	}
+	c.mu.Lock()
+	c.lastCommit = time.Now()
+	c.mu.Unlock()
+	return ctx.Err()
+}
+
+// Assignment returns the partitions currently assigned to this consumer
+func (c *Consumer) Assignment() []TopicPartition {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]TopicPartition(nil), c.assigned...)
+}
+
+// Close commits, leaves the group so the rest of it rebalances right away and
+// closes the connections
+func (c *Consumer) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.stop)
+		<-c.done
+		ctx := context.Background()
+		if !c.config.DisableAutoCommit {
+			if err := c.Commit(ctx); err != nil {
+				log.Println("Final commit for group", c.config.GroupID, "failed:", err)
+			}
+		}
+
+		c.mu.Lock()
+		memberID := c.memberID
+		c.mu.Unlock()
+		if memberID != "" {
+			e := encoder{}
+			e.putString(c.config.GroupID)
+			e.putString(memberID)
+			if _, err := c.coordinator.roundTrip(ctx, apiLeaveGroup, e.buf); err != nil {
+				log.Println("Leaving group", c.config.GroupID, "failed:", err)
+			}
+		}
+		c.coordinator.close()
+		c.fetcher.close()
+		for _, nearby := range c.nearby {
+			nearby.close()
+		}
+	})
+	return nil
+}
+
+func (c *Consumer) fetch(ctx context.Context, tp TopicPartition, maxWait time.Duration) ([]Record, error) {
+	c.mu.Lock()
+	offset, assigned := c.positions[tp]
+	c.mu.Unlock()
+	if !assigned {
+		return nil, nil
+	}
+
+	e := encoder{}
+	e.putString(tp.Topic)
+	e.putInt32(int32(tp.Partition))
+	e.putInt64(int64(offset))
+	e.putInt32(int32(c.config.MaxBytes))
+	e.putInt32(1) // min bytes, only matters when waiting
+	e.putInt32(int32(maxWait / time.Millisecond))
+	fetcher := c.fetcher
+	c.mu.Lock()
+	replica, nearby := c.replicaOf[tp]
+	c.mu.Unlock()
+	if nearby {
+		fetcher = c.nearby[replica]
+	}
+	d, err := fetcher.roundTrip(ctx, apiFetch, e.buf)
+	if err != nil && nearby && ctx.Err() == nil {
+		// Back to the broker at Addr until the next rebalance
+		log.Println("Fetching", tp.Topic, tp.Partition, "from broker", replica, "in rack", c.config.Rack, "failed:", err)
+		c.mu.Lock()
+		delete(c.replicaOf, tp)
+		c.mu.Unlock()
+		d, err = c.fetcher.roundTrip(ctx, apiFetch, e.buf)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	records, nextOffset, err := decodeRecords(d, tp)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	// A rebalance may have moved the partition away while the fetch was running
+	if _, stillAssigned := c.positions[tp]; stillAssigned {
+		c.positions[tp] = nextOffset
+	}
+	c.mu.Unlock()
+	return records, nil
+}
+
+// Fetch response: next_offset int64 | count int32 | count * (offset int64 | timestamp int64 | value bytes)
+func decodeRecords(d *decoder, tp TopicPartition) ([]Record, int, error) {
+	nextOffset := int(d.int64())
+	count := int(d.int32())
+	records := make([]Record, 0, count)
+	for i := 0; i < count && d.err == nil; i++ {
+		records = append(records, Record{
+			Topic:     tp.Topic,
+			Partition: tp.Partition,
+			Offset:    int(d.int64()),
+			Timestamp: d.int64(),
+			Value:     d.bytes(),
+		})
+	}
+	if d.err != nil {
+		return nil, 0, d.err
+	}
+	return records, nextOffset, nil
+}
+
+// Revoke the current assignment, rejoin the group and start consuming what it assigns
+func (c *Consumer) rebalance(ctx context.Context) error {
+	c.mu.Lock()
+	revoked := c.assigned
+	c.mu.Unlock()
+	if len(revoked) > 0 {
+		if !c.config.DisableAutoCommit {
+			if err := c.Commit(ctx); err != nil {
+				log.Println("Commit before rebalance of group", c.config.GroupID, "failed:", err)
+			}
+		}
+		if c.config.OnRevoked != nil {
+			c.config.OnRevoked(revoked)
+		}
+		c.mu.Lock()
+		c.assigned = nil
+		c.positions = make(map[TopicPartition]int)
+		c.mu.Unlock()
+	}
+
+	for {
+		assignment, err := c.joinAndSync(ctx)
+		if err == nil {
+			return c.assign(ctx, assignment)
+		}
+		switch errorCode(err) {
+		case errUnknownMemberID:
+			c.mu.Lock()
+			c.memberID = ""
+			c.mu.Unlock()
+		case errRebalanceInProgress, errIllegalGeneration:
+		default:
+			return err
+		}
+		select {
+		case <-time.After(rejoinBackoff):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (c *Consumer) joinAndSync(ctx context.Context) ([]TopicPartition, error) {
+	metadata, err := json.Marshal(c.config.Topics)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	memberID := c.memberID
+	c.mu.Unlock()
+
+	e := encoder{}
+	e.putString(c.config.GroupID)
+	e.putString(memberID)
+	e.putString(c.config.ClientID)
+	e.putString(consumerProtocolType)
+	e.putInt32(int32(c.config.SessionTimeout / time.Millisecond))
+	e.putInt32(int32(c.config.SessionTimeout / time.Millisecond))
+	e.putInt32(1)
+	e.putString(rangeAssignor)
+	e.putBytes(metadata)
+	d, err := c.coordinator.roundTrip(ctx, apiJoinGroup, e.buf)
+	if err != nil {
+		return nil, err
+	}
+
+	generation := int(d.int32())
+	d.string() // protocol, only range is offered
+	leaderID := d.string()
+	memberID = d.string()
+	members := make(map[string][]string)
+	count := int(d.int32())
+	for i := 0; i < count && d.err == nil; i++ {
+		id, subscription := d.string(), d.bytes()
+		topics := []string{}
+		if err := json.Unmarshal(subscription, &topics); err != nil {
+			return nil, err
+		}
+		members[id] = topics
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+
+	c.mu.Lock()
+	c.memberID, c.generation = memberID, generation
+	c.mu.Unlock()
+
+	assignments := map[string][]TopicPartition{}
+	if memberID == leaderID {
+		if assignments, err = c.assignRanges(ctx, members); err != nil {
+			return nil, err
+		}
+	}
+
+	e = encoder{}
+	e.putString(c.config.GroupID)
+	e.putInt32(int32(generation))
+	e.putString(memberID)
+	e.putInt32(int32(len(assignments)))
+	for id, partitions := range assignments {
+		data, err := json.Marshal(partitions)
+		if err != nil {
+			return nil, err
+		}
+		e.putString(id)
+		e.putBytes(data)
+	}
+	d, err = c.coordinator.roundTrip(ctx, apiSyncGroup, e.buf)
+	if err != nil {
+		return nil, err
+	}
+
+	assignment := []TopicPartition{}
+	if data := d.bytes(); len(data) > 0 {
+		if err := json.Unmarshal(data, &assignment); err != nil {
+			return nil, err
+		}
+	}
+	return assignment, d.err
+}
+
+// Range assignment, run by the group leader: the partitions of every topic
+// are split into contiguous ranges over the members subscribed to it
+func (c *Consumer) assignRanges(ctx context.Context, members map[string][]string) (map[string][]TopicPartition, error) {
+	subscribers := map[string][]string{}
+	for id, topics := range members {
+		for _, topicName := range topics {
+			subscribers[topicName] = append(subscribers[topicName], id)
+		}
+	}
+
+	assignments := make(map[string][]TopicPartition, len(members))
+	for topicName, ids := range subscribers {
+		partitions, err := c.coordinator.partitions(ctx, topicName)
+		if err != nil {
+			return nil, err
+		}
+		sort.Strings(ids)
+		perMember, extra := partitions/len(ids), partitions%len(ids)
+		start := 0
+		for i, id := range ids {
+			count := perMember
+			if i < extra {
+				count++
+			}
+			for p := start; p < start+count; p++ {
+				assignments[id] = append(assignments[id], TopicPartition{Topic: topicName, Partition: p})
+			}
+			start += count
+		}
+	}
+	return assignments, nil
+}
+
+// Start every assigned partition at its committed offset, or reset it
+func (c *Consumer) assign(ctx context.Context, assignment []TopicPartition) error {
+	positions := make(map[TopicPartition]int, len(assignment))
+	for _, tp := range assignment {
+		e := encoder{}
+		e.putString(c.config.GroupID)
+		e.putString(tp.Topic)
+		e.putInt32(int32(tp.Partition))
+		d, err := c.coordinator.roundTrip(ctx, apiOffsetFetch, e.buf)
+		if err != nil {
+			return err
+		}
+		offset := int(d.int64())
+		if offset < 0 {
+			timestamp := earliestTimestamp
+			if c.config.ResetToLatest {
+				timestamp = latestTimestamp
+			}
+			e = encoder{}
+			e.putString(tp.Topic)
+			e.putInt32(int32(tp.Partition))
+			e.putInt64(timestamp)
+			if d, err = c.coordinator.roundTrip(ctx, apiListOffsets, e.buf); err != nil {
+				return err
+			}
+			offset = int(d.int64())
+		}
+		positions[tp] = offset
+	}
+
+	replicaOf := c.nearbyReplicas(ctx, assignment)
+
+	c.mu.Lock()
+	c.assigned = assignment
+	c.positions = positions
+	c.committed = make(map[TopicPartition]int)
+	c.replicaOf = replicaOf
+	c.rejoin = false
+	memberID := c.memberID
+	c.mu.Unlock()
+
+	log.Println("Consumer", memberID, "of group", c.config.GroupID, "assigned", assignment)
+	if c.config.OnAssigned != nil {
+		c.config.OnAssigned(assignment)
+	}
+	return nil
+}
+
+// Pick the replica in the rack to fetch each partition from, its leader if
+// that is in the rack too. Partitions without one, or without metadata, are
+// fetched through the broker at Addr.
+func (c *Consumer) nearbyReplicas(ctx context.Context, assignment []TopicPartition) map[TopicPartition]int {
+	replicaOf := make(map[TopicPartition]int)
+	if c.config.Rack == "" || len(assignment) == 0 {
+		return replicaOf
+	}
+	m, err := (&Client{conn: c.coordinator}).Metadata(ctx, c.config.Topics...)
+	if err != nil {
+		log.Println("Consumer of group", c.config.GroupID, "fetches without its rack, no metadata:", err)
+		return replicaOf
+	}
+	inRack := map[int]bool{}
+	for _, b := range m.Brokers {
+		if b.Rack != c.config.Rack {
+			continue
+		}
+		inRack[b.ID] = true
+		if _, connected := c.nearby[b.ID]; !connected {
+			c.nearby[b.ID] = newConn(b.Addr())
+		}
+	}
+	for _, t := range m.Topics {
+		for _, p := range t.Partitions {
+			tp := TopicPartition{Topic: t.Name, Partition: p.Partition}
+			if !slices.Contains(assignment, tp) {
+				continue
+			}
+			if inRack[p.Leader] {
+				replicaOf[tp] = p.Leader
+				continue
+			}
+			for _, id := range p.Replicas {
+				if inRack[id] {
+					replicaOf[tp] = id
+					break
+				}
+			}
+		}
+	}
+	return replicaOf
+}
+
+// Heartbeat until closed, flagging a rejoin when the group starts rebalancing
+func (c *Consumer) heartbeatLoop() {
+	defer close(c.done)
+	ticker := time.NewTicker(c.config.HeartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.stop:
+			return
+		case <-ticker.C:
+		}
+
+		c.mu.Lock()
+		memberID, generation, rejoin := c.memberID, c.generation, c.rejoin
+		c.mu.Unlock()
+		if memberID == "" || rejoin {
+			continue
+		}
+
+		e := encoder{}
+		e.putString(c.config.GroupID)
+		e.putInt32(int32(generation))
+		e.putString(memberID)
+		ctx, cancel := context.WithTimeout(context.Background(), c.config.SessionTimeout)
+		_, err := c.coordinator.roundTrip(ctx, apiHeartbeat, e.buf)
+		cancel()
+		switch errorCode(err) {
+		case 0, -1:
+			if err != nil {
+				log.Println("Heartbeat for group", c.config.GroupID, "failed:", err)
+			}
+		case errUnknownMemberID:
+			c.mu.Lock()
+			c.memberID, c.rejoin = "", true
+			c.mu.Unlock()
+		default:
+			c.mu.Lock()
+			c.rejoin = true
+			c.mu.Unlock()
+		}
+	}
+}
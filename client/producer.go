@@ -0,0 +1,353 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/spaolacci/murmur3"
+)
+
+const (
+	defaultBatchSize    = 100
+	defaultLinger       = 5 * time.Millisecond
+	defaultRetries      = 3
+	defaultRetryBackoff = 100 * time.Millisecond
+	metadataMaxAge      = 30 * time.Second
+	sendQueueSize       = 100
+)
+
+var ErrProducerClosed = errors.New("producer is closed")
+
+// Partitioner picks the partition of a record from its key
+type Partitioner func(key string, numPartitions int) int
+
+// HashPartitioner hashes keys the same way the broker does for /produce, so
+// records keep their partition whichever way they were produced
+func HashPartitioner(key string, numPartitions int) int {
+	h := murmur3.New32()
+	h.Write([]byte(key))
+	return int(h.Sum32()) % numPartitions
+}
+
+// RoundRobinPartitioner spreads records evenly over partitions and ignores keys
+func RoundRobinPartitioner() Partitioner {
+	var counter atomic.Uint64
+	return func(_ string, numPartitions int) int {
+		return int((counter.Add(1) - 1) % uint64(numPartitions))
+	}
+}
+
+type ProducerConfig struct {
+	Addr         string        // Broker binary protocol address
+	BatchSize    int           // Records per batch, 100 by default
+	Linger       time.Duration // How long a batch waits to fill up, 5ms by default
+	Retries      int           // Resends after a network error, 3 by default, negative disables them
+	RetryBackoff time.Duration // Wait between resends, 100ms by default
+	Partitioner  Partitioner   // HashPartitioner by default
+	Compression  Compression
+}
+
+// RecordMetadata is where the broker appended a record
+type RecordMetadata struct {
+	Topic     string
+	Partition int
+	Offset    int
+	Timestamp int64 // Unix nanoseconds
+}
+
+type pendingRecord struct {
+	key      string
+	value    []byte
+	callback func(RecordMetadata, error)
+}
+
+type batch struct {
+	tp      TopicPartition
+	records []pendingRecord
+	timer   *time.Timer
+}
+
+type partitionCount struct {
+	count     int
+	fetchedAt time.Time
+}
+
+// Producer batches records per partition and sends them from a single
+// goroutine, so records of a partition are appended in the order they were
+// produced
+type Producer struct {
+	config     ProducerConfig
+	conn       *conn
+	mu         sync.Mutex
+	closed     bool
+	batches    map[TopicPartition]*batch
+	metadata   sync.Map // Key: topic, Value: partitionCount
+	sendQueue  chan *batch
+	detached   sync.WaitGroup // Batches taken out of batches but not yet on sendQueue
+	inFlight   sync.WaitGroup
+	senderDone chan struct{}
+}
+
+// NewProducer returns a producer for the broker at config.Addr, the
+// connection is opened on the first send
+func NewProducer(config ProducerConfig) (*Producer, error) {
+	if config.Addr == "" {
+		return nil, errors.New("broker address is required")
+	}
+	if config.BatchSize <= 0 {
+		config.BatchSize = defaultBatchSize
+	}
+	if config.Linger <= 0 {
+		config.Linger = defaultLinger
+	}
+	if config.Retries < 0 {
+		config.Retries = 0
+	} else if config.Retries == 0 {
+		config.Retries = defaultRetries
+	}
+	if config.RetryBackoff <= 0 {
+		config.RetryBackoff = defaultRetryBackoff
+	}
+	if config.Partitioner == nil {
+		config.Partitioner = HashPartitioner
+	}
+
+	p := &Producer{
+		config:     config,
+		conn:       newConn(config.Addr),
+		batches:    make(map[TopicPartition]*batch),
+		sendQueue:  make(chan *batch, sendQueueSize),
+		senderDone: make(chan struct{}),
+	}
+	go p.sender()
+	return p, nil
+}
+
+// Produce sends a record and waits until the broker has appended it
+func (p *Producer) Produce(ctx context.Context, topicName, key string, value []byte) (RecordMetadata, error) {
+	type result struct {
+		meta RecordMetadata
+		err  error
+	}
+	ch := make(chan result, 1)
+	err := p.ProduceAsync(topicName, key, value, func(meta RecordMetadata, err error) {
+		ch <- result{meta, err}
+	})
+	if err != nil {
+		return RecordMetadata{}, err
+	}
+
+	select {
+	case r := <-ch:
+		return r.meta, r.err
+	case <-ctx.Done():
+		return RecordMetadata{}, ctx.Err()
+	}
+}
+
+// ProduceAsync adds a record to its partition's batch. callback, which may be
+// nil, runs on the sender goroutine once the batch was sent.
+func (p *Producer) ProduceAsync(topicName, key string, value []byte, callback func(RecordMetadata, error)) error {
+	partitions, err := p.partitions(context.Background(), topicName)
+	if err != nil {
+		return err
+	}
+	tp := TopicPartition{Topic: topicName, Partition: p.config.Partitioner(key, partitions)}
+
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return ErrProducerClosed
+	}
+
+	b, exists := p.batches[tp]
+	if !exists {
+		b = &batch{tp: tp}
+		p.batches[tp] = b
+		p.inFlight.Add(1)
+		b.timer = time.AfterFunc(p.config.Linger, func() {
+			p.mu.Lock()
+			if p.batches[tp] != b {
+				p.mu.Unlock()
+				return
+			}
+			p.detach(b)
+			p.mu.Unlock()
+			p.dispatch(b)
+		})
+	}
+	b.records = append(b.records, pendingRecord{key: key, value: value, callback: callback})
+	if len(b.records) < p.config.BatchSize {
+		p.mu.Unlock()
+		return nil
+	}
+	b.timer.Stop()
+	p.detach(b)
+	p.mu.Unlock()
+	p.dispatch(b)
+	return nil
+}
+
+// Flush sends every pending batch and waits for the broker to acknowledge them
+func (p *Producer) Flush(ctx context.Context) error {
+	p.dispatchAll()
+
+	done := make(chan struct{})
+	go func() {
+		p.inFlight.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close sends pending records, waits for them to be acknowledged and closes
+// the connection
+func (p *Producer) Close() error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	p.closed = true
+	p.mu.Unlock()
+
+	// No batch is detached once closed is set, wait for the ones on their
+	// way to sendQueue before closing it
+	p.dispatchAll()
+	p.detached.Wait()
+	close(p.sendQueue)
+
+	<-p.senderDone
+	return p.conn.close()
+}
+
+// Take a batch out of the pending ones. Must be called with p.mu held, the
+// batch is then handed to dispatch once the lock is released: sendQueue may
+// be full and the sender must not wait on p.mu behind us.
+func (p *Producer) detach(b *batch) {
+	delete(p.batches, b.tp)
+	p.detached.Add(1)
+}
+
+// Hand a detached batch to the sender
+func (p *Producer) dispatch(b *batch) {
+	p.sendQueue <- b
+	p.detached.Done()
+}
+
+// Send every pending batch
+func (p *Producer) dispatchAll() {
+	p.mu.Lock()
+	pending := make([]*batch, 0, len(p.batches))
+	for _, b := range p.batches {
+		b.timer.Stop()
+		p.detach(b)
+		pending = append(pending, b)
+	}
+	p.mu.Unlock()
+
+	for _, b := range pending {
+		p.dispatch(b)
+	}
+}
+
+func (p *Producer) sender() {
+	defer close(p.senderDone)
+	for b := range p.sendQueue {
+		results, err := p.send(b)
+		for i, r := range b.records {
+			if r.callback == nil {
+				continue
+			}
+			if err != nil {
+				r.callback(RecordMetadata{}, err)
+			} else {
+				r.callback(results[i], nil)
+			}
+		}
+		p.inFlight.Done()
+	}
+}
+
+// Send a batch, resending it after network errors. Errors returned by the
+// broker are not retried.
+func (p *Producer) send(b *batch) ([]RecordMetadata, error) {
+	records := encoder{}
+	records.putInt32(int32(len(b.records)))
+	for _, r := range b.records {
+		records.putString(r.key)
+		records.putBytes(r.value)
+	}
+	payload, err := compress(p.config.Compression, records.buf)
+	if err != nil {
+		return nil, err
+	}
+
+	e := encoder{}
+	e.putString(b.tp.Topic)
+	e.putInt32(int32(b.tp.Partition))
+	e.putInt16(int16(p.config.Compression))
+	e.putBytes(payload)
+
+	var d *decoder
+	for attempt := 0; ; attempt++ {
+		d, err = p.conn.roundTrip(context.Background(), apiProduceBatch, e.buf)
+		if err == nil {
+			break
+		}
+		if errorCode(err) == errUnknownTopicOrPartition {
+			p.metadata.Delete(b.tp.Topic)
+		}
+		if _, isBrokerErr := err.(*BrokerError); isBrokerErr || attempt >= p.config.Retries {
+			return nil, err
+		}
+		log.Println("Retrying batch for", b.tp.Topic, b.tp.Partition, "after error:", err)
+		time.Sleep(p.config.RetryBackoff)
+	}
+
+	count := int(d.int32())
+	results := make([]RecordMetadata, 0, count)
+	for i := 0; i < count; i++ {
+		results = append(results, RecordMetadata{
+			Topic:     b.tp.Topic,
+			Partition: int(d.int32()),
+			Offset:    int(d.int64()),
+			Timestamp: d.int64(),
+		})
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+	if len(results) != len(b.records) {
+		return nil, errors.New("broker acknowledged a different number of records")
+	}
+	return results, nil
+}
+
+// Partition count of a topic, cached for metadataMaxAge
+func (p *Producer) partitions(ctx context.Context, topicName string) (int, error) {
+	if cached, ok := p.metadata.Load(topicName); ok {
+		entry := cached.(partitionCount)
+		if time.Since(entry.fetchedAt) < metadataMaxAge {
+			return entry.count, nil
+		}
+	}
+	count, err := p.conn.partitions(ctx, topicName)
+	if err != nil {
+		return 0, err
+	}
+	if count <= 0 {
+		return 0, errors.New("topic has no partitions")
+	}
+	p.metadata.Store(topicName, partitionCount{count: count, fetchedAt: time.Now()})
+	return count, nil
+}
@@ -0,0 +1,66 @@
+// Command franzmq-mirror copies topics from one FranzMQ cluster to another
+// until interrupted, outside of the brokers.
+//
+//	franzmq-mirror -source host:port -target host:port [-topics regexp] [-prefix p] [-rename source=target,...]
+//
+// See the mirror package for what is copied and how it resumes.
+package main
+
+import (
+	"FranzMQ/mirror"
+	"context"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+)
+
+func main() {
+	source := flag.String("source", "", "binary listener of a broker of the cluster to copy from")
+	target := flag.String("target", "", "binary listener of a broker of the cluster to copy to")
+	topics := flag.String("topics", ".*", "regular expression the names of the topics to copy match entirely")
+	prefix := flag.String("prefix", "", "put before the names of the copies, e.g. us-east.")
+	rename := flag.String("rename", "", "comma separated source=target names of copies, instead of prefixed ones")
+	replicas := flag.Int("replicas", 1, "replication factor of the copies")
+	checkpointTopic := flag.String("checkpoint-topic", "", "topic of the target checkpoints go to, the prefix and "+mirror.DefaultCheckpointTopic+" by default")
+	checkpointInterval := flag.Duration("checkpoint-interval", 0, "how often to checkpoint, 10s by default")
+	refreshInterval := flag.Duration("refresh-interval", 0, "how often to look for new topics and partitions, 30s by default")
+	syncGroups := flag.Bool("sync-group-offsets", false, "commit translated offsets of the source groups on the target")
+	flag.Parse()
+	if *source == "" || *target == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	var pairs []string
+	if *rename != "" {
+		pairs = strings.Split(*rename, ",")
+	}
+	renames, err := mirror.ParseRenames(pairs)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	m, err := mirror.Start(mirror.Settings{
+		Source:             *source,
+		Target:             *target,
+		Topics:             *topics,
+		Prefix:             *prefix,
+		Renames:            renames,
+		Replicas:           *replicas,
+		CheckpointTopic:    *checkpointTopic,
+		CheckpointInterval: *checkpointInterval,
+		RefreshInterval:    *refreshInterval,
+		SyncGroupOffsets:   *syncGroups,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	<-ctx.Done()
+	log.Println("Stopping the mirror")
+	m.Stop()
+}
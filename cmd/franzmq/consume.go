@@ -0,0 +1,189 @@
+package main
+
+import (
+	"FranzMQ/client"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+const consumeMaxWait = 500 * time.Millisecond
+
+func runConsume(ctx context.Context, broker string, args []string) error {
+	fs := flag.NewFlagSet("consume", flag.ExitOnError)
+	topicName := fs.String("topic", "", "topic to consume")
+	partition := fs.Int("partition", -1, "partition to consume, all of them by default")
+	offset := fs.String("offset", "latest", "where to start: earliest, latest or an offset")
+	fromTimestamp := fs.String("from-timestamp", "", "start at the first message at or after this RFC 3339 time")
+	groupID := fs.String("group", "", "consume as a member of this group and commit offsets")
+	format := fs.String("format", "value", "output format: value, text or json")
+	maxMessages := fs.Int("max-messages", 0, "exit after this many messages, 0 never exits")
+	rack := fs.String("rack", "", "with -group, fetch from the replicas in this rack")
+	fs.Parse(args)
+	if *topicName == "" {
+		return fmt.Errorf("-topic is required")
+	}
+	if *format != "value" && *format != "text" && *format != "json" {
+		return fmt.Errorf("unknown format %q", *format)
+	}
+
+	printed := 0
+	emit := func(records []client.Record) bool {
+		for _, record := range records {
+			printRecord(*format, record)
+			printed++
+			if *maxMessages > 0 && printed >= *maxMessages {
+				return false
+			}
+		}
+		return true
+	}
+
+	if *groupID != "" {
+		if *partition >= 0 || *fromTimestamp != "" || (*offset != "earliest" && *offset != "latest") {
+			return fmt.Errorf("groups consume every partition from their committed offsets, use groups reset-offsets to move them")
+		}
+		return consumeGroup(ctx, broker, *groupID, *topicName, *rack, *offset == "latest", emit)
+	}
+	if *rack != "" {
+		return fmt.Errorf("-rack needs -group")
+	}
+
+	c := client.NewClient(broker)
+	defer c.Close()
+
+	positions, err := startOffsets(ctx, c, *topicName, *partition, *offset, *fromTimestamp)
+	if err != nil {
+		return err
+	}
+
+	// Read what is there from every partition, long poll one of them, rotating, when nothing is
+	next := 0
+	for ctx.Err() == nil {
+		received := false
+		for i := range positions {
+			records, nextOffset, err := c.Fetch(ctx, *topicName, positions[i].partition, positions[i].offset, 0)
+			if err != nil {
+				return err
+			}
+			positions[i].offset = nextOffset
+			received = received || len(records) > 0
+			if !emit(records) {
+				return nil
+			}
+		}
+		if received {
+			continue
+		}
+
+		next = (next + 1) % len(positions)
+		records, nextOffset, err := c.Fetch(ctx, *topicName, positions[next].partition, positions[next].offset, consumeMaxWait)
+		if err != nil {
+			return err
+		}
+		positions[next].offset = nextOffset
+		if !emit(records) {
+			return nil
+		}
+	}
+	return nil
+}
+
+type position struct {
+	partition int
+	offset    int
+}
+
+func startOffsets(ctx context.Context, c *client.Client, topicName string, partition int, offset, fromTimestamp string) ([]position, error) {
+	desc, err := c.DescribeTopic(ctx, topicName)
+	if err != nil {
+		return nil, err
+	}
+
+	positions := []position{}
+	for _, p := range desc.Partitions {
+		if partition >= 0 && p.Partition != partition {
+			continue
+		}
+		start := position{partition: p.Partition}
+		switch {
+		case fromTimestamp != "":
+			at, err := time.Parse(time.RFC3339, fromTimestamp)
+			if err != nil {
+				return nil, fmt.Errorf("invalid -from-timestamp: %w", err)
+			}
+			if start.offset, err = c.ListOffset(ctx, topicName, p.Partition, at.UnixNano()); err != nil {
+				return nil, err
+			}
+		case offset == "earliest":
+			start.offset = p.EarliestOffset
+		case offset == "latest":
+			start.offset = p.LatestOffset
+		default:
+			if start.offset, err = strconv.Atoi(offset); err != nil {
+				return nil, fmt.Errorf("invalid -offset %q", offset)
+			}
+		}
+		positions = append(positions, start)
+	}
+	if len(positions) == 0 {
+		return nil, fmt.Errorf("partition %d does not exist for topic %s", partition, topicName)
+	}
+	return positions, nil
+}
+
+func consumeGroup(ctx context.Context, broker, groupID, topicName, rack string, resetToLatest bool, emit func([]client.Record) bool) error {
+	consumer, err := client.NewConsumer(client.ConsumerConfig{
+		Addr:          broker,
+		GroupID:       groupID,
+		ClientID:      "franzmq-cli",
+		Topics:        []string{topicName},
+		ResetToLatest: resetToLatest,
+		Rack:          rack,
+	})
+	if err != nil {
+		return err
+	}
+	defer consumer.Close()
+
+	for ctx.Err() == nil {
+		records, err := consumer.Poll(ctx)
+		if err != nil {
+			return err
+		}
+		if !emit(records) {
+			return nil
+		}
+	}
+	return nil
+}
+
+func printRecord(format string, record client.Record) {
+	switch format {
+	case "json":
+		line, _ := json.Marshal(map[string]interface{}{
+			"topic":     record.Topic,
+			"partition": record.Partition,
+			"offset":    record.Offset,
+			"timestamp": record.Timestamp,
+			"value":     json.RawMessage(record.Value),
+		})
+		fmt.Println(string(line))
+	case "text":
+		fmt.Printf("%d\t%d\t%s\t%s\n", record.Partition, record.Offset, time.Unix(0, record.Timestamp).Format(time.RFC3339Nano), displayValue(record.Value))
+	default:
+		fmt.Println(displayValue(record.Value))
+	}
+}
+
+// Messages produced as plain text are stored as JSON strings, print them unquoted
+func displayValue(value []byte) string {
+	var text string
+	if json.Unmarshal(value, &text) == nil {
+		return text
+	}
+	return string(value)
+}
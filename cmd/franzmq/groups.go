@@ -0,0 +1,143 @@
+package main
+
+import (
+	"FranzMQ/client"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+)
+
+func runGroups(ctx context.Context, broker string, args []string) error {
+	sub, args, err := subcommand("groups", args, "list", "describe", "reset-offsets")
+	if err != nil {
+		return err
+	}
+
+	c := client.NewClient(broker)
+	defer c.Close()
+
+	switch sub {
+	case "list":
+		names, err := c.ListGroups(ctx)
+		if err != nil {
+			return err
+		}
+		for _, name := range names {
+			fmt.Println(name)
+		}
+		return nil
+	case "describe":
+		return describeGroup(ctx, c, args)
+	default:
+		return resetOffsets(ctx, c, args)
+	}
+}
+
+func describeGroup(ctx context.Context, c *client.Client, args []string) error {
+	fs := flag.NewFlagSet("groups describe", flag.ExitOnError)
+	groupID := fs.String("group", "", "group id")
+	fs.Parse(args)
+	if *groupID == "" {
+		return fmt.Errorf("-group is required")
+	}
+
+	desc, err := c.DescribeGroup(ctx, *groupID)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Group %s is %s at generation %d\n\n", desc.GroupID, desc.State, desc.Generation)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "MEMBER\tCLIENT\tASSIGNMENT")
+	for _, m := range desc.Members {
+		fmt.Fprintf(w, "%s\t%s\t%v\n", m.MemberID, m.ClientID, m.Assignment)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "TOPIC\tPARTITION\tCOMMITTED\tLATEST\tLAG")
+	for _, tp := range client.SortedPartitions(desc.Offsets) {
+		committed := desc.Offsets[tp]
+		latest, err := c.ListOffset(ctx, tp.Topic, tp.Partition, client.LatestOffset)
+		if err != nil {
+			fmt.Fprintf(w, "%s\t%d\t%d\t-\t-\n", tp.Topic, tp.Partition, committed)
+			continue
+		}
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\n", tp.Topic, tp.Partition, committed, latest, latest-committed)
+	}
+	return w.Flush()
+}
+
+// Move the committed offsets of an inactive group, only printing the plan
+// unless -execute is given
+func resetOffsets(ctx context.Context, c *client.Client, args []string) error {
+	fs := flag.NewFlagSet("groups reset-offsets", flag.ExitOnError)
+	groupID := fs.String("group", "", "group id")
+	topicName := fs.String("topic", "", "topic whose offsets to reset")
+	partition := fs.Int("partition", -1, "partition to reset, all of them by default")
+	to := fs.String("to", "", "new position: earliest, latest, an offset or an RFC 3339 time")
+	execute := fs.Bool("execute", false, "commit the new offsets instead of only printing them")
+	fs.Parse(args)
+	if *groupID == "" || *topicName == "" || *to == "" {
+		return fmt.Errorf("-group, -topic and -to are required")
+	}
+
+	// A group the broker does not know yet has nothing to protect
+	desc, err := c.DescribeGroup(ctx, *groupID)
+	var brokerErr *client.BrokerError
+	if err != nil && !errors.As(err, &brokerErr) {
+		return err
+	}
+	if err == nil && len(desc.Members) > 0 {
+		return fmt.Errorf("group %s has %d active members, stop them before resetting offsets", *groupID, len(desc.Members))
+	}
+
+	topic, err := c.DescribeTopic(ctx, *topicName)
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TOPIC\tPARTITION\tNEW OFFSET")
+	for _, p := range topic.Partitions {
+		if *partition >= 0 && p.Partition != *partition {
+			continue
+		}
+		offset, err := resolveOffset(ctx, c, *topicName, p, *to)
+		if err != nil {
+			return err
+		}
+		if *execute {
+			if err := c.CommitOffset(ctx, *groupID, client.TopicPartition{Topic: *topicName, Partition: p.Partition}, offset); err != nil {
+				return err
+			}
+		}
+		fmt.Fprintf(w, "%s\t%d\t%d\n", *topicName, p.Partition, offset)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if !*execute {
+		fmt.Println("\nDry run, pass -execute to commit these offsets")
+	}
+	return nil
+}
+
+func resolveOffset(ctx context.Context, c *client.Client, topicName string, p client.PartitionDescription, to string) (int, error) {
+	switch to {
+	case "earliest":
+		return p.EarliestOffset, nil
+	case "latest":
+		return p.LatestOffset, nil
+	}
+	if offset, err := strconv.Atoi(to); err == nil {
+		return min(max(offset, p.EarliestOffset), p.LatestOffset), nil
+	}
+	at, err := time.Parse(time.RFC3339, to)
+	if err != nil {
+		return 0, fmt.Errorf("invalid -to %q", to)
+	}
+	return c.ListOffset(ctx, topicName, p.Partition, at.UnixNano())
+}
@@ -0,0 +1,86 @@
+// Command franzmq administers a FranzMQ broker and produces or consumes
+// messages from the shell over the binary protocol.
+//
+//	franzmq [-broker host:port] topics create|list|describe|alter|delete ...
+//	franzmq [-broker host:port] produce -topic name [-key-separator sep]
+//	franzmq [-broker host:port] consume -topic name [-offset earliest|latest|N] [-from-timestamp t] [-group id [-rack r]] [-format value|text|json]
+//	franzmq [-broker host:port] groups list|describe|reset-offsets ...
+//	franzmq [-broker host:port] reassignments list|start|decommission|elect-leaders ...
+//
+// The broker address defaults to $FRANZMQ_BROKER or localhost:9090.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+const usage = `Usage: franzmq [-broker host:port] <command> [arguments]
+
+Commands:
+  topics create|list|describe|alter|delete
+                                Manage topics
+  produce                       Produce stdin, one message per line
+  consume                       Print messages of a topic
+  groups list|describe|reset-offsets
+                                Inspect and reset consumer groups
+  reassignments list|start|decommission|elect-leaders
+                                Move partitions between brokers
+
+Run "franzmq <command> -h" for the arguments of a command.
+`
+
+func main() {
+	defaultBroker := os.Getenv("FRANZMQ_BROKER")
+	if defaultBroker == "" {
+		defaultBroker = "localhost:9090"
+	}
+	broker := flag.String("broker", defaultBroker, "broker binary protocol address")
+	flag.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	command, args := flag.Arg(0), flag.Args()[1:]
+	var err error
+	switch command {
+	case "topics":
+		err = runTopics(ctx, *broker, args)
+	case "produce":
+		err = runProduce(ctx, *broker, args)
+	case "consume":
+		err = runConsume(ctx, *broker, args)
+	case "groups":
+		err = runGroups(ctx, *broker, args)
+	case "reassignments":
+		err = runReassignments(ctx, *broker, args)
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err != nil && ctx.Err() == nil {
+		fmt.Fprintln(os.Stderr, "franzmq:", err)
+		os.Exit(1)
+	}
+}
+
+// Split "topics create ..." style commands into the subcommand and its arguments
+func subcommand(command string, args []string, subcommands ...string) (string, []string, error) {
+	if len(args) > 0 {
+		for _, sub := range subcommands {
+			if args[0] == sub {
+				return sub, args[1:], nil
+			}
+		}
+	}
+	return "", nil, fmt.Errorf("usage: franzmq %s %v", command, subcommands)
+}
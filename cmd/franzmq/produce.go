@@ -0,0 +1,86 @@
+package main
+
+import (
+	"FranzMQ/client"
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"sync/atomic"
+)
+
+const maxLineSize = 1024 * 1024
+
+func runProduce(ctx context.Context, broker string, args []string) error {
+	fs := flag.NewFlagSet("produce", flag.ExitOnError)
+	topicName := fs.String("topic", "", "topic to produce to")
+	keySeparator := fs.String("key-separator", "", "split every line into key and message at the first separator")
+	compression := fs.String("compression", "none", "wire compression: none, gzip, snappy or zstd")
+	fs.Parse(args)
+	if *topicName == "" {
+		return fmt.Errorf("-topic is required")
+	}
+	codec, err := parseCompression(*compression)
+	if err != nil {
+		return err
+	}
+
+	producer, err := client.NewProducer(client.ProducerConfig{Addr: broker, Compression: codec})
+	if err != nil {
+		return err
+	}
+
+	var produced, failed atomic.Int64
+	callback := func(_ client.RecordMetadata, err error) {
+		if err != nil {
+			failed.Add(1)
+			fmt.Fprintln(os.Stderr, "franzmq: produce failed:", err)
+			return
+		}
+		produced.Add(1)
+	}
+
+	scanner := bufio.NewScanner(os.Stdin)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLineSize)
+	for scanner.Scan() && ctx.Err() == nil {
+		key, value := "", scanner.Text()
+		if *keySeparator != "" {
+			if k, v, found := strings.Cut(value, *keySeparator); found {
+				key, value = k, v
+			}
+		}
+		if err := producer.ProduceAsync(*topicName, key, []byte(value), callback); err != nil {
+			producer.Close()
+			return err
+		}
+	}
+	if err := producer.Close(); err != nil {
+		return err
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "Produced %d messages to %s\n", produced.Load(), *topicName)
+	if failed.Load() > 0 {
+		return fmt.Errorf("%d messages failed", failed.Load())
+	}
+	return nil
+}
+
+func parseCompression(name string) (client.Compression, error) {
+	switch name {
+	case "none":
+		return client.CompressionNone, nil
+	case "gzip":
+		return client.CompressionGzip, nil
+	case "snappy":
+		return client.CompressionSnappy, nil
+	case "zstd":
+		return client.CompressionZstd, nil
+	default:
+		return 0, fmt.Errorf("unknown compression %q", name)
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"FranzMQ/client"
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+func runReassignments(ctx context.Context, broker string, args []string) error {
+	sub, args, err := subcommand("reassignments", args, "list", "start", "decommission", "elect-leaders")
+	if err != nil {
+		return err
+	}
+
+	c := client.NewClient(broker)
+	defer c.Close()
+
+	switch sub {
+	case "list":
+		return listReassignments(ctx, c)
+	case "start":
+		return startReassignment(ctx, c, args)
+	case "elect-leaders":
+		return electLeaders(ctx, c, args)
+	default:
+		return decommissionBroker(ctx, c, args)
+	}
+}
+
+func listReassignments(ctx context.Context, c *client.Client) error {
+	reassignments, err := c.ListReassignments(ctx)
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TOPIC\tPARTITION\tSTATE\tREPLICAS\tTARGET\tISR\tTHROTTLE")
+	for _, r := range reassignments {
+		fmt.Fprintf(w, "%s\t%d\t%s\t%v\t%v\t%v\t%d\n", r.Topic, r.Partition, r.State, r.Replicas, r.Target, r.InSyncReplicas, r.Throttle)
+	}
+	return w.Flush()
+}
+
+// Move partitions of a topic, given as -replicas 0=3,2 -replicas 1=2,3
+func startReassignment(ctx context.Context, c *client.Client, args []string) error {
+	fs := flag.NewFlagSet("reassignments start", flag.ExitOnError)
+	topicName := fs.String("topic", "", "topic whose partitions to move")
+	throttle := fs.Int("throttle", 0, "bytes per second the new replicas copy at, 0 for no limit")
+	partitions := partitionReplicas{}
+	fs.Var(partitions, "replicas", "partition=broker,broker... the new replicas of a partition, the first leads, repeatable")
+	fs.Parse(args)
+	if *topicName == "" || len(partitions) == 0 {
+		return fmt.Errorf("-topic and -replicas are required")
+	}
+	if err := c.ReassignPartitions(ctx, *topicName, partitions, *throttle); err != nil {
+		return err
+	}
+	fmt.Printf("Moving %d partitions of %s\n", len(partitions), *topicName)
+	return nil
+}
+
+// Move every partition off a broker before retiring it
+func decommissionBroker(ctx context.Context, c *client.Client, args []string) error {
+	fs := flag.NewFlagSet("reassignments decommission", flag.ExitOnError)
+	brokerID := fs.Int("broker-id", -1, "broker to move the partitions off")
+	throttle := fs.Int("throttle", 0, "bytes per second the new replicas copy at, 0 for no limit")
+	fs.Parse(args)
+	if *brokerID < 0 {
+		return fmt.Errorf("-broker-id is required")
+	}
+	moved, err := c.DecommissionBroker(ctx, *brokerID, *throttle)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Moving %d partitions off broker %d\n", moved, *brokerID)
+	return nil
+}
+
+// Move leadership back to the preferred replicas
+func electLeaders(ctx context.Context, c *client.Client, args []string) error {
+	fs := flag.NewFlagSet("reassignments elect-leaders", flag.ExitOnError)
+	topicName := fs.String("topic", "", "topic whose leaders to elect, all of them by default")
+	partition := fs.Int("partition", -1, "partition whose leader to elect, all of them by default")
+	fs.Parse(args)
+	partitions := []int{}
+	if *partition >= 0 {
+		if *topicName == "" {
+			return fmt.Errorf("-partition needs -topic")
+		}
+		partitions = append(partitions, *partition)
+	}
+	elections, err := c.ElectPreferredLeaders(ctx, *topicName, partitions...)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Electing the preferred leader of %d partitions\n", elections)
+	return nil
+}
+
+// partitionReplicas collects repeated -replicas partition=ids flags
+type partitionReplicas map[int][]int
+
+func (p partitionReplicas) String() string { return "" }
+
+func (p partitionReplicas) Set(value string) error {
+	partition, list, found := strings.Cut(value, "=")
+	n, err := strconv.Atoi(partition)
+	if !found || err != nil {
+		return fmt.Errorf("expected partition=broker,broker..., got %q", value)
+	}
+	ids := []int{}
+	for _, id := range strings.Split(list, ",") {
+		broker, err := strconv.Atoi(strings.TrimSpace(id))
+		if err != nil {
+			return fmt.Errorf("invalid broker id %q", id)
+		}
+		ids = append(ids, broker)
+	}
+	p[n] = ids
+	return nil
+}
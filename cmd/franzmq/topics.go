@@ -0,0 +1,174 @@
+package main
+
+import (
+	"FranzMQ/client"
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+func runTopics(ctx context.Context, broker string, args []string) error {
+	sub, args, err := subcommand("topics", args, "create", "list", "describe", "alter", "delete")
+	if err != nil {
+		return err
+	}
+
+	c := client.NewClient(broker)
+	defer c.Close()
+
+	switch sub {
+	case "create":
+		return createTopic(ctx, c, args)
+	case "list":
+		return listTopics(ctx, c)
+	case "alter":
+		return alterTopic(ctx, c, args)
+	case "delete":
+		return deleteTopic(ctx, c, args)
+	default:
+		return describeTopic(ctx, c, args)
+	}
+}
+
+func createTopic(ctx context.Context, c *client.Client, args []string) error {
+	fs := flag.NewFlagSet("topics create", flag.ExitOnError)
+	name := fs.String("topic", "", "topic name")
+	config := client.TopicConfig{}
+	fs.IntVar(&config.Partitions, "partitions", 1, "number of partitions")
+	fs.IntVar(&config.Replicas, "replicas", 1, "number of replicas")
+	fs.StringVar(&config.Compression, "compression", "", "compression stored in the topic config")
+	fs.StringVar(&config.DataType, "data-type", "", "data type stored in the topic config")
+	fs.Parse(args)
+	if *name == "" {
+		return fmt.Errorf("-topic is required")
+	}
+
+	if err := c.CreateTopic(ctx, *name, config); err != nil {
+		return err
+	}
+	fmt.Println("Created topic", *name)
+	return nil
+}
+
+func listTopics(ctx context.Context, c *client.Client) error {
+	topics, err := c.ListTopics(ctx)
+	if err != nil {
+		return err
+	}
+	names := make([]string, 0, len(topics))
+	for name := range topics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TOPIC\tPARTITIONS")
+	for _, name := range names {
+		fmt.Fprintf(w, "%s\t%d\n", name, topics[name])
+	}
+	return w.Flush()
+}
+
+func describeTopic(ctx context.Context, c *client.Client, args []string) error {
+	fs := flag.NewFlagSet("topics describe", flag.ExitOnError)
+	name := fs.String("topic", "", "topic name")
+	fs.Parse(args)
+	if *name == "" {
+		return fmt.Errorf("-topic is required")
+	}
+
+	desc, err := c.DescribeTopic(ctx, *name)
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "PARTITION\tEARLIEST\tLATEST\tMESSAGES")
+	for _, p := range desc.Partitions {
+		fmt.Fprintf(w, "%d\t%d\t%d\t%d\n", p.Partition, p.EarliestOffset, p.LatestOffset, p.LatestOffset-p.EarliestOffset)
+	}
+
+	configs, err := c.DescribeConfigs(ctx, *name)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "CONFIG\tVALUE\tSOURCE")
+	for _, entry := range configs {
+		source := "topic"
+		if entry.Default {
+			source = "default"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", entry.Name, entry.Value, source)
+	}
+	return w.Flush()
+}
+
+func alterTopic(ctx context.Context, c *client.Client, args []string) error {
+	fs := flag.NewFlagSet("topics alter", flag.ExitOnError)
+	name := fs.String("topic", "", "topic name")
+	partitions := fs.Int("partitions", 0, "new number of partitions, only growing is supported")
+	changes := configChanges{}
+	fs.Var(changes, "config", "set a config as key=value, repeatable")
+	fs.Var(resetConfigs(changes), "delete-config", "reset a config to its default, repeatable")
+	fs.Parse(args)
+	if *name == "" || (*partitions < 1 && len(changes) == 0) {
+		return fmt.Errorf("-topic and -partitions or -config are required")
+	}
+
+	if *partitions > 0 {
+		if err := c.CreatePartitions(ctx, *name, *partitions); err != nil {
+			return err
+		}
+		fmt.Printf("Topic %s now has %d partitions\n", *name, *partitions)
+	}
+	if len(changes) > 0 {
+		if err := c.AlterConfigs(ctx, *name, changes); err != nil {
+			return err
+		}
+		fmt.Println("Altered configs of topic", *name)
+	}
+	return nil
+}
+
+// Repeatable -config key=value flag
+type configChanges map[string]string
+
+func (c configChanges) String() string { return "" }
+
+func (c configChanges) Set(value string) error {
+	key, v, found := strings.Cut(value, "=")
+	if !found || key == "" {
+		return fmt.Errorf("expected key=value")
+	}
+	c[key] = v
+	return nil
+}
+
+// Repeatable -delete-config key flag, stored as an empty value
+type resetConfigs map[string]string
+
+func (c resetConfigs) String() string { return "" }
+
+func (c resetConfigs) Set(key string) error {
+	c[key] = ""
+	return nil
+}
+
+func deleteTopic(ctx context.Context, c *client.Client, args []string) error {
+	fs := flag.NewFlagSet("topics delete", flag.ExitOnError)
+	name := fs.String("topic", "", "topic name")
+	fs.Parse(args)
+	if *name == "" {
+		return fmt.Errorf("-topic is required")
+	}
+
+	if err := c.DeleteTopic(ctx, *name); err != nil {
+		return err
+	}
+	fmt.Println("Deleted topic", *name)
+	return nil
+}
@@ -0,0 +1,417 @@
+// Package config loads the broker settings. Every setting has a default and
+// can be set in a YAML file, through a FRANZMQ_<SECTION>_<KEY> environment
+// variable or with a -<section>.<key> flag, later sources winning. Lists are
+// comma separated in variables and flags.
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+type Broker struct {
+	Listeners Listeners `yaml:"listeners"`
+	Storage   Storage   `yaml:"storage"`
+	Tiered    Tiered    `yaml:"tiered"`
+	Cluster   Cluster   `yaml:"cluster"`
+	Producer  Producer  `yaml:"producer"`
+	Mirror    Mirror    `yaml:"mirror"`
+	Tracing   Tracing   `yaml:"tracing"`
+}
+
+type Listeners struct {
+	HTTP                string `yaml:"http"`
+	Binary              string `yaml:"binary"`
+	GRPC                string `yaml:"grpc"`
+	Kafka               string `yaml:"kafka"`
+	KafkaAdvertisedHost string `yaml:"kafka_advertised_host"` // Host Kafka clients are told to connect to
+}
+
+type Storage struct {
+	Backend           string        `yaml:"backend"`  // file, or memory to keep everything in RAM and lose it on exit
+	DataDir           string        `yaml:"data_dir"` // Topics, groups and deleted topics live below it
+	LogDirs           []string      `yaml:"log_dirs"` // Partitions are spread across these, data_dir/topics when empty
+	FileCacheDuration time.Duration `yaml:"file_cache_duration"`
+}
+
+// Tiered storage moves closed segments to an object store
+type Tiered struct {
+	Store         string        `yaml:"store"` // Empty keeps segments local, local or s3 offloads them
+	LocalDir      string        `yaml:"local_dir"`
+	S3Endpoint    string        `yaml:"s3_endpoint"` // e.g. http://minio:9000, buckets are addressed path style
+	S3Bucket      string        `yaml:"s3_bucket"`
+	S3Region      string        `yaml:"s3_region"`
+	S3AccessKey   string        `yaml:"s3_access_key"`
+	S3SecretKey   string        `yaml:"s3_secret_key" secret:"true"`
+	RetryInterval time.Duration `yaml:"retry_interval"` // Wait before a failed upload is tried again
+}
+
+// Cluster lists the brokers topics with several replicas are replicated
+// across, or where the cluster metadata is kept: etcd or the built-in quorum
+type Cluster struct {
+	BrokerID          int           `yaml:"broker_id"`
+	Brokers           []string      `yaml:"brokers"`              // id@host:port binary listener of every broker, this one included. Empty runs a single broker
+	EtcdEndpoints     []string      `yaml:"etcd_endpoints"`       // Brokers register in etcd and a controller assigns partitions, instead of brokers
+	Quorum            []string      `yaml:"quorum"`               // id@host:port binary listener of every broker voting in the built-in metadata quorum, instead of etcd
+	SessionTTL        time.Duration `yaml:"session_ttl"`          // A broker that lost etcd for this long is taken out of the cluster
+	AdvertisedAddr    string        `yaml:"advertised_addr"`      // Binary listener address registered in etcd, localhost and its port when empty
+	Rack              string        `yaml:"rack"`                 // Failure domain of this broker, the controller puts the replicas of a partition on distinct racks
+	ReplicaLagTimeMax time.Duration `yaml:"replica_lag_time_max"` // Followers not caught up for this long drop out of the in-sync replicas
+	ReplicaFetchWait  time.Duration `yaml:"replica_fetch_wait"`   // Longest a follower's fetch is parked on the leader
+	AckTimeout        time.Duration `yaml:"ack_timeout"`          // Longest a produce waits for the in-sync replicas
+
+	AutoLeaderRebalance          bool          `yaml:"auto_leader_rebalance"`           // The controller moves leadership back to the preferred replicas
+	LeaderImbalancePercent       int           `yaml:"leader_imbalance_percent"`        // Share of a broker's preferred partitions led elsewhere that triggers it
+	LeaderImbalanceCheckInterval time.Duration `yaml:"leader_imbalance_check_interval"` // How often the controller checks the balance
+}
+
+type Producer struct {
+	PartitionQueueSize  int           `yaml:"partition_queue_size"`
+	WriterQueueSize     int           `yaml:"writer_queue_size"`
+	WriterBatchSize     int           `yaml:"writer_batch_size"` // Writes per file buffered before a flush
+	WriterFlushInterval time.Duration `yaml:"writer_flush_interval"`
+	ConfigCacheDuration time.Duration `yaml:"config_cache_duration"`
+	// How often segments past their topic's retention.ms or retention.bytes are deleted
+	RetentionCheckInterval time.Duration `yaml:"retention_check_interval"`
+}
+
+// Mirror copies topics of another cluster into this one
+type Mirror struct {
+	Source             string        `yaml:"source"`           // Binary listener of a broker of the cluster to copy from, empty disables mirroring
+	Topics             string        `yaml:"topics"`           // Regular expression the names of the topics to copy match entirely
+	TopicPrefix        string        `yaml:"topic_prefix"`     // Put before the names of the copies, e.g. "us-east."
+	TopicRenames       []string      `yaml:"topic_renames"`    // source=target names of copies, instead of prefixed ones
+	Replicas           int           `yaml:"replicas"`         // Replication factor of the copies
+	CheckpointTopic    string        `yaml:"checkpoint_topic"` // Where the mirror records how far it copied, topic_prefix + mirror-checkpoints when empty
+	CheckpointInterval time.Duration `yaml:"checkpoint_interval"`
+	RefreshInterval    time.Duration `yaml:"refresh_interval"`   // How often new topics and partitions of the source are looked for
+	SyncGroupOffsets   bool          `yaml:"sync_group_offsets"` // Commit translated offsets of the source groups here
+}
+
+type Tracing struct {
+	Endpoint string `yaml:"endpoint"` // OTLP over HTTP, empty disables tracing
+}
+
+// Default returns the settings the broker runs with when nothing is configured
+func Default() Broker {
+	return Broker{
+		Listeners: Listeners{
+			HTTP:                ":8080",
+			Binary:              ":9090",
+			GRPC:                ":9091",
+			Kafka:               ":9092",
+			KafkaAdvertisedHost: "localhost",
+		},
+		Storage: Storage{
+			Backend:           "file",
+			DataDir:           "./files",
+			FileCacheDuration: 60 * time.Second,
+		},
+		Tiered: Tiered{
+			S3Region:      "us-east-1",
+			RetryInterval: 30 * time.Second,
+		},
+		Cluster: Cluster{
+			BrokerID:          1,
+			SessionTTL:        10 * time.Second,
+			ReplicaLagTimeMax: 10 * time.Second,
+			ReplicaFetchWait:  500 * time.Millisecond,
+			AckTimeout:        30 * time.Second,
+
+			AutoLeaderRebalance:          true,
+			LeaderImbalancePercent:       10,
+			LeaderImbalanceCheckInterval: 5 * time.Minute,
+		},
+		Producer: Producer{
+			PartitionQueueSize:  10000,
+			WriterQueueSize:     10000,
+			WriterBatchSize:     200,
+			WriterFlushInterval: 10 * time.Millisecond,
+			ConfigCacheDuration: 10 * time.Second,
+
+			RetentionCheckInterval: 5 * time.Minute,
+		},
+		Mirror: Mirror{
+			Topics:             ".*",
+			Replicas:           1,
+			CheckpointInterval: 10 * time.Second,
+			RefreshInterval:    30 * time.Second,
+		},
+		Tracing: Tracing{
+			Endpoint: "jaeger:4318",
+		},
+	}
+}
+
+// Load builds the settings from the defaults, the file given by -config or
+// $FRANZMQ_CONFIG, the environment and args, then validates them
+func Load(args []string) (Broker, error) {
+	b := Default()
+
+	fs := flag.NewFlagSet("franzmq", flag.ContinueOnError)
+	path := fs.String("config", os.Getenv("FRANZMQ_CONFIG"), "YAML config file")
+	flagValues := map[string]*string{}
+	for _, s := range settings(&b) {
+		flagValues[s.key] = fs.String(s.key, "", fmt.Sprintf("overrides %s (default %s)", s.key, format(s.value)))
+	}
+	if err := fs.Parse(args); err != nil {
+		return Broker{}, err
+	}
+
+	if *path != "" {
+		data, err := os.ReadFile(*path)
+		if err != nil {
+			return Broker{}, fmt.Errorf("error reading config file: %w", err)
+		}
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(&b); err != nil && !errors.Is(err, io.EOF) {
+			return Broker{}, fmt.Errorf("error parsing config file %s: %w", *path, err)
+		}
+	}
+
+	values := map[string]reflect.Value{}
+	for _, s := range settings(&b) {
+		values[s.key] = s.value
+		if env, found := os.LookupEnv(EnvName(s.key)); found {
+			if err := set(s.value, env); err != nil {
+				return Broker{}, fmt.Errorf("invalid %s: %w", EnvName(s.key), err)
+			}
+		}
+	}
+
+	var flagErr error
+	fs.Visit(func(f *flag.Flag) {
+		if value, isSetting := values[f.Name]; isSetting && flagErr == nil {
+			if err := set(value, *flagValues[f.Name]); err != nil {
+				flagErr = fmt.Errorf("invalid -%s: %w", f.Name, err)
+			}
+		}
+	})
+	if flagErr != nil {
+		return Broker{}, flagErr
+	}
+
+	return b, b.Validate()
+}
+
+// Validate checks every setting holds a usable value
+func (b Broker) Validate() error {
+	for key, addr := range map[string]string{
+		"listeners.http":   b.Listeners.HTTP,
+		"listeners.binary": b.Listeners.Binary,
+		"listeners.grpc":   b.Listeners.GRPC,
+		"listeners.kafka":  b.Listeners.Kafka,
+	} {
+		if _, port, err := net.SplitHostPort(addr); err != nil || port == "" {
+			return fmt.Errorf("%s must be a host:port address, got %q", key, addr)
+		}
+	}
+	if b.Listeners.KafkaAdvertisedHost == "" {
+		return fmt.Errorf("listeners.kafka_advertised_host is required")
+	}
+	if b.Storage.Backend != "file" && b.Storage.Backend != "memory" {
+		return fmt.Errorf("storage.backend must be file or memory, got %q", b.Storage.Backend)
+	}
+	if b.Storage.DataDir == "" {
+		return fmt.Errorf("storage.data_dir is required")
+	}
+	switch b.Tiered.Store {
+	case "":
+	case "local":
+		if b.Tiered.LocalDir == "" {
+			return fmt.Errorf("tiered.local_dir is required for the local store")
+		}
+	case "s3":
+		if b.Tiered.S3Endpoint == "" || b.Tiered.S3Bucket == "" {
+			return fmt.Errorf("tiered.s3_endpoint and tiered.s3_bucket are required for the s3 store")
+		}
+	default:
+		return fmt.Errorf("tiered.store must be empty, local or s3, got %q", b.Tiered.Store)
+	}
+	modes := 0
+	for _, list := range [][]string{b.Cluster.Brokers, b.Cluster.EtcdEndpoints, b.Cluster.Quorum} {
+		if len(list) > 0 {
+			modes++
+		}
+	}
+	if err := b.validateBrokers("cluster.brokers", b.Cluster.Brokers); err != nil {
+		return err
+	}
+	if err := b.validateBrokers("cluster.quorum", b.Cluster.Quorum); err != nil {
+		return err
+	}
+	if modes > 1 {
+		return fmt.Errorf("only one of cluster.brokers, cluster.etcd_endpoints and cluster.quorum can be set")
+	}
+	if b.Cluster.AdvertisedAddr != "" {
+		if _, port, err := net.SplitHostPort(b.Cluster.AdvertisedAddr); err != nil || port == "" {
+			return fmt.Errorf("cluster.advertised_addr must be a host:port address, got %q", b.Cluster.AdvertisedAddr)
+		}
+	}
+	if b.Mirror.Source != "" {
+		if _, port, err := net.SplitHostPort(b.Mirror.Source); err != nil || port == "" {
+			return fmt.Errorf("mirror.source must be a host:port address, got %q", b.Mirror.Source)
+		}
+	}
+	for _, s := range settings(&b) {
+		switch v := s.value.Interface().(type) {
+		case int:
+			if v < 1 {
+				return fmt.Errorf("%s must be positive, got %d", s.key, v)
+			}
+		case time.Duration:
+			if v <= 0 {
+				return fmt.Errorf("%s must be positive, got %s", s.key, v)
+			}
+		}
+	}
+	return nil
+}
+
+// Check a list of id@host:port brokers, if set, holds each broker once, this one too
+func (b Broker) validateBrokers(key string, list []string) error {
+	if len(list) == 0 {
+		return nil
+	}
+	ids := map[int]bool{}
+	for _, broker := range list {
+		id, _, err := ParseBroker(broker)
+		if err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+		if ids[id] {
+			return fmt.Errorf("%s lists broker %d twice", key, id)
+		}
+		ids[id] = true
+	}
+	if !ids[b.Cluster.BrokerID] {
+		return fmt.Errorf("%s must include this broker, id %d", key, b.Cluster.BrokerID)
+	}
+	return nil
+}
+
+// ParseBroker splits an id@host:port entry of cluster.brokers
+func ParseBroker(s string) (id int, addr string, err error) {
+	idStr, addr, found := strings.Cut(s, "@")
+	if !found {
+		return 0, "", fmt.Errorf("broker %q is not id@host:port", s)
+	}
+	if id, err = strconv.Atoi(idStr); err != nil || id < 1 {
+		return 0, "", fmt.Errorf("broker %q has an invalid id", s)
+	}
+	if _, port, err := net.SplitHostPort(addr); err != nil || port == "" {
+		return 0, "", fmt.Errorf("broker %q has an invalid address", s)
+	}
+	return id, addr, nil
+}
+
+// AdvertisedAddr returns the binary listener address other brokers reach this one at
+func (b Broker) AdvertisedAddr() string {
+	if b.Cluster.AdvertisedAddr != "" {
+		return b.Cluster.AdvertisedAddr
+	}
+	_, port, _ := net.SplitHostPort(b.Listeners.Binary)
+	return net.JoinHostPort("localhost", port)
+}
+
+// KafkaPort returns the port of the Kafka listener, advertised to clients
+func (b Broker) KafkaPort() int32 {
+	_, port, _ := net.SplitHostPort(b.Listeners.Kafka)
+	n, _ := strconv.Atoi(port)
+	return int32(n)
+}
+
+// Values returns every setting by its dotted key, formatted like a flag value.
+// Secrets are masked.
+func (b Broker) Values() map[string]string {
+	values := map[string]string{}
+	for _, s := range settings(&b) {
+		values[s.key] = format(s.value)
+		if s.secret && values[s.key] != "" {
+			values[s.key] = "******"
+		}
+	}
+	return values
+}
+
+// EnvName returns the environment variable overriding a dotted key
+func EnvName(key string) string {
+	return "FRANZMQ_" + strings.ToUpper(strings.ReplaceAll(key, ".", "_"))
+}
+
+type setting struct {
+	key    string // section.key from the yaml tags
+	value  reflect.Value
+	secret bool // Tagged secret:"true", hidden by Values
+}
+
+// Walk the sections of b, values are settable and point into b
+func settings(b *Broker) []setting {
+	result := []setting{}
+	root := reflect.ValueOf(b).Elem()
+	for i := 0; i < root.NumField(); i++ {
+		section := root.Field(i)
+		sectionName := root.Type().Field(i).Tag.Get("yaml")
+		for j := 0; j < section.NumField(); j++ {
+			field := section.Type().Field(j)
+			key := sectionName + "." + field.Tag.Get("yaml")
+			result = append(result, setting{key: key, value: section.Field(j), secret: field.Tag.Get("secret") == "true"})
+		}
+	}
+	return result
+}
+
+func set(value reflect.Value, s string) error {
+	switch value.Interface().(type) {
+	case string:
+		value.SetString(s)
+	case int:
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return fmt.Errorf("not an integer: %q", s)
+		}
+		value.SetInt(int64(n))
+	case bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return fmt.Errorf("not a boolean: %q", s)
+		}
+		value.SetBool(b)
+	case []string:
+		dirs := []string{}
+		for _, dir := range strings.Split(s, ",") {
+			if dir = strings.TrimSpace(dir); dir != "" {
+				dirs = append(dirs, dir)
+			}
+		}
+		value.Set(reflect.ValueOf(dirs))
+	case time.Duration:
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return fmt.Errorf("not a duration: %q", s)
+		}
+		value.SetInt(int64(d))
+	default:
+		return fmt.Errorf("unsupported setting type %s", value.Type())
+	}
+	return nil
+}
+
+func format(value reflect.Value) string {
+	if list, isList := value.Interface().([]string); isList {
+		return strings.Join(list, ",")
+	}
+	return fmt.Sprint(value.Interface())
+}
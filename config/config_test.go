@@ -0,0 +1,83 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLoad_Precedence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "franzmq.yaml")
+	file := "listeners:\n  http: \":8081\"\n  binary: \":9190\"\nproducer:\n  writer_batch_size: 50\n  writer_flush_interval: 5ms\n"
+	if err := os.WriteFile(path, []byte(file), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("FRANZMQ_LISTENERS_BINARY", ":9290")
+	t.Setenv("FRANZMQ_PRODUCER_WRITER_BATCH_SIZE", "75")
+
+	b, err := Load([]string{"-config", path, "-producer.writer_batch_size", "100", "-cluster.auto_leader_rebalance", "false"})
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if b.Listeners.HTTP != ":8081" {
+		t.Errorf("Expected the file to set listeners.http, got %q", b.Listeners.HTTP)
+	}
+	if b.Listeners.Binary != ":9290" {
+		t.Errorf("Expected the environment to override the file, got %q", b.Listeners.Binary)
+	}
+	if b.Producer.WriterBatchSize != 100 {
+		t.Errorf("Expected the flag to override the environment, got %d", b.Producer.WriterBatchSize)
+	}
+	if b.Producer.WriterFlushInterval != 5*time.Millisecond {
+		t.Errorf("Expected a duration from the file, got %s", b.Producer.WriterFlushInterval)
+	}
+	if b.Cluster.AutoLeaderRebalance {
+		t.Errorf("Expected the flag to turn off a boolean")
+	}
+	if b.Storage.DataDir != "./files" || b.KafkaPort() != 9092 {
+		t.Errorf("Expected defaults for unset keys, got %+v", b)
+	}
+	if b.Values()["producer.writer_flush_interval"] != "5ms" {
+		t.Errorf("Unexpected values %v", b.Values())
+	}
+}
+
+func TestValues_MasksSecrets(t *testing.T) {
+	t.Setenv("FRANZMQ_TIERED_S3_SECRET_KEY", "hunter2")
+	b, err := Load([]string{"-tiered.store", "s3", "-tiered.s3_endpoint", "http://minio:9000", "-tiered.s3_bucket", "franzmq"})
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if b.Tiered.S3SecretKey != "hunter2" {
+		t.Errorf("Expected the secret from the environment, got %q", b.Tiered.S3SecretKey)
+	}
+	if value := b.Values()["tiered.s3_secret_key"]; value != "******" {
+		t.Errorf("Expected the secret to be masked, got %q", value)
+	}
+}
+
+func TestLoad_Rejects(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "franzmq.yaml")
+	if err := os.WriteFile(path, []byte("producer:\n  writer_batch_sise: 50\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for name, args := range map[string][]string{
+		"unknown file key":  {"-config", path},
+		"bad address":       {"-listeners.http", "8080"},
+		"zero queue size":   {"-producer.partition_queue_size", "0"},
+		"bad duration":      {"-producer.writer_flush_interval", "soon"},
+		"missing data dir":  {"-storage.data_dir", ""},
+		"unknown backend":   {"-storage.backend", "s3"},
+		"s3 without bucket": {"-tiered.store", "s3", "-tiered.s3_endpoint", "http://minio:9000"},
+		"missing yaml file": {"-config", path + ".missing"},
+		"broker not listed": {"-cluster.broker_id", "3", "-cluster.brokers", "1@localhost:9090,2@localhost:9190"},
+		"bad broker entry":  {"-cluster.brokers", "localhost:9090"},
+		"brokers and etcd":  {"-cluster.brokers", "1@localhost:9090", "-cluster.etcd_endpoints", "localhost:2379"},
+		"quorum without me": {"-cluster.quorum", "2@localhost:9190,3@localhost:9290"},
+	} {
+		if _, err := Load(args); err == nil {
+			t.Errorf("%s: expected Load to fail", name)
+		}
+	}
+}
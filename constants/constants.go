@@ -2,12 +2,25 @@ package constants
 
 import (
 	"FranzMQ/mem_key_generator"
+	"strings"
 
+	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/trace"
 )
 
-const FilesDir = "./files/topics/"
+// Data directories, moved with SetDataDir before the broker starts
+var FilesDir = "./files/topics/"
+var GroupsDir = "./files/groups/"
+var DeletedDir = "./files/deleted/" // Topics waiting for their files to be removed
+
+// SetDataDir places the topic, group and deleted topic directories below dir
+func SetDataDir(dir string) {
+	dir = strings.TrimSuffix(dir, "/") + "/"
+	FilesDir = dir + "topics/"
+	GroupsDir = dir + "groups/"
+	DeletedDir = dir + "deleted/"
+}
 
 var OffsetMap = mem_key_generator.NewSafeMap()
 var LogSizeMap = mem_key_generator.NewSafeMap()
-var Tracer trace.Tracer // Exported variable
+var Tracer trace.Tracer = otel.Tracer("franzmq") // Exported variable
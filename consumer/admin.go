@@ -0,0 +1,101 @@
+package consumer
+
+import (
+	"FranzMQ/constants"
+	"FranzMQ/storage"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strings"
+)
+
+type MemberDescription struct {
+	MemberID   string `json:"member_id"`
+	ClientID   string `json:"client_id"`
+	Assignment []byte `json:"assignment,omitempty"`
+}
+
+type GroupDescription struct {
+	GroupID      string                 `json:"group_id"`
+	State        string                 `json:"state"`
+	Generation   int                    `json:"generation"`
+	ProtocolType string                 `json:"protocol_type"`
+	Protocol     string                 `json:"protocol"`
+	LeaderID     string                 `json:"leader_id"`
+	Members      []MemberDescription    `json:"members"`
+	Offsets      map[string]map[int]int `json:"offsets"` // Committed offsets by topic and partition
+}
+
+// ListGroups returns every group with live members or committed offsets, sorted
+func ListGroups(ctx context.Context) ([]string, error) {
+	_, span := constants.Tracer.Start(ctx, "ListGroups")
+	defer span.End()
+
+	seen := map[string]bool{}
+	groups.Range(func(key, value interface{}) bool {
+		g := value.(*group)
+		g.mu.Lock()
+		if len(g.members) > 0 {
+			seen[key.(string)] = true
+		}
+		g.mu.Unlock()
+		return true
+	})
+
+	entries, err := storage.List(constants.GroupsDir)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("error listing groups: %w", err)
+	}
+	for _, entry := range entries {
+		if name, isOffsets := strings.CutSuffix(entry.Name, ".json"); isOffsets && !entry.Dir {
+			seen[name] = true
+		}
+	}
+
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// DescribeGroup returns the membership and committed offsets of a group
+func DescribeGroup(ctx context.Context, groupID string) (GroupDescription, error) {
+	ctx, span := constants.Tracer.Start(ctx, "DescribeGroup")
+	defer span.End()
+
+	offsets, err := CommittedOffsets(ctx, groupID)
+	if err != nil {
+		return GroupDescription{}, err
+	}
+	desc := GroupDescription{GroupID: groupID, State: GroupEmpty, Members: []MemberDescription{}, Offsets: offsets}
+
+	// Load rather than getGroup, describing must not create the group
+	value, exists := groups.Load(groupID)
+	if !exists {
+		if len(offsets) == 0 {
+			return GroupDescription{}, fmt.Errorf("group %s does not exist", groupID)
+		}
+		return desc, nil
+	}
+
+	g := value.(*group)
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if len(g.members) == 0 && len(offsets) == 0 {
+		return GroupDescription{}, fmt.Errorf("group %s does not exist", groupID)
+	}
+	desc.State = g.state
+	desc.Generation = g.generation
+	desc.ProtocolType = g.protocolType
+	desc.Protocol = g.protocol
+	desc.LeaderID = g.leaderID
+	for _, m := range g.members {
+		desc.Members = append(desc.Members, MemberDescription{MemberID: m.id, ClientID: m.clientID, Assignment: m.assignment})
+	}
+	sort.Slice(desc.Members, func(i, j int) bool { return desc.Members[i].MemberID < desc.Members[j].MemberID })
+	return desc, nil
+}
@@ -0,0 +1,221 @@
+package consumer
+
+import (
+	"FranzMQ/constants"
+	"FranzMQ/producer"
+	"FranzMQ/storage"
+	"FranzMQ/utils"
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultMaxBytes = 1024 * 1024
+	MaxFetchWait    = 30 * time.Second
+)
+
+type FetchRequest struct {
+	Topic     string
+	Partition int
+	Offset    int           // First offset to return
+	MaxBytes  int           // Soft limit, at least one record is always returned
+	MinBytes  int           // Park the request until this many bytes are available
+	MaxWait   time.Duration // Upper bound on how long the request is parked
+	Replica   bool          // Set by followers, which read past the high watermark
+	// Set by followers, the leader epoch of the leader they fetch from
+	LeaderEpoch int
+}
+
+type Record struct {
+	Offset    int             `json:"offset"`
+	Partition int             `json:"partition"`
+	TimeStamp int64           `json:"timestamp"`
+	Message   json.RawMessage `json:"message"`
+	// Set for records produced with a key or headers, by Kafka clients
+	producer.EntryAttributes
+}
+
+// Value returns the bytes the record was produced with
+func (r Record) Value() []byte {
+	return r.EntryAttributes.Value(r.Message)
+}
+
+type FetchResponse struct {
+	Records       []Record `json:"records"`
+	NextOffset    int      `json:"next_offset"`
+	Bytes         int      `json:"bytes"`
+	HighWatermark int      `json:"high_watermark,omitempty"` // Only set for replicated partitions
+	// The leader's in-sync replicas, only set for the fetches of followers
+	InSyncReplicas []int `json:"in_sync_replicas,omitempty"`
+	// The leader's epochs, only set for the fetches of followers
+	LeaderEpochs []LeaderEpoch `json:"leader_epochs,omitempty"`
+}
+
+// LeaderEpoch is the first offset a partition got under a leader epoch
+type LeaderEpoch struct {
+	Epoch       int `json:"epoch"`
+	StartOffset int `json:"start_offset"`
+}
+
+// FetchForwarder serves fetches of partitions this broker holds no replica of
+type FetchForwarder func(ctx context.Context, req FetchRequest) (resp FetchResponse, forwarded bool, err error)
+
+var fetchForwarder FetchForwarder
+
+// SetFetchForwarder installs the forwarder of fetches for partitions held by other brokers
+func SetFetchForwarder(forwarder FetchForwarder) {
+	fetchForwarder = forwarder
+}
+
+// Fetch reads records of a partition starting at the requested offset. When
+// fewer than MinBytes are available it waits for processLogQueue appends to be
+// flushed, up to MaxWait, and then returns whatever it has.
+func Fetch(ctx context.Context, req FetchRequest) (FetchResponse, error) {
+	ctx, span := constants.Tracer.Start(ctx, "Fetch")
+	defer span.End()
+
+	if !utils.FileExists(ctx, req.Topic) {
+		return FetchResponse{}, producer.ErrUnknownTopic
+	}
+	if fetchForwarder != nil {
+		if resp, forwarded, err := fetchForwarder(ctx, req); forwarded {
+			return resp, err
+		}
+	}
+	if !storage.Exists(producer.LogFilePath(req.Topic, req.Partition)) {
+		return FetchResponse{}, fmt.Errorf("%w: %s-%d", producer.ErrUnknownPartition, req.Topic, req.Partition)
+	}
+	if req.MaxBytes <= 0 {
+		req.MaxBytes = DefaultMaxBytes
+	}
+	if req.MaxWait > MaxFetchWait {
+		req.MaxWait = MaxFetchWait
+	}
+
+	timer := time.NewTimer(req.MaxWait)
+	defer timer.Stop()
+
+	for {
+		// Subscribe before reading so an append in between still wakes us up
+		appended := producer.AppendNotifier(req.Topic, req.Partition)
+
+		resp, err := readPartition(ctx, req)
+		if err != nil {
+			return FetchResponse{}, err
+		}
+		if resp.Bytes >= req.MinBytes || req.MaxWait <= 0 {
+			return resp, nil
+		}
+
+		select {
+		case <-appended:
+		case <-timer.C:
+			return resp, nil
+		case <-ctx.Done():
+			return resp, nil
+		}
+	}
+}
+
+// Read records from disk without waiting
+func readPartition(ctx context.Context, req FetchRequest) (FetchResponse, error) {
+	_, span := constants.Tracer.Start(ctx, "readPartition")
+	defer span.End()
+
+	resp := FetchResponse{Records: []Record{}, NextOffset: req.Offset}
+
+	// Consumers only see what every in-sync replica has
+	highWatermark, capped := producer.HighWatermark(ctx, req.Topic, req.Partition)
+	if capped {
+		resp.HighWatermark = highWatermark
+	}
+
+	position, err := findPosition(producer.IndexFilePath(req.Topic, req.Partition), req.Offset)
+	if err != nil {
+		return resp, err
+	}
+	// Older segments may be gone to retention, read on from the oldest one kept
+	position = max(position, producer.LogStart(req.Topic, req.Partition))
+
+	reader := bufio.NewReader(producer.OpenLog(ctx, req.Topic, req.Partition, position))
+	for resp.Bytes < req.MaxBytes {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			break // EOF or a partially flushed entry, pick it up on the next fetch
+		}
+		record, err := parseLogEntry(line)
+		if err != nil {
+			return resp, err
+		}
+		if record.Offset < req.Offset {
+			continue // Index lagged behind the log
+		}
+		if capped && !req.Replica && record.Offset >= highWatermark {
+			break
+		}
+		if len(resp.Records) > 0 && resp.Bytes+len(line) > req.MaxBytes {
+			break
+		}
+		resp.Records = append(resp.Records, record)
+		resp.Bytes += len(line)
+		resp.NextOffset = record.Offset + 1
+	}
+	return resp, nil
+}
+
+// Find the byte position of the last indexed entry before offset
+func findPosition(indexPath string, offset int) (int64, error) {
+	if !storage.Exists(indexPath) {
+		return 0, nil
+	}
+
+	var position int64
+	scanner := bufio.NewScanner(storage.NewReader(indexPath, 0))
+	for scanner.Scan() {
+		// timestamp--start--end--offset
+		parts := strings.Split(scanner.Text(), "--")
+		if len(parts) != 4 {
+			continue
+		}
+		end, endErr := strconv.ParseInt(parts[2], 10, 64)
+		entryOffset, offsetErr := strconv.Atoi(parts[3])
+		if endErr != nil || offsetErr != nil {
+			continue // Header line
+		}
+		if entryOffset >= offset {
+			break
+		}
+		position = end
+	}
+	return position, scanner.Err()
+}
+
+// Parse a "timestamp--partition--offset--message" log line
+func parseLogEntry(line string) (Record, error) {
+	parts := strings.SplitN(strings.TrimSuffix(line, "\n"), "--", 4)
+	if len(parts) != 4 {
+		return Record{}, fmt.Errorf("malformed log entry: %q", line)
+	}
+	timeStamp, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return Record{}, fmt.Errorf("malformed log entry timestamp: %w", err)
+	}
+	partition, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return Record{}, fmt.Errorf("malformed log entry partition: %w", err)
+	}
+	offset, err := strconv.Atoi(parts[2])
+	if err != nil {
+		return Record{}, fmt.Errorf("malformed log entry offset: %w", err)
+	}
+	message, attributes, err := producer.SplitEntry(parts[3])
+	if err != nil {
+		return Record{}, err
+	}
+	return Record{Offset: offset, Partition: partition, TimeStamp: timeStamp, Message: message, EntryAttributes: attributes}, nil
+}
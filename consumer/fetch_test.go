@@ -0,0 +1,117 @@
+package consumer
+
+import (
+	"FranzMQ/constants"
+	"FranzMQ/producer"
+	"FranzMQ/storage"
+	"context"
+	"encoding/json"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func init() {
+	storage.SetBackend(storage.NewMemoryBackend())
+	go producer.GlobalWriterThread(producer.GlobalLogWriterQueue)
+	go producer.GlobalWriterThread(producer.GlobalIndexWriterQueue)
+}
+
+func setupTestTopic(topic string, numOfPartition int) {
+	storage.MkdirAll(constants.FilesDir + topic + "/meta")
+	storage.MkdirAll(constants.FilesDir + topic + "/index")
+	configData, _ := json.Marshal(map[string]interface{}{"NumOfPartition": numOfPartition})
+	storage.WriteFile(constants.FilesDir+topic+"/"+topic+".json", configData)
+	for i := 0; i < numOfPartition; i++ {
+		storage.WriteFile(constants.FilesDir+topic+"/"+topic+"-"+strconv.Itoa(i)+".log", []byte(""))
+		storage.WriteFile(constants.FilesDir+topic+"/index/"+topic+"-"+strconv.Itoa(i)+".index", []byte("timestamp--start--end--offset\n"))
+	}
+}
+
+func teardownTestTopic(topic string) {
+	storage.RemoveAll(constants.FilesDir + topic)
+}
+
+func TestFetch_ReturnsProducedMessages(t *testing.T) {
+	topic := "fetch_test"
+	setupTestTopic(topic, 1)
+	defer teardownTestTopic(topic)
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		if _, _, err := producer.ProduceMessage(ctx, topic, "key", "msg-"+strconv.Itoa(i)); err != nil {
+			t.Fatalf("produce failed: %v", err)
+		}
+	}
+
+	resp, err := Fetch(ctx, FetchRequest{Topic: topic, Partition: 0, Offset: 2, MinBytes: 1, MaxWait: time.Second})
+	if err != nil {
+		t.Fatalf("fetch failed: %v", err)
+	}
+	if len(resp.Records) != 2 {
+		t.Fatalf("Expected 2 records from offset 2 but got %d", len(resp.Records))
+	}
+	if resp.Records[0].Offset != 2 || string(resp.Records[0].Message) != `"msg-1"` {
+		t.Errorf("Unexpected first record: %+v", resp.Records[0])
+	}
+	if resp.NextOffset != 4 {
+		t.Errorf("Expected next offset 4 but got %d", resp.NextOffset)
+	}
+}
+
+func TestFetch_LongPollWakesOnAppend(t *testing.T) {
+	topic := "fetch_long_poll_test"
+	setupTestTopic(topic, 1)
+	defer teardownTestTopic(topic)
+	ctx := context.Background()
+
+	done := make(chan FetchResponse, 1)
+	go func() {
+		resp, _ := Fetch(ctx, FetchRequest{Topic: topic, Partition: 0, MinBytes: 1, MaxWait: 5 * time.Second})
+		done <- resp
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	start := time.Now()
+	producer.ProduceMessage(ctx, topic, "key", "late message")
+
+	select {
+	case resp := <-done:
+		if len(resp.Records) != 1 {
+			t.Fatalf("Expected 1 record but got %d", len(resp.Records))
+		}
+		if time.Since(start) > 2*time.Second {
+			t.Errorf("Fetch was not woken by the append")
+		}
+	case <-time.After(6 * time.Second):
+		t.Fatalf("Fetch never returned")
+	}
+}
+
+func TestFetch_MaxWaitExpires(t *testing.T) {
+	topic := "fetch_timeout_test"
+	setupTestTopic(topic, 1)
+	defer teardownTestTopic(topic)
+
+	start := time.Now()
+	resp, err := Fetch(context.Background(), FetchRequest{Topic: topic, Partition: 0, MinBytes: 1, MaxWait: 100 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("fetch failed: %v", err)
+	}
+	if len(resp.Records) != 0 {
+		t.Errorf("Expected no records but got %d", len(resp.Records))
+	}
+	if time.Since(start) < 100*time.Millisecond {
+		t.Errorf("Fetch returned before max wait elapsed")
+	}
+}
+
+func TestFetch_UnknownPartition(t *testing.T) {
+	topic := "fetch_partition_test"
+	setupTestTopic(topic, 1)
+	defer teardownTestTopic(topic)
+
+	if _, err := Fetch(context.Background(), FetchRequest{Topic: topic, Partition: 3}); err == nil {
+		t.Errorf("Expected error for unknown partition")
+	}
+}
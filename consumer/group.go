@@ -0,0 +1,507 @@
+package consumer
+
+import (
+	"FranzMQ/constants"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Group states
+const (
+	GroupEmpty               = "Empty"
+	GroupPreparingRebalance  = "PreparingRebalance"
+	GroupCompletingRebalance = "CompletingRebalance"
+	GroupStable              = "Stable"
+)
+
+var (
+	ErrUnknownMemberID      = errors.New("unknown member id")
+	ErrIllegalGeneration    = errors.New("illegal generation")
+	ErrRebalanceInProgress  = errors.New("rebalance in progress")
+	ErrInconsistentProtocol = errors.New("inconsistent group protocol")
+	ErrInvalidGroupID       = errors.New("invalid group id")
+)
+
+// Longest group id accepted, group ids name the files offsets are kept in
+const maxGroupIDLength = 249
+
+const (
+	sessionCheckInterval  = time.Second
+	defaultSessionTimeout = 10 * time.Second
+)
+
+// GroupProtocol is an assignment strategy a member supports, Metadata is
+// opaque to the coordinator and handed to the group leader as is
+type GroupProtocol struct {
+	Name     string
+	Metadata []byte
+}
+
+type JoinGroupRequest struct {
+	GroupID          string
+	MemberID         string // Empty for a member joining for the first time
+	ClientID         string
+	ProtocolType     string
+	SessionTimeout   time.Duration
+	RebalanceTimeout time.Duration
+	Protocols        []GroupProtocol
+}
+
+type GroupMember struct {
+	MemberID string `json:"member_id"`
+	ClientID string `json:"client_id"`
+	Metadata []byte `json:"metadata,omitempty"`
+}
+
+type JoinGroupResponse struct {
+	Generation int           `json:"generation"`
+	Protocol   string        `json:"protocol"`
+	LeaderID   string        `json:"leader_id"`
+	MemberID   string        `json:"member_id"`
+	Members    []GroupMember `json:"members"` // Only filled in for the leader, which computes the assignment
+}
+
+type joinResult struct {
+	resp JoinGroupResponse
+	err  error
+}
+
+type syncResult struct {
+	assignment []byte
+	err        error
+}
+
+type member struct {
+	id               string
+	clientID         string
+	protocols        []GroupProtocol
+	sessionTimeout   time.Duration
+	rebalanceTimeout time.Duration
+	lastHeartbeat    time.Time
+	assignment       []byte
+	joinCh           chan joinResult // Set while the member waits for the join phase to finish
+}
+
+// group runs the join/sync rebalance protocol: every member (re)joins, the
+// leader gets everyone's metadata and sends back an assignment per member
+// through SyncGroup, after which the group is stable until membership changes.
+type group struct {
+	mu             sync.Mutex
+	id             string
+	state          string
+	generation     int
+	protocolType   string
+	protocol       string
+	leaderID       string
+	members        map[string]*member
+	syncWaiters    map[string]chan syncResult
+	rebalanceTimer *time.Timer
+}
+
+var (
+	groups      sync.Map // Key: groupID, Value: *group
+	sessionOnce sync.Once
+)
+
+func getGroup(groupID string) *group {
+	sessionOnce.Do(func() { go expireSessions() })
+	actual, _ := groups.LoadOrStore(groupID, &group{
+		id:          groupID,
+		state:       GroupEmpty,
+		members:     make(map[string]*member),
+		syncWaiters: make(map[string]chan syncResult),
+	})
+	return actual.(*group)
+}
+
+// JoinGroup adds a member to the group and blocks until the rebalance it
+// triggers has collected every known member or timed out
+func JoinGroup(ctx context.Context, req JoinGroupRequest) (JoinGroupResponse, error) {
+	_, span := constants.Tracer.Start(ctx, "JoinGroup")
+	defer span.End()
+
+	if err := ValidateGroupID(req.GroupID); err != nil {
+		return JoinGroupResponse{}, err
+	}
+	if len(req.Protocols) == 0 {
+		return JoinGroupResponse{}, ErrInconsistentProtocol
+	}
+	if req.SessionTimeout <= 0 {
+		req.SessionTimeout = defaultSessionTimeout
+	}
+	if req.RebalanceTimeout <= 0 {
+		req.RebalanceTimeout = req.SessionTimeout
+	}
+
+	g := getGroup(req.GroupID)
+	g.mu.Lock()
+	if len(g.members) > 0 && g.protocolType != req.ProtocolType {
+		g.mu.Unlock()
+		return JoinGroupResponse{}, ErrInconsistentProtocol
+	}
+
+	m, exists := g.members[req.MemberID]
+	if req.MemberID != "" && !exists {
+		g.mu.Unlock()
+		return JoinGroupResponse{}, ErrUnknownMemberID
+	}
+	if !exists {
+		m = &member{id: req.ClientID + "-" + uuid.NewString()}
+		g.members[m.id] = m
+		log.Println("Member", m.id, "joining group", g.id)
+	}
+	m.clientID = req.ClientID
+	m.protocols = req.Protocols
+	m.sessionTimeout = req.SessionTimeout
+	m.rebalanceTimeout = req.RebalanceTimeout
+	m.lastHeartbeat = time.Now()
+	ch := make(chan joinResult, 1)
+	m.joinCh = ch
+	g.protocolType = req.ProtocolType
+
+	if g.state != GroupPreparingRebalance {
+		g.prepareRebalance()
+	}
+	g.maybeCompleteJoin()
+	g.mu.Unlock()
+
+	select {
+	case result := <-ch:
+		return result.resp, result.err
+	case <-ctx.Done():
+		return JoinGroupResponse{}, ctx.Err()
+	}
+}
+
+// SyncGroup hands the leader's assignment to every member. Followers block
+// until the leader has synced.
+func SyncGroup(ctx context.Context, groupID string, generation int, memberID string, assignments map[string][]byte) ([]byte, error) {
+	_, span := constants.Tracer.Start(ctx, "SyncGroup")
+	defer span.End()
+
+	g := getGroup(groupID)
+	g.mu.Lock()
+	m, exists := g.members[memberID]
+	if !exists {
+		g.mu.Unlock()
+		return nil, ErrUnknownMemberID
+	}
+	if generation != g.generation {
+		g.mu.Unlock()
+		return nil, ErrIllegalGeneration
+	}
+
+	switch g.state {
+	case GroupPreparingRebalance:
+		g.mu.Unlock()
+		return nil, ErrRebalanceInProgress
+	case GroupStable:
+		assignment := m.assignment
+		g.mu.Unlock()
+		return assignment, nil
+	}
+
+	if memberID == g.leaderID {
+		for id, mm := range g.members {
+			mm.assignment = assignments[id]
+		}
+		g.state = GroupStable
+		for id, waiter := range g.syncWaiters {
+			waiter <- syncResult{assignment: g.members[id].assignment}
+		}
+		g.syncWaiters = make(map[string]chan syncResult)
+		log.Println("Group", g.id, "stable at generation", g.generation, "with", len(g.members), "members")
+		assignment := m.assignment
+		g.mu.Unlock()
+		return assignment, nil
+	}
+
+	ch := make(chan syncResult, 1)
+	g.syncWaiters[memberID] = ch
+	g.mu.Unlock()
+
+	select {
+	case result := <-ch:
+		return result.assignment, result.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Heartbeat keeps a member's session alive and tells it when to rejoin
+func Heartbeat(ctx context.Context, groupID string, generation int, memberID string) error {
+	_, span := constants.Tracer.Start(ctx, "Heartbeat")
+	defer span.End()
+
+	g := getGroup(groupID)
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	m, exists := g.members[memberID]
+	if !exists {
+		return ErrUnknownMemberID
+	}
+	m.lastHeartbeat = time.Now()
+	if g.state == GroupPreparingRebalance {
+		return ErrRebalanceInProgress
+	}
+	if generation != g.generation {
+		return ErrIllegalGeneration
+	}
+	return nil
+}
+
+// LeaveGroup removes a member and rebalances the rest of the group
+func LeaveGroup(ctx context.Context, groupID string, memberID string) error {
+	_, span := constants.Tracer.Start(ctx, "LeaveGroup")
+	defer span.End()
+
+	g := getGroup(groupID)
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if _, exists := g.members[memberID]; !exists {
+		return ErrUnknownMemberID
+	}
+	log.Println("Member", memberID, "leaving group", g.id)
+	g.removeMember(memberID)
+	return nil
+}
+
+// ValidateGeneration checks a member belongs to the current generation, used
+// to fence offset commits from members that were rebalanced out. Generation -1
+// commits come from consumers that do not use group membership.
+func ValidateGeneration(groupID string, generation int, memberID string) error {
+	if generation < 0 && memberID == "" {
+		return nil
+	}
+
+	g := getGroup(groupID)
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if _, exists := g.members[memberID]; !exists {
+		return ErrUnknownMemberID
+	}
+	if generation != g.generation {
+		return ErrIllegalGeneration
+	}
+	if g.state == GroupPreparingRebalance {
+		return ErrRebalanceInProgress
+	}
+	return nil
+}
+
+// RebalanceGroups makes every group with members rejoin, for when the
+// partitions of a topic change. Subscriptions are opaque to the coordinator,
+// so it cannot tell which groups read the topic.
+func RebalanceGroups(ctx context.Context) {
+	_, span := constants.Tracer.Start(ctx, "RebalanceGroups")
+	defer span.End()
+
+	groups.Range(func(_, value interface{}) bool {
+		g := value.(*group)
+		g.mu.Lock()
+		if len(g.members) > 0 && g.state != GroupPreparingRebalance {
+			log.Println("Rebalancing group", g.id, "after a partition change")
+			g.prepareRebalance()
+		}
+		g.mu.Unlock()
+		return true
+	})
+}
+
+// ValidateGroupID checks a group id before it reaches storage: 1 to 249
+// letters, digits, '.', '_' or '-', and not "." or ".."
+func ValidateGroupID(groupID string) error {
+	if groupID == "" || groupID == "." || groupID == ".." || len(groupID) > maxGroupIDLength {
+		return fmt.Errorf("%w: %q", ErrInvalidGroupID, groupID)
+	}
+	for _, c := range groupID {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '.' || c == '_' || c == '-') {
+			return fmt.Errorf("%w: %q may only contain letters, digits, '.', '_' and '-'", ErrInvalidGroupID, groupID)
+		}
+	}
+	return nil
+}
+
+// Start a new rebalance, members in the middle of a sync have to rejoin.
+// Must be called with g.mu held.
+func (g *group) prepareRebalance() {
+	g.state = GroupPreparingRebalance
+	for id, waiter := range g.syncWaiters {
+		waiter <- syncResult{err: ErrRebalanceInProgress}
+		delete(g.syncWaiters, id)
+	}
+
+	timeout := time.Duration(0)
+	for _, m := range g.members {
+		timeout = max(timeout, m.rebalanceTimeout)
+	}
+	if g.rebalanceTimer != nil {
+		g.rebalanceTimer.Stop()
+	}
+	generation := g.generation
+	g.rebalanceTimer = time.AfterFunc(timeout, func() {
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		if g.state == GroupPreparingRebalance && g.generation == generation {
+			g.completeJoin() // Whoever did not rejoin in time is dropped
+		}
+	})
+}
+
+// Must be called with g.mu held
+func (g *group) maybeCompleteJoin() {
+	for _, m := range g.members {
+		if m.joinCh == nil {
+			return
+		}
+	}
+	g.completeJoin()
+}
+
+// Close the join phase: drop members that did not rejoin, pick a protocol
+// every member supports and a leader, and answer all pending joins.
+// Must be called with g.mu held.
+func (g *group) completeJoin() {
+	if g.rebalanceTimer != nil {
+		g.rebalanceTimer.Stop()
+		g.rebalanceTimer = nil
+	}
+	for id, m := range g.members {
+		if m.joinCh == nil {
+			log.Println("Member", id, "did not rejoin group", g.id, "in time")
+			delete(g.members, id)
+		}
+	}
+
+	g.generation++
+	if len(g.members) == 0 {
+		g.state = GroupEmpty
+		g.leaderID = ""
+		g.protocol = ""
+		return
+	}
+
+	ids := make([]string, 0, len(g.members))
+	for id := range g.members {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	if _, exists := g.members[g.leaderID]; !exists {
+		g.leaderID = ids[0]
+	}
+
+	g.protocol = g.selectProtocol()
+	if g.protocol == "" {
+		for _, m := range g.members {
+			m.joinCh <- joinResult{err: ErrInconsistentProtocol}
+			m.joinCh = nil
+		}
+		g.members = make(map[string]*member)
+		g.state = GroupEmpty
+		return
+	}
+
+	members := make([]GroupMember, 0, len(ids))
+	for _, id := range ids {
+		m := g.members[id]
+		members = append(members, GroupMember{MemberID: id, ClientID: m.clientID, Metadata: m.protocolMetadata(g.protocol)})
+	}
+
+	g.state = GroupCompletingRebalance
+	for id, m := range g.members {
+		resp := JoinGroupResponse{Generation: g.generation, Protocol: g.protocol, LeaderID: g.leaderID, MemberID: id, Members: []GroupMember{}}
+		if id == g.leaderID {
+			resp.Members = members
+		}
+		m.lastHeartbeat = time.Now()
+		m.joinCh <- joinResult{resp: resp}
+		m.joinCh = nil
+	}
+}
+
+// First protocol of the leader that all members support
+func (g *group) selectProtocol() string {
+	for _, candidate := range g.members[g.leaderID].protocols {
+		supported := true
+		for _, m := range g.members {
+			if m.protocolMetadata(candidate.Name) == nil {
+				supported = false
+				break
+			}
+		}
+		if supported {
+			return candidate.Name
+		}
+	}
+	return ""
+}
+
+func (m *member) protocolMetadata(name string) []byte {
+	for _, p := range m.protocols {
+		if p.Name == name {
+			if p.Metadata == nil {
+				return []byte{}
+			}
+			return p.Metadata
+		}
+	}
+	return nil
+}
+
+// Must be called with g.mu held
+func (g *group) removeMember(memberID string) {
+	m := g.members[memberID]
+	if m.joinCh != nil {
+		m.joinCh <- joinResult{err: ErrUnknownMemberID}
+	}
+	if waiter, exists := g.syncWaiters[memberID]; exists {
+		waiter <- syncResult{err: ErrUnknownMemberID}
+		delete(g.syncWaiters, memberID)
+	}
+	delete(g.members, memberID)
+
+	if len(g.members) == 0 {
+		if g.rebalanceTimer != nil {
+			g.rebalanceTimer.Stop()
+			g.rebalanceTimer = nil
+		}
+		g.state = GroupEmpty
+		g.leaderID = ""
+		g.generation++
+		return
+	}
+	if g.state != GroupPreparingRebalance {
+		g.prepareRebalance()
+	}
+	g.maybeCompleteJoin()
+}
+
+// Drop members whose session timed out without a heartbeat
+func expireSessions() {
+	ticker := time.NewTicker(sessionCheckInterval)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		groups.Range(func(_, value interface{}) bool {
+			g := value.(*group)
+			g.mu.Lock()
+			for id, m := range g.members {
+				if m.joinCh == nil && m.sessionTimeout > 0 && now.Sub(m.lastHeartbeat) > m.sessionTimeout {
+					log.Println("Member", id, "of group", g.id, "session expired")
+					g.removeMember(id)
+				}
+			}
+			g.mu.Unlock()
+			return true
+		})
+	}
+}
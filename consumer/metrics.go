@@ -0,0 +1,49 @@
+package consumer
+
+import (
+	"FranzMQ/metrics"
+	"FranzMQ/producer"
+	"FranzMQ/storage"
+	"context"
+	"strconv"
+)
+
+func init() {
+	metrics.RegisterGauges("franzmq_group_lag", "Records of a partition a group has not committed yet, up to the high watermark",
+		[]string{"group", "topic", "partition"}, groupLags)
+}
+
+func groupLags() []metrics.Sample {
+	ctx := context.Background()
+	groupIDs, err := ListGroups(ctx)
+	if err != nil {
+		return nil
+	}
+	samples := []metrics.Sample{}
+	for _, groupID := range groupIDs {
+		offsets, err := CommittedOffsets(ctx, groupID)
+		if err != nil {
+			continue
+		}
+		for topicName, partitions := range offsets {
+			if !storage.Exists(storage.ConfigPath(topicName)) {
+				continue // Offsets outlive deleted topics
+			}
+			for partition, committed := range partitions {
+				// Scrapes only read what is cached, partitions not loaded yet are left out
+				end, loaded := producer.CachedNextOffset(ctx, topicName, partition)
+				if !loaded {
+					continue
+				}
+				if hw, capped := producer.HighWatermark(ctx, topicName, partition); capped {
+					end = hw
+				}
+				samples = append(samples, metrics.Sample{
+					Labels: []string{groupID, topicName, strconv.Itoa(partition)},
+					Value:  float64(max(end-committed, 0)),
+				})
+			}
+		}
+	}
+	return samples
+}
@@ -0,0 +1,51 @@
+package consumer
+
+import (
+	"FranzMQ/producer"
+	"context"
+	"strconv"
+	"testing"
+)
+
+func TestGroupLags_UpToTheEndOfThePartition(t *testing.T) {
+	topic := "lag_test"
+	setupTestTopic(topic, 2)
+	defer teardownTestTopic(topic)
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		if _, _, err := producer.ProduceToPartition(ctx, topic, 0, "msg-"+strconv.Itoa(i)); err != nil {
+			t.Fatalf("produce failed: %v", err)
+		}
+	}
+	if _, _, err := producer.ProduceToPartition(ctx, topic, 1, "msg-3"); err != nil {
+		t.Fatalf("produce failed: %v", err)
+	}
+	if err := CommitOffset(ctx, "lag_group", topic, 0, 2); err != nil {
+		t.Fatalf("commit failed: %v", err)
+	}
+	if err := CommitOffset(ctx, "lag_group", topic, 1, 2); err != nil {
+		t.Fatalf("commit failed: %v", err)
+	}
+	// Offsets of deleted topics are left out, and partitions a scrape would
+	// have to load first
+	if err := CommitOffset(ctx, "lag_group", "lag_deleted_test", 0, 1); err != nil {
+		t.Fatalf("commit failed: %v", err)
+	}
+	setupTestTopic("lag_unloaded_test", 1)
+	defer teardownTestTopic("lag_unloaded_test")
+	if err := CommitOffset(ctx, "lag_group", "lag_unloaded_test", 0, 1); err != nil {
+		t.Fatalf("commit failed: %v", err)
+	}
+
+	lags := map[string]float64{}
+	for _, sample := range groupLags() {
+		if sample.Labels[0] == "lag_group" {
+			lags[sample.Labels[1]+"-"+sample.Labels[2]] = sample.Value
+		}
+	}
+	expected := map[string]float64{topic + "-0": 2, topic + "-1": 0}
+	if len(lags) != len(expected) || lags[topic+"-0"] != 2 || lags[topic+"-1"] != 0 {
+		t.Errorf("Expected lags %v but got %v", expected, lags)
+	}
+}
@@ -0,0 +1,233 @@
+package consumer
+
+import (
+	"FranzMQ/constants"
+	"FranzMQ/producer"
+	"FranzMQ/storage"
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Committed offsets of one consumer group, persisted to <group>.json
+type groupOffsets struct {
+	mu      sync.Mutex
+	loaded  bool
+	offsets map[string]int // Key: topic-partition
+}
+
+var committedOffsets sync.Map // Key: groupID, Value: *groupOffsets
+
+// CommitOffset stores the next offset a consumer group will read from a partition
+func CommitOffset(ctx context.Context, groupID, topicName string, partition, offset int) error {
+	_, span := constants.Tracer.Start(ctx, "CommitOffset")
+	defer span.End()
+
+	group, err := loadGroupOffsets(groupID)
+	if err != nil {
+		return err
+	}
+	defer group.mu.Unlock()
+
+	group.offsets[topicName+"-"+strconv.Itoa(partition)] = offset
+	return saveGroupOffsets(groupID, group.offsets)
+}
+
+// CommittedOffset returns the committed offset of a group, false when nothing was committed yet
+func CommittedOffset(ctx context.Context, groupID, topicName string, partition int) (int, bool, error) {
+	_, span := constants.Tracer.Start(ctx, "CommittedOffset")
+	defer span.End()
+
+	group, err := loadGroupOffsets(groupID)
+	if err != nil {
+		return 0, false, err
+	}
+	defer group.mu.Unlock()
+
+	offset, exists := group.offsets[topicName+"-"+strconv.Itoa(partition)]
+	return offset, exists, nil
+}
+
+// CommittedOffsets returns every committed offset of a group keyed by topic and partition
+func CommittedOffsets(ctx context.Context, groupID string) (map[string]map[int]int, error) {
+	_, span := constants.Tracer.Start(ctx, "CommittedOffsets")
+	defer span.End()
+
+	group, err := loadGroupOffsets(groupID)
+	if err != nil {
+		return nil, err
+	}
+	defer group.mu.Unlock()
+
+	result := make(map[string]map[int]int)
+	for key, offset := range group.offsets {
+		// Partition is always the part after the last dash, topic names may contain dashes
+		idx := strings.LastIndex(key, "-")
+		partition, err := strconv.Atoi(key[idx+1:])
+		if idx < 0 || err != nil {
+			continue
+		}
+		topicName := key[:idx]
+		if result[topicName] == nil {
+			result[topicName] = make(map[int]int)
+		}
+		result[topicName][partition] = offset
+	}
+	return result, nil
+}
+
+// OffsetForTimestamp finds the first offset of a partition whose record was
+// appended at or after timestamp (unix nanoseconds). found is false when every
+// record is older.
+func OffsetForTimestamp(ctx context.Context, topicName string, partition int, timestamp int64) (offset int, recordTimestamp int64, found bool, err error) {
+	_, span := constants.Tracer.Start(ctx, "OffsetForTimestamp")
+	defer span.End()
+
+	indexPath := producer.IndexFilePath(topicName, partition)
+	if !storage.Exists(indexPath) {
+		return 0, 0, false, fmt.Errorf("partition %d does not exist for topic %s", partition, topicName)
+	}
+
+	scanner := bufio.NewScanner(storage.NewReader(indexPath, 0))
+	for scanner.Scan() {
+		// timestamp--start--end--offset
+		parts := strings.Split(scanner.Text(), "--")
+		if len(parts) != 4 {
+			continue
+		}
+		entryTimestamp, tsErr := strconv.ParseInt(parts[0], 10, 64)
+		entryOffset, offsetErr := strconv.Atoi(parts[3])
+		if tsErr != nil || offsetErr != nil {
+			continue // Header line
+		}
+		if entryTimestamp >= timestamp {
+			return entryOffset, entryTimestamp, true, nil
+		}
+	}
+	return 0, 0, false, scanner.Err()
+}
+
+// EarliestOffset returns the first offset still present in a partition's log
+func EarliestOffset(ctx context.Context, topicName string, partition int) (int, error) {
+	_, span := constants.Tracer.Start(ctx, "EarliestOffset")
+	defer span.End()
+
+	logPath := producer.LogFilePath(topicName, partition)
+	if !storage.Exists(logPath) {
+		return 0, fmt.Errorf("partition %d does not exist for topic %s", partition, topicName)
+	}
+
+	if segments := producer.Segments(topicName, partition); len(segments) > 0 {
+		return segments[0].FirstOffset, nil
+	}
+	line, err := bufio.NewReader(storage.NewReader(logPath, 0)).ReadString('\n')
+	if err != nil {
+		// No closed segment and nothing flushed yet: a new partition whose first
+		// writes are still buffered, or one truncated back to its start
+		return 1, nil
+	}
+	record, err := parseLogEntry(line)
+	if err != nil {
+		return 0, err
+	}
+	return record.Offset, nil
+}
+
+// LatestOffset returns the offset the next produced message of a partition
+// will get, for replicated partitions the high watermark
+func LatestOffset(ctx context.Context, topicName string, partition int) (int, error) {
+	ctx, span := constants.Tracer.Start(ctx, "LatestOffset")
+	defer span.End()
+
+	if !storage.Exists(producer.LogFilePath(topicName, partition)) {
+		return 0, fmt.Errorf("partition %d does not exist for topic %s", partition, topicName)
+	}
+	if highWatermark, capped := producer.HighWatermark(ctx, topicName, partition); capped {
+		return highWatermark, nil
+	}
+	return producer.NextOffset(ctx, topicName, partition), nil
+}
+
+// Load a group's offsets from disk on first use, returns it locked
+func loadGroupOffsets(groupID string) (*groupOffsets, error) {
+	if err := ValidateGroupID(groupID); err != nil {
+		return nil, err
+	}
+	actual, _ := committedOffsets.LoadOrStore(groupID, &groupOffsets{offsets: make(map[string]int)})
+	group := actual.(*groupOffsets)
+	group.mu.Lock()
+	if group.loaded {
+		return group, nil
+	}
+
+	data, err := storage.ReadFile(constants.GroupsDir + groupID + ".json")
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		group.mu.Unlock()
+		return nil, fmt.Errorf("error reading committed offsets: %w", err)
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, &group.offsets); err != nil {
+			group.mu.Unlock()
+			return nil, fmt.Errorf("error decoding committed offsets: %w", err)
+		}
+	}
+	group.loaded = true
+	return group, nil
+}
+
+// Persist a group's offsets, storage replaces the file atomically so a crash never leaves half a file
+func saveGroupOffsets(groupID string, offsets map[string]int) error {
+	if err := ValidateGroupID(groupID); err != nil {
+		return err
+	}
+	jsonData, err := json.MarshalIndent(offsets, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding committed offsets: %w", err)
+	}
+	if err := storage.WriteFile(constants.GroupsDir+groupID+".json", jsonData); err != nil {
+		return fmt.Errorf("error writing committed offsets: %w", err)
+	}
+	return nil
+}
+
+// RemoveTopicOffsets drops the committed offsets every group holds for a
+// deleted topic, so a topic recreated under the same name starts clean
+func RemoveTopicOffsets(ctx context.Context, topicName string) error {
+	ctx, span := constants.Tracer.Start(ctx, "RemoveTopicOffsets")
+	defer span.End()
+
+	groupIDs, err := ListGroups(ctx)
+	if err != nil {
+		return err
+	}
+	for _, groupID := range groupIDs {
+		group, err := loadGroupOffsets(groupID)
+		if err != nil {
+			return err
+		}
+		changed := false
+		for key := range group.offsets {
+			// Key is topic-partition, check the rest is only the partition so "a" does not match "a-b-0"
+			if rest, found := strings.CutPrefix(key, topicName+"-"); found {
+				if _, err := strconv.Atoi(rest); err == nil {
+					delete(group.offsets, key)
+					changed = true
+				}
+			}
+		}
+		if changed {
+			err = saveGroupOffsets(groupID, group.offsets)
+		}
+		group.mu.Unlock()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
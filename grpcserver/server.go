@@ -0,0 +1,229 @@
+// Package grpcserver implements the gRPC services defined in api/franzmq.proto
+// on top of the topic, producer and consumer packages, and the HTTP/JSON
+// gateway generated from the same definition.
+package grpcserver
+
+import (
+	"FranzMQ/api"
+	"FranzMQ/constants"
+	"FranzMQ/consumer"
+	"FranzMQ/producer"
+	"FranzMQ/topic"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+const consumeWaitInterval = 15 * time.Second
+
+type Server struct {
+	api.UnimplementedTopicAdminServer
+	api.UnimplementedProducerServer
+	api.UnimplementedConsumerServer
+}
+
+// NewServer returns a gRPC server with all FranzMQ services registered
+func NewServer(opts ...grpc.ServerOption) *grpc.Server {
+	grpcServer := grpc.NewServer(opts...)
+	srv := &Server{}
+	api.RegisterTopicAdminServer(grpcServer, srv)
+	api.RegisterProducerServer(grpcServer, srv)
+	api.RegisterConsumerServer(grpcServer, srv)
+	return grpcServer
+}
+
+// NewGateway returns an HTTP handler serving the REST mapping of the services
+// by proxying to the gRPC server at grpcAddr
+func NewGateway(ctx context.Context, grpcAddr string) (http.Handler, error) {
+	mux := runtime.NewServeMux()
+	opts := []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}
+	if err := api.RegisterTopicAdminHandlerFromEndpoint(ctx, mux, grpcAddr, opts); err != nil {
+		return nil, err
+	}
+	if err := api.RegisterProducerHandlerFromEndpoint(ctx, mux, grpcAddr, opts); err != nil {
+		return nil, err
+	}
+	if err := api.RegisterConsumerHandlerFromEndpoint(ctx, mux, grpcAddr, opts); err != nil {
+		return nil, err
+	}
+	return mux, nil
+}
+
+func (s *Server) CreateTopic(ctx context.Context, req *api.CreateTopicRequest) (*api.CreateTopicResponse, error) {
+	_, span := constants.Tracer.Start(ctx, "grpc CreateTopic")
+	defer span.End()
+
+	config := topic.Config{
+		Compression:        req.GetConfig().GetCompression(),
+		DataType:           req.GetConfig().GetDataType(),
+		Replicas:           int(req.GetConfig().GetReplicas()),
+		NumOfPartition:     int(req.GetConfig().GetNumOfPartitions()),
+		PartitionStratergy: "HASH", // Default strategy
+	}
+	if success, err := topic.CreateAtTopic(req.GetName(), config); !success || err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	return &api.CreateTopicResponse{Name: req.GetName()}, nil
+}
+
+func (s *Server) ListTopics(ctx context.Context, _ *api.ListTopicsRequest) (*api.ListTopicsResponse, error) {
+	names, err := topic.ListTopics(ctx)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return &api.ListTopicsResponse{Topics: names}, nil
+}
+
+func (s *Server) DescribeTopic(ctx context.Context, req *api.DescribeTopicRequest) (*api.TopicDescription, error) {
+	config, err := topic.LoadConfig(ctx, req.GetName())
+	if err != nil {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+	return &api.TopicDescription{
+		Name: req.GetName(),
+		Config: &api.TopicConfig{
+			Compression:     config.Compression,
+			DataType:        config.DataType,
+			Replicas:        int32(config.Replicas),
+			NumOfPartitions: int32(config.NumOfPartition),
+		},
+	}, nil
+}
+
+func (s *Server) Produce(ctx context.Context, req *api.ProduceRequest) (*api.ProduceResponse, error) {
+	ctx, span := constants.Tracer.Start(ctx, "grpc Produce")
+	defer span.End()
+
+	return produce(ctx, req)
+}
+
+func (s *Server) ProduceStream(stream api.Producer_ProduceStreamServer) error {
+	ctx, span := constants.Tracer.Start(stream.Context(), "grpc ProduceStream")
+	defer span.End()
+
+	results := []*api.ProduceResponse{}
+	for {
+		req, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return stream.SendAndClose(&api.ProduceStreamResponse{Results: results})
+		}
+		if err != nil {
+			return err
+		}
+
+		result, err := produce(ctx, req)
+		if err != nil {
+			return err
+		}
+		results = append(results, result)
+	}
+}
+
+func produce(ctx context.Context, req *api.ProduceRequest) (*api.ProduceResponse, error) {
+	success, metaData, err := producer.ProduceMessage(ctx, req.GetTopic(), req.GetKey(), req.GetMessage().AsInterface())
+	if !success || err != nil {
+		return nil, errorStatus(err)
+	}
+	return &api.ProduceResponse{Offset: int64(metaData.Offset), Partition: int32(metaData.Partition), Timestamp: metaData.TimeStamp}, nil
+}
+
+// The status of a produce or fetch error: the client's mistakes by what they
+// got wrong, not-leader and too few replicas as worth retrying, anything else
+// as the broker's failure
+func errorStatus(err error) error {
+	code := codes.Internal
+	switch {
+	case errors.Is(err, producer.ErrUnknownTopic), errors.Is(err, producer.ErrUnknownPartition):
+		code = codes.NotFound
+	case errors.Is(err, producer.ErrInvalidMessage):
+		code = codes.InvalidArgument
+	case errors.Is(err, producer.ErrNotLeader), errors.Is(err, producer.ErrNotEnoughReplicas):
+		code = codes.Unavailable
+	case errors.Is(err, producer.ErrFencedLeaderEpoch):
+		code = codes.FailedPrecondition
+	}
+	return status.Error(code, err.Error())
+}
+
+func (s *Server) Fetch(ctx context.Context, req *api.FetchRequest) (*api.FetchResponse, error) {
+	ctx, span := constants.Tracer.Start(ctx, "grpc Fetch")
+	defer span.End()
+
+	resp, err := consumer.Fetch(ctx, consumer.FetchRequest{
+		Topic:     req.GetTopic(),
+		Partition: int(req.GetPartition()),
+		Offset:    int(req.GetOffset()),
+		MaxBytes:  int(req.GetMaxBytes()),
+		MinBytes:  int(req.GetMinBytes()),
+		MaxWait:   time.Duration(req.GetMaxWaitMs()) * time.Millisecond,
+	})
+	if err != nil {
+		return nil, errorStatus(err)
+	}
+
+	records, err := toRecords(resp.Records)
+	if err != nil {
+		return nil, err
+	}
+	return &api.FetchResponse{Records: records, NextOffset: int64(resp.NextOffset)}, nil
+}
+
+func (s *Server) Consume(req *api.ConsumeRequest, stream api.Consumer_ConsumeServer) error {
+	ctx, span := constants.Tracer.Start(stream.Context(), "grpc Consume")
+	defer span.End()
+
+	offset := int(req.GetOffset())
+	log.Println("gRPC consume of topic:", req.GetTopic(), "partition:", req.GetPartition(), "from offset:", offset)
+	for ctx.Err() == nil {
+		resp, err := consumer.Fetch(ctx, consumer.FetchRequest{
+			Topic:     req.GetTopic(),
+			Partition: int(req.GetPartition()),
+			Offset:    offset,
+			MinBytes:  1,
+			MaxWait:   consumeWaitInterval,
+		})
+		if err != nil {
+			return errorStatus(err)
+		}
+
+		records, err := toRecords(resp.Records)
+		if err != nil {
+			return err
+		}
+		for _, record := range records {
+			if err := stream.Send(record); err != nil {
+				return err
+			}
+		}
+		offset = resp.NextOffset
+	}
+	return nil
+}
+
+func toRecords(records []consumer.Record) ([]*api.Record, error) {
+	result := make([]*api.Record, 0, len(records))
+	for _, record := range records {
+		message := &structpb.Value{}
+		if err := protojson.Unmarshal(record.Message, message); err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+		result = append(result, &api.Record{
+			Offset:    int64(record.Offset),
+			Partition: int32(record.Partition),
+			Timestamp: record.TimeStamp,
+			Message:   message,
+		})
+	}
+	return result, nil
+}
@@ -0,0 +1,124 @@
+package grpcserver
+
+import (
+	"FranzMQ/api"
+	"FranzMQ/constants"
+	"FranzMQ/producer"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func init() {
+	go producer.GlobalWriterThread(producer.GlobalLogWriterQueue)
+	go producer.GlobalWriterThread(producer.GlobalIndexWriterQueue)
+}
+
+func dial(t *testing.T) *grpc.ClientConn {
+	listener := bufconn.Listen(1024 * 1024)
+	server := NewServer()
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func TestServer_ProduceStreamAndConsume(t *testing.T) {
+	topicName := "grpc_stream_test"
+	os.RemoveAll(constants.FilesDir + topicName)
+	defer os.RemoveAll(constants.FilesDir + topicName)
+
+	conn := dial(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	admin := api.NewTopicAdminClient(conn)
+	if _, err := admin.CreateTopic(ctx, &api.CreateTopicRequest{Name: topicName, Config: &api.TopicConfig{NumOfPartitions: 1}}); err != nil {
+		t.Fatalf("create topic failed: %v", err)
+	}
+
+	stream, err := api.NewProducerClient(conn).ProduceStream(ctx)
+	if err != nil {
+		t.Fatalf("produce stream failed: %v", err)
+	}
+	for _, text := range []string{"one", "two", "three"} {
+		if err := stream.Send(&api.ProduceRequest{Topic: topicName, Key: "k", Message: structpb.NewStringValue(text)}); err != nil {
+			t.Fatalf("send failed: %v", err)
+		}
+	}
+	produced, err := stream.CloseAndRecv()
+	if err != nil {
+		t.Fatalf("close failed: %v", err)
+	}
+	if len(produced.GetResults()) != 3 || produced.GetResults()[2].GetOffset() != 3 {
+		t.Fatalf("Unexpected produce results: %v", produced.GetResults())
+	}
+
+	consume, err := api.NewConsumerClient(conn).Consume(ctx, &api.ConsumeRequest{Topic: topicName, Partition: 0, Offset: 2})
+	if err != nil {
+		t.Fatalf("consume failed: %v", err)
+	}
+	for _, expected := range []string{"two", "three"} {
+		record, err := consume.Recv()
+		if err != nil {
+			t.Fatalf("recv failed: %v", err)
+		}
+		if record.GetMessage().GetStringValue() != expected {
+			t.Errorf("Expected %q but got %v", expected, record.GetMessage())
+		}
+	}
+}
+
+func TestServer_DescribeUnknownTopic(t *testing.T) {
+	conn := dial(t)
+	if _, err := api.NewTopicAdminClient(conn).DescribeTopic(context.Background(), &api.DescribeTopicRequest{Name: "grpc_missing_topic"}); err == nil {
+		t.Errorf("Expected an error for an unknown topic")
+	}
+}
+
+func TestErrorStatus(t *testing.T) {
+	cases := []struct {
+		err  error
+		code codes.Code
+	}{
+		{producer.ErrUnknownTopic, codes.NotFound},
+		{fmt.Errorf("%w: orders-3", producer.ErrUnknownPartition), codes.NotFound},
+		{fmt.Errorf("%w: too large", producer.ErrInvalidMessage), codes.InvalidArgument},
+		{fmt.Errorf("%w: orders-0", producer.ErrNotLeader), codes.Unavailable},
+		{producer.ErrNotEnoughReplicas, codes.Unavailable},
+		{producer.ErrFencedLeaderEpoch, codes.FailedPrecondition},
+		{errors.New("disk full"), codes.Internal},
+	}
+	for _, c := range cases {
+		if code := status.Code(errorStatus(c.err)); code != c.code {
+			t.Errorf("Expected %v for %q but got %v", c.code, c.err, code)
+		}
+	}
+}
+
+func TestServer_FetchUnknownTopic(t *testing.T) {
+	conn := dial(t)
+	_, err := api.NewConsumerClient(conn).Fetch(context.Background(), &api.FetchRequest{Topic: "grpc_missing_topic"})
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("Expected NotFound for an unknown topic but got %v", err)
+	}
+}
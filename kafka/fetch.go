@@ -0,0 +1,287 @@
+package kafka
+
+import (
+	"FranzMQ/consumer"
+	"FranzMQ/producer"
+	"context"
+	"time"
+)
+
+type fetchPartition struct {
+	index     int32
+	offset    int64
+	maxBytes  int32
+	code      int16
+	highWater int64
+	logStart  int64
+	records   []byte
+}
+
+type fetchTopic struct {
+	name       string
+	partitions []*fetchPartition
+}
+
+func (s *Server) handleFetch(ctx context.Context, version int16, d *decoder) ([]byte, error) {
+	d.int32() // replica id
+	maxWait := millis(d.int32())
+	minBytes := int(d.int32())
+	maxBytes := int(d.int32())
+	d.int8() // isolation level, there are no transactions
+	if version >= 7 {
+		d.int32() // session id, sessions are not kept and every fetch is a full one
+		d.int32() // session epoch
+	}
+
+	topics := []*fetchTopic{}
+	topicCount := d.arrayLen()
+	for t := 0; t < topicCount && d.err == nil; t++ {
+		ft := &fetchTopic{name: d.string()}
+		partitionCount := d.arrayLen()
+		for p := 0; p < partitionCount && d.err == nil; p++ {
+			fp := &fetchPartition{index: d.int32()}
+			if version >= 9 {
+				d.int32() // current leader epoch
+			}
+			fp.offset = d.int64()
+			if version >= 5 {
+				d.int64() // log start offset, only followers send it
+			}
+			fp.maxBytes = d.int32()
+			ft.partitions = append(ft.partitions, fp)
+		}
+		topics = append(topics, ft)
+	}
+	if version >= 7 {
+		forgotten := d.arrayLen()
+		for t := 0; t < forgotten && d.err == nil; t++ {
+			d.string()
+			for p, n := 0, d.arrayLen(); p < n && d.err == nil; p++ {
+				d.int32()
+			}
+		}
+	}
+	if version >= 11 {
+		d.string() // rack id
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+
+	// Read everything once, park on the partitions' append notifiers until
+	// min bytes are there or max wait runs out
+	deadline := time.NewTimer(maxWait)
+	defer deadline.Stop()
+	for {
+		notifiers := []<-chan struct{}{}
+		for _, ft := range topics {
+			for _, fp := range ft.partitions {
+				notifiers = append(notifiers, producer.AppendNotifier(ft.name, int(fp.index)))
+			}
+		}
+
+		total := 0
+		for _, ft := range topics {
+			for _, fp := range ft.partitions {
+				budget := fp.maxBytes
+				if maxBytes > 0 && total >= maxBytes {
+					budget = 0 // Over the response limit, only report watermarks
+				}
+				total += readFetchPartition(ctx, ft.name, fp, budget)
+			}
+		}
+		if total >= minBytes || maxWait <= 0 || !waitForAny(ctx, notifiers, deadline.C) {
+			break
+		}
+	}
+
+	e := encoder{}
+	e.int32(0) // throttle time
+	if version >= 7 {
+		e.int16(errNone)
+		e.int32(0) // session id, no session was created
+	}
+	e.arrayLen(len(topics))
+	for _, ft := range topics {
+		e.string(ft.name)
+		e.arrayLen(len(ft.partitions))
+		for _, fp := range ft.partitions {
+			e.int32(fp.index)
+			e.int16(fp.code)
+			e.int64(fp.highWater)
+			e.int64(fp.highWater) // last stable offset
+			if version >= 5 {
+				e.int64(fp.logStart)
+			}
+			e.arrayLen(-1) // aborted transactions
+			if version >= 11 {
+				e.int32(-1) // preferred read replica
+			}
+			e.bytes(fp.records)
+		}
+	}
+	return e.buf, nil
+}
+
+// Read a partition without waiting, returns the number of bytes read
+func readFetchPartition(ctx context.Context, topicName string, fp *fetchPartition, maxBytes int32) int {
+	fp.code, fp.records = errNone, nil
+	fp.highWater, fp.logStart = -1, -1
+
+	latest, err := consumer.LatestOffset(ctx, topicName, int(fp.index))
+	if err != nil {
+		fp.code = errUnknownTopicOrPartition
+		return 0
+	}
+	earliest, err := consumer.EarliestOffset(ctx, topicName, int(fp.index))
+	if err != nil {
+		fp.code = errUnknownTopicOrPartition
+		return 0
+	}
+	fp.highWater, fp.logStart = toKafkaOffset(latest), toKafkaOffset(earliest)
+
+	if fp.offset < fp.logStart || fp.offset > fp.highWater {
+		fp.code = errOffsetOutOfRange
+		return 0
+	}
+	if fp.offset == fp.highWater || maxBytes <= 0 {
+		return 0
+	}
+
+	resp, err := consumer.Fetch(ctx, consumer.FetchRequest{
+		Topic:     topicName,
+		Partition: int(fp.index),
+		Offset:    fromKafkaOffset(fp.offset),
+		MaxBytes:  int(maxBytes),
+	})
+	if err != nil {
+		fp.code = errUnknownTopicOrPartition
+		return 0
+	}
+	if len(resp.Records) == 0 {
+		return 0
+	}
+
+	records := make([]record, 0, len(resp.Records))
+	for _, r := range resp.Records {
+		records = append(records, fetchedRecord(r))
+	}
+	fp.records = encodeRecordBatch(toKafkaOffset(resp.Records[0].Offset), records)
+	return len(fp.records)
+}
+
+// Records produced natively become the value of a record without key
+func fetchedRecord(r consumer.Record) record {
+	return record{Key: r.Key, Value: r.Value(), Headers: r.Headers, Timestamp: r.TimeStamp / int64(time.Millisecond)}
+}
+
+// Wait until any channel fires, false when the deadline or ctx came first
+func waitForAny(ctx context.Context, notifiers []<-chan struct{}, deadline <-chan time.Time) bool {
+	woken := make(chan struct{}, 1)
+	stop := make(chan struct{})
+	defer close(stop)
+	for _, ch := range notifiers {
+		go func(ch <-chan struct{}) {
+			select {
+			case <-ch:
+				select {
+				case woken <- struct{}{}:
+				default:
+				}
+			case <-stop:
+			}
+		}(ch)
+	}
+
+	select {
+	case <-woken:
+		return true
+	case <-deadline:
+		return false
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func (s *Server) handleListOffsets(ctx context.Context, version int16, d *decoder) ([]byte, error) {
+	d.int32() // replica id
+	if version >= 2 {
+		d.int8() // isolation level
+	}
+
+	type listPartition struct {
+		index     int32
+		timestamp int64
+	}
+	type listTopic struct {
+		name       string
+		partitions []listPartition
+	}
+	topics := []listTopic{}
+	topicCount := d.arrayLen()
+	for t := 0; t < topicCount && d.err == nil; t++ {
+		lt := listTopic{name: d.string()}
+		partitionCount := d.arrayLen()
+		for p := 0; p < partitionCount && d.err == nil; p++ {
+			lp := listPartition{index: d.int32()}
+			if version >= 4 {
+				d.int32() // current leader epoch
+			}
+			lp.timestamp = d.int64()
+			lt.partitions = append(lt.partitions, lp)
+		}
+		topics = append(topics, lt)
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+
+	e := encoder{}
+	if version >= 2 {
+		e.int32(0) // throttle time
+	}
+	e.arrayLen(len(topics))
+	for _, lt := range topics {
+		e.string(lt.name)
+		e.arrayLen(len(lt.partitions))
+		for _, lp := range lt.partitions {
+			code, timestamp, offset := listOffset(ctx, lt.name, int(lp.index), lp.timestamp)
+			e.int32(lp.index)
+			e.int16(code)
+			e.int64(timestamp)
+			e.int64(offset)
+			if version >= 4 {
+				e.int32(unknownLeaderEpoch)
+			}
+		}
+	}
+	return e.buf, nil
+}
+
+// Resolve a ListOffsets timestamp: -1 latest, -2 earliest, otherwise the
+// first record at or after the timestamp in milliseconds
+func listOffset(ctx context.Context, topicName string, partition int, timestamp int64) (int16, int64, int64) {
+	switch timestamp {
+	case -1:
+		latest, err := consumer.LatestOffset(ctx, topicName, partition)
+		if err != nil {
+			return errUnknownTopicOrPartition, -1, -1
+		}
+		return errNone, -1, toKafkaOffset(latest)
+	case -2:
+		earliest, err := consumer.EarliestOffset(ctx, topicName, partition)
+		if err != nil {
+			return errUnknownTopicOrPartition, -1, -1
+		}
+		return errNone, -1, toKafkaOffset(earliest)
+	}
+
+	offset, recordTimestamp, found, err := consumer.OffsetForTimestamp(ctx, topicName, partition, timestamp*int64(time.Millisecond))
+	if err != nil {
+		return errUnknownTopicOrPartition, -1, -1
+	}
+	if !found {
+		return errNone, -1, -1
+	}
+	return errNone, recordTimestamp / int64(time.Millisecond), toKafkaOffset(offset)
+}
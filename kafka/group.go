@@ -0,0 +1,251 @@
+package kafka
+
+import (
+	"FranzMQ/consumer"
+	"context"
+	"sort"
+)
+
+func (s *Server) handleJoinGroup(ctx context.Context, version int16, clientID string, d *decoder) ([]byte, error) {
+	req := consumer.JoinGroupRequest{GroupID: d.string(), ClientID: clientID}
+	req.SessionTimeout = millis(d.int32())
+	if version >= 1 {
+		req.RebalanceTimeout = millis(d.int32())
+	}
+	req.MemberID = d.string()
+	if version >= 5 {
+		d.nullableString() // group instance id, static membership is not supported
+	}
+	req.ProtocolType = d.string()
+	protocolCount := d.arrayLen()
+	for i := 0; i < protocolCount && d.err == nil; i++ {
+		req.Protocols = append(req.Protocols, consumer.GroupProtocol{Name: d.string(), Metadata: d.bytes()})
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+
+	resp, err := consumer.JoinGroup(ctx, req)
+	if err != nil {
+		resp = consumer.JoinGroupResponse{Generation: -1, MemberID: req.MemberID}
+	}
+
+	e := encoder{}
+	if version >= 2 {
+		e.int32(0) // throttle time
+	}
+	e.int16(groupErrorCode(err))
+	e.int32(int32(resp.Generation))
+	e.string(resp.Protocol)
+	e.string(resp.LeaderID)
+	e.string(resp.MemberID)
+	e.arrayLen(len(resp.Members))
+	for _, m := range resp.Members {
+		e.string(m.MemberID)
+		if version >= 5 {
+			e.nullableString(nil)
+		}
+		e.bytes(m.Metadata)
+	}
+	return e.buf, nil
+}
+
+func (s *Server) handleSyncGroup(ctx context.Context, version int16, d *decoder) ([]byte, error) {
+	groupID, generation, memberID := d.string(), int(d.int32()), d.string()
+	if version >= 3 {
+		d.nullableString() // group instance id
+	}
+	assignments := make(map[string][]byte)
+	count := d.arrayLen()
+	for i := 0; i < count && d.err == nil; i++ {
+		assignments[d.string()] = d.bytes()
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+
+	assignment, err := consumer.SyncGroup(ctx, groupID, generation, memberID, assignments)
+	if assignment == nil {
+		assignment = []byte{}
+	}
+
+	e := encoder{}
+	if version >= 1 {
+		e.int32(0) // throttle time
+	}
+	e.int16(groupErrorCode(err))
+	e.bytes(assignment)
+	return e.buf, nil
+}
+
+func (s *Server) handleHeartbeat(ctx context.Context, version int16, d *decoder) ([]byte, error) {
+	groupID, generation, memberID := d.string(), int(d.int32()), d.string()
+	if version >= 3 {
+		d.nullableString() // group instance id
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+
+	err := consumer.Heartbeat(ctx, groupID, generation, memberID)
+
+	e := encoder{}
+	if version >= 1 {
+		e.int32(0) // throttle time
+	}
+	e.int16(groupErrorCode(err))
+	return e.buf, nil
+}
+
+func (s *Server) handleLeaveGroup(ctx context.Context, version int16, d *decoder) ([]byte, error) {
+	groupID, memberID := d.string(), d.string()
+	if d.err != nil {
+		return nil, d.err
+	}
+
+	err := consumer.LeaveGroup(ctx, groupID, memberID)
+
+	e := encoder{}
+	if version >= 1 {
+		e.int32(0) // throttle time
+	}
+	e.int16(groupErrorCode(err))
+	return e.buf, nil
+}
+
+func (s *Server) handleOffsetCommit(ctx context.Context, version int16, d *decoder) ([]byte, error) {
+	groupID := d.string()
+	generation, memberID := -1, ""
+	if version >= 1 {
+		generation, memberID = int(d.int32()), d.string()
+	}
+	if version >= 7 {
+		d.nullableString() // group instance id
+	}
+	if version >= 2 && version <= 4 {
+		d.int64() // retention time, offsets are kept forever
+	}
+
+	type commitPartition struct {
+		index  int32
+		offset int64
+	}
+	type commitTopic struct {
+		name       string
+		partitions []commitPartition
+	}
+	topics := []commitTopic{}
+	topicCount := d.arrayLen()
+	for t := 0; t < topicCount && d.err == nil; t++ {
+		ct := commitTopic{name: d.string()}
+		partitionCount := d.arrayLen()
+		for p := 0; p < partitionCount && d.err == nil; p++ {
+			cp := commitPartition{index: d.int32(), offset: d.int64()}
+			if version >= 6 {
+				d.int32() // committed leader epoch
+			}
+			if version == 1 {
+				d.int64() // commit timestamp
+			}
+			d.nullableString() // metadata
+			ct.partitions = append(ct.partitions, cp)
+		}
+		topics = append(topics, ct)
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+
+	// Members rebalanced out must not overwrite the new owner's progress
+	validateErr := consumer.ValidateGroupID(groupID)
+	if validateErr == nil {
+		validateErr = consumer.ValidateGeneration(groupID, generation, memberID)
+	}
+
+	e := encoder{}
+	if version >= 3 {
+		e.int32(0) // throttle time
+	}
+	e.arrayLen(len(topics))
+	for _, ct := range topics {
+		e.string(ct.name)
+		e.arrayLen(len(ct.partitions))
+		for _, cp := range ct.partitions {
+			code := groupErrorCode(validateErr)
+			if validateErr == nil {
+				if err := consumer.CommitOffset(ctx, groupID, ct.name, int(cp.index), fromKafkaOffset(cp.offset)); err != nil {
+					code = errUnknownServerError
+				}
+			}
+			e.int32(cp.index)
+			e.int16(code)
+		}
+	}
+	return e.buf, nil
+}
+
+func (s *Server) handleOffsetFetch(ctx context.Context, version int16, d *decoder) ([]byte, error) {
+	groupID := d.string()
+	requested := map[string][]int32{}
+	names := []string{}
+	topicCount := d.arrayLen()
+	for t := 0; t < topicCount && d.err == nil; t++ {
+		name := d.string()
+		names = append(names, name)
+		partitionCount := d.arrayLen()
+		for p := 0; p < partitionCount && d.err == nil; p++ {
+			requested[name] = append(requested[name], d.int32())
+		}
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+
+	committed := map[string]map[int]int{}
+	err := consumer.ValidateGroupID(groupID)
+	if err == nil {
+		if committed, err = consumer.CommittedOffsets(ctx, groupID); err != nil {
+			committed = map[string]map[int]int{}
+		}
+	}
+
+	// A null topic list asks for everything the group has committed
+	if topicCount < 0 {
+		for name, partitions := range committed {
+			names = append(names, name)
+			for partition := range partitions {
+				requested[name] = append(requested[name], int32(partition))
+			}
+			sort.Slice(requested[name], func(i, j int) bool { return requested[name][i] < requested[name][j] })
+		}
+		sort.Strings(names)
+	}
+
+	e := encoder{}
+	if version >= 3 {
+		e.int32(0) // throttle time
+	}
+	e.arrayLen(len(names))
+	for _, name := range names {
+		e.string(name)
+		e.arrayLen(len(requested[name]))
+		for _, partition := range requested[name] {
+			offset := int64(-1)
+			if committedOffset, exists := committed[name][int(partition)]; exists {
+				offset = toKafkaOffset(committedOffset)
+			}
+			e.int32(partition)
+			e.int64(offset)
+			if version >= 5 {
+				e.int32(unknownLeaderEpoch)
+			}
+			empty := ""
+			e.nullableString(&empty) // metadata
+			e.int16(groupErrorCode(err))
+		}
+	}
+	if version >= 2 {
+		e.int16(groupErrorCode(err))
+	}
+	return e.buf, nil
+}
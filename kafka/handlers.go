@@ -0,0 +1,329 @@
+package kafka
+
+import (
+	"FranzMQ/constants"
+	"FranzMQ/consumer"
+	"FranzMQ/metrics"
+	"FranzMQ/topic"
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// API keys
+const (
+	apiProduce         int16 = 0
+	apiFetch           int16 = 1
+	apiListOffsets     int16 = 2
+	apiMetadata        int16 = 3
+	apiOffsetCommit    int16 = 8
+	apiOffsetFetch     int16 = 9
+	apiFindCoordinator int16 = 10
+	apiJoinGroup       int16 = 11
+	apiHeartbeat       int16 = 12
+	apiLeaveGroup      int16 = 13
+	apiSyncGroup       int16 = 14
+	apiApiVersions     int16 = 18
+	apiInitProducerID  int16 = 22
+)
+
+// Endpoint names of the API keys in request metrics
+var apiNames = map[int16]string{
+	apiProduce:         "Produce",
+	apiFetch:           "Fetch",
+	apiListOffsets:     "ListOffsets",
+	apiMetadata:        "Metadata",
+	apiOffsetCommit:    "OffsetCommit",
+	apiOffsetFetch:     "OffsetFetch",
+	apiFindCoordinator: "FindCoordinator",
+	apiJoinGroup:       "JoinGroup",
+	apiHeartbeat:       "Heartbeat",
+	apiLeaveGroup:      "LeaveGroup",
+	apiSyncGroup:       "SyncGroup",
+	apiApiVersions:     "ApiVersions",
+	apiInitProducerID:  "InitProducerID",
+}
+
+// Error codes
+const (
+	errUnknownServerError        int16 = -1
+	errNone                      int16 = 0
+	errOffsetOutOfRange          int16 = 1
+	errCorruptMessage            int16 = 2
+	errUnknownTopicOrPartition   int16 = 3
+	errNotLeaderForPartition     int16 = 6
+	errNotEnoughReplicas         int16 = 19
+	errIllegalGeneration         int16 = 22
+	errInconsistentGroupProtocol int16 = 23
+	errInvalidGroupID            int16 = 24
+	errUnknownMemberID           int16 = 25
+	errRebalanceInProgress       int16 = 27
+	errUnsupportedVersion        int16 = 35
+	errUnsupportedCompression    int16 = 76
+)
+
+// Supported version range per API, all of them non-flexible
+var apiVersions = map[int16][2]int16{
+	apiProduce:         {3, 8},
+	apiFetch:           {4, 11},
+	apiListOffsets:     {1, 5},
+	apiMetadata:        {0, 8},
+	apiOffsetCommit:    {0, 7},
+	apiOffsetFetch:     {0, 5},
+	apiFindCoordinator: {0, 2},
+	apiJoinGroup:       {0, 5},
+	apiHeartbeat:       {0, 3},
+	apiLeaveGroup:      {0, 2},
+	apiSyncGroup:       {0, 3},
+	apiApiVersions:     {0, 2},
+	apiInitProducerID:  {0, 1},
+}
+
+const (
+	clusterID           = "franzmq"
+	unknownOperations   = -2147483648 // Authorized operations were not requested
+	unknownLeaderEpoch  = -1
+	producerIDStartedAt = 1000
+)
+
+var nextProducerID atomic.Int64
+
+func init() {
+	nextProducerID.Store(producerIDStartedAt)
+}
+
+// Name of an API key, its number for unknown keys
+func apiName(apiKey int16) string {
+	if name, found := apiNames[apiKey]; found {
+		return name
+	}
+	return strconv.Itoa(int(apiKey))
+}
+
+// Run a request and return its response body, nil means no response is sent
+func (s *Server) handle(ctx context.Context, header requestHeader, d *decoder) ([]byte, error) {
+	ctx, span := constants.Tracer.Start(ctx, "kafka.handle")
+	defer span.End()
+	defer metrics.ObserveRequest("kafka", apiName(header.apiKey), time.Now())
+
+	versions, supported := apiVersions[header.apiKey]
+	if header.apiKey == apiApiVersions && (!supported || header.apiVersion > versions[1]) {
+		// Clients probe with their newest ApiVersions, answer in v0 so they can downgrade
+		return s.handleApiVersions(0, errUnsupportedVersion), nil
+	}
+	if !supported || header.apiVersion < versions[0] || header.apiVersion > versions[1] {
+		return nil, fmt.Errorf("unsupported api version")
+	}
+
+	version := header.apiVersion
+	switch header.apiKey {
+	case apiApiVersions:
+		return s.handleApiVersions(version, errNone), nil
+	case apiMetadata:
+		return s.handleMetadata(ctx, version, d)
+	case apiProduce:
+		return s.handleProduce(ctx, version, d)
+	case apiFetch:
+		return s.handleFetch(ctx, version, d)
+	case apiListOffsets:
+		return s.handleListOffsets(ctx, version, d)
+	case apiFindCoordinator:
+		return s.handleFindCoordinator(version, d)
+	case apiOffsetCommit:
+		return s.handleOffsetCommit(ctx, version, d)
+	case apiOffsetFetch:
+		return s.handleOffsetFetch(ctx, version, d)
+	case apiJoinGroup:
+		return s.handleJoinGroup(ctx, version, header.clientID, d)
+	case apiSyncGroup:
+		return s.handleSyncGroup(ctx, version, d)
+	case apiHeartbeat:
+		return s.handleHeartbeat(ctx, version, d)
+	case apiLeaveGroup:
+		return s.handleLeaveGroup(ctx, version, d)
+	case apiInitProducerID:
+		return s.handleInitProducerID(version, d)
+	}
+	return nil, fmt.Errorf("unsupported api key")
+}
+
+func (s *Server) handleApiVersions(version int16, code int16) []byte {
+	keys := make([]int16, 0, len(apiVersions))
+	for key := range apiVersions {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+
+	e := encoder{}
+	e.int16(code)
+	e.arrayLen(len(keys))
+	for _, key := range keys {
+		e.int16(key)
+		e.int16(apiVersions[key][0])
+		e.int16(apiVersions[key][1])
+	}
+	if version >= 1 {
+		e.int32(0) // throttle time
+	}
+	return e.buf
+}
+
+func (s *Server) handleMetadata(ctx context.Context, version int16, d *decoder) ([]byte, error) {
+	var names []string
+	count := d.arrayLen()
+	for i := 0; i < count; i++ {
+		names = append(names, d.string())
+	}
+	if version >= 4 {
+		d.bool() // allow auto topic creation, topics have to be created explicitly
+	}
+	if version >= 8 {
+		d.bool() // include cluster authorized operations
+		d.bool() // include topic authorized operations
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+
+	// v0 asks for all topics with an empty list, later versions with a null one
+	if (version == 0 && count == 0) || count < 0 {
+		all, err := topic.ListTopics(ctx)
+		if err != nil {
+			return nil, err
+		}
+		names = all
+	}
+
+	e := encoder{}
+	if version >= 3 {
+		e.int32(0) // throttle time
+	}
+	e.arrayLen(1)
+	e.int32(s.NodeID)
+	e.string(s.Host)
+	e.int32(s.Port)
+	if version >= 1 {
+		e.nullableString(nil) // rack
+	}
+	if version >= 2 {
+		id := clusterID
+		e.nullableString(&id)
+	}
+	if version >= 1 {
+		e.int32(s.NodeID) // controller
+	}
+
+	e.arrayLen(len(names))
+	for _, name := range names {
+		config, err := topic.LoadConfig(ctx, name)
+		code := errNone
+		if err != nil {
+			code = errUnknownTopicOrPartition
+		}
+		e.int16(code)
+		e.string(name)
+		if version >= 1 {
+			e.bool(false) // internal
+		}
+		e.arrayLen(config.NumOfPartition)
+		for p := 0; p < config.NumOfPartition; p++ {
+			e.int16(errNone)
+			e.int32(int32(p))
+			e.int32(s.NodeID) // leader
+			if version >= 7 {
+				e.int32(unknownLeaderEpoch)
+			}
+			e.arrayLen(1) // replicas
+			e.int32(s.NodeID)
+			e.arrayLen(1) // isr
+			e.int32(s.NodeID)
+			if version >= 5 {
+				e.arrayLen(0) // offline replicas
+			}
+		}
+		if version >= 8 {
+			e.int32(unknownOperations)
+		}
+	}
+	if version >= 8 {
+		e.int32(unknownOperations)
+	}
+	return e.buf, nil
+}
+
+// This broker coordinates every group
+func (s *Server) handleFindCoordinator(version int16, d *decoder) ([]byte, error) {
+	d.string() // key
+	if version >= 1 {
+		d.int8() // key type
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+
+	e := encoder{}
+	if version >= 1 {
+		e.int32(0) // throttle time
+	}
+	e.int16(errNone)
+	if version >= 1 {
+		e.nullableString(nil) // error message
+	}
+	e.int32(s.NodeID)
+	e.string(s.Host)
+	e.int32(s.Port)
+	return e.buf, nil
+}
+
+// Hands out producer ids so idempotent clients can start, sequence numbers
+// are not checked so retries may still duplicate
+func (s *Server) handleInitProducerID(version int16, d *decoder) ([]byte, error) {
+	d.nullableString() // transactional id
+	d.int32()          // transaction timeout
+	if d.err != nil {
+		return nil, d.err
+	}
+
+	e := encoder{}
+	e.int32(0) // throttle time
+	e.int16(errNone)
+	e.int64(nextProducerID.Add(1))
+	e.int16(0) // epoch
+	return e.buf, nil
+}
+
+// Map coordinator errors to Kafka error codes
+func groupErrorCode(err error) int16 {
+	switch {
+	case err == nil:
+		return errNone
+	case errors.Is(err, consumer.ErrUnknownMemberID):
+		return errUnknownMemberID
+	case errors.Is(err, consumer.ErrIllegalGeneration):
+		return errIllegalGeneration
+	case errors.Is(err, consumer.ErrRebalanceInProgress):
+		return errRebalanceInProgress
+	case errors.Is(err, consumer.ErrInconsistentProtocol):
+		return errInconsistentGroupProtocol
+	case errors.Is(err, consumer.ErrInvalidGroupID):
+		return errInvalidGroupID
+	}
+	return errUnknownServerError
+}
+
+// Kafka offsets start at 0, FranzMQ offsets at 1
+func toKafkaOffset(offset int) int64 {
+	return int64(offset) - 1
+}
+
+func fromKafkaOffset(offset int64) int {
+	return int(offset) + 1
+}
+
+func millis(d int32) time.Duration {
+	return time.Duration(d) * time.Millisecond
+}
@@ -0,0 +1,116 @@
+package kafka
+
+import (
+	"FranzMQ/consumer"
+	"FranzMQ/producer"
+	"context"
+	"errors"
+	"log"
+)
+
+type producePartition struct {
+	index      int32
+	code       int16
+	baseOffset int64
+	logStart   int64
+}
+
+type produceTopic struct {
+	name       string
+	partitions []producePartition
+}
+
+func (s *Server) handleProduce(ctx context.Context, version int16, d *decoder) ([]byte, error) {
+	d.nullableString() // transactional id
+	acks := d.int16()
+	d.int32() // timeout, appends are synchronous
+
+	results := []produceTopic{}
+	topicCount := d.arrayLen()
+	for t := 0; t < topicCount && d.err == nil; t++ {
+		result := produceTopic{name: d.string()}
+		partitionCount := d.arrayLen()
+		for p := 0; p < partitionCount && d.err == nil; p++ {
+			index, records := d.int32(), d.bytes()
+			if d.err != nil {
+				break
+			}
+			result.partitions = append(result.partitions, appendRecords(ctx, result.name, int(index), records))
+		}
+		results = append(results, result)
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+	if acks == 0 {
+		return nil, nil
+	}
+
+	e := encoder{}
+	e.arrayLen(len(results))
+	for _, result := range results {
+		e.string(result.name)
+		e.arrayLen(len(result.partitions))
+		for _, p := range result.partitions {
+			e.int32(p.index)
+			e.int16(p.code)
+			e.int64(p.baseOffset)
+			e.int64(-1) // log append time, create time is used
+			if version >= 5 {
+				e.int64(p.logStart)
+			}
+			if version >= 8 {
+				e.arrayLen(0)         // record errors
+				e.nullableString(nil) // error message
+			}
+		}
+	}
+	e.int32(0) // throttle time
+	return e.buf, nil
+}
+
+// Append every record of the batches to the partition in one step, the base
+// offset is the offset of the first one
+func appendRecords(ctx context.Context, topicName string, partition int, data []byte) producePartition {
+	result := producePartition{index: int32(partition), baseOffset: -1, logStart: -1}
+
+	batches, err := decodeRecordBatches(data)
+	if err != nil {
+		log.Println("Error decoding kafka record batch for", topicName, partition, ":", err)
+		result.code = errCorruptMessage
+		if errors.Is(err, errCompressionNotSupported) {
+			result.code = errUnsupportedCompression
+		}
+		return result
+	}
+
+	msgs := []interface{}{}
+	for _, batch := range batches {
+		for _, r := range batch.Records {
+			msgs = append(msgs, producer.Record{Key: r.Key, Value: r.Value, Headers: r.Headers})
+		}
+	}
+	if len(msgs) == 0 {
+		result.code = errCorruptMessage
+		return result
+	}
+
+	metaData, err := producer.ProduceBatchToPartition(ctx, topicName, partition, msgs)
+	if err != nil {
+		switch {
+		case errors.Is(err, producer.ErrNotEnoughReplicas):
+			result.code = errNotEnoughReplicas
+		case errors.Is(err, producer.ErrNotLeader):
+			result.code = errNotLeaderForPartition
+		default:
+			result.code = errUnknownTopicOrPartition
+		}
+		return result
+	}
+	result.baseOffset = toKafkaOffset(metaData.Offset)
+
+	if earliest, err := consumer.EarliestOffset(ctx, topicName, partition); err == nil {
+		result.logStart = toKafkaOffset(earliest)
+	}
+	return result
+}
@@ -0,0 +1,215 @@
+package kafka
+
+import (
+	"FranzMQ/producer"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// Compression codecs in the low bits of the batch attributes
+const (
+	compressionNone   = 0
+	compressionGzip   = 1
+	compressionSnappy = 2
+	compressionLz4    = 3
+	compressionZstd   = 4
+)
+
+// Java clients frame snappy data in the xerial stream format
+var xerialHeader = []byte{0x82, 'S', 'N', 'A', 'P', 'P', 'Y', 0}
+
+type record struct {
+	Key       []byte
+	Value     []byte
+	Headers   []recordHeader
+	Timestamp int64 // Milliseconds
+}
+
+type recordHeader = producer.Header
+
+type recordBatch struct {
+	BaseOffset int64
+	Records    []record
+}
+
+// Decode the magic v2 record batches of a produce request
+func decodeRecordBatches(data []byte) ([]recordBatch, error) {
+	batches := []recordBatch{}
+	for len(data) > 0 {
+		if len(data) < 61 {
+			return nil, fmt.Errorf("truncated record batch")
+		}
+		batchLength := int(int32(binary.BigEndian.Uint32(data[8:12])))
+		if batchLength < 49 || 12+batchLength > len(data) {
+			return nil, fmt.Errorf("invalid record batch length %d", batchLength)
+		}
+		batch, err := decodeRecordBatch(data[:12+batchLength])
+		if err != nil {
+			return nil, err
+		}
+		batches = append(batches, batch)
+		data = data[12+batchLength:]
+	}
+	return batches, nil
+}
+
+func decodeRecordBatch(data []byte) (recordBatch, error) {
+	d := &decoder{buf: data}
+	baseOffset := d.int64()
+	d.int32() // batch length
+	d.int32() // partition leader epoch
+	if magic := d.int8(); magic != 2 {
+		return recordBatch{}, fmt.Errorf("unsupported record batch magic %d", magic)
+	}
+	crc := uint32(d.int32())
+	if crc32.Checksum(data[d.off:], castagnoli) != crc {
+		return recordBatch{}, fmt.Errorf("record batch crc mismatch")
+	}
+	attributes := d.int16()
+	d.int32() // last offset delta
+	baseTimestamp := d.int64()
+	d.int64() // max timestamp
+	d.int64() // producer id
+	d.int16() // producer epoch
+	d.int32() // base sequence
+	count := int(d.int32())
+	if d.err != nil {
+		return recordBatch{}, d.err
+	}
+
+	payload, err := decompress(int(attributes&0x7), data[d.off:])
+	if err != nil {
+		return recordBatch{}, err
+	}
+
+	rd := &decoder{buf: payload}
+	batch := recordBatch{BaseOffset: baseOffset}
+	for i := 0; i < count; i++ {
+		length := int(rd.varint())
+		end := rd.off + length
+		rd.int8() // attributes
+		timestampDelta := rd.varint()
+		rd.varint() // offset delta
+		key := rd.varintBytes()
+		value := rd.varintBytes()
+		var headers []recordHeader
+		headerCount := int(rd.varint())
+		if headerCount > rd.remaining() {
+			return recordBatch{}, fmt.Errorf("record with %d headers in %d bytes", headerCount, rd.remaining())
+		}
+		for h := 0; h < headerCount && rd.err == nil; h++ {
+			headerKey := string(rd.next(int(rd.varint())))
+			headers = append(headers, recordHeader{Key: headerKey, Value: rd.varintBytes()})
+		}
+		if rd.err != nil {
+			return recordBatch{}, rd.err
+		}
+		if rd.off != end {
+			return recordBatch{}, fmt.Errorf("record length mismatch")
+		}
+		batch.Records = append(batch.Records, record{Key: key, Value: value, Headers: headers, Timestamp: baseTimestamp + timestampDelta})
+	}
+	return batch, nil
+}
+
+func decompress(codec int, data []byte) ([]byte, error) {
+	switch codec {
+	case compressionNone:
+		return data, nil
+	case compressionGzip:
+		reader, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer reader.Close()
+		return io.ReadAll(reader)
+	case compressionSnappy:
+		if !bytes.HasPrefix(data, xerialHeader) {
+			return snappy.Decode(nil, data)
+		}
+		// 8 byte magic, 4 byte version, 4 byte compat, then length prefixed blocks
+		out := []byte{}
+		for chunks := data[16:]; len(chunks) > 0; {
+			if len(chunks) < 4 {
+				return nil, fmt.Errorf("truncated xerial snappy block")
+			}
+			size := int(binary.BigEndian.Uint32(chunks[:4]))
+			if 4+size > len(chunks) {
+				return nil, fmt.Errorf("truncated xerial snappy block")
+			}
+			block, err := snappy.Decode(nil, chunks[4:4+size])
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, block...)
+			chunks = chunks[4+size:]
+		}
+		return out, nil
+	case compressionZstd:
+		reader, err := zstd.NewReader(nil)
+		if err != nil {
+			return nil, err
+		}
+		defer reader.Close()
+		return reader.DecodeAll(data, nil)
+	default:
+		return nil, errCompressionNotSupported
+	}
+}
+
+var errCompressionNotSupported = fmt.Errorf("unsupported compression codec")
+
+// Encode records with consecutive offsets as one uncompressed magic v2 batch
+func encodeRecordBatch(baseOffset int64, records []record) []byte {
+	if len(records) == 0 {
+		return nil
+	}
+	baseTimestamp, maxTimestamp := records[0].Timestamp, records[0].Timestamp
+	for _, r := range records {
+		maxTimestamp = max(maxTimestamp, r.Timestamp)
+	}
+
+	body := encoder{}
+	body.int16(0) // attributes: no compression, create time
+	body.int32(int32(len(records) - 1))
+	body.int64(baseTimestamp)
+	body.int64(maxTimestamp)
+	body.int64(-1) // producer id
+	body.int16(-1) // producer epoch
+	body.int32(-1) // base sequence
+	body.int32(int32(len(records)))
+	for i, r := range records {
+		rec := encoder{}
+		rec.int8(0)
+		rec.varint(r.Timestamp - baseTimestamp)
+		rec.varint(int64(i))
+		rec.varintBytes(r.Key)
+		rec.varintBytes(r.Value)
+		rec.varint(int64(len(r.Headers)))
+		for _, h := range r.Headers {
+			rec.varint(int64(len(h.Key)))
+			rec.buf = append(rec.buf, h.Key...)
+			rec.varintBytes(h.Value)
+		}
+		body.varint(int64(len(rec.buf)))
+		body.buf = append(body.buf, rec.buf...)
+	}
+
+	e := encoder{buf: make([]byte, 0, 21+len(body.buf))}
+	e.int64(baseOffset)
+	e.int32(int32(9 + len(body.buf))) // leader epoch, magic and crc precede the body
+	e.int32(-1)                       // partition leader epoch
+	e.int8(2)                         // magic
+	e.int32(int32(crc32.Checksum(body.buf, castagnoli)))
+	e.buf = append(e.buf, body.buf...)
+	return e.buf
+}
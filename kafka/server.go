@@ -0,0 +1,155 @@
+// Package kafka speaks a subset of the Kafka wire protocol on top of FranzMQ
+// topics and partitions, so existing Kafka clients can talk to a FranzMQ
+// broker without being rewritten.
+//
+// Supported APIs are ApiVersions, Metadata, Produce, Fetch, ListOffsets,
+// FindCoordinator, OffsetCommit, OffsetFetch, JoinGroup, SyncGroup,
+// Heartbeat, LeaveGroup and InitProducerId, each up to its last non-flexible
+// version. The broker presents itself as a single node cluster that leads
+// every partition and coordinates every group.
+//
+// FranzMQ offsets start at 1 while Kafka offsets start at 0, Kafka offset n is
+// FranzMQ offset n+1. Values are stored as JSON like everything else: a value
+// that is valid JSON is stored as is, anything else as a JSON string which is
+// unquoted again on fetch. Keys are only used for partitioning by the client
+// and headers are dropped.
+package kafka
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"sync"
+)
+
+const maxFrameSize = 100 * 1024 * 1024
+
+type Server struct {
+	NodeID int32
+	Host   string // Advertised to clients in metadata and coordinator responses
+	Port   int32
+
+	mu       sync.Mutex
+	listener net.Listener
+	conns    map[net.Conn]struct{}
+}
+
+func NewServer(host string, port int32) *Server {
+	return &Server{Host: host, Port: port, conns: make(map[net.Conn]struct{})}
+}
+
+// ListenAndServe accepts Kafka protocol connections on addr
+func (s *Server) ListenAndServe(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(listener)
+}
+
+// Serve accepts connections on listener until Close is called
+func (s *Server) Serve(listener net.Listener) error {
+	s.mu.Lock()
+	s.listener = listener
+	s.mu.Unlock()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		s.mu.Lock()
+		s.conns[conn] = struct{}{}
+		s.mu.Unlock()
+		go s.handleConn(conn)
+	}
+}
+
+// Close stops accepting and drops open connections
+func (s *Server) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	if s.listener == nil {
+		return nil
+	}
+	return s.listener.Close()
+}
+
+type requestHeader struct {
+	apiKey        int16
+	apiVersion    int16
+	correlationID int32
+	clientID      string
+}
+
+// Kafka handles one request per connection at a time and answers in order,
+// clients rely on that for produce ordering
+func (s *Server) handleConn(conn net.Conn) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer func() {
+		cancel()
+		conn.Close()
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+	}()
+
+	reader := bufio.NewReader(conn)
+	for {
+		header, body, err := readRequest(reader)
+		if err != nil {
+			if err != io.EOF && !errors.Is(err, net.ErrClosed) {
+				log.Println("Error reading kafka request:", err)
+			}
+			return
+		}
+
+		resp, err := s.handle(ctx, header, body)
+		if err != nil {
+			log.Println("Error handling kafka request", header.apiKey, "version", header.apiVersion, "from", header.clientID+":", err)
+			return // Kafka closes the connection on requests it cannot parse
+		}
+		if resp == nil {
+			continue // acks=0 produce, the client expects no response
+		}
+
+		frame := make([]byte, 8, 8+len(resp))
+		binary.BigEndian.PutUint32(frame[0:4], uint32(4+len(resp)))
+		binary.BigEndian.PutUint32(frame[4:8], uint32(header.correlationID))
+		if _, err := conn.Write(append(frame, resp...)); err != nil {
+			return
+		}
+	}
+}
+
+func readRequest(reader *bufio.Reader) (requestHeader, *decoder, error) {
+	var sizeBuf [4]byte
+	if _, err := io.ReadFull(reader, sizeBuf[:]); err != nil {
+		return requestHeader{}, nil, err
+	}
+	size := int(int32(binary.BigEndian.Uint32(sizeBuf[:])))
+	if size < 10 || size > maxFrameSize {
+		return requestHeader{}, nil, fmt.Errorf("invalid frame size %d", size)
+	}
+
+	frame := make([]byte, size)
+	if _, err := io.ReadFull(reader, frame); err != nil {
+		return requestHeader{}, nil, err
+	}
+
+	d := &decoder{buf: frame}
+	header := requestHeader{apiKey: d.int16(), apiVersion: d.int16(), correlationID: d.int32()}
+	header.clientID = d.string()
+	return header, d, d.err
+}
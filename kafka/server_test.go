@@ -0,0 +1,203 @@
+package kafka
+
+import (
+	"FranzMQ/constants"
+	"FranzMQ/consumer"
+	"FranzMQ/producer"
+	"FranzMQ/topic"
+	"context"
+	"encoding/json"
+	"net"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+func init() {
+	go producer.GlobalWriterThread(producer.GlobalLogWriterQueue)
+	go producer.GlobalWriterThread(producer.GlobalIndexWriterQueue)
+}
+
+func startServer(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen failed: %v", err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	server := NewServer("127.0.0.1", int32(port))
+	go server.Serve(listener)
+	t.Cleanup(func() { server.Close() })
+	return listener.Addr().String()
+}
+
+func createTestTopic(t *testing.T, name string, partitions int) {
+	os.RemoveAll(constants.FilesDir + name)
+	if _, err := topic.CreateAtTopic(name, topic.Config{NumOfPartition: partitions}); err != nil {
+		t.Fatalf("create topic failed: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(constants.FilesDir + name) })
+}
+
+func TestKafka_ProduceAndConsumeWithGroup(t *testing.T) {
+	topicName := "kafka_group_test"
+	createTestTopic(t, topicName, 2)
+	os.RemoveAll(constants.GroupsDir)
+	t.Cleanup(func() { os.RemoveAll(constants.GroupsDir) })
+	addr := startServer(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	client, err := kgo.NewClient(kgo.SeedBrokers(addr), kgo.DefaultProduceTopic(topicName))
+	if err != nil {
+		t.Fatalf("client failed: %v", err)
+	}
+	defer client.Close()
+
+	for i := 0; i < 10; i++ {
+		value := `{"n":` + strconv.Itoa(i) + `}`
+		if i%2 == 1 {
+			value = "plain-" + strconv.Itoa(i)
+		}
+		record := &kgo.Record{Key: []byte("key-" + strconv.Itoa(i)), Value: []byte(value)}
+		if err := client.ProduceSync(ctx, record).FirstErr(); err != nil {
+			t.Fatalf("produce failed: %v", err)
+		}
+	}
+
+	group, err := kgo.NewClient(
+		kgo.SeedBrokers(addr),
+		kgo.ConsumerGroup("kafka-test-group"),
+		kgo.ConsumeTopics(topicName),
+		kgo.ConsumeResetOffset(kgo.NewOffset().AtStart()),
+		kgo.DisableAutoCommit(),
+	)
+	if err != nil {
+		t.Fatalf("group client failed: %v", err)
+	}
+	defer group.Close()
+
+	seen := map[string]bool{}
+	for len(seen) < 10 {
+		fetches := group.PollFetches(ctx)
+		if ctx.Err() != nil {
+			t.Fatalf("timed out after %d records", len(seen))
+		}
+		fetches.EachError(func(topic string, partition int32, err error) {
+			t.Fatalf("fetch error on %s %d: %v", topic, partition, err)
+		})
+		fetches.EachRecord(func(r *kgo.Record) {
+			seen[string(r.Value)] = true
+		})
+	}
+	if !seen[`{"n":0}`] || !seen["plain-1"] {
+		t.Errorf("Expected JSON and plain values to round trip, got %v", seen)
+	}
+
+	if err := group.CommitUncommittedOffsets(ctx); err != nil {
+		t.Fatalf("commit failed: %v", err)
+	}
+	committed := group.CommittedOffsets()
+	total := int64(0)
+	for _, partition := range committed[topicName] {
+		total += partition.Offset
+	}
+	if total != 10 {
+		t.Errorf("Expected committed offsets to add up to 10 but got %d", total)
+	}
+}
+
+func TestKafka_RecordsRoundTrip(t *testing.T) {
+	topicName := "kafka_round_trip_test"
+	createTestTopic(t, topicName, 1)
+	addr := startServer(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	client, err := kgo.NewClient(kgo.SeedBrokers(addr), kgo.DefaultProduceTopic(topicName), kgo.ProducerLinger(50*time.Millisecond))
+	if err != nil {
+		t.Fatalf("client failed: %v", err)
+	}
+	defer client.Close()
+
+	// Values the JSON log could mangle, produced as a single batch
+	values := [][]byte{[]byte(`"quoted"`), []byte("null"), []byte(`{ "a" : 1 }`), nil, {}, []byte("plain text"), {0xff, 0x00}}
+	records := []*kgo.Record{}
+	for i, value := range values {
+		records = append(records, &kgo.Record{
+			Key:     []byte("key-" + strconv.Itoa(i)),
+			Value:   value,
+			Headers: []kgo.RecordHeader{{Key: "h", Value: []byte(strconv.Itoa(i))}},
+		})
+	}
+	results := client.ProduceSync(ctx, records...)
+	if err := results.FirstErr(); err != nil {
+		t.Fatalf("produce failed: %v", err)
+	}
+	for i, result := range results {
+		if result.Record.Offset != results[0].Record.Offset+int64(i) {
+			t.Errorf("Expected contiguous offsets but record %d got %d", i, result.Record.Offset)
+		}
+	}
+
+	reader, err := kgo.NewClient(kgo.SeedBrokers(addr), kgo.ConsumeTopics(topicName), kgo.ConsumeResetOffset(kgo.NewOffset().AtStart()))
+	if err != nil {
+		t.Fatalf("reader failed: %v", err)
+	}
+	defer reader.Close()
+
+	fetched := []*kgo.Record{}
+	for len(fetched) < len(values) {
+		fetches := reader.PollFetches(ctx)
+		if ctx.Err() != nil {
+			t.Fatalf("timed out after %d records", len(fetched))
+		}
+		fetched = append(fetched, fetches.Records()...)
+	}
+	for i, r := range fetched {
+		if (r.Value == nil) != (values[i] == nil) || string(r.Value) != string(values[i]) {
+			t.Errorf("Record %d: expected value %q but got %q", i, values[i], r.Value)
+		}
+		if string(r.Key) != "key-"+strconv.Itoa(i) {
+			t.Errorf("Record %d: unexpected key %q", i, r.Key)
+		}
+		if len(r.Headers) != 1 || r.Headers[0].Key != "h" || string(r.Headers[0].Value) != strconv.Itoa(i) {
+			t.Errorf("Record %d: unexpected headers %v", i, r.Headers)
+		}
+	}
+
+	// The other APIs see the values as messages, keys and headers next to them
+	resp, err := consumer.Fetch(ctx, consumer.FetchRequest{Topic: topicName, Partition: 0, Offset: 1, MaxBytes: 1 << 20, MinBytes: 1, MaxWait: time.Second})
+	if err != nil {
+		t.Fatalf("fetch failed: %v", err)
+	}
+	messages := []string{`"quoted"`, `null`, `{ "a" : 1 }`, `null`, `""`, `"plain text"`, `"/wA="`}
+	for i, r := range resp.Records {
+		if string(r.Message) != messages[i] || string(r.Key) != "key-"+strconv.Itoa(i) {
+			t.Errorf("Record %d: expected message %s with its key but got %s %q", i, messages[i], r.Message, r.Key)
+		}
+	}
+}
+
+// JSON produced natively is never taken for a record's side fields
+func TestKafka_FetchesNativeMessages(t *testing.T) {
+	topicName := "kafka_native_test"
+	createTestTopic(t, topicName, 1)
+	ctx := context.Background()
+	native := `{"key":"a2V5","encoding":"base64"}`
+	if _, _, err := producer.ProduceToPartition(ctx, topicName, 0, json.RawMessage(native)); err != nil {
+		t.Fatalf("produce failed: %v", err)
+	}
+	resp, err := consumer.Fetch(ctx, consumer.FetchRequest{Topic: topicName, Partition: 0, Offset: 1, MaxBytes: 1 << 20, MinBytes: 1, MaxWait: time.Second})
+	if err != nil || len(resp.Records) != 1 {
+		t.Fatalf("fetch failed: %v %+v", err, resp)
+	}
+	r := fetchedRecord(resp.Records[0])
+	if r.Key != nil || string(r.Value) != native {
+		t.Errorf("Expected the native message as the value without key, got %q %q", r.Key, r.Value)
+	}
+}
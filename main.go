@@ -1,23 +1,45 @@
 package main
 
 import (
+	"FranzMQ/config"
 	"FranzMQ/constants"
+	"FranzMQ/consumer"
+	"FranzMQ/grpcserver"
+	"FranzMQ/kafka"
 	"FranzMQ/metrics"
+	"FranzMQ/mirror"
+	"FranzMQ/orchestrator"
+	"FranzMQ/orchestrator/store"
 	"FranzMQ/producer"
+	"FranzMQ/protocol"
+	"FranzMQ/quorum"
+	"FranzMQ/replication"
+	"FranzMQ/storage"
+	"FranzMQ/tiered"
 	"FranzMQ/topic"
+	"FranzMQ/utils"
 	"context"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 
 	// _ "net/http/pprof" // Import for side effects
 	"os"
+	"path/filepath"
+	"time"
 
 	"go.opentelemetry.io/otel"
+	"google.golang.org/grpc"
 )
 
-const dataDir = "/app/data"
+var brokerConfig config.Broker
+
+// The cluster metadata of a broker registered with etcd or the quorum, nil otherwise
+var cluster *orchestrator.Orchestrator
 
 type CreateTopicRequest struct {
 	Name   string `json:"name"`
@@ -35,6 +57,15 @@ type ProduceMessageRequest struct {
 	Message interface{} `json:"message"`
 }
 
+type FetchMessageRequest struct {
+	Topic     string `json:"topic"`
+	Partition int    `json:"partition"`
+	Offset    int    `json:"offset"`
+	MaxBytes  int    `json:"max_bytes"`
+	MinBytes  int    `json:"min_bytes"`
+	MaxWaitMs int    `json:"max_wait_ms"`
+}
+
 // JSON response helper
 func jsonResponse(w http.ResponseWriter, statusCode int, message interface{}) {
 	w.Header().Set("Content-Type", "application/json")
@@ -101,33 +132,310 @@ func produceMessage(w http.ResponseWriter, r *http.Request) {
 	jsonResponse(w, http.StatusOK, metaData)
 }
 
+func fetchMessages(w http.ResponseWriter, r *http.Request) {
+	// Request context so parked fetches are released when the client goes away
+	ctx, span := constants.Tracer.Start(r.Context(), "fetchMessages POST")
+	defer span.End()
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req FetchMessageRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonResponse(w, http.StatusBadRequest, "Invalid JSON request")
+		return
+	}
+	defer r.Body.Close()
+
+	resp, err := consumer.Fetch(ctx, consumer.FetchRequest{
+		Topic:     req.Topic,
+		Partition: req.Partition,
+		Offset:    req.Offset,
+		MaxBytes:  req.MaxBytes,
+		MinBytes:  req.MinBytes,
+		MaxWait:   time.Duration(req.MaxWaitMs) * time.Millisecond,
+	})
+	if err != nil {
+		jsonResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	jsonResponse(w, http.StatusOK, resp)
+}
+
 func ensureDataDir() {
-	if _, err := os.Stat(dataDir); os.IsNotExist(err) {
+	if !storage.Exists(brokerConfig.Storage.DataDir) {
 		log.Println("Data directory not found, creating...")
-		if err := os.MkdirAll(dataDir, 0755); err != nil {
+		if err := storage.MkdirAll(brokerConfig.Storage.DataDir); err != nil {
 			log.Fatalf("Error creating data directory: %v", err)
 		}
 	}
 }
 
-func main() {
+// Offload closed segments to the configured object store, including those
+// rolled before a restart
+func startTieredStorage() {
+	var store tiered.ObjectStore
+	switch brokerConfig.Tiered.Store {
+	case "":
+		return
+	case "local":
+		store = tiered.NewLocalStore(brokerConfig.Tiered.LocalDir)
+	case "s3":
+		s3, err := tiered.NewS3Store(brokerConfig.Tiered.S3Endpoint, brokerConfig.Tiered.S3Bucket,
+			brokerConfig.Tiered.S3Region, brokerConfig.Tiered.S3AccessKey, brokerConfig.Tiered.S3SecretKey)
+		if err != nil {
+			log.Fatalf("Error setting up tiered storage: %v", err)
+		}
+		store = s3
+	}
+	tiered.Start(store, brokerConfig.Cluster.BrokerID, brokerConfig.Tiered.RetryInterval)
+
+	ctx := context.Background()
+	names, err := topic.ListTopics(ctx)
+	if err != nil {
+		log.Println("Error listing topics to offload:", err)
+		return
+	}
+	for _, name := range names {
+		config, err := topic.LoadConfig(ctx, name)
+		if err != nil {
+			continue
+		}
+		for p := 0; p < config.NumOfPartition; p++ {
+			tiered.Enqueue(name, p)
+		}
+	}
+	log.Println("Tiered storage enabled with the", brokerConfig.Tiered.Store, "store")
+}
+
+// Delete the segments of every topic that are past its retention, from now
+// on every retention_check_interval
+func startRetention() {
+	go func() {
+		ticker := time.NewTicker(brokerConfig.Producer.RetentionCheckInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			ctx := context.Background()
+			names, err := topic.ListTopics(ctx)
+			if err != nil {
+				log.Println("Error listing topics for retention:", err)
+				continue
+			}
+			for _, name := range names {
+				config, err := topic.LoadConfig(ctx, name)
+				if err != nil {
+					continue
+				}
+				for p := 0; p < config.NumOfPartition; p++ {
+					if err := producer.EnforceRetention(ctx, name, p); err != nil {
+						log.Println("Error enforcing retention of", name, p, err)
+					}
+				}
+			}
+		}
+	}()
+}
 
-	tp, err := metrics.StartTracing()
+// Replicate topics across the brokers of the cluster, if there are others
+func startReplication() {
+	protocol.SetMetadataSource(replication.Describe)
+	if len(brokerConfig.Cluster.EtcdEndpoints) > 0 || len(brokerConfig.Cluster.Quorum) > 0 {
+		startOrchestrator()
+		return
+	}
+	if len(brokerConfig.Cluster.Brokers) <= 1 {
+		replication.Standalone(brokerConfig.Cluster.BrokerID, brokerConfig.AdvertisedAddr(), brokerConfig.Cluster.Rack)
+		return
+	}
+	replication.Start(replication.Settings{
+		BrokerID:          brokerConfig.Cluster.BrokerID,
+		Rack:              brokerConfig.Cluster.Rack,
+		Brokers:           parseBrokers(brokerConfig.Cluster.Brokers),
+		ReplicaLagTimeMax: brokerConfig.Cluster.ReplicaLagTimeMax,
+		FetchWait:         brokerConfig.Cluster.ReplicaFetchWait,
+		AckTimeout:        brokerConfig.Cluster.AckTimeout,
+	})
+	protocol.SetReplicaFetcher(replication.ServeReplicaFetch)
+	protocol.SetEpochOffsetter(replication.OffsetForLeaderEpoch)
+}
+
+// Register with etcd or the built-in quorum, the controller hands out the
+// partitions
+func startOrchestrator() {
+	replication.Start(replication.Settings{
+		BrokerID:          brokerConfig.Cluster.BrokerID,
+		Rack:              brokerConfig.Cluster.Rack,
+		Managed:           true,
+		ReplicaLagTimeMax: brokerConfig.Cluster.ReplicaLagTimeMax,
+		FetchWait:         brokerConfig.Cluster.ReplicaFetchWait,
+		AckTimeout:        brokerConfig.Cluster.AckTimeout,
+	})
+	protocol.SetReplicaFetcher(replication.ServeReplicaFetch)
+	protocol.SetEpochOffsetter(replication.OffsetForLeaderEpoch)
+
+	var metadata store.Store
+	if len(brokerConfig.Cluster.Quorum) > 0 {
+		dir := filepath.Join(brokerConfig.Storage.DataDir, "quorum")
+		if brokerConfig.Storage.Backend == "memory" {
+			dir = ""
+		}
+		node, err := quorum.Start(quorum.Settings{
+			NodeID: brokerConfig.Cluster.BrokerID,
+			Voters: parseBrokers(brokerConfig.Cluster.Quorum),
+			Dir:    dir,
+		})
+		if err != nil {
+			log.Fatalf("failed to start the metadata quorum: %v", err)
+		}
+		protocol.SetRaftHandler(node.Step)
+		metadata = node
+	} else {
+		etcd, err := utils.Etcd(brokerConfig.Cluster.EtcdEndpoints)
+		if err != nil {
+			log.Fatalf("failed to connect to etcd: %v", err)
+		}
+		metadata = store.NewEtcd(etcd)
+	}
+	imbalancePercent := brokerConfig.Cluster.LeaderImbalancePercent
+	if !brokerConfig.Cluster.AutoLeaderRebalance {
+		imbalancePercent = 0
+	}
+	cluster = orchestrator.Start(orchestrator.Settings{
+		BrokerID:   brokerConfig.Cluster.BrokerID,
+		Addr:       brokerConfig.AdvertisedAddr(),
+		Rack:       brokerConfig.Cluster.Rack,
+		Store:      metadata,
+		SessionTTL: brokerConfig.Cluster.SessionTTL,
+
+		LeaderImbalancePercent:       imbalancePercent,
+		LeaderImbalanceCheckInterval: brokerConfig.Cluster.LeaderImbalanceCheckInterval,
+	})
+	protocol.SetReassigner(cluster)
+	protocol.SetLeaderElector(cluster.ElectPreferredLeaders)
+}
+
+// Copy the topics of another cluster into this one, if one is configured
+func startMirror() {
+	if brokerConfig.Mirror.Source == "" {
+		return
+	}
+	renames, err := mirror.ParseRenames(brokerConfig.Mirror.TopicRenames)
+	if err != nil {
+		log.Fatalf("invalid mirror.topic_renames: %v", err)
+	}
+	_, err = mirror.Start(mirror.Settings{
+		Source:             brokerConfig.Mirror.Source,
+		Target:             brokerConfig.AdvertisedAddr(),
+		Topics:             brokerConfig.Mirror.Topics,
+		Prefix:             brokerConfig.Mirror.TopicPrefix,
+		Renames:            renames,
+		Replicas:           brokerConfig.Mirror.Replicas,
+		CheckpointTopic:    brokerConfig.Mirror.CheckpointTopic,
+		CheckpointInterval: brokerConfig.Mirror.CheckpointInterval,
+		RefreshInterval:    brokerConfig.Mirror.RefreshInterval,
+		SyncGroupOffsets:   brokerConfig.Mirror.SyncGroupOffsets,
+	})
 	if err != nil {
-		log.Fatalf("failed to initialize tracer: %v", err)
+		log.Fatalf("failed to start mirroring: %v", err)
+	}
+}
+
+// Broker addresses by id of a list checked by config.Load
+func parseBrokers(list []string) map[int]string {
+	brokers := map[int]string{}
+	for _, broker := range list {
+		id, addr, _ := config.ParseBroker(broker)
+		brokers[id] = addr
+	}
+	return brokers
+}
+
+// Serve an endpoint of the HTTP listener, timing its requests
+func handleHTTP(pattern string, handler http.HandlerFunc) {
+	http.HandleFunc(pattern, metrics.InstrumentHTTP(pattern, handler))
+}
+
+func main() {
+	var err error
+	if brokerConfig, err = config.Load(os.Args[1:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return
+		}
+		log.Fatalf("invalid configuration: %v", err)
+	}
+
+	if brokerConfig.Tracing.Endpoint != "" {
+		tp, err := metrics.StartTracing(brokerConfig.Tracing.Endpoint)
+		if err != nil {
+			log.Fatalf("failed to initialize tracer: %v", err)
+		}
+		defer func() { _ = tp.Shutdown(context.Background()) }()
 	}
-	defer func() { _ = tp.Shutdown(context.Background()) }()
 
 	constants.Tracer = otel.Tracer("franzmq")
+	if brokerConfig.Storage.Backend == "memory" {
+		storage.SetBackend(storage.NewMemoryBackend())
+	}
+	constants.SetDataDir(brokerConfig.Storage.DataDir)
+	storage.SetLogDirs(brokerConfig.Storage.LogDirs)
+	utils.SetFileCacheExpiry(brokerConfig.Storage.FileCacheDuration)
+	producer.Configure(producer.Settings{
+		PartitionQueueSize:  brokerConfig.Producer.PartitionQueueSize,
+		WriterQueueSize:     brokerConfig.Producer.WriterQueueSize,
+		WriterBatchSize:     brokerConfig.Producer.WriterBatchSize,
+		WriterFlushInterval: brokerConfig.Producer.WriterFlushInterval,
+		ConfigCacheDuration: brokerConfig.Producer.ConfigCacheDuration,
+	})
 	go producer.GlobalWriterThread(producer.GlobalLogWriterQueue)
 	go producer.GlobalWriterThread(producer.GlobalIndexWriterQueue)
 
 	ensureDataDir()
-	http.HandleFunc("/create-topic", createTopic)
-	http.HandleFunc("/produce", produceMessage)
+	topic.PurgeDeleted()
+	startTieredStorage()
+	startRetention()
+	startReplication()
+	startMirror()
+	handleHTTP("/create-topic", createTopic)
+	handleHTTP("/produce", produceMessage)
+	handleHTTP("/fetch", fetchMessages)
+	http.HandleFunc("/stream", streamMessages) // Long lived, not timed
+	handleHTTP("/topics", listTopics)
+	handleHTTP("/topics/{name}", topicByName)
+	handleHTTP("/topics/{name}/configs", topicConfigs)
+	handleHTTP("/metadata", clusterMetadata)
+	handleHTTP("/admin/config", adminConfig)
+	handleHTTP("/reassignments", reassignments)
+	handleHTTP("/brokers/{id}/decommission", decommissionBroker)
+	handleHTTP("/elect-leaders", electLeaders)
+	go func() {
+		fmt.Println("🚀 FranzMQ binary protocol running on", brokerConfig.Listeners.Binary)
+		log.Fatal(protocol.NewServer().ListenAndServe(brokerConfig.Listeners.Binary))
+	}()
+	go func() {
+		fmt.Println("🚀 FranzMQ kafka protocol running on", brokerConfig.Listeners.Kafka)
+		kafkaServer := kafka.NewServer(brokerConfig.Listeners.KafkaAdvertisedHost, brokerConfig.KafkaPort())
+		log.Fatal(kafkaServer.ListenAndServe(brokerConfig.Listeners.Kafka))
+	}()
+	grpcListener, err := net.Listen("tcp", brokerConfig.Listeners.GRPC)
+	if err != nil {
+		log.Fatalf("failed to listen for gRPC: %v", err)
+	}
+	go func() {
+		fmt.Println("🚀 FranzMQ gRPC running on", brokerConfig.Listeners.GRPC)
+		log.Fatal(grpcserver.NewServer(grpc.UnaryInterceptor(metrics.UnaryInterceptor)).Serve(grpcListener))
+	}()
+	_, grpcPort, _ := net.SplitHostPort(brokerConfig.Listeners.GRPC)
+	gateway, err := grpcserver.NewGateway(context.Background(), net.JoinHostPort("localhost", grpcPort))
+	if err != nil {
+		log.Fatalf("failed to start gRPC gateway: %v", err)
+	}
+	http.Handle("/v1/", gateway)
+	http.Handle("/metrics", metrics.Handler())
 	// go func() {
 	// 	log.Println(http.ListenAndServe(":6060", nil))
 	// }()
-	fmt.Println("🚀 FranzMQ server running on port 8080")
-	log.Fatal(http.ListenAndServe(":8080", nil)) // TODO: pick from env
+	fmt.Println("🚀 FranzMQ server running on", brokerConfig.Listeners.HTTP)
+	log.Fatal(http.ListenAndServe(brokerConfig.Listeners.HTTP, nil))
 }
@@ -62,6 +62,17 @@ func (s *SafeMap) INCRBY(ctx context.Context, key string, value int) int {
 	return newVal
 }
 
+// SET replaces the value of a key
+func (s *SafeMap) SET(ctx context.Context, key string, value int) {
+	ctx, span := tracer.Start(ctx, "SET")
+	defer span.End()
+
+	lock := s.getLock(ctx, key)
+	lock.Lock()
+	defer lock.Unlock()
+	s.data.Store(key, value)
+}
+
 // getLock retrieves or initializes a lock for a key
 func (s *SafeMap) getLock(ctx context.Context, key string) *sync.Mutex {
 	ctx, span := tracer.Start(ctx, "getLock")
@@ -70,3 +81,13 @@ func (s *SafeMap) getLock(ctx context.Context, key string) *sync.Mutex {
 	actual, _ := s.locks.LoadOrStore(key, &sync.Mutex{})
 	return actual.(*sync.Mutex)
 }
+
+// Delete removes a key and its lock, callers must make sure nobody else is
+// updating the key anymore
+func (s *SafeMap) Delete(ctx context.Context, key string) {
+	_, span := tracer.Start(ctx, "Delete")
+	defer span.End()
+
+	s.data.Delete(key)
+	s.locks.Delete(key)
+}
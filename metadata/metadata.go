@@ -0,0 +1,53 @@
+// Package metadata describes where the partitions of a cluster live, so
+// clients can send produces and fetches straight to the partition leaders.
+package metadata
+
+// Cluster is what a broker knows about the brokers of its cluster and the
+// partitions of the topics asked for
+type Cluster struct {
+	Brokers []Broker `json:"brokers"`
+	Topics  []Topic  `json:"topics"`
+}
+
+// Broker is the binary listener of a broker
+type Broker struct {
+	ID   int    `json:"id"`
+	Host string `json:"host"`
+	Port int    `json:"port"`
+	Rack string `json:"rack,omitempty"`
+}
+
+type Topic struct {
+	Name       string      `json:"name"`
+	Partitions []Partition `json:"partitions"`
+}
+
+// Partition lists the replicas of a partition and which of them leads. Only
+// the brokers holding a replica know the in-sync replicas, the others leave
+// them empty.
+type Partition struct {
+	Partition      int   `json:"partition"`
+	Leader         int   `json:"leader"` // -1 while none of the replicas is up
+	Replicas       []int `json:"replicas"`
+	InSyncReplicas []int `json:"isr"`
+}
+
+// Reassignment is the progress of a partition moving to other brokers
+type Reassignment struct {
+	Topic          string `json:"topic"`
+	Partition      int    `json:"partition"`
+	Replicas       []int  `json:"replicas"` // Where the partition is now
+	Target         []int  `json:"target"`   // Where it goes
+	Adding         []int  `json:"adding"`
+	Removing       []int  `json:"removing"`
+	InSyncReplicas []int  `json:"isr"`
+	Throttle       int    `json:"throttle,omitempty"` // Bytes per second the new replicas copy at
+	State          string `json:"state"`
+}
+
+// States of a reassignment, in order
+const (
+	ReassignmentPending  = "pending"  // The controller has not picked it up yet
+	ReassignmentCopying  = "copying"  // The new replicas catch up with the leader
+	ReassignmentElecting = "electing" // Leadership moves to a new replica
+)
@@ -0,0 +1,31 @@
+package metrics
+
+import "github.com/prometheus/client_golang/prometheus"
+
+// Sample is the value of a gauge when scraped, with its label values
+type Sample struct {
+	Labels []string
+	Value  float64
+}
+
+// gaugeFunc is a gauge read from its source on every scrape
+type gaugeFunc struct {
+	desc *prometheus.Desc
+	read func() []Sample
+}
+
+func (g *gaugeFunc) Describe(ch chan<- *prometheus.Desc) {
+	ch <- g.desc
+}
+
+func (g *gaugeFunc) Collect(ch chan<- prometheus.Metric) {
+	for _, s := range g.read() {
+		ch <- prometheus.MustNewConstMetric(g.desc, prometheus.GaugeValue, s.Value, s.Labels...)
+	}
+}
+
+// RegisterGauges adds a gauge that calls read on every scrape, each sample
+// becoming a series with the labels
+func RegisterGauges(name, help string, labels []string, read func() []Sample) {
+	Registry.MustRegister(&gaugeFunc{desc: prometheus.NewDesc(name, help, labels, nil), read: read})
+}
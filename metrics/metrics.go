@@ -0,0 +1,107 @@
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"google.golang.org/grpc"
+)
+
+// Registry holds the broker's metrics, served by Handler
+var Registry = prometheus.NewRegistry()
+
+var (
+	producedRecords = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "franzmq_produced_records_total",
+		Help: "Records appended to a partition on this broker",
+	}, []string{"topic", "partition"})
+	producedBytes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "franzmq_produced_bytes_total",
+		Help: "Bytes of the records appended to a partition on this broker",
+	}, []string{"topic", "partition"})
+	flushBatchSize = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "franzmq_flush_batch_entries",
+		Help:    "Entries written to a file by one flush of the writer threads",
+		Buckets: prometheus.ExponentialBuckets(1, 2, 12),
+	})
+	flushDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "franzmq_flush_duration_seconds",
+		Help:    "Time a flush of the writer threads takes to append to a file",
+		Buckets: prometheus.ExponentialBuckets(0.00005, 2, 16),
+	})
+	fsyncDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "franzmq_fsync_duration_seconds",
+		Help:    "Time syncing a file to disk takes when it is closed or rolled",
+		Buckets: prometheus.ExponentialBuckets(0.00005, 2, 16),
+	})
+	requestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "franzmq_request_duration_seconds",
+		Help:    "Time requests take to be handled, parked fetches included, by listener and endpoint",
+		Buckets: prometheus.ExponentialBuckets(0.0001, 2, 16),
+	}, []string{"listener", "endpoint"})
+)
+
+func init() {
+	Registry.MustRegister(
+		producedRecords, producedBytes, flushBatchSize, flushDuration, fsyncDuration, requestDuration,
+		prometheus.NewGoCollector(),
+		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+	)
+}
+
+// Handler serves the metrics in the Prometheus text format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
+
+// Produced counts a record of size bytes appended to a partition
+func Produced(topic string, partition, size int) {
+	p := strconv.Itoa(partition)
+	producedRecords.WithLabelValues(topic, p).Inc()
+	producedBytes.WithLabelValues(topic, p).Add(float64(size))
+}
+
+// RemoveTopic drops the series of the partitions of a deleted topic
+func RemoveTopic(topic string, partitions int) {
+	for partition := 0; partition < partitions; partition++ {
+		p := strconv.Itoa(partition)
+		producedRecords.DeleteLabelValues(topic, p)
+		producedBytes.DeleteLabelValues(topic, p)
+	}
+}
+
+// Flushed records a flush of entries to a file that started at start
+func Flushed(entries int, start time.Time) {
+	flushBatchSize.Observe(float64(entries))
+	flushDuration.Observe(time.Since(start).Seconds())
+}
+
+// Synced records a file sync that started at start
+func Synced(start time.Time) {
+	fsyncDuration.Observe(time.Since(start).Seconds())
+}
+
+// ObserveRequest records a request to an endpoint of a listener that started
+// at start, meant to be deferred
+func ObserveRequest(listener, endpoint string, start time.Time) {
+	requestDuration.WithLabelValues(listener, endpoint).Observe(time.Since(start).Seconds())
+}
+
+// InstrumentHTTP times the requests of an HTTP handler as endpoint
+func InstrumentHTTP(endpoint string, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer ObserveRequest("http", endpoint, time.Now())
+		handler(w, r)
+	}
+}
+
+// UnaryInterceptor times the unary calls of a gRPC server by method, streams
+// live too long for a latency
+func UnaryInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	defer ObserveRequest("grpc", info.FullMethod, time.Now())
+	return handler(ctx, req)
+}
@@ -0,0 +1,49 @@
+package metrics
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHandler_ServesCountersAndGauges(t *testing.T) {
+	Produced("metrics_test", 1, 10)
+	Produced("metrics_test", 1, 5)
+	ObserveRequest("binary", "Produce", time.Now())
+	RegisterGauges("franzmq_test_depth", "A gauge of the test", []string{"queue"}, func() []Sample {
+		return []Sample{{Labels: []string{"log"}, Value: 3}}
+	})
+
+	recorder := httptest.NewRecorder()
+	Handler().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	body, _ := io.ReadAll(recorder.Body)
+	for _, line := range []string{
+		`franzmq_produced_records_total{partition="1",topic="metrics_test"} 2`,
+		`franzmq_produced_bytes_total{partition="1",topic="metrics_test"} 15`,
+		`franzmq_request_duration_seconds_count{endpoint="Produce",listener="binary"} 1`,
+		`franzmq_test_depth{queue="log"} 3`,
+	} {
+		if !strings.Contains(string(body), line) {
+			t.Errorf("Expected the metrics to contain %s", line)
+		}
+	}
+}
+
+func TestRemoveTopic_DropsPartitionSeries(t *testing.T) {
+	Produced("metrics_removed", 0, 10)
+	Produced("metrics_removed", 1, 10)
+	Produced("metrics_kept", 0, 10)
+	RemoveTopic("metrics_removed", 2)
+
+	recorder := httptest.NewRecorder()
+	Handler().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	body, _ := io.ReadAll(recorder.Body)
+	if strings.Contains(string(body), `topic="metrics_removed"`) {
+		t.Error("Expected the series of the removed topic to be gone")
+	}
+	if !strings.Contains(string(body), `franzmq_produced_records_total{partition="0",topic="metrics_kept"} 1`) {
+		t.Error("Expected the series of other topics to stay")
+	}
+}
@@ -14,7 +14,7 @@ import (
 	semconv "go.opentelemetry.io/otel/semconv/v1.22.0"
 )
 
-func StartTracing() (*trace.TracerProvider, error) {
+func StartTracing(endpoint string) (*trace.TracerProvider, error) {
 	headers := map[string]string{
 		"content-type": "application/json",
 	}
@@ -22,7 +22,7 @@ func StartTracing() (*trace.TracerProvider, error) {
 	exporter, err := otlptrace.New(
 		context.Background(),
 		otlptracehttp.NewClient(
-			otlptracehttp.WithEndpoint("jaeger:4318"),
+			otlptracehttp.WithEndpoint(endpoint),
 			otlptracehttp.WithHeaders(headers),
 			otlptracehttp.WithInsecure(),
 		),
@@ -0,0 +1,157 @@
+package mirror
+
+import (
+	"FranzMQ/client"
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+)
+
+// Checkpoint is how far a source partition was copied, the records of the
+// checkpoint topic are their JSON
+type Checkpoint struct {
+	Topic        string `json:"topic"` // Source topic
+	Partition    int    `json:"partition"`
+	SourceOffset int    `json:"source_offset"` // Next offset of the source to copy, 0 once the topic was deleted
+	TargetOffset int    `json:"target_offset"` // Offset the copy of SourceOffset gets on the target
+	Timestamp    int64  `json:"timestamp"`     // Unix nanoseconds
+}
+
+// Create the checkpoint topic on the target if needed and resume every
+// partition from its last checkpoint
+func (m *Mirror) loadCheckpoints(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+	name := m.settings.CheckpointTopic
+	topics, err := m.target.ListTopics(ctx)
+	if err != nil {
+		return err
+	}
+	if _, found := topics[name]; !found {
+		if err := m.target.CreateTopic(ctx, name, client.TopicConfig{Partitions: 1, Replicas: m.settings.Replicas}); err != nil {
+			return err
+		}
+		log.Println("Created mirror checkpoint topic", name)
+		return nil
+	}
+
+	offset, err := m.target.ListOffset(ctx, name, 0, client.EarliestOffset)
+	if err != nil {
+		return err
+	}
+	latest, err := m.target.ListOffset(ctx, name, 0, client.LatestOffset)
+	if err != nil {
+		return err
+	}
+	checkpoints := map[client.TopicPartition]Checkpoint{}
+	for offset < latest {
+		records, nextOffset, err := m.target.Fetch(ctx, name, 0, offset, 0)
+		if err != nil {
+			return err
+		}
+		if len(records) == 0 {
+			break
+		}
+		for _, record := range records {
+			var c Checkpoint
+			if err := json.Unmarshal(record.Value, &c); err != nil {
+				log.Println("Skipping invalid mirror checkpoint at offset", record.Offset, err)
+				continue
+			}
+			checkpoints[client.TopicPartition{Topic: c.Topic, Partition: c.Partition}] = c
+		}
+		offset = nextOffset
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for tp, c := range checkpoints {
+		if c.SourceOffset == 0 {
+			continue // Reset when its topic was deleted
+		}
+		state := m.state(tp)
+		state.sourceOffset, state.targetOffset = c.SourceOffset, c.TargetOffset
+		state.syncs = []offsetSync{{source: c.SourceOffset, target: c.TargetOffset}}
+		state.checkpointed = true
+	}
+	log.Println("Loaded", len(checkpoints), "mirror checkpoints from", name)
+	return nil
+}
+
+// Write a checkpoint of every partition copied further or reset since the
+// last one
+func (m *Mirror) checkpoint(ctx context.Context) {
+	now := time.Now().UnixNano()
+	var written []*partitionState
+	var values [][]byte
+	m.mu.Lock()
+	for tp, state := range m.partitions {
+		if state.checkpointed {
+			continue
+		}
+		value, _ := json.Marshal(Checkpoint{
+			Topic:        tp.Topic,
+			Partition:    tp.Partition,
+			SourceOffset: state.sourceOffset,
+			TargetOffset: state.targetOffset,
+			Timestamp:    now,
+		})
+		values = append(values, value)
+		written = append(written, state)
+		state.checkpointed = true
+	}
+	m.mu.Unlock()
+	if len(values) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+	if _, err := m.produce(ctx, &m.checkpointer, m.settings.CheckpointTopic, 0, values); err != nil {
+		log.Println("Error writing mirror checkpoints to", m.settings.CheckpointTopic, err)
+		m.mu.Lock()
+		for _, state := range written {
+			state.checkpointed = false
+		}
+		m.mu.Unlock()
+	}
+}
+
+// Commit the offsets of the source groups on the target, translated to the
+// mirrored topics, so their consumers can move over. Groups with members on
+// the target commit their own and are left alone, and offsets only move
+// forward.
+func (m *Mirror) syncGroupOffsets(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+	groups, err := m.source.ListGroups(ctx)
+	if err != nil {
+		log.Println("Error listing groups of the source cluster:", err)
+		return
+	}
+	for _, groupID := range groups {
+		source, err := m.source.DescribeGroup(ctx, groupID)
+		if err != nil {
+			continue
+		}
+		// A group the target never saw does not describe
+		target, err := m.target.DescribeGroup(ctx, groupID)
+		if err == nil && len(target.Members) > 0 {
+			continue
+		}
+		for tp, offset := range source.Offsets {
+			translated, found := m.Translate(tp.Topic, tp.Partition, offset)
+			if !found {
+				continue
+			}
+			targetTP := client.TopicPartition{Topic: m.TargetTopic(tp.Topic), Partition: tp.Partition}
+			if committed, found := target.Offsets[targetTP]; found && committed >= translated {
+				continue
+			}
+			if err := m.target.CommitOffset(ctx, groupID, targetTP, translated); err != nil {
+				log.Println("Error syncing offset of group", groupID, "for", targetTP.Topic, targetTP.Partition, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,298 @@
+// Package mirror copies topics from one FranzMQ cluster to another, like
+// Kafka's MirrorMaker. Every partition of a selected source topic is copied
+// to the same partition of a topic on the target, named after it. Where the
+// copy got to is checkpointed to a topic on the target, so a restarted mirror
+// resumes there, and the checkpoints translate offsets of the source to the
+// target for consumers failing over.
+//
+// Copies are at least once: records mirrored after the last checkpoint are
+// copied again after a restart. A topic deleted from either cluster is copied
+// from the start of the source topic once it is back.
+//
+// A record is copied as the message every API returns, the stored JSON. Its
+// key is not carried over, nor the headers and value encoding of records
+// produced by Kafka clients, so a binary Kafka value reaches the target as
+// the JSON string of its base64.
+//
+// Run it in a broker of the target cluster from the mirror section of its
+// config, or on its own with cmd/franzmq-mirror.
+package mirror
+
+import (
+	"FranzMQ/client"
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultCheckpointTopic = "mirror-checkpoints"
+
+	defaultCheckpointInterval = 10 * time.Second
+	defaultRefreshInterval    = 30 * time.Second
+	defaultFetchWait          = 500 * time.Millisecond
+	retryBackoff              = time.Second
+	requestTimeout            = 10 * time.Second
+)
+
+type Settings struct {
+	Source string // Binary listener of a broker of the source cluster
+	Target string // Binary listener of a broker of the target cluster
+
+	Topics   string            // Regular expression source topic names must match entirely, every topic when empty
+	Prefix   string            // Put before the names of the topics on the target, e.g. "us-east."
+	Renames  map[string]string // Target names of source topics, instead of the prefixed ones
+	Replicas int               // Replication factor of the topics created on the target, 1 when 0
+
+	CheckpointTopic    string        // Topic of the target the checkpoints go to, Prefix + DefaultCheckpointTopic when empty
+	CheckpointInterval time.Duration // 10s when 0
+	RefreshInterval    time.Duration // How often new source topics and partitions are looked for, 30s when 0
+	FetchWait          time.Duration // Longest a fetch from the source waits for records, 500ms when 0
+
+	SyncGroupOffsets bool // Commit the translated offsets of source groups on the target for groups without members there
+}
+
+// mirroredTopic is a source topic whose partitions are being copied
+type mirroredTopic struct {
+	partitions int // Being copied
+	ctx        context.Context
+	cancel     context.CancelFunc
+	wg         sync.WaitGroup
+}
+
+// Mirror copies the selected topics until stopped
+type Mirror struct {
+	settings Settings
+	topics   *regexp.Regexp
+	source   *client.Client // Topic discovery and group offsets
+	target   *client.Client
+	// Writes checkpoints, moved to the leader of the checkpoint topic
+	checkpointer *client.Client
+
+	mu         sync.Mutex
+	partitions map[client.TopicPartition]*partitionState // Key: source partition
+	started    map[string]*mirroredTopic                 // Key: source topic, only used by run
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+	done   chan struct{}
+}
+
+// Start mirrors in the background. It keeps retrying while either cluster
+// is unreachable.
+func Start(s Settings) (*Mirror, error) {
+	if s.Source == "" || s.Target == "" {
+		return nil, fmt.Errorf("source and target addresses are required")
+	}
+	if s.Topics == "" {
+		s.Topics = ".*"
+	}
+	topics, err := regexp.Compile("^(?:" + s.Topics + ")$")
+	if err != nil {
+		return nil, fmt.Errorf("invalid topics expression: %w", err)
+	}
+	if s.Replicas <= 0 {
+		s.Replicas = 1
+	}
+	if s.CheckpointTopic == "" {
+		s.CheckpointTopic = s.Prefix + DefaultCheckpointTopic
+	}
+	if s.CheckpointInterval <= 0 {
+		s.CheckpointInterval = defaultCheckpointInterval
+	}
+	if s.RefreshInterval <= 0 {
+		s.RefreshInterval = defaultRefreshInterval
+	}
+	if s.FetchWait <= 0 {
+		s.FetchWait = defaultFetchWait
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	m := &Mirror{
+		settings: s,
+		topics:   topics,
+		source:   client.NewClient(s.Source),
+		target:   client.NewClient(s.Target),
+
+		checkpointer: client.NewClient(s.Target),
+		partitions:   make(map[client.TopicPartition]*partitionState),
+		started:      make(map[string]*mirroredTopic),
+		cancel:       cancel,
+		done:         make(chan struct{}),
+	}
+	go m.run(ctx)
+	return m, nil
+}
+
+// Stop stops copying and checkpoints where every partition got to
+func (m *Mirror) Stop() {
+	m.cancel()
+	<-m.done
+}
+
+// ParseRenames reads source=target topic name pairs
+func ParseRenames(pairs []string) (map[string]string, error) {
+	renames := map[string]string{}
+	for _, pair := range pairs {
+		source, target, found := strings.Cut(pair, "=")
+		if !found || source == "" || target == "" {
+			return nil, fmt.Errorf("topic rename %q is not source=target", pair)
+		}
+		renames[source] = target
+	}
+	return renames, nil
+}
+
+// TargetTopic returns the name a source topic has on the target
+func (m *Mirror) TargetTopic(sourceTopic string) string {
+	if name, found := m.settings.Renames[sourceTopic]; found {
+		return name
+	}
+	return m.settings.Prefix + sourceTopic
+}
+
+func (m *Mirror) run(ctx context.Context) {
+	defer close(m.done)
+	defer m.source.Close()
+	defer m.target.Close()
+	defer func() { m.checkpointer.Close() }()
+
+	// Nothing is copied before the checkpoints say where to resume
+	for {
+		err := m.loadCheckpoints(ctx)
+		if err == nil {
+			break
+		}
+		log.Println("Error loading mirror checkpoints from", m.settings.CheckpointTopic, err)
+		if !sleep(ctx, retryBackoff) {
+			return
+		}
+	}
+	log.Println("Mirroring topics of", m.settings.Source, "to", m.settings.Target)
+
+	refresh := time.NewTicker(m.settings.RefreshInterval)
+	defer refresh.Stop()
+	checkpoint := time.NewTicker(m.settings.CheckpointInterval)
+	defer checkpoint.Stop()
+	m.refresh(ctx)
+	for {
+		select {
+		case <-refresh.C:
+			m.refresh(ctx)
+		case <-checkpoint.C:
+			m.checkpoint(ctx)
+			if m.settings.SyncGroupOffsets {
+				m.syncGroupOffsets(ctx)
+			}
+		case <-ctx.Done():
+			m.wg.Wait()
+			// The mirror's context is gone, give the last checkpoint its own
+			finalCtx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+			m.checkpoint(finalCtx)
+			cancel()
+			return
+		}
+	}
+}
+
+// Look for source topics to mirror, create them on the target and start
+// copying their new partitions. Topics deleted from either cluster stop
+// being copied and start over from the earliest offset if they come back.
+func (m *Mirror) refresh(ctx context.Context) {
+	listCtx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+	sourceTopics, err := m.source.ListTopics(listCtx)
+	if err != nil {
+		log.Println("Error listing topics of the source cluster:", err)
+		return
+	}
+	targetTopics, err := m.target.ListTopics(listCtx)
+	if err != nil {
+		log.Println("Error listing topics of the target cluster:", err)
+		return
+	}
+
+	for name, mirrored := range m.started {
+		if _, found := sourceTopics[name]; !found {
+			log.Println("Topic", name, "was deleted from the source cluster, no longer mirroring it")
+		} else if _, found := targetTopics[m.TargetTopic(name)]; !found {
+			log.Println("Mirror", m.TargetTopic(name), "of topic", name, "was deleted from the target cluster")
+		} else {
+			continue
+		}
+		m.stopTopic(name, mirrored)
+	}
+
+	for name, partitions := range sourceTopics {
+		if !m.topics.MatchString(name) || name == m.settings.CheckpointTopic {
+			continue
+		}
+		mirrored, found := m.started[name]
+		if found && mirrored.partitions >= partitions {
+			continue
+		}
+		if err := m.ensureTopic(listCtx, name, partitions, targetTopics); err != nil {
+			log.Println("Error creating mirror of topic", name, "on the target cluster:", err)
+			continue
+		}
+		if !found {
+			mirrored = &mirroredTopic{}
+			mirrored.ctx, mirrored.cancel = context.WithCancel(ctx)
+			m.started[name] = mirrored
+		}
+		for p := mirrored.partitions; p < partitions; p++ {
+			m.startPartition(mirrored, client.TopicPartition{Topic: name, Partition: p})
+		}
+		mirrored.partitions = partitions
+	}
+}
+
+// Create the target topic of a source topic with its partitions and
+// settings, or add the partitions it lacks
+func (m *Mirror) ensureTopic(ctx context.Context, name string, partitions int, targetTopics map[string]int) error {
+	targetName := m.TargetTopic(name)
+	if existing, found := targetTopics[targetName]; found {
+		if existing >= partitions {
+			return nil
+		}
+		log.Println("Adding partitions to mirrored topic", targetName, "to match", name)
+		return m.target.CreatePartitions(ctx, targetName, partitions)
+	}
+
+	entries, err := m.source.DescribeConfigs(ctx, name)
+	if err != nil {
+		return err
+	}
+	config := client.TopicConfig{Partitions: partitions, Replicas: m.settings.Replicas}
+	changes := map[string]string{}
+	for _, entry := range entries {
+		switch {
+		case entry.Name == "compression":
+			config.Compression = entry.Value
+		case !entry.Default && !entry.ReadOnly:
+			changes[entry.Name] = entry.Value
+		}
+	}
+	if err := m.target.CreateTopic(ctx, targetName, config); err != nil {
+		return err
+	}
+	log.Println("Created topic", targetName, "mirroring", name)
+	if len(changes) == 0 {
+		return nil
+	}
+	return m.target.AlterConfigs(ctx, targetName, changes)
+}
+
+// Wait for d unless ctx is done first, false when it is
+func sleep(ctx context.Context, d time.Duration) bool {
+	select {
+	case <-time.After(d):
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,188 @@
+package mirror
+
+import (
+	"FranzMQ/client"
+	"FranzMQ/client/clienttest"
+	"context"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestTargetTopic(t *testing.T) {
+	renames, err := ParseRenames([]string{"orders=east-orders"})
+	if err != nil {
+		t.Fatalf("parse renames failed: %v", err)
+	}
+	m := &Mirror{settings: Settings{Prefix: "east.", Renames: renames}}
+	if name := m.TargetTopic("orders"); name != "east-orders" {
+		t.Errorf("Expected the renamed east-orders but got %s", name)
+	}
+	if name := m.TargetTopic("payments"); name != "east.payments" {
+		t.Errorf("Expected the prefixed east.payments but got %s", name)
+	}
+	if _, err := ParseRenames([]string{"orders"}); err == nil {
+		t.Error("Expected a rename without a target to be refused")
+	}
+}
+
+// The broker is both clusters, the copies are told apart by their prefix
+func TestMirror_CopiesResumesAndSyncsGroups(t *testing.T) {
+	broker := clienttest.NewBroker(t)
+	sourceTopic, targetTopic := "mirror_orders", "east.mirror_orders"
+	broker.CreateTopic(sourceTopic, 2)
+	c := client.NewClient(broker.Addr())
+	defer c.Close()
+	ctx := context.Background()
+	t.Cleanup(func() {
+		c.DeleteTopic(ctx, targetTopic)
+		c.DeleteTopic(ctx, "east."+DefaultCheckpointTopic)
+	})
+
+	produce := func(partition, n int) {
+		t.Helper()
+		if _, err := c.Produce(ctx, sourceTopic, partition, []byte(`{"n":`+strconv.Itoa(n)+`}`)); err != nil {
+			t.Fatalf("produce failed: %v", err)
+		}
+	}
+	for n := 0; n < 3; n++ {
+		produce(0, n)
+	}
+	if _, err := c.Produce(ctx, sourceTopic, 1, []byte("plain text")); err != nil {
+		t.Fatalf("produce failed: %v", err)
+	}
+
+	settings := Settings{
+		Source:             broker.Addr(),
+		Target:             broker.Addr(),
+		Topics:             "mirror_.*",
+		Prefix:             "east.",
+		CheckpointInterval: 50 * time.Millisecond,
+		RefreshInterval:    50 * time.Millisecond,
+		FetchWait:          20 * time.Millisecond,
+		SyncGroupOffsets:   true,
+	}
+	m, err := Start(settings)
+	if err != nil {
+		t.Fatalf("start failed: %v", err)
+	}
+	waitForRecords(t, c, targetTopic, 0, 3)
+	waitForRecords(t, c, targetTopic, 1, 1)
+	if records := readAll(t, c, targetTopic, 0); string(records[2].Value) != `{"n":2}` {
+		t.Errorf("Expected the third copy to be {\"n\":2} but got %s", records[2].Value)
+	}
+	if source, copies := readAll(t, c, sourceTopic, 1), readAll(t, c, targetTopic, 1); string(copies[0].Value) != string(source[0].Value) {
+		t.Errorf("Expected the copy of a text message to be %s but got %s", source[0].Value, copies[0].Value)
+	}
+
+	// A group done with the source partition is done with its copy too
+	sourceEnd, _ := c.ListOffset(ctx, sourceTopic, 0, client.LatestOffset)
+	targetEnd, _ := c.ListOffset(ctx, targetTopic, 0, client.LatestOffset)
+	if err := c.CommitOffset(ctx, "mirror_group", client.TopicPartition{Topic: sourceTopic, Partition: 0}, sourceEnd); err != nil {
+		t.Fatalf("commit failed: %v", err)
+	}
+	eventually(t, func() bool {
+		desc, err := c.DescribeGroup(ctx, "mirror_group")
+		return err == nil && desc.Offsets[client.TopicPartition{Topic: targetTopic, Partition: 0}] == targetEnd
+	}, "the group offset to be translated to the copy")
+
+	// Stopping checkpoints, a new mirror copies what came after only
+	m.Stop()
+	produce(0, 4)
+	if m, err = Start(settings); err != nil {
+		t.Fatalf("restart failed: %v", err)
+	}
+	defer m.Stop()
+	waitForRecords(t, c, targetTopic, 0, 4)
+	time.Sleep(200 * time.Millisecond)
+	if records := readAll(t, c, targetTopic, 0); len(records) != 4 {
+		t.Errorf("Expected 4 copies after the restart but got %d", len(records))
+	}
+}
+
+// A source topic deleted and created again is copied from its start
+func TestMirror_RestartsDeletedTopic(t *testing.T) {
+	broker := clienttest.NewBroker(t)
+	sourceTopic, targetTopic := "mirror_recreated", "west.mirror_recreated"
+	broker.CreateTopic(sourceTopic, 1)
+	c := client.NewClient(broker.Addr())
+	defer c.Close()
+	ctx := context.Background()
+	t.Cleanup(func() {
+		c.DeleteTopic(ctx, sourceTopic)
+		c.DeleteTopic(ctx, targetTopic)
+		c.DeleteTopic(ctx, "west."+DefaultCheckpointTopic)
+	})
+
+	for n := 0; n < 3; n++ {
+		if _, err := c.Produce(ctx, sourceTopic, 0, []byte(`{"n":`+strconv.Itoa(n)+`}`)); err != nil {
+			t.Fatalf("produce failed: %v", err)
+		}
+	}
+	m, err := Start(Settings{
+		Source:             broker.Addr(),
+		Target:             broker.Addr(),
+		Topics:             "mirror_recreated",
+		Prefix:             "west.",
+		CheckpointInterval: 50 * time.Millisecond,
+		RefreshInterval:    50 * time.Millisecond,
+		FetchWait:          20 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("start failed: %v", err)
+	}
+	defer m.Stop()
+	waitForRecords(t, c, targetTopic, 0, 3)
+
+	if err := c.DeleteTopic(ctx, sourceTopic); err != nil {
+		t.Fatalf("delete failed: %v", err)
+	}
+	eventually(t, func() bool {
+		_, found := m.Translate(sourceTopic, 0, 3)
+		return !found
+	}, "the deleted topic to be reset")
+
+	broker.CreateTopic(sourceTopic, 1)
+	if _, err := c.Produce(ctx, sourceTopic, 0, []byte(`{"n":3}`)); err != nil {
+		t.Fatalf("produce failed: %v", err)
+	}
+	waitForRecords(t, c, targetTopic, 0, 4)
+	if records := readAll(t, c, targetTopic, 0); string(records[3].Value) != `{"n":3}` {
+		t.Errorf("Expected the record of the new topic copied but got %s", records[3].Value)
+	}
+}
+
+func readAll(t *testing.T, c *client.Client, topicName string, partition int) []client.Record {
+	t.Helper()
+	var all []client.Record
+	offset := 0
+	for {
+		records, next, err := c.Fetch(context.Background(), topicName, partition, offset, 0)
+		if err != nil {
+			return all // Not created yet
+		}
+		if len(records) == 0 {
+			return all
+		}
+		all = append(all, records...)
+		offset = next
+	}
+}
+
+func waitForRecords(t *testing.T, c *client.Client, topicName string, partition, n int) {
+	t.Helper()
+	eventually(t, func() bool {
+		return len(readAll(t, c, topicName, partition)) >= n
+	}, strconv.Itoa(n)+" records in "+topicName+" "+strconv.Itoa(partition))
+}
+
+func eventually(t *testing.T, condition func() bool, what string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %s", what)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
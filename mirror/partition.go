@@ -0,0 +1,194 @@
+package mirror
+
+import (
+	"FranzMQ/client"
+	"context"
+	"fmt"
+	"log"
+)
+
+// Offset syncs kept per partition for translating offsets, the older half is
+// dropped when there are more
+const maxOffsetSyncs = 1000
+
+// partitionState is how far a source partition has been copied
+type partitionState struct {
+	sourceOffset int          // Next offset of the source to copy, 0 before anything was
+	targetOffset int          // Offset the copy of sourceOffset gets on the target
+	syncs        []offsetSync // Oldest first
+	checkpointed bool         // Nothing was copied or reset since the last checkpoint
+}
+
+// offsetSync is an offset of the source and the offset of its copy, both
+// right after a copied batch
+type offsetSync struct {
+	source int
+	target int
+}
+
+// Must be called with m.mu held
+func (m *Mirror) state(tp client.TopicPartition) *partitionState {
+	state, found := m.partitions[tp]
+	if !found {
+		state = &partitionState{checkpointed: true}
+		m.partitions[tp] = state
+	}
+	return state
+}
+
+func (m *Mirror) startPartition(mirrored *mirroredTopic, tp client.TopicPartition) {
+	m.wg.Add(1)
+	mirrored.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		defer mirrored.wg.Done()
+		m.copyPartition(mirrored.ctx, tp)
+	}()
+}
+
+// Stop copying the partitions of a source topic and forget how far they
+// got, the checkpoints included, so a topic of the same name is copied from
+// its earliest offset
+func (m *Mirror) stopTopic(name string, mirrored *mirroredTopic) {
+	mirrored.cancel()
+	mirrored.wg.Wait()
+	delete(m.started, name)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for p := 0; p < mirrored.partitions; p++ {
+		// Checkpointed with offset 0, which no longer resumes anything
+		m.partitions[client.TopicPartition{Topic: name, Partition: p}] = &partitionState{}
+	}
+}
+
+// Copy a source partition to the same partition of its target topic until
+// ctx is done, from its checkpoint or the earliest offset. A batch failing to
+// be produced is fetched again. The checkpoint lags the copies, what was
+// produced to the target after it is produced again on a restart.
+func (m *Mirror) copyPartition(ctx context.Context, tp client.TopicPartition) {
+	source := client.NewClient(m.settings.Source)
+	defer source.Close()
+	target := client.NewClient(m.settings.Target)
+	defer func() { target.Close() }()
+	targetTopic := m.TargetTopic(tp.Topic)
+
+	m.mu.Lock()
+	offset := m.state(tp).sourceOffset
+	m.mu.Unlock()
+	// Without a checkpoint, start at the earliest offset and where the target
+	// partition ends
+	for offset == 0 {
+		earliest, err := source.ListOffset(ctx, tp.Topic, tp.Partition, client.EarliestOffset)
+		if err == nil {
+			var end int
+			if end, err = target.ListOffset(ctx, targetTopic, tp.Partition, client.LatestOffset); err == nil {
+				offset = earliest
+				m.copied(tp, earliest, end)
+				break
+			}
+		}
+		log.Println("Error finding where to start mirroring", tp.Topic, tp.Partition, err)
+		if !sleep(ctx, retryBackoff) {
+			return
+		}
+	}
+	log.Println("Mirroring", tp.Topic, tp.Partition, "to", targetTopic, "from offset", offset)
+
+	for ctx.Err() == nil {
+		records, nextOffset, err := source.Fetch(ctx, tp.Topic, tp.Partition, offset, m.settings.FetchWait)
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Println("Error fetching", tp.Topic, tp.Partition, "to mirror:", err)
+				sleep(ctx, retryBackoff)
+			}
+			continue
+		}
+		if len(records) == 0 {
+			continue
+		}
+		// The values are the stored messages, produced again as they are
+		values := make([][]byte, 0, len(records))
+		for _, record := range records {
+			values = append(values, record.Value)
+		}
+		results, err := m.produce(ctx, &target, targetTopic, tp.Partition, values)
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Println("Error producing mirrored records of", tp.Topic, tp.Partition, "to", targetTopic, err)
+				sleep(ctx, retryBackoff)
+			}
+			continue
+		}
+		offset = nextOffset
+		m.copied(tp, nextOffset, results[len(results)-1].Offset+1)
+	}
+}
+
+// Produce to a partition of the target through c, moving c to the leader of
+// the partition when the broker it is connected to does not lead it
+func (m *Mirror) produce(ctx context.Context, c **client.Client, topicName string, partition int, values [][]byte) ([]client.RecordMetadata, error) {
+	results, err := (*c).ProduceBatch(ctx, topicName, partition, values)
+	if !client.IsNotLeader(err) {
+		return results, err
+	}
+	addr, lookupErr := m.targetLeader(ctx, topicName, partition)
+	if lookupErr != nil {
+		return nil, fmt.Errorf("%w, and finding the leader failed: %v", err, lookupErr)
+	}
+	(*c).Close()
+	*c = client.NewClient(addr)
+	return (*c).ProduceBatch(ctx, topicName, partition, values)
+}
+
+// Address of the broker leading a partition of the target cluster
+func (m *Mirror) targetLeader(ctx context.Context, topicName string, partition int) (string, error) {
+	metadata, err := m.target.Metadata(ctx, topicName)
+	if err != nil {
+		return "", err
+	}
+	for _, t := range metadata.Topics {
+		for _, p := range t.Partitions {
+			if p.Partition != partition {
+				continue
+			}
+			if b, found := metadata.Broker(p.Leader); found {
+				return b.Addr(), nil
+			}
+		}
+	}
+	return "", fmt.Errorf("no leader of %s-%d", topicName, partition)
+}
+
+// Record that a partition was copied up to sourceOffset, which gets
+// targetOffset on the target
+func (m *Mirror) copied(tp client.TopicPartition, sourceOffset, targetOffset int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	state := m.state(tp)
+	state.sourceOffset, state.targetOffset = sourceOffset, targetOffset
+	state.checkpointed = false
+	state.syncs = append(state.syncs, offsetSync{source: sourceOffset, target: targetOffset})
+	if len(state.syncs) > maxOffsetSyncs {
+		state.syncs = append([]offsetSync{}, state.syncs[len(state.syncs)/2:]...)
+	}
+}
+
+// Translate returns the offset on the target topic to resume consuming a
+// copy of a source partition at, for a consumer that got to offset on the
+// source. It is at or before the copy of offset, so nothing is skipped. False
+// when the mirror remembers no copied batch ending at or before offset.
+func (m *Mirror) Translate(sourceTopic string, partition, offset int) (int, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	state, found := m.partitions[client.TopicPartition{Topic: sourceTopic, Partition: partition}]
+	if !found {
+		return 0, false
+	}
+	for i := len(state.syncs) - 1; i >= 0; i-- {
+		if state.syncs[i].source <= offset {
+			return state.syncs[i].target, true
+		}
+	}
+	return 0, false
+}
@@ -1,9 +1,9 @@
 package broker
 
-import "sync"
-
+// Broker is a broker registered with the cluster, stored under its id while
+// its session is alive
 type Broker struct {
-	Mu                    sync.Mutex
-	LastPartition         int
-	DistriButionStratergy string
+	ID   int    `json:"id"`
+	Addr string `json:"addr"` // Binary listener
+	Rack string `json:"rack,omitempty"`
 }
@@ -0,0 +1,666 @@
+package orchestrator
+
+import (
+	"FranzMQ/client"
+	"FranzMQ/replication"
+	"FranzMQ/replication/clustertest"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/server/v3/embed"
+)
+
+// Run an etcd server in the test process, returning its client URL
+func startEtcd(t *testing.T) string {
+	t.Helper()
+	cfg := embed.NewConfig()
+	cfg.Dir = t.TempDir()
+	cfg.LogLevel = "error"
+	clientURL, _ := url.Parse("http://" + clustertest.FreeAddr(t))
+	peerURL, _ := url.Parse("http://" + clustertest.FreeAddr(t))
+	cfg.ListenClientUrls, cfg.AdvertiseClientUrls = []url.URL{*clientURL}, []url.URL{*clientURL}
+	cfg.ListenPeerUrls, cfg.AdvertisePeerUrls = []url.URL{*peerURL}, []url.URL{*peerURL}
+	cfg.InitialCluster = cfg.InitialClusterFromName(cfg.Name)
+
+	e, err := embed.StartEtcd(cfg)
+	if err != nil {
+		t.Fatalf("starting etcd failed: %v", err)
+	}
+	t.Cleanup(e.Close)
+	select {
+	case <-e.Server.ReadyNotify():
+	case <-time.After(10 * time.Second):
+		t.Fatal("etcd did not come up")
+	}
+	return clientURL.String()
+}
+
+func TestCluster_ControllerMovesLeadership(t *testing.T) {
+	if testing.Short() {
+		t.Skip("starts broker processes")
+	}
+	endpoint := startEtcd(t)
+	brokers := clustertest.Start(t, 3, func(id int, addrs map[int]string) []string {
+		return []string{
+			"-cluster.etcd_endpoints", endpoint,
+			"-cluster.session_ttl", "2s",
+			"-cluster.advertised_addr", addrs[id],
+		}
+	})
+	etcd, err := clientv3.New(clientv3.Config{Endpoints: []string{endpoint}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer etcd.Close()
+	ctx := context.Background()
+	clients := map[int]*client.Client{}
+	for id, b := range brokers {
+		clients[id] = client.NewClient(b.Addr)
+		defer clients[id].Close()
+	}
+	assignment := func() (replication.Assignment, error) {
+		resp, err := etcd.Get(ctx, assignmentsPrefix+"failover")
+		if err != nil || len(resp.Kvs) == 0 {
+			return replication.Assignment{}, fmt.Errorf("not assigned: %v", err)
+		}
+		var partitions []replication.Assignment
+		err = json.Unmarshal(resp.Kvs[0].Value, &partitions)
+		return partitions[0], err
+	}
+
+	// Every broker gets the topic, the controller assigns it
+	if err := clients[1].CreateTopic(ctx, "failover", client.TopicConfig{Partitions: 1, Replicas: 3}); err != nil {
+		t.Fatalf("create topic failed: %v", err)
+	}
+	a, err := assignment()
+	if err != nil {
+		t.Fatalf("Expected the topic assigned once created, got %v", err)
+	}
+	if err := clients[2].AlterConfigs(ctx, "failover", map[string]string{"retention.ms": "600000"}); err != nil {
+		t.Fatalf("alter configs failed: %v", err)
+	}
+	clustertest.Eventually(t, "config not passed on", func() error {
+		entries, err := clients[3].DescribeConfigs(ctx, "failover")
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if entry.Name == "retention.ms" && entry.Value != "600000" {
+				return fmt.Errorf("retention.ms is %s", entry.Value)
+			}
+		}
+		return nil
+	})
+
+	for i := 1; i <= 3; i++ {
+		if _, err := clients[a.Replicas[1]].Produce(ctx, "failover", 0, []byte(fmt.Sprintf(`{"n":%d}`, i))); err != nil {
+			t.Fatalf("produce %d failed: %v", i, err)
+		}
+	}
+
+	// A topic with one replica lives on one broker, the others forward to it
+	if err := clients[2].CreateTopic(ctx, "single", client.TopicConfig{Partitions: 1, Replicas: 1}); err != nil {
+		t.Fatalf("create topic failed: %v", err)
+	}
+	for id := 1; id <= 3; id++ {
+		clustertest.Eventually(t, "produce not forwarded", func() error {
+			_, err := clients[id].Produce(ctx, "single", 0, []byte(fmt.Sprintf(`{"via":%d}`, id)))
+			return err
+		})
+	}
+	owner := -1
+	for id := 1; id <= 3; id++ {
+		m, err := clients[id].Metadata(ctx, "single")
+		if err != nil {
+			t.Fatalf("metadata failed: %v", err)
+		}
+		p := m.Topics[0].Partitions[0]
+		if len(p.Replicas) != 1 || p.Leader != p.Replicas[0] || (owner != -1 && p.Leader != owner) {
+			t.Errorf("Broker %d shows partition %+v, expected one replica led by broker %d", id, p, owner)
+		}
+		owner = p.Leader
+		clustertest.Eventually(t, "records not fetched", func() error {
+			records, _, err := clients[id].Fetch(ctx, "single", 0, 1, 0)
+			if err == nil && len(records) != 3 {
+				err = fmt.Errorf("%d records through broker %d", len(records), id)
+			}
+			return err
+		})
+	}
+
+	// The leader goes away, another replica takes over with every record
+	brokers[a.Leader].Stop()
+	survivor := a.Replicas[1]
+	clustertest.Eventually(t, "leadership not moved", func() error {
+		moved, err := assignment()
+		if err != nil {
+			return err
+		}
+		if moved.Leader == a.Leader || moved.Leader == replication.NoLeader {
+			return fmt.Errorf("led by %d", moved.Leader)
+		}
+		// Clients routing by metadata follow the move
+		m, err := clients[survivor].Metadata(ctx, "failover")
+		if err != nil {
+			return err
+		}
+		if leader := m.Topics[0].Partitions[0].Leader; leader != moved.Leader {
+			return fmt.Errorf("metadata shows leader %d instead of %d", leader, moved.Leader)
+		}
+		if _, found := m.Broker(a.Leader); found {
+			return fmt.Errorf("metadata still lists broker %d", a.Leader)
+		}
+		return nil
+	})
+	clustertest.Eventually(t, "produce to the new leader failed", func() error {
+		meta, err := clients[survivor].Produce(ctx, "failover", 0, []byte(`{"n":4}`))
+		if err != nil {
+			return err
+		}
+		if meta.Offset != 4 {
+			t.Fatalf("Expected offset 4 after failover, got %d", meta.Offset)
+		}
+		return nil
+	})
+	for id := range brokers {
+		if id == a.Leader {
+			continue
+		}
+		clustertest.Eventually(t, fmt.Sprintf("broker %d does not show the records", id), func() error {
+			records, _, err := clients[id].Fetch(ctx, "failover", 0, 1, time.Second)
+			if err != nil {
+				return err
+			}
+			if len(records) != 4 {
+				return fmt.Errorf("got %d records", len(records))
+			}
+			return nil
+		})
+	}
+
+	if err := clients[survivor].DeleteTopic(ctx, "failover"); err != nil {
+		t.Fatalf("delete topic failed: %v", err)
+	}
+	clustertest.Eventually(t, "topic not deleted", func() error {
+		for id := range brokers {
+			if id == a.Leader {
+				continue
+			}
+			if topics, err := clients[id].ListTopics(ctx); err != nil || topics["failover"] != 0 {
+				return fmt.Errorf("still on broker %d: %v", id, err)
+			}
+		}
+		if _, err := assignment(); err == nil {
+			return fmt.Errorf("still assigned")
+		}
+		return nil
+	})
+}
+
+func TestCluster_Quorum(t *testing.T) {
+	if testing.Short() {
+		t.Skip("starts broker processes")
+	}
+	brokers := clustertest.Start(t, 3, func(id int, addrs map[int]string) []string {
+		voters := []string{}
+		for id, addr := range addrs {
+			voters = append(voters, fmt.Sprintf("%d@%s", id, addr))
+		}
+		return []string{
+			"-cluster.quorum", strings.Join(voters, ","),
+			"-cluster.session_ttl", "2s",
+			"-cluster.advertised_addr", addrs[id],
+		}
+	})
+	ctx := context.Background()
+	clients := map[int]*client.Client{}
+	for id, b := range brokers {
+		clients[id] = client.NewClient(b.Addr)
+		defer clients[id].Close()
+	}
+
+	// The brokers join once the quorum elected its leader
+	clustertest.Eventually(t, "brokers not joined", func() error {
+		for id := 1; id <= 3; id++ {
+			if !strings.Contains(brokers[1].Log(), fmt.Sprintf("Broker %d joined the cluster", id)) {
+				return fmt.Errorf("broker %d not seen by broker 1", id)
+			}
+		}
+		return nil
+	})
+	clustertest.Eventually(t, "topic not created", func() error {
+		return clients[1].CreateTopic(ctx, "quorum", client.TopicConfig{Partitions: 1, Replicas: 3})
+	})
+	clustertest.Eventually(t, "topic not passed on", func() error {
+		if topics, err := clients[3].ListTopics(ctx); err != nil || topics["quorum"] != 1 {
+			return fmt.Errorf("not on broker 3: %v", err)
+		}
+		return nil
+	})
+	for i := 1; i <= 3; i++ {
+		clustertest.Eventually(t, fmt.Sprintf("produce %d failed", i), func() error {
+			_, err := clients[2].Produce(ctx, "quorum", 0, []byte(fmt.Sprintf(`{"n":%d}`, i)))
+			return err
+		})
+	}
+
+	// Two voters of three keep the metadata going
+	brokers[1].Stop()
+	clustertest.Eventually(t, "produce without broker 1 failed", func() error {
+		meta, err := clients[2].Produce(ctx, "quorum", 0, []byte(`{"n":4}`))
+		if err != nil {
+			return err
+		}
+		if meta.Offset != 4 {
+			t.Fatalf("Expected offset 4 without broker 1, got %d", meta.Offset)
+		}
+		return nil
+	})
+	clustertest.Eventually(t, "broker 3 does not show the records", func() error {
+		records, _, err := clients[3].Fetch(ctx, "quorum", 0, 1, time.Second)
+		if err != nil {
+			return err
+		}
+		if len(records) != 4 {
+			return fmt.Errorf("got %d records", len(records))
+		}
+		return nil
+	})
+}
+
+func TestCluster_DecommissionMovesPartitions(t *testing.T) {
+	if testing.Short() {
+		t.Skip("starts broker processes")
+	}
+	endpoint := startEtcd(t)
+	brokers := clustertest.Start(t, 3, func(id int, addrs map[int]string) []string {
+		return []string{
+			"-cluster.etcd_endpoints", endpoint,
+			"-cluster.session_ttl", "2s",
+			"-cluster.advertised_addr", addrs[id],
+		}
+	})
+	ctx := context.Background()
+	clients := map[int]*client.Client{}
+	for id, b := range brokers {
+		clients[id] = client.NewClient(b.Addr)
+		defer clients[id].Close()
+	}
+	clustertest.Eventually(t, "brokers not joined", func() error {
+		m, err := clients[1].Metadata(ctx)
+		if err != nil || len(m.Brokers) != 3 {
+			return fmt.Errorf("brokers %v: %v", m.Brokers, err)
+		}
+		return nil
+	})
+	if err := clients[1].CreateTopic(ctx, "moving", client.TopicConfig{Partitions: 1, Replicas: 2}); err != nil {
+		t.Fatalf("create topic failed: %v", err)
+	}
+	var before client.PartitionMetadata
+	clustertest.Eventually(t, "topic not assigned", func() error {
+		m, err := clients[1].Metadata(ctx, "moving")
+		if err != nil {
+			return err
+		}
+		if before = m.Topics[0].Partitions[0]; before.Leader == replication.NoLeader {
+			return fmt.Errorf("no leader")
+		}
+		return nil
+	})
+	for i := 1; i <= 3; i++ {
+		clustertest.Eventually(t, fmt.Sprintf("produce %d failed", i), func() error {
+			_, err := clients[before.Leader].Produce(ctx, "moving", 0, []byte(fmt.Sprintf(`{"n":%d}`, i)))
+			return err
+		})
+	}
+
+	// Retiring the leader copies the partition to the third broker, which
+	// takes over before the leader is removed
+	added := 6 - before.Replicas[0] - before.Replicas[1]
+	if moved, err := clients[2].DecommissionBroker(ctx, before.Leader, 1<<20); err != nil || moved != 1 {
+		t.Fatalf("Expected 1 partition moved, got %d %v", moved, err)
+	}
+	clustertest.Eventually(t, "partition not moved", func() error {
+		moving, err := clients[3].ListReassignments(ctx)
+		if err != nil || len(moving) > 0 {
+			return fmt.Errorf("still moving %+v: %v", moving, err)
+		}
+		m, err := clients[3].Metadata(ctx, "moving")
+		if err != nil {
+			return err
+		}
+		p := m.Topics[0].Partitions[0]
+		if len(p.Replicas) != 2 || p.Replicas[0] != added || p.Leader == before.Leader || p.Leader == replication.NoLeader {
+			return fmt.Errorf("partition is %+v", p)
+		}
+		return nil
+	})
+	clustertest.Eventually(t, "produce after the move failed", func() error {
+		meta, err := clients[added].Produce(ctx, "moving", 0, []byte(`{"n":4}`))
+		if err != nil {
+			return err
+		}
+		if meta.Offset != 4 {
+			t.Fatalf("Expected offset 4 after the move, got %d", meta.Offset)
+		}
+		return nil
+	})
+	clustertest.Eventually(t, "new replica does not show the records", func() error {
+		records, _, err := clients[added].Fetch(ctx, "moving", 0, 1, time.Second)
+		if err != nil {
+			return err
+		}
+		if len(records) != 4 {
+			return fmt.Errorf("got %d records", len(records))
+		}
+		return nil
+	})
+}
+
+func TestCluster_PreferredLeaderElection(t *testing.T) {
+	if testing.Short() {
+		t.Skip("starts broker processes")
+	}
+	endpoint := startEtcd(t)
+	brokers := clustertest.Start(t, 3, func(id int, addrs map[int]string) []string {
+		return []string{
+			"-cluster.etcd_endpoints", endpoint,
+			"-cluster.session_ttl", "2s",
+			"-cluster.advertised_addr", addrs[id],
+			"-cluster.auto_leader_rebalance", "false",
+		}
+	})
+	ctx := context.Background()
+	clients := map[int]*client.Client{}
+	for id, b := range brokers {
+		clients[id] = client.NewClient(b.Addr)
+		defer clients[id].Close()
+	}
+	clustertest.Eventually(t, "brokers not joined", func() error {
+		m, err := clients[2].Metadata(ctx)
+		if err != nil || len(m.Brokers) != 3 {
+			return fmt.Errorf("brokers %v: %v", m.Brokers, err)
+		}
+		return nil
+	})
+	if err := clients[2].CreateTopic(ctx, "preferred", client.TopicConfig{Partitions: 3, Replicas: 3}); err != nil {
+		t.Fatalf("create topic failed: %v", err)
+	}
+	// The partition broker 1 prefers to lead
+	preferredBy1 := func() (client.PartitionMetadata, error) {
+		m, err := clients[2].Metadata(ctx, "preferred")
+		if err != nil {
+			return client.PartitionMetadata{}, err
+		}
+		for _, p := range m.Topics[0].Partitions {
+			if len(p.Replicas) > 0 && p.Replicas[0] == 1 {
+				return p, nil
+			}
+		}
+		return client.PartitionMetadata{}, fmt.Errorf("no partition prefers broker 1: %+v", m.Topics)
+	}
+	clustertest.Eventually(t, "broker 1 does not lead", func() error {
+		p, err := preferredBy1()
+		if err == nil && p.Leader != 1 {
+			err = fmt.Errorf("led by %d", p.Leader)
+		}
+		return err
+	})
+
+	// Leadership moves away while broker 1 is down and stays away once it is back
+	brokers[1].Stop()
+	clustertest.Eventually(t, "leadership not moved", func() error {
+		p, err := preferredBy1()
+		if err == nil && (p.Leader == 1 || p.Leader == replication.NoLeader) {
+			err = fmt.Errorf("led by %d", p.Leader)
+		}
+		return err
+	})
+	brokers[1].Start(t)
+	clustertest.Eventually(t, "broker 1 not back in sync", func() error {
+		p, err := preferredBy1()
+		if err != nil {
+			return err
+		}
+		m, err := clients[p.Leader].Metadata(ctx, "preferred")
+		if err != nil {
+			return err
+		}
+		for _, q := range m.Topics[0].Partitions {
+			if q.Partition == p.Partition && len(q.InSyncReplicas) != 3 {
+				return fmt.Errorf("in-sync replicas %v", q.InSyncReplicas)
+			}
+		}
+		return nil
+	})
+	if p, _ := preferredBy1(); p.Leader == 1 {
+		t.Fatalf("Expected leadership to stay away without automatic balancing")
+	}
+
+	clustertest.Eventually(t, "preferred leader not elected", func() error {
+		if _, err := clients[3].ElectPreferredLeaders(ctx, "preferred"); err != nil {
+			return err
+		}
+		p, err := preferredBy1()
+		if err == nil && p.Leader != 1 {
+			err = fmt.Errorf("led by %d", p.Leader)
+		}
+		return err
+	})
+	if elections, err := clients[2].ElectPreferredLeaders(ctx, ""); err != nil || elections != 0 {
+		t.Errorf("Expected every partition led by its preferred replica, got %d %v", elections, err)
+	}
+}
+
+func TestCluster_UncleanElectionTruncatesOldLeader(t *testing.T) {
+	if testing.Short() {
+		t.Skip("starts broker processes")
+	}
+	endpoint := startEtcd(t)
+	brokers := clustertest.Start(t, 2, func(id int, addrs map[int]string) []string {
+		return []string{
+			"-cluster.etcd_endpoints", endpoint,
+			"-cluster.session_ttl", "2s",
+			"-cluster.advertised_addr", addrs[id],
+			"-cluster.replica_lag_time_max", "1s",
+		}
+	})
+	ctx := context.Background()
+	clients := map[int]*client.Client{}
+	for id, b := range brokers {
+		clients[id] = client.NewClient(b.Addr)
+		defer clients[id].Close()
+	}
+	partition := func(id int) (client.PartitionMetadata, error) {
+		m, err := clients[id].Metadata(ctx, "unclean")
+		if err != nil {
+			return client.PartitionMetadata{}, err
+		}
+		if len(m.Topics) == 0 || len(m.Topics[0].Partitions) == 0 {
+			return client.PartitionMetadata{}, fmt.Errorf("not assigned: %+v", m.Topics)
+		}
+		return m.Topics[0].Partitions[0], nil
+	}
+	clustertest.Eventually(t, "brokers not joined", func() error {
+		m, err := clients[1].Metadata(ctx)
+		if err != nil || len(m.Brokers) != 2 {
+			return fmt.Errorf("brokers %v: %v", m.Brokers, err)
+		}
+		return nil
+	})
+	if err := clients[1].CreateTopic(ctx, "unclean", client.TopicConfig{Partitions: 1, Replicas: 2}); err != nil {
+		t.Fatalf("create topic failed: %v", err)
+	}
+	var p client.PartitionMetadata
+	clustertest.Eventually(t, "first produce failed", func() error {
+		var err error
+		if p, err = partition(1); err != nil {
+			return err
+		}
+		_, err = clients[p.Leader].Produce(ctx, "unclean", 0, []byte(`{"n":1}`))
+		return err
+	})
+	leader, follower := p.Leader, p.Replicas[0]
+	if follower == leader {
+		follower = p.Replicas[1]
+	}
+	clustertest.Eventually(t, "follower does not show the first record", func() error {
+		if records, _, err := clients[follower].Fetch(ctx, "unclean", 0, 1, time.Second); err != nil || len(records) != 1 {
+			return fmt.Errorf("got %d records: %v", len(records), err)
+		}
+		return nil
+	})
+
+	// The follower goes away and falls out of sync, the leader takes records
+	// it never gets
+	brokers[follower].Stop()
+	clustertest.Eventually(t, "follower still in sync", func() error {
+		if m, err := partition(leader); err != nil || len(m.InSyncReplicas) != 1 {
+			return fmt.Errorf("in-sync replicas %v: %v", m.InSyncReplicas, err)
+		}
+		return nil
+	})
+	for i := 2; i <= 3; i++ {
+		if _, err := clients[leader].Produce(ctx, "unclean", 0, []byte(fmt.Sprintf(`{"n":%d}`, i))); err != nil {
+			t.Fatalf("produce %d failed: %v", i, err)
+		}
+	}
+
+	clustertest.Eventually(t, "leader does not show its records", func() error {
+		if records, _, err := clients[leader].Fetch(ctx, "unclean", 0, 1, time.Second); err != nil || len(records) != 3 {
+			return fmt.Errorf("got %d records: %v", len(records), err)
+		}
+		return nil
+	})
+
+	// Back alone, the out of sync replica only leads once the topic allows it
+	brokers[leader].Stop()
+	brokers[follower].Start(t)
+	clustertest.Eventually(t, "old leader still in the cluster", func() error {
+		m, err := clients[follower].Metadata(ctx)
+		if err != nil || len(m.Brokers) != 1 {
+			return fmt.Errorf("brokers %v: %v", m.Brokers, err)
+		}
+		return nil
+	})
+	clustertest.Eventually(t, "old leader still leads", func() error {
+		if m, err := partition(follower); err != nil || m.Leader != replication.NoLeader {
+			return fmt.Errorf("partition %+v: %v", m, err)
+		}
+		return nil
+	})
+	time.Sleep(time.Second)
+	if m, err := partition(follower); err != nil || m.Leader != replication.NoLeader {
+		t.Fatalf("Expected no leader without unclean election, got %+v %v", m, err)
+	}
+	if err := clients[follower].AlterConfigs(ctx, "unclean", map[string]string{"unclean.leader.election.enable": "true"}); err != nil {
+		t.Fatalf("alter configs failed: %v", err)
+	}
+	clustertest.Eventually(t, "out of sync replica not elected", func() error {
+		_, err := clients[follower].Produce(ctx, "unclean", 0, []byte(`{"n":4}`))
+		return err
+	})
+
+	// The old leader comes back as follower and drops what the new one never had
+	brokers[leader].Start(t)
+	clustertest.Eventually(t, "old leader not truncated", func() error {
+		records, _, err := clients[leader].Fetch(ctx, "unclean", 0, 1, time.Second)
+		if err != nil {
+			return err
+		}
+		values := []string{}
+		for _, r := range records {
+			values = append(values, string(r.Value))
+		}
+		if len(values) != 2 || values[1] != `{"n":4}` {
+			return fmt.Errorf("got %v", values)
+		}
+		return nil
+	})
+	if !strings.Contains(brokers[leader].Log(), "Truncating unclean 0 to offset 2") {
+		t.Errorf("Expected the old leader to log its truncation")
+	}
+}
+
+func TestCluster_RackAwarePlacement(t *testing.T) {
+	if testing.Short() {
+		t.Skip("starts broker processes")
+	}
+	endpoint := startEtcd(t)
+	racks := map[int]string{1: "east", 2: "east", 3: "west"}
+	brokers := clustertest.Start(t, 3, func(id int, addrs map[int]string) []string {
+		return []string{
+			"-cluster.etcd_endpoints", endpoint,
+			"-cluster.session_ttl", "2s",
+			"-cluster.advertised_addr", addrs[id],
+			"-cluster.rack", racks[id],
+		}
+	})
+	ctx := context.Background()
+	c := client.NewClient(brokers[1].Addr)
+	defer c.Close()
+	clustertest.Eventually(t, "brokers not joined", func() error {
+		m, err := c.Metadata(ctx)
+		if err != nil || len(m.Brokers) != 3 {
+			return fmt.Errorf("brokers %v: %v", m.Brokers, err)
+		}
+		for _, b := range m.Brokers {
+			if b.Rack != racks[b.ID] {
+				return fmt.Errorf("broker %d in rack %q", b.ID, b.Rack)
+			}
+		}
+		return nil
+	})
+	if err := c.CreateTopic(ctx, "racks", client.TopicConfig{Partitions: 4, Replicas: 2}); err != nil {
+		t.Fatalf("create topic failed: %v", err)
+	}
+	clustertest.Eventually(t, "topic not assigned", func() error {
+		m, err := c.Metadata(ctx, "racks")
+		if err != nil {
+			return err
+		}
+		for _, p := range m.Topics[0].Partitions {
+			if len(p.Replicas) != 2 || racks[p.Replicas[0]] == racks[p.Replicas[1]] {
+				return fmt.Errorf("partition %d on %v", p.Partition, p.Replicas)
+			}
+		}
+		return nil
+	})
+	for i := 0; i < 4; i++ {
+		clustertest.Eventually(t, fmt.Sprintf("produce %d failed", i), func() error {
+			_, err := c.Produce(ctx, "racks", i, []byte(fmt.Sprintf(`{"n":%d}`, i)))
+			return err
+		})
+	}
+
+	// Every partition has a replica in the west, the consumer reads from there
+	consumer, err := client.NewConsumer(client.ConsumerConfig{
+		Addr:    brokers[1].Addr,
+		GroupID: "racks-group",
+		Topics:  []string{"racks"},
+		Rack:    "west",
+		MaxWait: 100 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer consumer.Close()
+	seen := 0
+	deadline := time.Now().Add(20 * time.Second)
+	for seen < 4 && time.Now().Before(deadline) {
+		records, err := consumer.Poll(ctx)
+		if err != nil {
+			t.Fatalf("poll failed: %v", err)
+		}
+		seen += len(records)
+	}
+	if seen != 4 {
+		t.Errorf("Expected the 4 records from the west replicas, got %d", seen)
+	}
+}
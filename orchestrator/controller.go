@@ -0,0 +1,224 @@
+package orchestrator
+
+import (
+	"FranzMQ/orchestrator/broker"
+	"FranzMQ/orchestrator/store"
+	"FranzMQ/replication"
+	"FranzMQ/topic"
+	"context"
+	"encoding/json"
+	"log"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+// Keep a session with the store: register this broker under it and
+// campaign to be the controller. A lost session, when the store did not hear
+// from this broker for the session TTL, starts over with a new one.
+func (o *Orchestrator) run() {
+	for {
+		session, err := o.store.NewSession(o.settings.SessionTTL)
+		if err != nil {
+			log.Println("Error opening cluster session:", err)
+			time.Sleep(time.Second)
+			continue
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		go func() {
+			select {
+			case <-session.Done():
+			case <-ctx.Done():
+			}
+			cancel()
+		}()
+
+		if o.register(ctx, session) {
+			o.lead(ctx, session)
+		}
+		cancel()
+		session.Close()
+		log.Println("Broker", o.settings.BrokerID, "lost its cluster session, registering again")
+	}
+}
+
+// Put this broker under the session. A key left by an earlier run of this
+// broker goes with its session, so wait for that.
+func (o *Orchestrator) register(ctx context.Context, session store.Session) bool {
+	value, _ := json.Marshal(broker.Broker{ID: o.settings.BrokerID, Addr: o.settings.Addr, Rack: o.settings.Rack})
+	key := brokersPrefix + strconv.Itoa(o.settings.BrokerID)
+	for {
+		created, err := session.Create(ctx, key, value)
+		if err == nil && created {
+			log.Println("Broker", o.settings.BrokerID, "registered with the cluster at", o.settings.Addr)
+			return true
+		}
+		if err != nil {
+			log.Println("Error registering broker:", err)
+		} else {
+			log.Println("Broker", o.settings.BrokerID, "is still registered by an earlier session, waiting for it to expire")
+		}
+		select {
+		case <-time.After(time.Second):
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
+
+// Campaign to be the controller, then keep the assignments in line with the
+// live brokers and topics until the session ends
+func (o *Orchestrator) lead(ctx context.Context, session store.Session) {
+	leader, err := session.Campaign(ctx, controllerPrefix, strconv.Itoa(o.settings.BrokerID))
+	if err != nil {
+		return
+	}
+	log.Println("Broker", o.settings.BrokerID, "is the controller")
+
+	var balanceCheck <-chan time.Time
+	if o.settings.LeaderImbalancePercent > 0 {
+		ticker := time.NewTicker(o.settings.LeaderImbalanceCheckInterval)
+		defer ticker.Stop()
+		balanceCheck = ticker.C
+	}
+	imbalancePercent := 0 // Only checked on the ticks
+	for {
+		v, changed := o.snapshot()
+		changes := plan(v.live, v.racks, v.topics, v.assignments, v.isr)
+		finished := planMoves(v, changes)
+		finished = append(finished, planElections(v, changes, imbalancePercent)...)
+		stampEpochs(v.assignments, changes)
+		imbalancePercent = 0
+		for name, partitions := range changes {
+			if err := o.writeAssignment(ctx, leader, name, partitions); err != nil {
+				log.Println("Broker", o.settings.BrokerID, "stopped being the controller:", err)
+				return
+			}
+		}
+		for _, key := range finished {
+			if err := o.deleteKey(ctx, leader, key); err != nil {
+				log.Println("Broker", o.settings.BrokerID, "stopped being the controller:", err)
+				return
+			}
+		}
+		select {
+		case <-changed:
+		case <-balanceCheck:
+			imbalancePercent = o.settings.LeaderImbalancePercent
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Put the assignment of a topic, nil deletes it
+func (o *Orchestrator) writeAssignment(ctx context.Context, leader store.Leader, name string, partitions []replication.Assignment) error {
+	writeCtx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+	if partitions == nil {
+		return leader.Delete(writeCtx, assignmentsPrefix+name)
+	}
+	value, err := json.Marshal(partitions)
+	if err != nil {
+		return err
+	}
+	if err := leader.Put(writeCtx, assignmentsPrefix+name, value); err != nil {
+		return err
+	}
+	log.Println("Assigned topic", name, partitions)
+	return nil
+}
+
+func (o *Orchestrator) deleteKey(ctx context.Context, leader store.Leader, key string) error {
+	deleteCtx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+	return leader.Delete(deleteCtx, key)
+}
+
+// plan returns the assignments to change, nil for those to delete. New
+// partitions are spread over the live brokers and their racks, once there
+// are enough live brokers to hold every replica. A partition whose leader is gone is led by its first live replica
+// the last leader had in sync, or by no one until one comes back. Topics
+// with unclean.leader.election.enable take any live replica instead of
+// waiting.
+func plan(live []int, racks map[int]string, topics map[string]topic.Config, current map[string][]replication.Assignment, isr map[partitionKey]isrRecord) map[string][]replication.Assignment {
+	changes := map[string][]replication.Assignment{}
+	for name := range current {
+		if _, found := topics[name]; !found {
+			changes[name] = nil
+		}
+	}
+	if len(live) == 0 {
+		return changes
+	}
+	alive := map[int]bool{}
+	for _, id := range live {
+		alive[id] = true
+	}
+
+	for name, config := range topics {
+		replicas := max(config.Replicas, 1)
+		partitions := append([]replication.Assignment{}, current[name]...)
+		for p := range partitions {
+			if a := partitions[p]; a.Leader == replication.NoLeader || !alive[a.Leader] {
+				partitions[p] = replication.Assignment{Replicas: a.Replicas, Leader: electLeader(a, isr[partitionKey{name, p}], alive, config.UncleanLeaderElection), Epoch: a.Epoch}
+			}
+		}
+		// A partition placed on fewer brokers would stay short of replicas
+		for p := len(partitions); p < config.NumOfPartition && len(live) >= replicas; p++ {
+			ids := replication.Assign(live, racks, name, p, replicas)
+			partitions = append(partitions, replication.Assignment{Replicas: ids, Leader: ids[0]})
+		}
+		if !reflect.DeepEqual(partitions, current[name]) {
+			changes[name] = partitions
+		}
+	}
+	return changes
+}
+
+// The replica to lead a partition whose leader is gone. Without an ISR
+// record of the last leader, from before leaders put theirs, every replica
+// counts as in sync.
+func electLeader(a replication.Assignment, record isrRecord, alive map[int]bool, unclean bool) int {
+	inSync := a.Replicas
+	if record.ISR != nil && (record.Leader == a.Leader || a.Leader == replication.NoLeader) {
+		inSync = record.ISR
+	}
+	for _, id := range a.Replicas {
+		if alive[id] && contains(inSync, id) {
+			return id
+		}
+	}
+	if !unclean {
+		return replication.NoLeader
+	}
+	for _, id := range a.Replicas {
+		if alive[id] {
+			log.Println("Electing broker", id, "leader out of sync, it may miss messages the last leader had")
+			return id
+		}
+	}
+	return replication.NoLeader
+}
+
+// Give the changed assignments the leader epoch of the current ones, one
+// more for the partitions whose leader changes
+func stampEpochs(current, changes map[string][]replication.Assignment) {
+	for name, partitions := range changes {
+		if partitions == nil {
+			continue
+		}
+		partitions = append([]replication.Assignment{}, partitions...)
+		for p := range partitions {
+			if p >= len(current[name]) {
+				continue // New partitions start at epoch 0
+			}
+			previous := current[name][p]
+			partitions[p].Epoch = previous.Epoch
+			if partitions[p].Leader != previous.Leader {
+				partitions[p].Epoch++
+			}
+		}
+		changes[name] = partitions
+	}
+}
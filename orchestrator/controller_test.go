@@ -0,0 +1,204 @@
+package orchestrator
+
+import (
+	"FranzMQ/replication"
+	"FranzMQ/topic"
+	"testing"
+)
+
+func TestPlan(t *testing.T) {
+	topics := map[string]topic.Config{
+		"orders": {NumOfPartition: 2, Replicas: 2},
+		"single": {NumOfPartition: 1, Replicas: 1},
+	}
+	current := map[string][]replication.Assignment{
+		"deleted": {{Replicas: []int{1, 2}, Leader: 1}},
+	}
+	changes := plan([]int{1, 2, 3}, nil, topics, current, nil)
+	if partitions, found := changes["deleted"]; !found || partitions != nil {
+		t.Errorf("Expected the assignment of a deleted topic removed, got %v", changes)
+	}
+	if single := changes["single"]; len(single) != 1 || len(single[0].Replicas) != 1 || single[0].Leader != single[0].Replicas[0] {
+		t.Errorf("Expected a topic with one replica on a single broker, got %v", single)
+	}
+	orders := changes["orders"]
+	if len(orders) != 2 {
+		t.Fatalf("Expected both partitions assigned, got %v", orders)
+	}
+	for p, a := range orders {
+		if len(a.Replicas) != 2 || a.Leader != a.Replicas[0] {
+			t.Errorf("Expected partition %d on 2 brokers led by the first, got %+v", p, a)
+		}
+	}
+
+	// Too few brokers to hold every replica, nothing is placed yet
+	if changes := plan([]int{1}, nil, topics, nil, nil); len(changes["orders"]) != 0 || len(changes["single"]) != 1 {
+		t.Errorf("Expected only the topic with one replica assigned on a single broker, got %v", changes)
+	}
+
+	// The leader of partition 0 goes away, the other replica takes over
+	delete(topics, "single")
+	current = map[string][]replication.Assignment{"orders": orders}
+	gone := orders[0].Leader
+	live := []int{}
+	for _, id := range []int{1, 2, 3} {
+		if id != gone {
+			live = append(live, id)
+		}
+	}
+	changes = plan(live, nil, topics, current, nil)
+	if leader := changes["orders"][0].Leader; leader != orders[0].Replicas[1] {
+		t.Errorf("Expected broker %d to lead partition 0, got %d", orders[0].Replicas[1], leader)
+	}
+
+	// Without a live replica no one leads, until one is back
+	changes = plan([]int{6}, nil, topics, current, nil)
+	if leader := changes["orders"][0].Leader; leader != replication.NoLeader {
+		t.Errorf("Expected no leader without live replicas, got %d", leader)
+	}
+	current["orders"] = changes["orders"]
+	changes = plan([]int{gone, 6}, nil, topics, current, nil)
+	if leader := changes["orders"][0].Leader; leader != gone {
+		t.Errorf("Expected broker %d back as leader, got %d", gone, leader)
+	}
+
+	current["orders"] = changes["orders"]
+	if changes = plan([]int{gone, 6}, nil, topics, current, nil); len(changes) != 0 {
+		t.Errorf("Expected nothing to change, got %v", changes)
+	}
+}
+
+func TestPlanMoves(t *testing.T) {
+	key := partitionKey{"orders", 0}
+	v := view{
+		live:          []int{1, 2, 3, 4},
+		topics:        map[string]topic.Config{"orders": {NumOfPartition: 1, Replicas: 2}},
+		assignments:   map[string][]replication.Assignment{"orders": {{Replicas: []int{1, 2}, Leader: 1}}},
+		reassignments: map[partitionKey]reassignment{key: {Replicas: []int{3, 2}, Throttle: 100}},
+		isr:           map[partitionKey]isrRecord{key: {Leader: 1, ISR: []int{1, 2}}},
+	}
+	step := func() replication.Assignment {
+		t.Helper()
+		changes := map[string][]replication.Assignment{}
+		finished := planMoves(v, changes)
+		if len(finished) > 0 {
+			delete(v.reassignments, key)
+		}
+		if partitions, found := changes["orders"]; found {
+			v.assignments["orders"] = partitions
+		}
+		return v.assignments["orders"][0]
+	}
+
+	// The new replica is added first, the old leader keeps leading
+	a := step()
+	if !equalIDs(a.Replicas, []int{3, 2, 1}) || !equalIDs(a.Adding, []int{3}) || !equalIDs(a.Removing, []int{1}) || a.Leader != 1 || a.Throttle != 100 {
+		t.Fatalf("Expected broker 3 added with 1 leading, got %+v", a)
+	}
+	if moved := step(); !equalAssignments(moved, a) {
+		t.Errorf("Expected nothing to change until broker 3 is in sync, got %+v", moved)
+	}
+
+	// In sync, leadership goes to the new replica, then the old one goes away
+	v.isr[key] = isrRecord{Leader: 1, ISR: []int{1, 2, 3}}
+	if a = step(); a.Leader != 3 || len(a.Replicas) != 3 {
+		t.Fatalf("Expected broker 3 to lead before 1 is removed, got %+v", a)
+	}
+	if moved := step(); !equalAssignments(moved, a) {
+		t.Errorf("Expected nothing to change until 3 reports the ISR, got %+v", moved)
+	}
+	v.isr[key] = isrRecord{Leader: 3, ISR: []int{3, 2, 1}}
+	if a = step(); !equalIDs(a.Replicas, []int{3, 2}) || a.Leader != 3 || len(a.Adding) != 0 || a.Throttle != 0 {
+		t.Errorf("Expected the partition on 3 and 2 led by 3, got %+v", a)
+	}
+	if _, moving := v.reassignments[key]; moving {
+		t.Errorf("Expected the reassignment finished")
+	}
+
+	// The moves of deleted topics are dropped with their ISR
+	v.reassignments[partitionKey{"deleted", 0}] = reassignment{Replicas: []int{1}}
+	v.isr[partitionKey{"deleted", 0}] = isrRecord{Leader: 1, ISR: []int{1}}
+	finished := planMoves(v, map[string][]replication.Assignment{})
+	if len(finished) != 2 {
+		t.Errorf("Expected the keys of the deleted topic removed, got %v", finished)
+	}
+}
+
+func TestPlanElections(t *testing.T) {
+	v := view{
+		live:   []int{1, 2, 3},
+		topics: map[string]topic.Config{"orders": {NumOfPartition: 3, Replicas: 2}},
+		assignments: map[string][]replication.Assignment{"orders": {
+			{Replicas: []int{1, 2}, Leader: 2}, // Broker 1 came back
+			{Replicas: []int{2, 3}, Leader: 2},
+			{Replicas: []int{3, 1}, Leader: 1}, // Broker 3 came back, not in sync yet
+		}},
+		isr: map[partitionKey]isrRecord{
+			{"orders", 0}: {Leader: 2, ISR: []int{2, 1}},
+			{"orders", 2}: {Leader: 1, ISR: []int{1}},
+		},
+		elections: map[partitionKey]bool{},
+	}
+
+	// Balanced enough, nothing moves until asked for
+	changes := map[string][]replication.Assignment{}
+	if planElections(v, changes, 101); len(changes) != 0 {
+		t.Errorf("Expected no election under the threshold, got %v", changes)
+	}
+	v.elections[partitionKey{"orders", 0}] = true
+	v.elections[partitionKey{"orders", 2}] = true
+	finished := planElections(v, changes, 0)
+	if len(finished) != 1 || finished[0] != (partitionKey{"orders", 0}).key(electionsPrefix) {
+		t.Errorf("Expected only the election of partition 0 done, got %v", finished)
+	}
+	if leader := changes["orders"][0].Leader; leader != 1 {
+		t.Errorf("Expected broker 1 elected, got %d", leader)
+	}
+	if leader := changes["orders"][2].Leader; leader != 1 {
+		t.Errorf("Expected broker 1 to keep leading until 3 is in sync, got %d", leader)
+	}
+
+	// The election kept for partition 2 happens once broker 3 caught up
+	v.elections = map[partitionKey]bool{{"orders", 2}: true}
+	v.isr[partitionKey{"orders", 2}] = isrRecord{Leader: 1, ISR: []int{1, 3}}
+	changes = map[string][]replication.Assignment{}
+	if finished := planElections(v, changes, 0); len(finished) != 1 || changes["orders"][2].Leader != 3 {
+		t.Errorf("Expected broker 3 elected and the request done, got %v and %v", changes, finished)
+	}
+
+	// Over the threshold the controller elects by itself
+	v.elections = map[partitionKey]bool{}
+	changes = map[string][]replication.Assignment{}
+	planElections(v, changes, 10)
+	if partitions := changes["orders"]; len(partitions) != 3 || partitions[0].Leader != 1 || partitions[2].Leader != 3 {
+		t.Errorf("Expected every preferred replica to lead, got %v", partitions)
+	}
+}
+
+func TestPlan_UncleanElection(t *testing.T) {
+	topics := map[string]topic.Config{"orders": {NumOfPartition: 1, Replicas: 2}}
+	current := map[string][]replication.Assignment{"orders": {{Replicas: []int{1, 2}, Leader: 1, Epoch: 3}}}
+	isr := map[partitionKey]isrRecord{{"orders", 0}: {Leader: 1, ISR: []int{1}}}
+
+	// Broker 2 fell behind before the leader went away, it waits for 1
+	changes := plan([]int{2}, nil, topics, current, isr)
+	stampEpochs(current, changes)
+	if a := changes["orders"][0]; a.Leader != replication.NoLeader || a.Epoch != 4 {
+		t.Errorf("Expected no leader at epoch 4 without an in-sync replica, got %+v", a)
+	}
+
+	// Unless the topic takes out of sync leaders
+	topics["orders"] = topic.Config{NumOfPartition: 1, Replicas: 2, UncleanLeaderElection: true}
+	changes = plan([]int{2}, nil, topics, current, isr)
+	stampEpochs(current, changes)
+	if a := changes["orders"][0]; a.Leader != 2 || a.Epoch != 4 {
+		t.Errorf("Expected broker 2 to lead at epoch 4, got %+v", a)
+	}
+
+	// An in-sync replica leads either way
+	isr[partitionKey{"orders", 0}] = isrRecord{Leader: 1, ISR: []int{1, 2}}
+	topics["orders"] = topic.Config{NumOfPartition: 1, Replicas: 2}
+	if changes = plan([]int{2}, nil, topics, current, isr); changes["orders"][0].Leader != 2 {
+		t.Errorf("Expected the in-sync broker 2 to lead, got %+v", changes["orders"][0])
+	}
+}
@@ -0,0 +1,152 @@
+package orchestrator
+
+import (
+	"FranzMQ/replication"
+	"context"
+	"fmt"
+	"log"
+	"sort"
+)
+
+// ElectPreferredLeaders moves leadership of partitions back to their
+// preferred replica, the first of the assignment, where it is up and in
+// sync. It covers the partitions given of a topic, all of them when there
+// are none, and every topic when name is empty. Returns the number of
+// partitions not led by their preferred replica. The controller elects them
+// in the background, those whose preferred replica is down or out of sync
+// once it is back in sync.
+func (o *Orchestrator) ElectPreferredLeaders(ctx context.Context, name string, partitions []int) (int, error) {
+	v, _ := o.snapshot()
+	names := []string{name}
+	if name == "" {
+		names, partitions = nil, nil
+		for name := range v.assignments {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+	} else if _, found := v.topics[name]; !found {
+		return 0, fmt.Errorf("topic %s does not exist in the cluster", name)
+	}
+
+	keys := []partitionKey{}
+	for _, name := range names {
+		assigned := v.assignments[name]
+		selected := partitions
+		if len(selected) == 0 {
+			for p := range assigned {
+				selected = append(selected, p)
+			}
+		}
+		for _, p := range selected {
+			if p < 0 || p >= len(assigned) {
+				return 0, fmt.Errorf("topic %s has no assigned partition %d", name, p)
+			}
+			if a := assigned[p]; len(a.Replicas) > 0 && a.Leader != a.Replicas[0] {
+				keys = append(keys, partitionKey{name, p})
+			}
+		}
+	}
+
+	for _, key := range keys {
+		putCtx, cancel := context.WithTimeout(ctx, requestTimeout)
+		err := o.store.Put(putCtx, key.key(electionsPrefix), []byte("{}"))
+		cancel()
+		if err != nil {
+			return 0, err
+		}
+	}
+	return len(keys), nil
+}
+
+// planElections moves leadership to the preferred replica of the partitions
+// an election was asked for and, when imbalancePercent is set, of the
+// brokers that do not lead more than that percentage of the partitions they
+// are the preferred replica of. Adds to the changes of plan and planMoves,
+// returns the election keys to delete: those of partitions now led by their
+// preferred replica and of deleted partitions. An election asked for while
+// the preferred replica is down, out of sync or the partition is moving
+// stays until it can happen.
+func planElections(v view, changes map[string][]replication.Assignment, imbalancePercent int) []string {
+	finished := []string{}
+	elect := map[partitionKey]bool{}
+	for key := range v.elections {
+		elect[key] = true
+	}
+	current := func(name string) []replication.Assignment {
+		if partitions, changed := changes[name]; changed {
+			return partitions
+		}
+		return v.assignments[name]
+	}
+
+	if imbalancePercent > 0 {
+		preferred, notLed := map[int]int{}, map[int]int{}
+		for name := range v.assignments {
+			for _, a := range current(name) {
+				if len(a.Replicas) > 0 {
+					preferred[a.Replicas[0]]++
+					if a.Leader != a.Replicas[0] {
+						notLed[a.Replicas[0]]++
+					}
+				}
+			}
+		}
+		for name := range v.assignments {
+			for p, a := range current(name) {
+				if len(a.Replicas) == 0 || a.Leader == a.Replicas[0] {
+					continue
+				}
+				if id := a.Replicas[0]; notLed[id]*100 > imbalancePercent*preferred[id] {
+					elect[partitionKey{name, p}] = true
+				}
+			}
+		}
+	}
+
+	alive := map[int]bool{}
+	for _, id := range v.live {
+		alive[id] = true
+	}
+	for key := range elect {
+		done := func() {
+			if v.elections[key] {
+				finished = append(finished, key.key(electionsPrefix))
+			}
+		}
+		partitions := current(key.topic)
+		if key.partition >= len(partitions) {
+			done() // Deleted
+			continue
+		}
+		a := partitions[key.partition]
+		if len(a.Replicas) > 0 && a.Leader == a.Replicas[0] {
+			done()
+			continue
+		}
+		if !preferredEligible(a, v.isr[key], alive) {
+			continue
+		}
+		if _, moving := v.reassignments[key]; moving {
+			continue
+		}
+		done()
+		log.Println("Electing broker", a.Replicas[0], "leader of", key.topic, key.partition, "instead of", a.Leader)
+		a.Leader = a.Replicas[0]
+		partitions = append([]replication.Assignment{}, partitions...)
+		partitions[key.partition] = a
+		changes[key.topic] = partitions
+	}
+	return finished
+}
+
+// Whether leadership can move to the preferred replica: it is up and in sync
+// with the leader, and the partition is not moving
+func preferredEligible(a replication.Assignment, isr isrRecord, alive map[int]bool) bool {
+	if len(a.Replicas) == 0 || a.Leader == replication.NoLeader || a.Leader == a.Replicas[0] {
+		return false
+	}
+	if len(a.Adding) > 0 || len(a.Removing) > 0 {
+		return false
+	}
+	return alive[a.Replicas[0]] && isr.Leader == a.Leader && contains(isr.ISR, a.Replicas[0])
+}
@@ -1,9 +1,553 @@
+// Package orchestrator keeps the cluster metadata in a store, etcd or the
+// built-in Raft quorum. Every broker registers itself under a session, so it
+// disappears when the broker does, and passes the topics created, changed
+// and deleted on it to the store. All brokers watch the store and apply what
+// the others did. One of them is elected controller and assigns the
+// partitions of every topic to live brokers, those with a single replica
+// too, moving leadership away from brokers that went away. Brokers pick the
+// assignments up through their watch and hand them to the replication
+// package. The controller also moves partitions to the brokers a
+// reassignment asks for, see Reassign, and leadership back to the preferred
+// replicas, see ElectPreferredLeaders.
+//
+// Keys, below /franzmq/:
+//
+//	brokers/<id>                     broker.Broker, gone with the broker's session
+//	topics/<name>                    topic.Config
+//	assignments/<name>               []replication.Assignment, one per partition
+//	reassignments/<name>/<partition> where a partition moves to, until it is there
+//	isr/<name>/<partition>           the in-sync replicas, put by the partition leader
+//	elections/<name>/<partition>     a preferred leader election asked for
+//	controller/                      election of the controller
 package orchestrator
 
 import (
 	"FranzMQ/orchestrator/broker"
+	"FranzMQ/orchestrator/store"
+	"FranzMQ/replication"
+	"FranzMQ/topic"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 )
 
+const (
+	keyPrefix           = "/franzmq/"
+	brokersPrefix       = keyPrefix + "brokers/"
+	topicsPrefix        = keyPrefix + "topics/"
+	assignmentsPrefix   = keyPrefix + "assignments/"
+	reassignmentsPrefix = keyPrefix + "reassignments/"
+	isrPrefix           = keyPrefix + "isr/"
+	electionsPrefix     = keyPrefix + "elections/"
+	controllerPrefix    = keyPrefix + "controller/"
+
+	requestTimeout    = 5 * time.Second
+	assignmentTimeout = 10 * time.Second // Longest a topic creation waits for the controller
+)
+
+type Settings struct {
+	BrokerID   int
+	Addr       string // Binary listener address the other brokers connect to
+	Rack       string // Failure domain, replicas of a partition go to distinct racks
+	Store      store.Store
+	SessionTTL time.Duration // A broker not heard of for this long is taken out of the cluster
+
+	// The controller moves leadership back to the preferred replicas of a
+	// broker once it does not lead this percentage of them, checked every
+	// LeaderImbalanceCheckInterval. 0 leaves leadership where it is.
+	LeaderImbalancePercent       int
+	LeaderImbalanceCheckInterval time.Duration
+}
+
+// Orchestrator mirrors the metadata in the store
 type Orchestrator struct {
-	topic_name_to_broker map[string]broker.Broker
+	settings Settings
+	store    store.Store
+
+	mu            sync.Mutex
+	brokers       map[int]broker.Broker
+	topics        map[string]topic.Config
+	assignments   map[string][]replication.Assignment
+	reassignments map[partitionKey]reassignment
+	isr           map[partitionKey]isrRecord
+	elections     map[partitionKey]bool
+	applying      map[string]bool // Topics being brought in line with the store
+	changed       chan struct{}   // Closed whenever the metadata changed
+
+	isrLock    sync.Mutex
+	pendingISR map[partitionKey]isrRecord // ISR changes of partitions led here, not put yet
+	isrChanged chan struct{}
+}
+
+type partitionKey struct {
+	topic     string
+	partition int
+}
+
+// The key below prefix of a partition
+func (k partitionKey) key(prefix string) string {
+	return prefix + k.topic + "/" + strconv.Itoa(k.partition)
+}
+
+// The partition of a key below prefix
+func parsePartitionKey(prefix, key string) (partitionKey, bool) {
+	name, partition, found := strings.Cut(strings.TrimPrefix(key, prefix), "/")
+	p, err := strconv.Atoi(partition)
+	return partitionKey{name, p}, found && err == nil
+}
+
+// Start follows the metadata in the store in the background: it loads it,
+// registers the topics only this broker has, then keeps watching the store
+// and takes part in the controller election. The store may not be reachable
+// yet, the nodes of the built-in quorum for one reach each other through the
+// listeners started after this.
+func Start(s Settings) *Orchestrator {
+	o := &Orchestrator{
+		settings:      s,
+		store:         s.Store,
+		brokers:       map[int]broker.Broker{},
+		topics:        map[string]topic.Config{},
+		assignments:   map[string][]replication.Assignment{},
+		reassignments: map[partitionKey]reassignment{},
+		isr:           map[partitionKey]isrRecord{},
+		elections:     map[partitionKey]bool{},
+		applying:      map[string]bool{},
+		changed:       make(chan struct{}),
+		pendingISR:    map[partitionKey]isrRecord{},
+		isrChanged:    make(chan struct{}, 1),
+	}
+	topic.OnCreate(o.topicCreated)
+	topic.OnDelete(o.topicDeleted)
+	topic.OnConfigChange(o.topicChanged)
+	replication.OnISRChange(o.leaderISRChanged)
+
+	go func() {
+		for {
+			ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+			kvs, rev, err := o.store.Get(ctx, keyPrefix)
+			if err != nil {
+				cancel()
+				log.Println("Error loading cluster metadata, trying again:", err)
+				time.Sleep(time.Second)
+				continue
+			}
+			o.load(kvs)
+			o.registerTopics(ctx)
+			cancel()
+			go o.follow(rev + 1)
+			go o.run()
+			go o.publishISR()
+			log.Println("Broker", s.BrokerID, "following the cluster metadata")
+			return
+		}
+	}()
+	return o
+}
+
+// Brokers returns the live brokers by id
+func (o *Orchestrator) Brokers() map[int]broker.Broker {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	brokers := make(map[int]broker.Broker, len(o.brokers))
+	for id, b := range o.brokers {
+		brokers[id] = b
+	}
+	return brokers
+}
+
+// Watch the store from rev on, loading everything again when the watch
+// breaks, for example because the revision was compacted
+func (o *Orchestrator) follow(rev int64) {
+	for {
+		for resp := range o.store.Watch(context.Background(), keyPrefix, rev) {
+			if resp.Err != nil {
+				log.Println("Error watching cluster metadata:", resp.Err)
+				break
+			}
+			for _, event := range resp.Events {
+				o.apply(event.Key, event.Value, event.Deleted)
+			}
+			rev = resp.Revision + 1
+			o.signal()
+		}
+
+		time.Sleep(time.Second)
+		ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+		kvs, current, err := o.store.Get(ctx, keyPrefix)
+		cancel()
+		if err != nil {
+			log.Println("Error loading cluster metadata:", err)
+			continue
+		}
+		o.load(kvs)
+		rev = current + 1
+	}
+}
+
+// Apply a full copy of the metadata, brokers first so replicas can be
+// reached, then topics so assignments find them
+func (o *Orchestrator) load(kvs []store.KV) {
+	present := map[string][]byte{}
+	for _, kv := range kvs {
+		present[kv.Key] = kv.Value
+	}
+	o.mu.Lock()
+	known := []string{}
+	for id := range o.brokers {
+		known = append(known, brokersPrefix+strconv.Itoa(id))
+	}
+	for name := range o.topics {
+		known = append(known, topicsPrefix+name)
+	}
+	for name := range o.assignments {
+		known = append(known, assignmentsPrefix+name)
+	}
+	for key := range o.reassignments {
+		known = append(known, key.key(reassignmentsPrefix))
+	}
+	for key := range o.isr {
+		known = append(known, key.key(isrPrefix))
+	}
+	for key := range o.elections {
+		known = append(known, key.key(electionsPrefix))
+	}
+	o.mu.Unlock()
+
+	for _, key := range known {
+		if _, found := present[key]; !found {
+			o.apply(key, nil, true)
+		}
+	}
+	for _, prefix := range []string{brokersPrefix, topicsPrefix, assignmentsPrefix, reassignmentsPrefix, isrPrefix, electionsPrefix} {
+		for key, value := range present {
+			if strings.HasPrefix(key, prefix) {
+				o.apply(key, value, false)
+			}
+		}
+	}
+	o.signal()
+}
+
+// Apply one change of the metadata to the caches and this broker
+func (o *Orchestrator) apply(key string, value []byte, deleted bool) {
+	switch {
+	case strings.HasPrefix(key, brokersPrefix):
+		id, err := strconv.Atoi(strings.TrimPrefix(key, brokersPrefix))
+		if err != nil {
+			return
+		}
+		var b broker.Broker
+		if !deleted {
+			if err := json.Unmarshal(value, &b); err != nil {
+				log.Println("Error decoding broker", key, err)
+				return
+			}
+		}
+		o.mu.Lock()
+		if deleted {
+			delete(o.brokers, id)
+			log.Println("Broker", id, "left the cluster")
+		} else if _, known := o.brokers[id]; !known {
+			o.brokers[id] = b
+			log.Println("Broker", id, "joined the cluster at", b.Addr)
+		} else {
+			o.brokers[id] = b
+		}
+		addrs, racks := map[int]string{}, map[int]string{}
+		for id, b := range o.brokers {
+			addrs[id], racks[id] = b.Addr, b.Rack
+		}
+		o.mu.Unlock()
+		replication.SetBrokers(addrs)
+		replication.SetRacks(racks)
+
+	case strings.HasPrefix(key, topicsPrefix):
+		name := strings.TrimPrefix(key, topicsPrefix)
+		if deleted {
+			o.mu.Lock()
+			delete(o.topics, name)
+			o.mu.Unlock()
+			o.deleteLocally(name)
+			return
+		}
+		var config topic.Config
+		if err := json.Unmarshal(value, &config); err != nil {
+			log.Println("Error decoding topic", key, err)
+			return
+		}
+		o.mu.Lock()
+		o.topics[name] = config
+		o.mu.Unlock()
+		o.applyLocally(name, config)
+
+	case strings.HasPrefix(key, assignmentsPrefix):
+		name := strings.TrimPrefix(key, assignmentsPrefix)
+		var partitions []replication.Assignment
+		if !deleted {
+			if err := json.Unmarshal(value, &partitions); err != nil {
+				log.Println("Error decoding assignment", key, err)
+				return
+			}
+		}
+		o.mu.Lock()
+		if deleted {
+			delete(o.assignments, name)
+		} else {
+			o.assignments[name] = partitions
+		}
+		o.mu.Unlock()
+		replication.SetAssignment(name, partitions)
+
+	case strings.HasPrefix(key, reassignmentsPrefix):
+		partition, valid := parsePartitionKey(reassignmentsPrefix, key)
+		var r reassignment
+		if !valid || (!deleted && json.Unmarshal(value, &r) != nil) {
+			log.Println("Error decoding reassignment", key)
+			return
+		}
+		o.mu.Lock()
+		if deleted {
+			delete(o.reassignments, partition)
+		} else {
+			o.reassignments[partition] = r
+		}
+		o.mu.Unlock()
+
+	case strings.HasPrefix(key, isrPrefix):
+		partition, valid := parsePartitionKey(isrPrefix, key)
+		var record isrRecord
+		if !valid || (!deleted && json.Unmarshal(value, &record) != nil) {
+			log.Println("Error decoding in-sync replicas", key)
+			return
+		}
+		o.mu.Lock()
+		if deleted {
+			delete(o.isr, partition)
+		} else {
+			o.isr[partition] = record
+		}
+		o.mu.Unlock()
+
+	case strings.HasPrefix(key, electionsPrefix):
+		partition, valid := parsePartitionKey(electionsPrefix, key)
+		if !valid {
+			log.Println("Error decoding election", key)
+			return
+		}
+		o.mu.Lock()
+		if deleted {
+			delete(o.elections, partition)
+		} else {
+			o.elections[partition] = true
+		}
+		o.mu.Unlock()
+	}
+}
+
+// Bring a topic on this broker in line with the store. The caches are
+// updated first and the topic marked, so the topic listeners see the change
+// came from the store and do not pass the steps in between back.
+func (o *Orchestrator) applyLocally(name string, config topic.Config) {
+	ctx := context.Background()
+	o.mu.Lock()
+	o.applying[name] = true
+	o.mu.Unlock()
+	defer func() {
+		o.mu.Lock()
+		delete(o.applying, name)
+		o.mu.Unlock()
+	}()
+
+	local, err := topic.LoadConfig(ctx, name)
+	if err != nil {
+		if _, err := topic.CreateAtTopic(name, config); err != nil {
+			log.Println("Error creating topic", name, "of the cluster:", err)
+		}
+		return
+	}
+	if config.NumOfPartition > local.NumOfPartition {
+		if err := topic.AddPartitions(ctx, name, config.NumOfPartition); err != nil {
+			log.Println("Error adding partitions to topic", name, err)
+		}
+	}
+	if changes := topic.ConfigChanges(local, config); len(changes) > 0 {
+		if _, err := topic.AlterConfigs(ctx, name, changes); err != nil {
+			log.Println("Error applying the config of topic", name, err)
+		}
+	}
+}
+
+func (o *Orchestrator) deleteLocally(name string) {
+	ctx := context.Background()
+	if _, err := topic.LoadConfig(ctx, name); err != nil {
+		return
+	}
+	if err := topic.DeleteTopic(ctx, name); err != nil {
+		log.Println("Error deleting topic", name, "of the cluster:", err)
+	}
+}
+
+// Put the topics of this broker the store does not know yet, for example those
+// created before it joined a cluster
+func (o *Orchestrator) registerTopics(ctx context.Context) {
+	names, err := topic.ListTopics(ctx)
+	if err != nil {
+		log.Println("Error listing topics to register:", err)
+		return
+	}
+	for _, name := range names {
+		if o.cached(name) {
+			continue
+		}
+		if config, err := topic.LoadConfig(ctx, name); err == nil {
+			if err := o.putTopic(ctx, name, config, true); err != nil {
+				log.Println("Error registering topic", name, err)
+			}
+		}
+	}
+}
+
+// Put the config of a topic, only if it is new with create, otherwise only
+// if it still exists
+func (o *Orchestrator) putTopic(ctx context.Context, name string, config topic.Config, create bool) error {
+	value, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+	if !create {
+		return o.store.Update(ctx, topicsPrefix+name, value)
+	}
+	created, err := o.store.Create(ctx, topicsPrefix+name, value)
+	if err != nil {
+		return err
+	}
+	if !created {
+		return fmt.Errorf("topic %s already exists in the cluster", name)
+	}
+	return nil
+}
+
+// Whether the store is known to have the topic
+func (o *Orchestrator) cached(name string) bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	_, found := o.topics[name]
+	return found
+}
+
+// A topic created on this broker goes to the store. It is not usable before
+// the controller assigned it, so wait for that.
+func (o *Orchestrator) topicCreated(ctx context.Context, name string, config topic.Config) {
+	if o.cached(name) {
+		return // Created from the store
+	}
+	putCtx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+	if err := o.putTopic(putCtx, name, config, true); err != nil {
+		log.Println("Error registering topic", name, err)
+		return
+	}
+	timer := time.NewTimer(assignmentTimeout)
+	defer timer.Stop()
+	for {
+		o.mu.Lock()
+		assigned, changed := len(o.assignments[name]) >= config.NumOfPartition, o.changed
+		o.mu.Unlock()
+		if assigned {
+			return
+		}
+		select {
+		case <-changed:
+		case <-timer.C:
+			log.Println("Topic", name, "not assigned to brokers yet, it needs", max(config.Replicas, 1), "live brokers")
+			return
+		}
+	}
+}
+
+// Runs while topic changes are locked, which applying changes of the store waits for
+func (o *Orchestrator) topicDeleted(ctx context.Context, name string) {
+	if !o.cached(name) {
+		return // Deleted from the store
+	}
+	deleteCtx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+	if err := o.store.Delete(deleteCtx, topicsPrefix+name); err != nil {
+		log.Println("Error deleting topic", name, "from the cluster:", err)
+	}
+}
+
+func (o *Orchestrator) topicChanged(ctx context.Context, name string, config topic.Config) {
+	o.mu.Lock()
+	current, found := o.topics[name]
+	applying := o.applying[name]
+	o.mu.Unlock()
+	if !found || applying || current == config {
+		return // Unknown yet or changed from the store
+	}
+	putCtx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+	if err := o.putTopic(putCtx, name, config, false); err != nil {
+		log.Println("Error passing on the config of topic", name, err)
+	}
+}
+
+// Wake everyone waiting on a change of the metadata
+func (o *Orchestrator) signal() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	close(o.changed)
+	o.changed = make(chan struct{})
+}
+
+// view is a consistent copy of the metadata the controller works on
+type view struct {
+	live          []int
+	racks         map[int]string // Of the live brokers
+	topics        map[string]topic.Config
+	assignments   map[string][]replication.Assignment
+	reassignments map[partitionKey]reassignment
+	isr           map[partitionKey]isrRecord
+	elections     map[partitionKey]bool
+}
+
+func (o *Orchestrator) snapshot() (view, <-chan struct{}) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	v := view{
+		live:          make([]int, 0, len(o.brokers)),
+		racks:         make(map[int]string, len(o.brokers)),
+		topics:        make(map[string]topic.Config, len(o.topics)),
+		assignments:   make(map[string][]replication.Assignment, len(o.assignments)),
+		reassignments: make(map[partitionKey]reassignment, len(o.reassignments)),
+		isr:           make(map[partitionKey]isrRecord, len(o.isr)),
+		elections:     make(map[partitionKey]bool, len(o.elections)),
+	}
+	for id, b := range o.brokers {
+		v.live = append(v.live, id)
+		v.racks[id] = b.Rack
+	}
+	sort.Ints(v.live)
+	for name, config := range o.topics {
+		v.topics[name] = config
+	}
+	for name, partitions := range o.assignments {
+		v.assignments[name] = partitions
+	}
+	for key, r := range o.reassignments {
+		v.reassignments[key] = r
+	}
+	for key, record := range o.isr {
+		v.isr[key] = record
+	}
+	for key := range o.elections {
+		v.elections[key] = true
+	}
+	return v, o.changed
 }
@@ -0,0 +1,386 @@
+package orchestrator
+
+import (
+	"FranzMQ/metadata"
+	"FranzMQ/replication"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+)
+
+// reassignment is where a partition moves to
+type reassignment struct {
+	Replicas []int `json:"replicas"`
+	Throttle int   `json:"throttle,omitempty"` // Bytes per second the new replicas copy at, no limit when 0
+}
+
+// isrRecord is the in-sync replicas of a partition as its leader put them
+type isrRecord struct {
+	Leader int   `json:"leader"`
+	ISR    []int `json:"isr"`
+}
+
+// Reassign moves partitions of a topic to the replicas given by partition,
+// the first one becomes the preferred leader. The controller adds the new
+// replicas, waits until they caught up with the leader, moves leadership to
+// a new replica if the leader is not one of them, then removes the old
+// replicas. The new replicas copy at up to throttle bytes per second, no
+// limit when 0. A partition already moving goes to the new replicas instead.
+func (o *Orchestrator) Reassign(ctx context.Context, name string, partitions map[int][]int, throttle int) error {
+	o.mu.Lock()
+	config, found := o.topics[name]
+	live := map[int]bool{}
+	for id := range o.brokers {
+		live[id] = true
+	}
+	o.mu.Unlock()
+	if !found {
+		return fmt.Errorf("topic %s does not exist in the cluster", name)
+	}
+	if throttle < 0 {
+		return fmt.Errorf("throttle must not be negative, got %d", throttle)
+	}
+	for p, replicas := range partitions {
+		if p < 0 || p >= config.NumOfPartition {
+			return fmt.Errorf("topic %s has no partition %d", name, p)
+		}
+		if len(replicas) == 0 {
+			return fmt.Errorf("partition %d needs at least one replica", p)
+		}
+		seen := map[int]bool{}
+		for _, id := range replicas {
+			if !live[id] {
+				return fmt.Errorf("broker %d of partition %d is not in the cluster", id, p)
+			}
+			if seen[id] {
+				return fmt.Errorf("broker %d is a replica of partition %d twice", id, p)
+			}
+			seen[id] = true
+		}
+	}
+
+	for p, replicas := range partitions {
+		value, err := json.Marshal(reassignment{Replicas: replicas, Throttle: throttle})
+		if err != nil {
+			return err
+		}
+		putCtx, cancel := context.WithTimeout(ctx, requestTimeout)
+		err = o.store.Put(putCtx, partitionKey{name, p}.key(reassignmentsPrefix), value)
+		cancel()
+		if err != nil {
+			return err
+		}
+		log.Println("Reassigning", name, p, "to", replicas)
+	}
+	return nil
+}
+
+// Decommission moves every partition off a broker before it is retired. Each
+// replica on it goes to the live broker with the fewest replicas that does
+// not have one of the partition yet, on a rack the partition is not on if
+// there is one. Returns the number of partitions moved.
+func (o *Orchestrator) Decommission(ctx context.Context, brokerID, throttle int) (int, error) {
+	v, _ := o.snapshot()
+	load := map[int]int{}
+	for _, id := range v.live {
+		if id != brokerID {
+			load[id] = 0
+		}
+	}
+	targets := map[string]map[int][]int{}
+	names := []string{}
+	for name := range v.assignments {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for p, a := range v.assignments[name] {
+			replicas := a.Replicas
+			if r, moving := v.reassignments[partitionKey{name, p}]; moving {
+				replicas = r.Replicas
+			}
+			for _, id := range replicas {
+				if _, counted := load[id]; counted {
+					load[id]++
+				}
+			}
+			if contains(replicas, brokerID) {
+				if targets[name] == nil {
+					targets[name] = map[int][]int{}
+				}
+				targets[name][p] = replicas
+			}
+		}
+	}
+
+	moved := 0
+	for _, name := range names {
+		partitions := targets[name]
+		for p := 0; p < len(v.assignments[name]); p++ {
+			replicas, found := partitions[p]
+			if !found {
+				continue
+			}
+			usedRacks := map[string]bool{}
+			for _, id := range replicas {
+				if id != brokerID {
+					usedRacks[v.racks[id]] = true
+				}
+			}
+			replacement := -1
+			for id, count := range load {
+				if contains(replicas, id) {
+					continue
+				}
+				if replacement == -1 {
+					replacement = id
+					continue
+				}
+				spread, best := !usedRacks[v.racks[id]], !usedRacks[v.racks[replacement]]
+				if (spread && !best) || (spread == best && (count < load[replacement] || (count == load[replacement] && id < replacement))) {
+					replacement = id
+				}
+			}
+			if replacement == -1 {
+				return moved, fmt.Errorf("no broker left to move partition %d of %s to", p, name)
+			}
+			target := []int{}
+			for _, id := range replicas {
+				if id == brokerID {
+					id = replacement
+				}
+				target = append(target, id)
+			}
+			partitions[p] = target
+			load[replacement]++
+		}
+		if len(partitions) == 0 {
+			continue
+		}
+		if err := o.Reassign(ctx, name, partitions, throttle); err != nil {
+			return moved, err
+		}
+		moved += len(partitions)
+	}
+	log.Println("Decommissioning broker", brokerID, "moves", moved, "partitions")
+	return moved, nil
+}
+
+// Reassignments returns the progress of the partitions moving, by topic and
+// partition
+func (o *Orchestrator) Reassignments() []metadata.Reassignment {
+	v, _ := o.snapshot()
+	progress := []metadata.Reassignment{}
+	for key, r := range v.reassignments {
+		m := metadata.Reassignment{Topic: key.topic, Partition: key.partition, Target: r.Replicas, Throttle: r.Throttle, State: metadata.ReassignmentPending}
+		m.Replicas, m.Adding, m.Removing, m.InSyncReplicas = []int{}, []int{}, []int{}, []int{}
+		if partitions := v.assignments[key.topic]; key.partition < len(partitions) {
+			a := partitions[key.partition]
+			m.Replicas = a.Replicas
+			if len(a.Adding) > 0 || len(a.Removing) > 0 {
+				m.Adding, m.Removing = nonNil(a.Adding), nonNil(a.Removing)
+				m.State = metadata.ReassignmentCopying
+				if record := v.isr[key]; record.Leader == a.Leader {
+					m.InSyncReplicas = nonNil(record.ISR)
+					if containsAll(record.ISR, a.Adding) {
+						m.State = metadata.ReassignmentElecting
+					}
+				}
+			}
+		}
+		progress = append(progress, m)
+	}
+	sort.Slice(progress, func(i, j int) bool {
+		if progress[i].Topic != progress[j].Topic {
+			return progress[i].Topic < progress[j].Topic
+		}
+		return progress[i].Partition < progress[j].Partition
+	})
+	return progress
+}
+
+// planMoves takes the partitions with a reassignment one step further,
+// adding to the assignment changes of plan. Returns the keys to delete: the
+// reassignments done, and the reassignments and ISRs of deleted topics.
+//
+// A move first makes the partition replicated to the old and the new
+// replicas. Once the new ones are in sync, leadership goes to the first of
+// them in sync if the leader is not one of them, then the old ones are
+// removed.
+func planMoves(v view, changes map[string][]replication.Assignment) []string {
+	finished := []string{}
+	for key := range v.isr {
+		if _, found := v.topics[key.topic]; !found {
+			finished = append(finished, key.key(isrPrefix))
+		}
+	}
+	alive := map[int]bool{}
+	for _, id := range v.live {
+		alive[id] = true
+	}
+
+	for key, r := range v.reassignments {
+		partitions, changed := changes[key.topic]
+		if !changed {
+			partitions = v.assignments[key.topic]
+		}
+		if _, found := v.topics[key.topic]; !found || key.partition >= len(partitions) {
+			if !found {
+				finished = append(finished, key.key(reassignmentsPrefix))
+			}
+			continue // Deleted, or assigned on the next round
+		}
+		a := partitions[key.partition]
+		next, done := move(a, r, v.isr[key], alive)
+		if done {
+			finished = append(finished, key.key(reassignmentsPrefix))
+		}
+		if !equalAssignments(next, a) {
+			partitions = append([]replication.Assignment{}, partitions...)
+			partitions[key.partition] = next
+			changes[key.topic] = partitions
+		}
+	}
+	return finished
+}
+
+// The next step of moving a partition, true once it is where r asks for
+func move(a replication.Assignment, r reassignment, isr isrRecord, alive map[int]bool) (replication.Assignment, bool) {
+	if a.Leader == replication.NoLeader {
+		return a, false // Waits for a replica to come back
+	}
+	// The replicas the partition had before it started moving, then those it
+	// has while moving: the new ones first
+	original := []int{}
+	for _, id := range a.Replicas {
+		if !contains(a.Adding, id) {
+			original = append(original, id)
+		}
+	}
+	moving := replication.Assignment{Replicas: append([]int{}, r.Replicas...), Leader: a.Leader, Throttle: r.Throttle}
+	for _, id := range original {
+		if contains(r.Replicas, id) {
+			continue
+		}
+		moving.Replicas = append(moving.Replicas, id)
+		moving.Removing = append(moving.Removing, id)
+	}
+	for _, id := range r.Replicas {
+		if !contains(original, id) {
+			moving.Adding = append(moving.Adding, id)
+		}
+	}
+	if len(moving.Adding) == 0 && len(moving.Removing) == 0 {
+		return replication.Assignment{Replicas: r.Replicas, Leader: a.Leader}, true // Only the order changes
+	}
+	if !equalIDs(a.Replicas, moving.Replicas) || !equalIDs(a.Adding, moving.Adding) || !equalIDs(a.Removing, moving.Removing) {
+		return moving, false
+	}
+
+	a.Throttle = r.Throttle
+	if isr.Leader != a.Leader || !containsAll(isr.ISR, a.Adding) {
+		return a, false // Still copying
+	}
+	if !contains(r.Replicas, a.Leader) {
+		for _, id := range r.Replicas {
+			if alive[id] && contains(isr.ISR, id) {
+				a.Leader = id
+				return a, false
+			}
+		}
+		return a, false
+	}
+	return replication.Assignment{Replicas: r.Replicas, Leader: a.Leader}, true
+}
+
+// Pass an ISR change of a partition led here on to the store, without
+// waiting for it
+func (o *Orchestrator) leaderISRChanged(topicName string, partition int, isr []int) {
+	o.isrLock.Lock()
+	o.pendingISR[partitionKey{topicName, partition}] = isrRecord{Leader: o.settings.BrokerID, ISR: isr}
+	o.isrLock.Unlock()
+	select {
+	case o.isrChanged <- struct{}{}:
+	default:
+	}
+}
+
+// Put the latest ISR of each partition led here, keeping those that failed
+// for the next round
+func (o *Orchestrator) publishISR() {
+	for range o.isrChanged {
+		o.isrLock.Lock()
+		pending := o.pendingISR
+		o.pendingISR = map[partitionKey]isrRecord{}
+		o.isrLock.Unlock()
+
+		failed := false
+		for key, record := range pending {
+			value, _ := json.Marshal(record)
+			ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+			err := o.store.Put(ctx, key.key(isrPrefix), value)
+			cancel()
+			if err != nil {
+				log.Println("Error putting the in-sync replicas of", key.topic, key.partition, err)
+				o.isrLock.Lock()
+				if _, newer := o.pendingISR[key]; !newer {
+					o.pendingISR[key] = record
+				}
+				o.isrLock.Unlock()
+				failed = true
+			}
+		}
+		if failed {
+			time.Sleep(time.Second)
+			select {
+			case o.isrChanged <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
+
+func contains(ids []int, id int) bool {
+	for _, candidate := range ids {
+		if candidate == id {
+			return true
+		}
+	}
+	return false
+}
+
+func containsAll(ids, all []int) bool {
+	for _, id := range all {
+		if !contains(ids, id) {
+			return false
+		}
+	}
+	return true
+}
+
+func equalIDs(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func equalAssignments(a, b replication.Assignment) bool {
+	return a.Leader == b.Leader && a.Throttle == b.Throttle && equalIDs(a.Replicas, b.Replicas) &&
+		equalIDs(a.Adding, b.Adding) && equalIDs(a.Removing, b.Removing)
+}
+
+func nonNil(ids []int) []int {
+	if ids == nil {
+		return []int{}
+	}
+	return ids
+}
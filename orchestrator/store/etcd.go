@@ -0,0 +1,138 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/client/v3/concurrency"
+)
+
+// Etcd keeps the metadata in an etcd cluster
+type Etcd struct {
+	client *clientv3.Client
+}
+
+func NewEtcd(client *clientv3.Client) *Etcd {
+	return &Etcd{client: client}
+}
+
+func (e *Etcd) Get(ctx context.Context, prefix string) ([]KV, int64, error) {
+	resp, err := e.client.Get(ctx, prefix, clientv3.WithPrefix())
+	if err != nil {
+		return nil, 0, err
+	}
+	kvs := make([]KV, 0, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		kvs = append(kvs, KV{Key: string(kv.Key), Value: kv.Value})
+	}
+	return kvs, resp.Header.Revision, nil
+}
+
+func (e *Etcd) Watch(ctx context.Context, prefix string, rev int64) <-chan WatchResponse {
+	out := make(chan WatchResponse)
+	go func() {
+		defer close(out)
+		for resp := range e.client.Watch(ctx, prefix, clientv3.WithPrefix(), clientv3.WithRev(rev)) {
+			w := WatchResponse{Revision: resp.Header.Revision, Err: resp.Err()}
+			for _, event := range resp.Events {
+				w.Events = append(w.Events, Event{Key: string(event.Kv.Key), Value: event.Kv.Value, Deleted: event.Type == mvccpb.DELETE})
+			}
+			select {
+			case out <- w:
+			case <-ctx.Done():
+				return
+			}
+			if w.Err != nil {
+				return
+			}
+		}
+	}()
+	return out
+}
+
+func (e *Etcd) Create(ctx context.Context, key string, value []byte) (bool, error) {
+	return create(ctx, e.client, key, value)
+}
+
+func (e *Etcd) Update(ctx context.Context, key string, value []byte) error {
+	_, err := e.client.Txn(ctx).
+		If(clientv3.Compare(clientv3.CreateRevision(key), ">", 0)).
+		Then(clientv3.OpPut(key, string(value))).
+		Commit()
+	return err
+}
+
+func (e *Etcd) Put(ctx context.Context, key string, value []byte) error {
+	_, err := e.client.Put(ctx, key, string(value))
+	return err
+}
+
+func (e *Etcd) Delete(ctx context.Context, key string) error {
+	_, err := e.client.Delete(ctx, key)
+	return err
+}
+
+func (e *Etcd) NewSession(ttl time.Duration) (Session, error) {
+	session, err := concurrency.NewSession(e.client, concurrency.WithTTL(max(int(ttl.Seconds()), 1)))
+	if err != nil {
+		return nil, err
+	}
+	return etcdSession{session}, nil
+}
+
+// A session is an etcd lease kept alive
+type etcdSession struct {
+	*concurrency.Session
+}
+
+func (s etcdSession) Create(ctx context.Context, key string, value []byte) (bool, error) {
+	return create(ctx, s.Client(), key, value, clientv3.WithLease(s.Lease()))
+}
+
+func (s etcdSession) Campaign(ctx context.Context, prefix, value string) (Leader, error) {
+	election := concurrency.NewElection(s.Session, prefix)
+	if err := election.Campaign(ctx, value); err != nil {
+		return nil, err
+	}
+	// Writes only go through while the election key is still ours
+	fence := clientv3.Compare(clientv3.CreateRevision(election.Key()), "=", election.Rev())
+	return etcdLeader{client: s.Client(), fence: fence}, nil
+}
+
+type etcdLeader struct {
+	client *clientv3.Client
+	fence  clientv3.Cmp
+}
+
+func (l etcdLeader) Put(ctx context.Context, key string, value []byte) error {
+	return l.write(ctx, clientv3.OpPut(key, string(value)))
+}
+
+func (l etcdLeader) Delete(ctx context.Context, key string) error {
+	return l.write(ctx, clientv3.OpDelete(key))
+}
+
+func (l etcdLeader) write(ctx context.Context, op clientv3.Op) error {
+	resp, err := l.client.Txn(ctx).If(l.fence).Then(op).Commit()
+	if err != nil {
+		return err
+	}
+	if !resp.Succeeded {
+		return fmt.Errorf("%w: %s not written", ErrLostElection, op.KeyBytes())
+	}
+	return nil
+}
+
+func create(ctx context.Context, client *clientv3.Client, key string, value []byte, opts ...clientv3.OpOption) (bool, error) {
+	resp, err := client.Txn(ctx).
+		If(clientv3.Compare(clientv3.CreateRevision(key), "=", 0)).
+		Then(clientv3.OpPut(key, string(value), opts...)).
+		Commit()
+	if err != nil {
+		return false, err
+	}
+	return resp.Succeeded, nil
+}
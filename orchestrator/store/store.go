@@ -0,0 +1,66 @@
+// Package store is what the orchestrator keeps the cluster metadata in: a
+// consistent key value store with watches, sessions that end when their
+// owner goes away, and elections. etcd is one, the quorum package's
+// built-in Raft log the other.
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrLostElection fails the writes of a leader that was replaced
+var ErrLostElection = errors.New("lost the election")
+
+// KV is a key and its value
+type KV struct {
+	Key   string
+	Value []byte
+}
+
+// Event is a change of a key
+type Event struct {
+	Key     string
+	Value   []byte // Nil once deleted
+	Deleted bool
+}
+
+// WatchResponse carries the events of one revision or more
+type WatchResponse struct {
+	Events   []Event
+	Revision int64 // Of the last event
+	Err      error // The watch broke and the channel closes
+}
+
+type Store interface {
+	// Get returns the keys below prefix and the revision they were read at
+	Get(ctx context.Context, prefix string) ([]KV, int64, error)
+	// Watch sends the changes below prefix from revision rev on, until ctx
+	// is done or the watch broke
+	Watch(ctx context.Context, prefix string, rev int64) <-chan WatchResponse
+	// Create puts key unless it exists, false when it does
+	Create(ctx context.Context, key string, value []byte) (bool, error)
+	// Update puts key if it exists
+	Update(ctx context.Context, key string, value []byte) error
+	Put(ctx context.Context, key string, value []byte) error
+	Delete(ctx context.Context, key string) error
+	// NewSession opens a session that ends with Close or once the store did
+	// not hear from it for ttl
+	NewSession(ttl time.Duration) (Session, error)
+}
+
+type Session interface {
+	Done() <-chan struct{}
+	Close() error
+	// Create puts key unless it exists, it is deleted when the session ends
+	Create(ctx context.Context, key string, value []byte) (bool, error)
+	// Campaign blocks until this session leads the election at prefix
+	Campaign(ctx context.Context, prefix, value string) (Leader, error)
+}
+
+// Leader writes as long as it holds its election
+type Leader interface {
+	Put(ctx context.Context, key string, value []byte) error
+	Delete(ctx context.Context, key string) error
+}
@@ -0,0 +1,55 @@
+package producer
+
+import (
+	"FranzMQ/constants"
+	"FranzMQ/metrics"
+	"context"
+	"log"
+	"time"
+)
+
+const writerCloseTimeout = 5 * time.Second
+
+// RemoveTopic drops everything the producer keeps for a topic: partition
+// goroutines, open writer file handles, offsets, log sizes, segments, the
+// cached config, its metric series and the segments in the remote tier.
+// Call it after the topic files were moved away, so no produce can start new
+// queues for it.
+func RemoveTopic(ctx context.Context, topicName string, partitions int) {
+	ctx, span := constants.Tracer.Start(ctx, "RemoveTopic")
+	defer span.End()
+
+	StopQueues(ctx, topicName)
+
+	for p := 0; p < partitions; p++ {
+		closeWriterFile(ctx, GlobalLogWriterQueue, getLogFilePath(topicName, p))
+		closeWriterFile(ctx, GlobalIndexWriterQueue, getIndexFilePath(topicName, p))
+
+		key := partitionKey(topicName, p)
+		constants.OffsetMap.Delete(ctx, key)
+		constants.LogSizeMap.Delete(ctx, key)
+		partitionLogs.Delete(key)
+
+		// Parked fetches wake up and find the partition gone
+		notifyAppend(getLogFilePath(topicName, p))
+	}
+	InvalidateConfig(topicName)
+	metrics.RemoveTopic(topicName, partitions)
+
+	if tier := currentRemoteTier(); tier != nil {
+		if err := tier.RemoveTopic(ctx, topicName); err != nil {
+			log.Println("Error removing remote segments of", topicName, err)
+		}
+	}
+}
+
+// Ask a writer thread to flush and close a file, and wait until it did
+func closeWriterFile(ctx context.Context, writerQueue chan LogWrite, filePath string) {
+	closed := make(chan struct{})
+	writerQueue <- LogWrite{Ctx: ctx, FilePath: filePath, Closed: closed}
+	select {
+	case <-closed:
+	case <-time.After(writerCloseTimeout):
+		log.Println("Timed out waiting for the writer to close", filePath)
+	}
+}
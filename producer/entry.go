@@ -0,0 +1,116 @@
+package producer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// Entries with side fields start with this, JSON never does, so no message
+// produced natively is taken for one
+const attributesMarker = "^"
+
+// Record is a message produced with a key or headers, by Kafka clients. The
+// value is stored as the message every API returns, the key and headers next
+// to it, and the bytes come back as they were produced.
+type Record struct {
+	Key     []byte
+	Value   []byte // nil for a tombstone
+	Headers []Header
+}
+
+type Header struct {
+	Key   string `json:"key"`
+	Value []byte `json:"value"`
+}
+
+// How the value of a Record became the message of its entry
+const (
+	EncodingJSON   = "json"   // The value is JSON and the message as is
+	EncodingString = "string" // The value is UTF-8 text, the message a JSON string of it
+	EncodingBase64 = "base64" // The message is a JSON string of the value in base64
+	EncodingNull   = "null"   // A tombstone, the message is null
+)
+
+// EntryAttributes are the side fields of an entry produced as a Record, the
+// zero value for messages produced natively
+type EntryAttributes struct {
+	Key      []byte   `json:"key,omitempty"`
+	Headers  []Header `json:"headers,omitempty"`
+	Encoding string   `json:"encoding,omitempty"`
+}
+
+// Store the value of a record as its message, with the side fields before it
+func encodeRecord(r Record) (string, error) {
+	attributes := EntryAttributes{Key: r.Key, Headers: r.Headers}
+	var message []byte
+	switch {
+	case r.Value == nil:
+		attributes.Encoding, message = EncodingNull, []byte("null")
+	case json.Valid(r.Value) && !bytes.ContainsAny(r.Value, "\r\n"):
+		attributes.Encoding, message = EncodingJSON, r.Value
+	case utf8.Valid(r.Value):
+		attributes.Encoding = EncodingString
+		message, _ = json.Marshal(string(r.Value))
+	default:
+		attributes.Encoding = EncodingBase64
+		message, _ = json.Marshal(r.Value)
+	}
+	return JoinEntry(message, attributes)
+}
+
+// JoinEntry puts a message and its side fields back into the entry they
+// were split from, for followers copying the log
+func JoinEntry(message json.RawMessage, attributes EntryAttributes) (string, error) {
+	if attributes.Encoding == "" {
+		return string(message), nil
+	}
+	side, err := json.Marshal(attributes)
+	if err != nil {
+		return "", fmt.Errorf("error encoding record attributes: %w", err)
+	}
+	return attributesMarker + string(side) + string(message), nil
+}
+
+// SplitEntry returns the message of a stored entry and its side fields
+func SplitEntry(entry string) (json.RawMessage, EntryAttributes, error) {
+	var attributes EntryAttributes
+	if !strings.HasPrefix(entry, attributesMarker) {
+		return json.RawMessage(entry), attributes, nil
+	}
+	dec := json.NewDecoder(strings.NewReader(entry[len(attributesMarker):]))
+	if err := dec.Decode(&attributes); err != nil {
+		return nil, attributes, fmt.Errorf("malformed record attributes: %w", err)
+	}
+	message := strings.TrimSpace(entry[len(attributesMarker)+int(dec.InputOffset()):])
+	return json.RawMessage(message), attributes, nil
+}
+
+// Value returns the bytes a message was produced with. Native messages
+// that are JSON strings give their text, null gives nil.
+func (a EntryAttributes) Value(message json.RawMessage) []byte {
+	switch a.Encoding {
+	case EncodingJSON:
+		return message
+	case EncodingNull:
+		return nil
+	case EncodingBase64:
+		var value []byte
+		if err := json.Unmarshal(message, &value); err == nil {
+			return value
+		}
+		return message
+	}
+	if string(message) == "null" {
+		return nil
+	}
+	if len(message) > 0 && message[0] == '"' {
+		var s string
+		if err := json.Unmarshal(message, &s); err == nil {
+			return []byte(s)
+		}
+	}
+	return message
+}
@@ -0,0 +1,32 @@
+package producer
+
+import (
+	"FranzMQ/metrics"
+	"strconv"
+)
+
+func init() {
+	metrics.RegisterGauges("franzmq_partition_queue_depth", "Entries waiting in the log queue of a partition",
+		[]string{"topic", "partition"}, partitionQueueDepths)
+	metrics.RegisterGauges("franzmq_writer_queue_depth", "Writes waiting for a global writer thread",
+		[]string{"queue"}, writerQueueDepths)
+}
+
+func partitionQueueDepths() []metrics.Sample {
+	queueLock.Lock()
+	defer queueLock.Unlock()
+	samples := []metrics.Sample{}
+	for topic, queues := range logQueues {
+		for partition, queue := range queues {
+			samples = append(samples, metrics.Sample{Labels: []string{topic, strconv.Itoa(partition)}, Value: float64(len(queue))})
+		}
+	}
+	return samples
+}
+
+func writerQueueDepths() []metrics.Sample {
+	return []metrics.Sample{
+		{Labels: []string{"log"}, Value: float64(len(GlobalLogWriterQueue))},
+		{Labels: []string{"index"}, Value: float64(len(GlobalIndexWriterQueue))},
+	}
+}
@@ -0,0 +1,21 @@
+package producer
+
+import "sync"
+
+// Waiters parked on a partition's log, woken once new entries hit the file
+var appendWaiters sync.Map // Key: log file path, Value: chan struct{}
+
+// AppendNotifier returns a channel that is closed the next time entries are
+// flushed to the partition's log file. Grab it before reading the log so an
+// append that lands in between is not missed.
+func AppendNotifier(topic string, partition int) <-chan struct{} {
+	ch, _ := appendWaiters.LoadOrStore(getLogFilePath(topic, partition), make(chan struct{}))
+	return ch.(chan struct{})
+}
+
+// Wake everyone waiting on the given file
+func notifyAppend(filePath string) {
+	if ch, ok := appendWaiters.LoadAndDelete(filePath); ok {
+		close(ch.(chan struct{}))
+	}
+}
@@ -2,20 +2,38 @@ package producer
 
 import (
 	"FranzMQ/constants"
+	"FranzMQ/storage"
 	"FranzMQ/utils"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
-	"os"
 	"sync"
 	"time"
 )
 
 type Config struct {
-	NumOfPartition int `json:"NumOfPartition"`
+	NumOfPartition    int   `json:"NumOfPartition"`
+	Replicas          int   `json:"Replicas"`
+	MinInsyncReplicas int   `json:"MinInsyncReplicas"` // 0 means 1
+	MaxMessageBytes   int   `json:"MaxMessageBytes"`   // 0 means DefaultMaxMessageBytes
+	SegmentBytes      int64 `json:"SegmentBytes"`      // 0 means DefaultSegmentBytes
+	RetentionMs       int64 `json:"RetentionMs"`       // 0 or -1 keeps segments forever
+	RetentionBytes    int64 `json:"RetentionBytes"`    // 0 or -1 for no limit
 }
 
+// DefaultMaxMessageBytes limits messages of topics without max.message.bytes
+const DefaultMaxMessageBytes = 1024 * 1024
+
+// Errors of produce requests naming what is not there or sending what is not
+// accepted, the fault of the client
+var (
+	ErrUnknownTopic     = errors.New("topic does not exist, please create the topic first")
+	ErrUnknownPartition = errors.New("the partition does not exist")
+	ErrInvalidMessage   = errors.New("invalid message")
+)
+
 type ConfigCacheEntry struct {
 	config     *Config
 	lastUpdate time.Time
@@ -27,8 +45,21 @@ var (
 	cacheDuration = 10 * time.Second
 )
 
-// Ensure the queue is created before use
-func getQueue(topic string, partition int) chan LogEntry {
+// Ensure the queue is created before use, nil when the topic is gone
+func getQueue(topic string, partition int, numOfPartition int) chan LogEntry {
+	queueLock.Lock()
+	_, exists := logQueues[topic]
+	queueLock.Unlock()
+	if !exists {
+		// Topics created before a restart have no queues yet, deleted ones must not get new ones
+		if !storage.Exists(storage.ConfigPath(topic)) {
+			return nil
+		}
+		InitQueues(topic, numOfPartition)
+	}
+
+	queueLock.Lock()
+	defer queueLock.Unlock()
 	return logQueues[topic][partition]
 }
 
@@ -42,7 +73,7 @@ func ProduceMessage(ctx context.Context, topicName, key string, msg interface{})
 
 	exists := utils.FileExists(ctx, topicName)
 	if !exists {
-		return false, NewMsgProduceResponse{}, fmt.Errorf("topic does not exist, please create the topic first")
+		return false, NewMsgProduceResponse{}, ErrUnknownTopic
 	}
 
 	config, err := loadConfig(ctx, topicName)
@@ -53,28 +84,180 @@ func ProduceMessage(ctx context.Context, topicName, key string, msg interface{})
 	partition := utils.MurmurHashKeyToPartition(ctx, key, config.NumOfPartition)
 	log.Println("Partition selected:", partition)
 
-	timeStamp := time.Now().UnixNano()
+	return produce(ctx, topicName, partition, config, msg)
+}
 
-	jsonFormattedValue, err := utils.StructToJSON(ctx, msg)
+// PartitionForKey returns the partition ProduceMessage puts messages with key in
+func PartitionForKey(ctx context.Context, topicName, key string) (int, error) {
+	if !utils.FileExists(ctx, topicName) {
+		return 0, ErrUnknownTopic
+	}
+	config, err := loadConfig(ctx, topicName)
 	if err != nil {
-		return false, NewMsgProduceResponse{}, fmt.Errorf("error converting message to JSON: %w", err)
+		return 0, err
 	}
+	return utils.MurmurHashKeyToPartition(ctx, key, config.NumOfPartition), nil
+}
 
-	logQueue := getQueue(topicName, partition)
-	if logQueue == nil {
-		return false, NewMsgProduceResponse{}, fmt.Errorf("log queue not found for topic %s and partition %d", topicName, partition)
+// ProduceToPartition appends a message to a partition chosen by the caller
+func ProduceToPartition(ctx context.Context, topicName string, partition int, msg interface{}) (bool, NewMsgProduceResponse, error) {
+	ctx, span := constants.Tracer.Start(ctx, "ProduceToPartition")
+	defer span.End()
+
+	config, err := partitionConfig(ctx, topicName, partition)
+	if err != nil {
+		return false, NewMsgProduceResponse{}, err
 	}
+	return produce(ctx, topicName, partition, config, msg)
+}
+
+// ProduceBatchToPartition appends messages to a partition in one step: they
+// get contiguous offsets and either all of them are appended or none is. The
+// response carries the offset of the first one. Batches are not forwarded,
+// on a broker that does not lead the partition it fails with ErrNotLeader.
+func ProduceBatchToPartition(ctx context.Context, topicName string, partition int, msgs []interface{}) (NewMsgProduceResponse, error) {
+	ctx, span := constants.Tracer.Start(ctx, "ProduceBatchToPartition")
+	defer span.End()
+	return produceBatch(ctx, topicName, partition, msgs, false)
+}
+
+// ProduceBatch is ProduceBatchToPartition, except that a broker not leading
+// the partition forwards the batch to the leader
+func ProduceBatch(ctx context.Context, topicName string, partition int, msgs []interface{}) (NewMsgProduceResponse, error) {
+	ctx, span := constants.Tracer.Start(ctx, "ProduceBatch")
+	defer span.End()
+	return produceBatch(ctx, topicName, partition, msgs, true)
+}
+
+func produceBatch(ctx context.Context, topicName string, partition int, msgs []interface{}, forward bool) (NewMsgProduceResponse, error) {
+	config, err := partitionConfig(ctx, topicName, partition)
+	if err != nil {
+		return NewMsgProduceResponse{}, err
+	}
+	if len(msgs) == 0 {
+		return NewMsgProduceResponse{}, fmt.Errorf("empty batch for topic %s partition %d", topicName, partition)
+	}
+
+	entries := make([]string, 0, len(msgs))
+	for _, msg := range msgs {
+		entry, err := encodeEntry(ctx, topicName, config, msg)
+		if err != nil {
+			return NewMsgProduceResponse{}, err
+		}
+		entries = append(entries, entry)
+	}
+
+	r := replicatorFor(config)
+	if r != nil {
+		if !r.IsLeader(topicName, partition) {
+			if forward {
+				return r.Forward(ctx, topicName, partition, entries)
+			}
+			return NewMsgProduceResponse{}, fmt.Errorf("%w: %s-%d", ErrNotLeader, topicName, partition)
+		}
+		if err := r.CheckWritable(topicName, partition, minInsyncReplicas(config)); err != nil {
+			return NewMsgProduceResponse{}, err
+		}
+	}
+	return appendEntries(ctx, topicName, partition, config, r, entries)
+}
+
+func partitionConfig(ctx context.Context, topicName string, partition int) (*Config, error) {
+	exists := utils.FileExists(ctx, topicName)
+	if !exists {
+		return nil, ErrUnknownTopic
+	}
+
+	config, err := loadConfig(ctx, topicName)
+	if err != nil {
+		return nil, err
+	}
+	if partition < 0 || partition >= config.NumOfPartition {
+		return nil, fmt.Errorf("%w: %s-%d", ErrUnknownPartition, topicName, partition)
+	}
+	return config, nil
+}
+
+// Push a message to the partition's queue and wait for its offset
+func produce(ctx context.Context, topicName string, partition int, config *Config, msg interface{}) (bool, NewMsgProduceResponse, error) {
+	jsonFormattedValue, err := encodeEntry(ctx, topicName, config, msg)
+	if err != nil {
+		return false, NewMsgProduceResponse{}, err
+	}
+
+	r := replicatorFor(config)
+	if r != nil {
+		if !r.IsLeader(topicName, partition) {
+			resp, err := r.Forward(ctx, topicName, partition, []string{jsonFormattedValue})
+			return err == nil, resp, err
+		}
+		if err := r.CheckWritable(topicName, partition, minInsyncReplicas(config)); err != nil {
+			return false, NewMsgProduceResponse{}, err
+		}
+	}
+
+	resp, err := appendEntries(ctx, topicName, partition, config, r, []string{jsonFormattedValue})
+	return err == nil, resp, err
+}
+
+// Encode a message as it is stored in the log, within the topic's size limit
+func encodeEntry(ctx context.Context, topicName string, config *Config, msg interface{}) (string, error) {
+	var jsonFormattedValue string
+	var err error
+	if r, isRecord := msg.(Record); isRecord {
+		jsonFormattedValue, err = encodeRecord(r)
+	} else if jsonFormattedValue, err = utils.StructToJSON(ctx, msg); err != nil {
+		err = fmt.Errorf("%w, error converting it to JSON: %v", ErrInvalidMessage, err)
+	}
+	if err != nil {
+		return "", err
+	}
+	maxBytes := config.MaxMessageBytes
+	if maxBytes == 0 {
+		maxBytes = DefaultMaxMessageBytes
+	}
+	if len(jsonFormattedValue) > maxBytes {
+		return "", fmt.Errorf("%w: %d bytes is larger than the %d bytes allowed for topic %s", ErrInvalidMessage, len(jsonFormattedValue), maxBytes, topicName)
+	}
+	return jsonFormattedValue, nil
+}
+
+// Queue entries as one LogEntry so nothing else lands between them, then
+// wait for their offsets and, on replicated partitions, for the in-sync
+// replicas to have the last one
+func appendEntries(ctx context.Context, topicName string, partition int, config *Config, r Replicator, entries []string) (NewMsgProduceResponse, error) {
+	timeStamp := time.Now().UnixNano()
 
 	// Create callback channel
 	callbackCh := make(chan int, 1)
 
+	// Hold sendLock so StopQueues cannot close the queue under us
+	sendLock.RLock()
+	logQueue := getQueue(topicName, partition, config.NumOfPartition)
+	if logQueue == nil {
+		sendLock.RUnlock()
+		return NewMsgProduceResponse{}, fmt.Errorf("log queue not found for topic %s and partition %d", topicName, partition)
+	}
+
 	// Send LogEntry with callback
-	logQueue <- LogEntry{Ctx: ctx, Entry: jsonFormattedValue, Callback: callbackCh}
+	logQueue <- LogEntry{Ctx: ctx, Entry: entries[0], Callback: callbackCh, rest: entries[1:]}
+	sendLock.RUnlock()
 
-	// Wait for the offset from processLogQueue
+	// Wait for the offset of the first entry from processLogQueue
 	offset := <-callbackCh
+	resp := NewMsgProduceResponse{Offset: offset, Partition: partition, TimeStamp: timeStamp}
+
+	// Acknowledge replicated messages once every in-sync replica has them
+	if r != nil {
+		if err := r.WaitCommitted(ctx, topicName, partition, offset+len(entries)-1, minInsyncReplicas(config)); err != nil {
+			return resp, err
+		}
+	}
+	return resp, nil
+}
 
-	return true, NewMsgProduceResponse{Offset: offset, Partition: partition, TimeStamp: timeStamp}, nil
+func InvalidateConfig(topicName string) {
+	configCache.Delete(topicName)
 }
 
 // Load topic configuration
@@ -93,15 +276,13 @@ func loadConfig(ctx context.Context, topicName string) (*Config, error) {
 	}
 
 	// Load from disk if cache is expired or missing
-	configPath := fmt.Sprintf("%s%s/%s.json", constants.FilesDir, topicName, topicName)
-	file, err := os.Open(configPath)
+	data, err := storage.ReadFile(storage.ConfigPath(topicName))
 	if err != nil {
 		return nil, fmt.Errorf("error opening config file: %w", err)
 	}
-	defer file.Close()
 
 	var config Config
-	if err := json.NewDecoder(file).Decode(&config); err != nil {
+	if err := json.Unmarshal(data, &config); err != nil {
 		return nil, fmt.Errorf("error decoding config file: %w", err)
 	}
 
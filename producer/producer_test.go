@@ -3,31 +3,41 @@ package producer
 import (
 	"FranzMQ/constants"
 	"FranzMQ/metrics"
+	"FranzMQ/storage"
 	"context"
 	"encoding/json"
-	"io/ioutil"
-	"os"
+	"errors"
+	"io"
 	"strconv"
+	"strings"
 	"testing"
+	"time"
 )
 
-var tp, _ = metrics.StartTracing()
+var tp, _ = metrics.StartTracing("jaeger:4318")
+
+var testBackend = storage.NewMemoryBackend()
+
+func init() {
+	storage.SetBackend(testBackend)
+	go GlobalWriterThread(GlobalLogWriterQueue)
+	go GlobalWriterThread(GlobalIndexWriterQueue)
+}
 
 func setupTestTopic(topic string, numOfPartition int) {
-	os.MkdirAll(constants.FilesDir+topic, 0755)
-	os.MkdirAll(constants.FilesDir+topic+"/"+"meta", 0755)
-	os.MkdirAll(constants.FilesDir+topic+"/"+"index", 0755)
+	storage.MkdirAll(constants.FilesDir + topic + "/" + "meta")
+	storage.MkdirAll(constants.FilesDir + topic + "/" + "index")
 	config := map[string]interface{}{"NumOfPartition": numOfPartition}
 	configData, _ := json.Marshal(config)
-	ioutil.WriteFile(constants.FilesDir+topic+"/"+topic+".json", configData, 0644)
+	storage.WriteFile(constants.FilesDir+topic+"/"+topic+".json", configData)
 	for i := 0; i < numOfPartition; i++ {
-		ioutil.WriteFile(constants.FilesDir+topic+"/"+topic+"-"+strconv.Itoa(i)+".log", []byte(""), 0644)
-		ioutil.WriteFile(constants.FilesDir+topic+"/"+"meta/"+topic+"-"+strconv.Itoa(i)+".json", []byte("{\"Offset\": 0}"), 0644)
+		storage.WriteFile(constants.FilesDir+topic+"/"+topic+"-"+strconv.Itoa(i)+".log", []byte(""))
+		storage.WriteFile(constants.FilesDir+topic+"/"+"meta/"+topic+"-"+strconv.Itoa(i)+".json", []byte("{\"Offset\": 0}"))
 	}
 }
 
 func teardownTestTopic(topic string) {
-	os.RemoveAll(constants.FilesDir + topic)
+	storage.RemoveAll(constants.FilesDir + topic)
 }
 func TestProduceMessage_Success(t *testing.T) {
 	topic := "test_topic"
@@ -90,3 +100,304 @@ func TestProduceMessage_OffsetIncrement(t *testing.T) {
 		t.Errorf("Expected offset to increment sequentially but got %d and %d", response1.Offset, response2.Offset)
 	}
 }
+
+func TestRecoverPartition_CutsPartialEntry(t *testing.T) {
+	topic := "recover_test"
+	setupTestTopic(topic, 1)
+	defer teardownTestTopic(topic)
+
+	logPath := getLogFilePath(topic, 0)
+	storage.WriteFile(logPath, []byte("1--0--1--{\"a\":1}\n2--0--2--{\"a\""))
+	storage.WriteFile(getIndexFilePath(topic, 0), []byte("timestamp--start--end--offset\n1--0--17--1\n"))
+
+	recoverPartition(context.Background(), topic, 0)
+	if size, _ := storage.Size(logPath); size != 17 {
+		t.Errorf("Expected the partial entry to be cut at 17 bytes, got %d", size)
+	}
+	if offset := NextOffset(context.Background(), topic, 0); offset != 2 {
+		t.Errorf("Expected next offset 2 but got %d", offset)
+	}
+}
+
+func TestTruncate_ReopensSegment(t *testing.T) {
+	topic := "truncate_test"
+	setupTestTopic(topic, 1)
+	defer teardownTestTopic(topic)
+	storage.WriteFile(constants.FilesDir+topic+"/"+topic+".json", []byte(`{"NumOfPartition": 1, "SegmentBytes": 40}`))
+	ctx := context.Background()
+
+	for i := 1; i <= 5; i++ {
+		if _, _, err := ProduceToPartition(ctx, topic, 0, "Msg "+strconv.Itoa(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := Truncate(ctx, topic, 0, 3); err != nil {
+		t.Fatalf("truncate failed: %v", err)
+	}
+	if offset := NextOffset(ctx, topic, 0); offset != 3 {
+		t.Errorf("Expected next offset 3 after the truncation, got %d", offset)
+	}
+	if segments := Segments(topic, 0); len(segments) != 1 || segments[0].LastOffset != 2 {
+		t.Errorf("Expected only the segment up to offset 2 left, got %+v", segments)
+	}
+
+	// Appends continue from the cut
+	if _, response, err := ProduceToPartition(ctx, topic, 0, "Msg 3b"); err != nil || response.Offset != 3 {
+		t.Fatalf("Expected the next record at offset 3, got %d %v", response.Offset, err)
+	}
+	if err := Truncate(ctx, topic, 0, 9); err != nil {
+		t.Fatalf("truncating past the end failed: %v", err)
+	}
+	data, err := io.ReadAll(OpenLog(ctx, topic, 0, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 3 || !strings.Contains(lines[2], "--3--") || !strings.Contains(lines[2], "Msg 3b") {
+		t.Errorf("Expected offsets 1, 2 and the new 3 in the log, got %q", lines)
+	}
+}
+
+// Fails every rename
+type renameFails struct {
+	storage.Backend
+}
+
+func (renameFails) Rename(from, to string) error {
+	return errors.New("rename failed")
+}
+
+func TestRollSegment_KeepsLogWhenRenameFails(t *testing.T) {
+	topic := "roll_fail_test"
+	setupTestTopic(topic, 1)
+	defer teardownTestTopic(topic)
+	ctx := context.Background()
+
+	for i := 1; i <= 2; i++ {
+		if _, _, err := ProduceToPartition(ctx, topic, 0, "Msg "+strconv.Itoa(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	logPath := getLogFilePath(topic, 0)
+	closeWriterFile(ctx, GlobalLogWriterQueue, logPath)
+	size, _ := storage.Size(logPath)
+	half := size / 2
+
+	storage.SetBackend(renameFails{testBackend})
+	rollSegment(ctx, &segmentRoll{topic: topic, partition: 0, segment: Segment{Start: 0, End: half, FirstOffset: 1, LastOffset: 1}})
+	storage.SetBackend(testBackend)
+	if segments := Segments(topic, 0); len(segments) != 0 {
+		t.Errorf("Expected no segment after the failed roll, got %+v", segments)
+	}
+	if after, _ := storage.Size(logPath); after != size {
+		t.Errorf("Expected the log to keep its %d bytes, got %d", size, after)
+	}
+	loaded, _ := storage.ReadFile(storage.SegmentsPath(topic, 0))
+	var manifest []Segment
+	json.Unmarshal(loaded, &manifest)
+	if len(manifest) != 0 {
+		t.Errorf("Expected the manifest restored, got %s", loaded)
+	}
+
+	// The next roll takes the bytes of the failed one along
+	rollSegment(ctx, &segmentRoll{topic: topic, partition: 0, segment: Segment{Start: half, End: size, FirstOffset: 2, LastOffset: 2}})
+	if segments := Segments(topic, 0); len(segments) != 1 || segments[0].Start != 0 || segments[0].FirstOffset != 1 {
+		t.Errorf("Expected one segment from offset 1, got %+v", segments)
+	}
+}
+
+// Records the segments deleted from it, reads are not expected
+type deletedTier struct {
+	deleted []Segment
+}
+
+func (d *deletedTier) ReadSegment(ctx context.Context, topic string, partition int, segment Segment, offset int64, length int) ([]byte, error) {
+	return nil, io.EOF
+}
+
+func (d *deletedTier) DeleteSegment(ctx context.Context, topic string, partition int, segment Segment) error {
+	d.deleted = append(d.deleted, segment)
+	return nil
+}
+
+func (d *deletedTier) RemoveTopic(ctx context.Context, topic string) error {
+	return nil
+}
+
+func TestTruncate_DropsRemoteSegment(t *testing.T) {
+	topic := "truncate_remote_test"
+	setupTestTopic(topic, 1)
+	defer teardownTestTopic(topic)
+	storage.WriteFile(constants.FilesDir+topic+"/"+topic+".json", []byte(`{"NumOfPartition": 1, "SegmentBytes": 40}`))
+	tier := &deletedTier{}
+	SetRemoteTier(tier)
+	defer SetRemoteTier(nil)
+	ctx := context.Background()
+
+	for i := 1; i <= 5; i++ {
+		if _, _, err := ProduceToPartition(ctx, topic, 0, "Msg "+strconv.Itoa(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for deadline := time.Now().Add(5 * time.Second); len(Segments(topic, 0)) < 2; {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected 2 segments but got %+v", Segments(topic, 0))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	remote := Segments(topic, 0)[1]
+	if err := MarkRemote(ctx, topic, 0, remote.Start); err != nil {
+		t.Fatal(err)
+	}
+
+	// The cut falls inside the remote segment, all of it goes
+	if err := Truncate(ctx, topic, 0, remote.LastOffset); err != nil {
+		t.Fatalf("truncate failed: %v", err)
+	}
+	if offset := NextOffset(ctx, topic, 0); offset != remote.FirstOffset {
+		t.Errorf("Expected next offset %d after the truncation, got %d", remote.FirstOffset, offset)
+	}
+	if segments := Segments(topic, 0); len(segments) != 1 || segments[0].Remote {
+		t.Errorf("Expected only the local segment left, got %+v", segments)
+	}
+	if len(tier.deleted) != 1 || tier.deleted[0].Start != remote.Start {
+		t.Errorf("Expected the remote segment deleted from the tier, got %+v", tier.deleted)
+	}
+	if _, response, err := ProduceToPartition(ctx, topic, 0, "Msg again"); err != nil || response.Offset != remote.FirstOffset {
+		t.Fatalf("Expected the next record at offset %d, got %d %v", remote.FirstOffset, response.Offset, err)
+	}
+}
+
+func TestEnforceRetention_DeletesOldestSegments(t *testing.T) {
+	topic := "retention_test"
+	setupTestTopic(topic, 1)
+	defer teardownTestTopic(topic)
+	configPath := constants.FilesDir + topic + "/" + topic + ".json"
+	storage.WriteFile(configPath, []byte(`{"NumOfPartition": 1, "SegmentBytes": 40, "RetentionBytes": 50}`))
+	ctx := context.Background()
+
+	for i := 1; i <= 6; i++ {
+		if _, _, err := ProduceToPartition(ctx, topic, 0, "Msg "+strconv.Itoa(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Rolls happen on the writer thread
+	for deadline := time.Now().Add(5 * time.Second); len(Segments(topic, 0)) < 3; {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected 3 segments but got %+v", Segments(topic, 0))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if err := EnforceRetention(ctx, topic, 0); err != nil {
+		t.Fatalf("retention failed: %v", err)
+	}
+	segments := Segments(topic, 0)
+	if len(segments) != 1 || segments[0].FirstOffset != 5 {
+		t.Fatalf("Expected only the segment from offset 5 left, got %+v", segments)
+	}
+	data, err := io.ReadAll(OpenLog(ctx, topic, 0, LogStart(topic, 0)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first := strings.SplitN(string(data), "\n", 2)[0]; !strings.Contains(first, "--0--5--") {
+		t.Errorf("Expected the log to start at offset 5, got %q", first)
+	}
+	index, _ := storage.ReadFile(getIndexFilePath(topic, 0))
+	if entries := strings.Split(strings.TrimSpace(string(index)), "\n"); len(entries) != 2 || !strings.HasSuffix(entries[0], "--5") {
+		t.Errorf("Expected the index to start at offset 5, got %q", entries)
+	}
+
+	// Once old enough every closed segment goes, the active log stays
+	storage.WriteFile(configPath, []byte(`{"NumOfPartition": 1, "SegmentBytes": 40, "RetentionMs": 1}`))
+	InvalidateConfig(topic)
+	time.Sleep(5 * time.Millisecond)
+	if err := EnforceRetention(ctx, topic, 0); err != nil {
+		t.Fatalf("retention failed: %v", err)
+	}
+	if segments := Segments(topic, 0); len(segments) != 0 {
+		t.Errorf("Expected every closed segment deleted, got %+v", segments)
+	}
+}
+
+func TestTruncate_AfterRetention(t *testing.T) {
+	topic := "truncate_retention_test"
+	setupTestTopic(topic, 1)
+	defer teardownTestTopic(topic)
+	configPath := constants.FilesDir + topic + "/" + topic + ".json"
+	storage.WriteFile(configPath, []byte(`{"NumOfPartition": 1, "SegmentBytes": 40, "RetentionMs": 1}`))
+	ctx := context.Background()
+
+	for i := 1; i <= 6; i++ {
+		if _, _, err := ProduceToPartition(ctx, topic, 0, "Msg "+strconv.Itoa(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for deadline := time.Now().Add(5 * time.Second); len(Segments(topic, 0)) < 3; {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected 3 segments but got %+v", Segments(topic, 0))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	indexPath := getIndexFilePath(topic, 0)
+	closeWriterFile(ctx, GlobalIndexWriterQueue, indexPath)
+	untrimmed, _ := storage.ReadFile(indexPath)
+	time.Sleep(5 * time.Millisecond)
+	if err := EnforceRetention(ctx, topic, 0); err != nil {
+		t.Fatalf("retention failed: %v", err)
+	}
+	if _, _, err := ProduceToPartition(ctx, topic, 0, "Msg 7"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Into the deleted segments, with the index trimmed and without
+	if err := Truncate(ctx, topic, 0, 2); err != nil {
+		t.Fatalf("truncate failed: %v", err)
+	}
+	if offset := NextOffset(ctx, topic, 0); offset != 7 {
+		t.Errorf("Expected next offset 7 once the kept entry is cut, got %d", offset)
+	}
+	if _, _, err := ProduceToPartition(ctx, topic, 0, "Msg 7b"); err != nil {
+		t.Fatal(err)
+	}
+	closeWriterFile(ctx, GlobalIndexWriterQueue, indexPath)
+	trimmed, _ := storage.ReadFile(indexPath)
+	storage.WriteFile(indexPath, append(untrimmed, trimmed...))
+	if err := Truncate(ctx, topic, 0, 2); err != nil {
+		t.Fatalf("truncate failed: %v", err)
+	}
+	if offset := NextOffset(ctx, topic, 0); offset != 7 {
+		t.Errorf("Expected next offset 7 once the kept entry is cut, got %d", offset)
+	}
+	if size, _ := LogSize(topic, 0); size != LogStart(topic, 0) {
+		t.Errorf("Expected nothing left past the log start, got %d bytes up to %d", size, LogStart(topic, 0))
+	}
+}
+
+func TestPartitionQueueDepths_CountsWaitingEntries(t *testing.T) {
+	// A queue nothing drains, so the entries stay
+	queue := make(chan LogEntry, 4)
+	queue <- LogEntry{}
+	queue <- LogEntry{}
+	queueLock.Lock()
+	logQueues["depth_test"] = map[int]chan LogEntry{1: queue}
+	queueLock.Unlock()
+	defer func() {
+		queueLock.Lock()
+		delete(logQueues, "depth_test")
+		queueLock.Unlock()
+	}()
+
+	found := false
+	for _, sample := range partitionQueueDepths() {
+		if sample.Labels[0] == "depth_test" {
+			found = true
+			if sample.Labels[1] != "1" || sample.Value != 2 {
+				t.Errorf("Expected 2 entries waiting for partition 1, got %+v", sample)
+			}
+		}
+	}
+	if !found {
+		t.Error("Expected a sample of the depth_test queue")
+	}
+}
@@ -2,38 +2,83 @@ package producer
 
 import (
 	"FranzMQ/constants"
-	"bufio"
+	"FranzMQ/metrics"
+	"FranzMQ/storage"
+	"bytes"
 	"context"
 	"fmt"
 	"log"
-	"os"
-	"strconv"
 	"sync"
 	"time"
 )
 
 var (
 	queueLock              sync.Mutex
+	sendLock               sync.RWMutex                             // Held for reading while sending to a log queue, for writing while closing them
 	logQueues              = make(map[string]map[int]chan LogEntry) // Topic → Partition → Log Queue
+	queueDone              = make(map[string]*sync.WaitGroup)       // Topic → running processLogQueue goroutines
 	GlobalLogWriterQueue   = make(chan LogWrite, 10000)             // Global queue for log writes
 	GlobalIndexWriterQueue = make(chan LogWrite, 10000)             // Global queue for index writes
 )
 
+// Tunables, changed through Configure
+var (
+	partitionQueueSize  = 10000
+	writerBatchSize     = 200
+	writerFlushInterval = 10 * time.Millisecond
+)
+
+// Settings tune the write path, zero fields keep the current value
+type Settings struct {
+	PartitionQueueSize  int
+	WriterQueueSize     int
+	WriterBatchSize     int
+	WriterFlushInterval time.Duration
+	ConfigCacheDuration time.Duration
+}
+
+// Configure applies settings. It must run before the writer threads start
+// and before any topic is used, since it replaces the writer queues.
+func Configure(s Settings) {
+	if s.PartitionQueueSize > 0 {
+		partitionQueueSize = s.PartitionQueueSize
+	}
+	if s.WriterQueueSize > 0 {
+		GlobalLogWriterQueue = make(chan LogWrite, s.WriterQueueSize)
+		GlobalIndexWriterQueue = make(chan LogWrite, s.WriterQueueSize)
+	}
+	if s.WriterBatchSize > 0 {
+		writerBatchSize = s.WriterBatchSize
+	}
+	if s.WriterFlushInterval > 0 {
+		writerFlushInterval = s.WriterFlushInterval
+	}
+	if s.ConfigCacheDuration > 0 {
+		cacheDuration = s.ConfigCacheDuration
+	}
+}
+
 type LogEntry struct {
-	Ctx      context.Context
-	Entry    string
-	Callback chan int // Callback channel for offset
+	Ctx       context.Context
+	Entry     string
+	Callback  chan int // Callback channel for offset
+	TimeStamp int64    // Set on entries replicated from a leader, which keep the leader's timestamp
+	rest      []string // Entries of a batch appended right after Entry, Callback gets the first offset
+	truncate  *truncation
+	trimIndex *truncation // Drops the index entries before offset instead
 }
 
 type LogWrite struct {
 	Ctx      context.Context
 	FilePath string
 	Entry    string
+	Closed   chan struct{} // Set on close requests: the writer flushes and closes FilePath, then closes this
+	roll     *segmentRoll  // Set on roll requests: the writer flushes FilePath and rolls it into a segment
 }
 
 // Initialize queues for a given topic with M partitions
 func InitQueues(topicName string, partitions int) {
-	_, span := constants.Tracer.Start(context.Background(), "InitQueues")
+	ctx, span := constants.Tracer.Start(context.Background(), "InitQueues")
 	defer span.End()
 
 	queueLock.Lock()
@@ -41,101 +86,180 @@ func InitQueues(topicName string, partitions int) {
 
 	if _, exists := logQueues[topicName]; !exists {
 		logQueues[topicName] = make(map[int]chan LogEntry)
+		queueDone[topicName] = &sync.WaitGroup{}
 	}
 
 	for i := 0; i < partitions; i++ {
-		logQueues[topicName][i] = make(chan LogEntry, 10000)
-		go processLogQueue(topicName, i)
+		if _, exists := logQueues[topicName][i]; exists {
+			continue // Already running, keep the existing goroutine
+		}
+		recoverPartition(ctx, topicName, i)
+		queue := make(chan LogEntry, partitionQueueSize)
+		logQueues[topicName][i] = queue
+		done := queueDone[topicName]
+		done.Add(1)
+		go func() {
+			defer done.Done()
+			processLogQueue(topicName, i, queue)
+		}()
 	}
 	// Start global writer threads
 }
 
+// StopQueues stops the partition goroutines of a topic once they have handed
+// everything already queued to the writer threads. Produces arriving later
+// no longer find a queue.
+func StopQueues(ctx context.Context, topicName string) {
+	_, span := constants.Tracer.Start(ctx, "StopQueues")
+	defer span.End()
+
+	sendLock.Lock()
+	queueLock.Lock()
+	queues, done := logQueues[topicName], queueDone[topicName]
+	delete(logQueues, topicName)
+	delete(queueDone, topicName)
+	queueLock.Unlock()
+	for _, queue := range queues {
+		close(queue)
+	}
+	sendLock.Unlock()
+
+	if done != nil {
+		done.Wait()
+	}
+}
+
 // Process log queue and push entries to writer queues
-func processLogQueue(topic string, partition int) {
-	for logEntry := range logQueues[topic][partition] {
-		ctx, span := constants.Tracer.Start(logEntry.Ctx, "processLogQueue")
-		defer span.End()
+func processLogQueue(topic string, partition int, queue chan LogEntry) {
+	// Where the active segment starts, moved ahead as soon as a roll is queued
+	segmentStart, firstOffset := activeSegment(topic, partition)
 
-		offsetKey := topic + "-" + strconv.Itoa(partition)
-		offset := constants.OffsetMap.INCR(ctx, offsetKey)
-		if logEntry.Callback != nil {
-			logEntry.Callback <- offset
+	for logEntry := range queue {
+		ctx, span := constants.Tracer.Start(logEntry.Ctx, "processLogQueue")
+		if logEntry.truncate != nil {
+			err := truncateLog(ctx, topic, partition, logEntry.truncate.offset)
+			segmentStart, firstOffset = activeSegment(topic, partition)
+			logEntry.truncate.done <- err
+			span.End()
+			continue
+		}
+		if logEntry.trimIndex != nil {
+			logEntry.trimIndex.done <- trimIndex(ctx, topic, partition, logEntry.trimIndex.offset)
+			span.End()
+			continue
 		}
-		timeStamp := time.Now().UnixNano()
-		logEntryStr := fmt.Sprintf("%d--%d--%d--%s\n", timeStamp, partition, offset, logEntry.Entry)
 
-		log.Println("Queueing log entry with offset:", offset)
-		GlobalLogWriterQueue <- LogWrite{Ctx: ctx, FilePath: getLogFilePath(topic, partition), Entry: logEntryStr}
+		offsetKey := partitionKey(topic, partition)
+		for i, entry := range append([]string{logEntry.Entry}, logEntry.rest...) {
+			offset := constants.OffsetMap.INCR(ctx, offsetKey)
+			if i == 0 && logEntry.Callback != nil {
+				logEntry.Callback <- offset
+			}
+			metrics.Produced(topic, partition, len(entry))
+			timeStamp := time.Now().UnixNano()
+			if logEntry.TimeStamp != 0 {
+				timeStamp = logEntry.TimeStamp
+			}
+			logEntryStr := fmt.Sprintf("%d--%d--%d--%s\n", timeStamp, partition, offset, entry)
 
-		endOffset := constants.LogSizeMap.INCRBY(ctx, offsetKey, len(logEntryStr))
-		indexEntry := fmt.Sprintf("%d--%d--%d--%d\n", timeStamp, endOffset-len(logEntryStr), endOffset, offset)
-		GlobalIndexWriterQueue <- LogWrite{Ctx: ctx, FilePath: getIndexFilePath(topic, partition), Entry: indexEntry}
+			log.Println("Queueing log entry with offset:", offset)
+			GlobalLogWriterQueue <- LogWrite{Ctx: ctx, FilePath: getLogFilePath(topic, partition), Entry: logEntryStr}
+
+			endOffset := constants.LogSizeMap.INCRBY(ctx, offsetKey, len(logEntryStr))
+			indexEntry := fmt.Sprintf("%d--%d--%d--%d\n", timeStamp, endOffset-len(logEntryStr), endOffset, offset)
+			GlobalIndexWriterQueue <- LogWrite{Ctx: ctx, FilePath: getIndexFilePath(topic, partition), Entry: indexEntry}
+
+			if int64(endOffset)-segmentStart >= segmentBytes(ctx, topic) {
+				segment := Segment{Start: segmentStart, End: int64(endOffset), FirstOffset: firstOffset, LastOffset: offset, LastTimestamp: timeStamp}
+				GlobalLogWriterQueue <- LogWrite{Ctx: ctx, FilePath: getLogFilePath(topic, partition), roll: &segmentRoll{topic: topic, partition: partition, segment: segment}}
+				segmentStart, firstOffset = int64(endOffset), offset+1
+			}
+		}
+		span.End()
 	}
 }
 
 // Global writer thread for logs & indexes
 func GlobalWriterThread(writerQueue chan LogWrite) {
-	fileMap := make(map[string]*bufio.Writer)
-	fileHandles := make(map[string]*os.File)
-
-	ticker := time.NewTicker(10 * time.Millisecond)
+	ticker := time.NewTicker(writerFlushInterval)
 	defer ticker.Stop()
 
 	batch := make(map[string][]LogWrite) // Group writes by file
 	for {
 		select {
 		case logWrite := <-writerQueue:
+			if logWrite.Closed != nil || logWrite.roll != nil {
+				// Writes queued before the request still land in the file
+				if pending, exists := batch[logWrite.FilePath]; exists {
+					flushBuffer(map[string][]LogWrite{logWrite.FilePath: pending})
+					delete(batch, logWrite.FilePath)
+				}
+				syncStart := time.Now()
+				if err := storage.Sync(logWrite.FilePath); err != nil {
+					log.Println("Error syncing file:", err)
+				}
+				metrics.Synced(syncStart)
+				if err := storage.Close(logWrite.FilePath); err != nil {
+					log.Println("Error closing file:", err)
+				}
+				if logWrite.roll != nil {
+					rollSegment(logWrite.Ctx, logWrite.roll)
+				} else {
+					close(logWrite.Closed)
+				}
+				continue
+			}
 			batch[logWrite.FilePath] = append(batch[logWrite.FilePath], logWrite)
-			if len(batch[logWrite.FilePath]) >= 200 {
-				flushBuffer(batch, fileMap, fileHandles)
+			if len(batch[logWrite.FilePath]) >= writerBatchSize {
+				flushBuffer(batch)
 				batch = make(map[string][]LogWrite) // Clear batch after flushing
 			}
 		case <-ticker.C:
 			if len(batch) > 0 {
-				flushBuffer(batch, fileMap, fileHandles)
+				flushBuffer(batch)
 				batch = make(map[string][]LogWrite) // Clear batch after flushing
 			}
 		}
 	}
 }
 
-// Flush batched writes to corresponding files
-func flushBuffer(batch map[string][]LogWrite, fileMap map[string]*bufio.Writer, fileHandles map[string]*os.File) {
+// Flush batched writes to corresponding files, one append per file
+func flushBuffer(batch map[string][]LogWrite) {
 	for filePath, entries := range batch {
 		ctx := entries[0].Ctx
 		_, span := constants.Tracer.Start(ctx, "flushBuffer")
 		defer span.End()
 
-		if _, exists := fileMap[filePath]; !exists {
-			file, err := os.OpenFile(filePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0666)
-			if err != nil {
-				log.Println("Error opening file:", err)
-				continue
-			}
-			fileHandles[filePath] = file
-			fileMap[filePath] = bufio.NewWriter(file)
-		}
-
-		writer := fileMap[filePath]
+		var buf bytes.Buffer
 		for _, entry := range entries {
-			_, err := writer.WriteString(entry.Entry)
-			if err != nil {
-				log.Println("Error writing to buffer:", err)
-				return
-			}
+			buf.WriteString(entry.Entry)
 		}
-		if err := writer.Flush(); err != nil {
-			log.Println("Error flushing buffer:", err)
+		start := time.Now()
+		if err := storage.Append(filePath, buf.Bytes()); err != nil {
+			log.Println("Error writing file:", err)
+			continue
 		}
+		metrics.Flushed(len(entries), start)
+		notifyAppend(filePath)
 	}
 }
 
+// LogFilePath returns the log file of a partition
+func LogFilePath(topic string, partition int) string {
+	return getLogFilePath(topic, partition)
+}
+
+// IndexFilePath returns the index file of a partition
+func IndexFilePath(topic string, partition int) string {
+	return getIndexFilePath(topic, partition)
+}
+
 // Get log file path
 func getLogFilePath(topic string, partition int) string {
-	return fmt.Sprintf("./files/topics/%s/%s-%d.log", topic, topic, partition)
+	return storage.LogPath(topic, partition)
 }
 
 // Get index file path
 func getIndexFilePath(topic string, partition int) string {
-	return fmt.Sprintf("./files/topics/%s/index/%s-%d.index", topic, topic, partition)
+	return storage.IndexPath(topic, partition)
 }
@@ -0,0 +1,107 @@
+package producer
+
+import (
+	"FranzMQ/constants"
+	"FranzMQ/storage"
+	"bufio"
+	"bytes"
+	"context"
+	"log"
+	"strconv"
+	"strings"
+)
+
+// NextOffset returns the offset the next message of a partition will get
+func NextOffset(ctx context.Context, topic string, partition int) int {
+	ctx, span := constants.Tracer.Start(ctx, "NextOffset")
+	defer span.End()
+
+	queueLock.Lock()
+	recoverPartition(ctx, topic, partition)
+	queueLock.Unlock()
+
+	offset, _ := constants.OffsetMap.Get(ctx, partitionKey(topic, partition))
+	return offset + 1
+}
+
+// CachedNextOffset is NextOffset of a partition whose offsets were already
+// loaded, false otherwise. It never reads the partition's files.
+func CachedNextOffset(ctx context.Context, topic string, partition int) (int, bool) {
+	offset, found := constants.OffsetMap.Get(ctx, partitionKey(topic, partition))
+	return offset + 1, found
+}
+
+// Seed OffsetMap and LogSizeMap from disk so a restarted broker continues
+// where it left off instead of handing out offsets from 1 again.
+// Must be called with queueLock held.
+func recoverPartition(ctx context.Context, topic string, partition int) {
+	ctx, span := constants.Tracer.Start(ctx, "recoverPartition")
+	defer span.End()
+
+	key := partitionKey(topic, partition)
+	if _, exists := constants.OffsetMap.Get(ctx, key); exists {
+		return
+	}
+
+	pl := loadPartitionLog(topic, partition)
+	pl.mu.RLock()
+	activeBase := pl.activeBase
+	pl.mu.RUnlock()
+	logSize := activeBase + trimPartialEntry(getLogFilePath(topic, partition))
+
+	lastOffset := 0
+	if storage.Exists(getIndexFilePath(topic, partition)) {
+		scanner := bufio.NewScanner(storage.NewReader(getIndexFilePath(topic, partition), 0))
+		for scanner.Scan() {
+			// timestamp--start--end--offset
+			parts := strings.Split(scanner.Text(), "--")
+			if len(parts) != 4 {
+				continue
+			}
+			if offset, err := strconv.Atoi(parts[3]); err == nil {
+				lastOffset = offset
+			}
+		}
+	}
+
+	constants.OffsetMap.INCRBY(ctx, key, lastOffset)
+	constants.LogSizeMap.INCRBY(ctx, key, int(logSize))
+}
+
+// A crash in the middle of a flush can leave half an entry at the end of a
+// log, cut it so new entries start on a line of their own. Returns the size.
+func trimPartialEntry(logPath string) int64 {
+	size, err := storage.Size(logPath)
+	if err != nil || size == 0 {
+		return 0
+	}
+
+	// Walk back in chunks to the last complete line
+	end := size
+	for end > 0 {
+		start := max(0, end-4096)
+		chunk, err := storage.ReadRange(logPath, start, int(end-start))
+		if err != nil {
+			return size
+		}
+		if i := bytes.LastIndexByte(chunk, '\n'); i >= 0 {
+			end = start + int64(i) + 1
+			break
+		}
+		end = start
+	}
+	if end == size {
+		return size
+	}
+	log.Println("Cutting", size-end, "bytes of a partial entry from", logPath)
+	if err := storage.Truncate(logPath, end); err != nil {
+		log.Println("Error truncating log:", err)
+		return size
+	}
+	return end
+}
+
+// Key used for a partition in OffsetMap and LogSizeMap
+func partitionKey(topic string, partition int) string {
+	return topic + "-" + strconv.Itoa(partition)
+}
@@ -0,0 +1,116 @@
+package producer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// Errors of replicated partitions
+var (
+	ErrNotLeader         = errors.New("this broker is not the leader of the partition")
+	ErrNotEnoughReplicas = errors.New("fewer replicas in sync than min.insync.replicas")
+	ErrFencedLeaderEpoch = errors.New("the leader epoch does not match the leader's")
+)
+
+// Replicator places partitions on brokers and keeps their replicas in sync.
+// Without one every partition is local only.
+type Replicator interface {
+	// IsLeader reports whether this broker takes the writes of a partition
+	IsLeader(topic string, partition int) bool
+	// Forward produces messages on the leader of a partition in one batch,
+	// the response carries the offset of the first one
+	Forward(ctx context.Context, topic string, partition int, values []string) (NewMsgProduceResponse, error)
+	// CheckWritable fails with ErrNotEnoughReplicas when fewer than minInsync replicas are in sync
+	CheckWritable(topic string, partition int, minInsync int) error
+	// WaitCommitted blocks until every in-sync replica has offset
+	WaitCommitted(ctx context.Context, topic string, partition int, offset int, minInsync int) error
+	// HighWatermark returns the first offset not yet on every in-sync replica
+	HighWatermark(topic string, partition int) int
+}
+
+var (
+	replicatorLock sync.RWMutex
+	replicator     Replicator
+	placesAll      bool // Topics with a single replica are placed on one broker too
+)
+
+// SetReplicator turns on replication of topics with more than one replica.
+// With placeAll the topics with a single replica go to one broker as well,
+// otherwise every broker keeps its own copy of them.
+func SetReplicator(r Replicator, placeAll bool) {
+	replicatorLock.Lock()
+	defer replicatorLock.Unlock()
+	replicator, placesAll = r, placeAll
+}
+
+// The replicator in charge of a topic, nil when it is local to this broker
+func replicatorFor(config *Config) Replicator {
+	replicatorLock.RLock()
+	defer replicatorLock.RUnlock()
+	if config.Replicas <= 1 && !placesAll {
+		return nil
+	}
+	return replicator
+}
+
+func minInsyncReplicas(config *Config) int {
+	return max(config.MinInsyncReplicas, 1)
+}
+
+// HighWatermark returns the first offset of a partition that consumers may
+// not see yet because it is not on every in-sync replica. capped is false
+// for partitions that are not replicated, all of their log is visible.
+func HighWatermark(ctx context.Context, topic string, partition int) (hw int, capped bool) {
+	config, err := loadConfig(ctx, topic)
+	if err != nil {
+		return 0, false
+	}
+	r := replicatorFor(config)
+	if r == nil {
+		return 0, false
+	}
+	return r.HighWatermark(topic, partition), true
+}
+
+// IsLeader reports whether this broker takes the writes of a partition,
+// always true for partitions that are not replicated
+func IsLeader(ctx context.Context, topic string, partition int) bool {
+	config, err := loadConfig(ctx, topic)
+	if err != nil {
+		return true
+	}
+	r := replicatorFor(config)
+	return r == nil || r.IsLeader(topic, partition)
+}
+
+// AppendReplicated appends an entry a follower fetched from the leader,
+// keeping the leader's offset and timestamp
+func AppendReplicated(ctx context.Context, topic string, partition int, offset int, timestamp int64, value string) error {
+	config, err := loadConfig(ctx, topic)
+	if err != nil {
+		return err
+	}
+
+	callbackCh := make(chan int, 1)
+	sendLock.RLock()
+	logQueue := getQueue(topic, partition, config.NumOfPartition)
+	if logQueue == nil {
+		sendLock.RUnlock()
+		return fmt.Errorf("log queue not found for topic %s and partition %d", topic, partition)
+	}
+	logQueue <- LogEntry{Ctx: ctx, Entry: value, Callback: callbackCh, TimeStamp: timestamp}
+	sendLock.RUnlock()
+
+	if local := <-callbackCh; local != offset {
+		return fmt.Errorf("replica of %s-%d out of step: leader offset %d stored as %d", topic, partition, offset, local)
+	}
+	return nil
+}
+
+// NotifyWaiters wakes fetches parked on a partition, for example once more
+// of it became visible
+func NotifyWaiters(topic string, partition int) {
+	notifyAppend(getLogFilePath(topic, partition))
+}
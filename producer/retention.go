@@ -0,0 +1,133 @@
+package producer
+
+import (
+	"FranzMQ/constants"
+	"FranzMQ/storage"
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EnforceRetention deletes the oldest closed segments of a partition that are
+// past the topic's retention.ms, or that the partition can do without and
+// still hold retention.bytes, and the index entries of their records. The
+// active log file is never deleted, so retention only acts on rolled
+// segments, like Kafka.
+func EnforceRetention(ctx context.Context, topic string, partition int) error {
+	ctx, span := constants.Tracer.Start(ctx, "EnforceRetention")
+	defer span.End()
+
+	config, err := loadConfig(ctx, topic)
+	if err != nil {
+		return err
+	}
+	if config.RetentionMs <= 0 && config.RetentionBytes <= 0 {
+		return nil
+	}
+	if !storage.Exists(getLogFilePath(topic, partition)) {
+		return nil // No replica of the partition on this broker
+	}
+	size, err := LogSize(topic, partition)
+	if err != nil {
+		return err
+	}
+
+	pl := loadPartitionLog(topic, partition)
+	pl.mu.Lock()
+	cutoff := time.Now().UnixNano() - config.RetentionMs*int64(time.Millisecond)
+	expired := 0
+	for _, segment := range pl.segments {
+		left := size - segment.End // Bytes left once this segment and the older ones are gone
+		if config.RetentionMs > 0 && segment.LastTimestamp < cutoff {
+			expired++
+			continue
+		}
+		if config.RetentionBytes > 0 && left >= config.RetentionBytes {
+			expired++
+			continue
+		}
+		break
+	}
+	if expired == 0 {
+		pl.mu.Unlock()
+		return nil
+	}
+	deleted := pl.segments[:expired]
+	kept := pl.segments[expired:]
+	if err := saveSegments(topic, partition, kept); err != nil {
+		pl.mu.Unlock()
+		return err
+	}
+	pl.segments = kept
+	pl.mu.Unlock()
+
+	// Readers already past the lookup fail once the files are gone, the next
+	// fetch starts at the new log start
+	for _, segment := range deleted {
+		if err := removeSegment(ctx, topic, partition, segment); err != nil {
+			return err
+		}
+	}
+	log.Println("Retention deleted", len(deleted), "segments of", partitionKey(topic, partition), "up to offset", deleted[len(deleted)-1].LastOffset)
+
+	// Fetches scan the index, it starts where the log does again
+	done := make(chan error, 1)
+	trim := &truncation{offset: deleted[len(deleted)-1].LastOffset + 1, done: done}
+	if err := sendToPartition(ctx, topic, partition, LogEntry{Ctx: ctx, trimIndex: trim}); err != nil {
+		return err
+	}
+	return <-done
+}
+
+// Drop the index entries of a partition before offset. Runs on the partition
+// goroutine, so nothing is appended meanwhile.
+func trimIndex(ctx context.Context, topic string, partition int, offset int) error {
+	indexPath := getIndexFilePath(topic, partition)
+	closeWriterFile(ctx, GlobalIndexWriterQueue, indexPath)
+
+	index, err := storage.ReadFile(indexPath)
+	if err != nil {
+		return fmt.Errorf("error reading index of %s-%d: %w", topic, partition, err)
+	}
+	var kept bytes.Buffer
+	for _, line := range strings.SplitAfter(string(index), "\n") {
+		// timestamp--start--end--offset, the header line stays
+		parts := strings.Split(strings.TrimSpace(line), "--")
+		if len(parts) == 4 {
+			if entryOffset, err := strconv.Atoi(parts[3]); err == nil && entryOffset < offset {
+				continue
+			}
+		}
+		kept.WriteString(line)
+	}
+	if err := storage.WriteFile(indexPath, kept.Bytes()); err != nil {
+		return fmt.Errorf("error trimming index of %s-%d: %w", topic, partition, err)
+	}
+	return nil
+}
+
+// LogStart returns the position of the oldest byte of a partition still kept
+func LogStart(topic string, partition int) int64 {
+	pl := loadPartitionLog(topic, partition)
+	pl.mu.RLock()
+	defer pl.mu.RUnlock()
+	if len(pl.segments) > 0 {
+		return pl.segments[0].Start
+	}
+	return pl.activeBase
+}
+
+func removeSegment(ctx context.Context, topic string, partition int, segment Segment) error {
+	if !segment.Remote {
+		return storage.RemoveAll(SegmentPath(topic, partition, segment))
+	}
+	tier := currentRemoteTier()
+	if tier == nil {
+		return fmt.Errorf("segment at %d of %s-%d is remote but no remote tier is configured", segment.Start, topic, partition)
+	}
+	return tier.DeleteSegment(ctx, topic, partition, segment)
+}
@@ -0,0 +1,323 @@
+package producer
+
+import (
+	"FranzMQ/constants"
+	"FranzMQ/storage"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"slices"
+	"strconv"
+	"sync"
+)
+
+// DefaultSegmentBytes rolls the log of topics without segment.bytes
+const DefaultSegmentBytes = 1024 * 1024 * 1024
+
+const (
+	localReadSize  = 64 * 1024
+	remoteReadSize = 1024 * 1024 // Object store round trips are slow, read more at once
+)
+
+// Segment is a closed part of a partition's log. Positions count bytes of the
+// whole partition like the index does, so they stay valid across rolls.
+type Segment struct {
+	Start         int64 // Position of the first byte
+	End           int64 // Position after the last byte
+	FirstOffset   int
+	LastOffset    int
+	LastTimestamp int64 // Unix nanoseconds of the newest entry
+	Remote        bool  // Uploaded to the remote tier and removed from the local disk
+}
+
+// RemoteTier holds segments moved off the broker's disks
+type RemoteTier interface {
+	ReadSegment(ctx context.Context, topic string, partition int, segment Segment, offset int64, length int) ([]byte, error)
+	DeleteSegment(ctx context.Context, topic string, partition int, segment Segment) error
+	RemoveTopic(ctx context.Context, topic string) error
+}
+
+// Closed segments and the start of the active log file of a partition
+type partitionLog struct {
+	mu         sync.RWMutex
+	segments   []Segment // Oldest first
+	activeBase int64     // Position of the first byte in the active log file
+}
+
+// Roll request handed to the log writer thread
+type segmentRoll struct {
+	topic     string
+	partition int
+	segment   Segment
+}
+
+var (
+	partitionLogs    sync.Map // Key: topic-partition, Value: *partitionLog
+	partitionLogLock sync.Mutex
+
+	remoteTierLock sync.RWMutex
+	remoteTier     RemoteTier
+
+	rollListenersLock sync.Mutex
+	rollListeners     []func(topic string, partition int, segment Segment)
+)
+
+// SetRemoteTier sets where segments marked remote are read from
+func SetRemoteTier(tier RemoteTier) {
+	remoteTierLock.Lock()
+	defer remoteTierLock.Unlock()
+	remoteTier = tier
+}
+
+func currentRemoteTier() RemoteTier {
+	remoteTierLock.RLock()
+	defer remoteTierLock.RUnlock()
+	return remoteTier
+}
+
+// OnSegmentRolled registers fn to run every time a partition's log is rolled
+// into a closed segment. It runs on the writer thread and must not block.
+func OnSegmentRolled(fn func(topic string, partition int, segment Segment)) {
+	rollListenersLock.Lock()
+	defer rollListenersLock.Unlock()
+	rollListeners = append(rollListeners, fn)
+}
+
+// Segments returns the closed segments of a partition, oldest first
+func Segments(topic string, partition int) []Segment {
+	pl := loadPartitionLog(topic, partition)
+	pl.mu.RLock()
+	defer pl.mu.RUnlock()
+	return slices.Clone(pl.segments)
+}
+
+// SegmentPath returns the local file of a closed segment
+func SegmentPath(topic string, partition int, segment Segment) string {
+	return getLogFilePath(topic, partition) + "." + strconv.FormatInt(segment.Start, 10)
+}
+
+// LogSize returns the bytes ever written to a partition, local and remote
+func LogSize(topic string, partition int) (int64, error) {
+	pl := loadPartitionLog(topic, partition)
+	pl.mu.RLock()
+	defer pl.mu.RUnlock()
+	size, err := storage.Size(getLogFilePath(topic, partition))
+	if err != nil {
+		return 0, err
+	}
+	return pl.activeBase + size, nil
+}
+
+// MarkRemote records that a closed segment was uploaded to the remote tier
+// and removes its local file. Readers already past the lookup fall back to
+// the remote tier when the file is gone.
+func MarkRemote(ctx context.Context, topic string, partition int, start int64) error {
+	_, span := constants.Tracer.Start(ctx, "MarkRemote")
+	defer span.End()
+
+	pl := loadPartitionLog(topic, partition)
+	pl.mu.Lock()
+	i := slices.IndexFunc(pl.segments, func(s Segment) bool { return s.Start == start })
+	if i < 0 {
+		pl.mu.Unlock()
+		return fmt.Errorf("segment at %d of %s-%d not found", start, topic, partition)
+	}
+	segments := slices.Clone(pl.segments)
+	segments[i].Remote = true
+	if err := saveSegments(topic, partition, segments); err != nil {
+		pl.mu.Unlock()
+		return err
+	}
+	pl.segments = segments
+	pl.mu.Unlock()
+
+	return storage.RemoveAll(SegmentPath(topic, partition, segments[i]))
+}
+
+// OpenLog reads a partition's log from a position taken from the index,
+// through the closed segments, local or remote, into the active log file
+func OpenLog(ctx context.Context, topic string, partition int, position int64) io.Reader {
+	return &logReader{ctx: ctx, topic: topic, partition: partition, position: position}
+}
+
+type logReader struct {
+	ctx       context.Context
+	topic     string
+	partition int
+	position  int64
+	buf       []byte
+}
+
+func (r *logReader) Read(p []byte) (int, error) {
+	if len(r.buf) == 0 {
+		chunk, err := readLogChunk(r.ctx, r.topic, r.partition, r.position)
+		if err != nil {
+			return 0, err
+		}
+		if len(chunk) == 0 {
+			return 0, io.EOF
+		}
+		r.buf = chunk
+		r.position += int64(len(chunk))
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+// Read from position up to the end of the segment holding it
+func readLogChunk(ctx context.Context, topic string, partition int, position int64) ([]byte, error) {
+	pl := loadPartitionLog(topic, partition)
+	pl.mu.RLock()
+	if position >= pl.activeBase {
+		// Held while reading so a roll cannot rename the file under us
+		defer pl.mu.RUnlock()
+		return storage.ReadRange(getLogFilePath(topic, partition), position-pl.activeBase, localReadSize)
+	}
+	i, found := slices.BinarySearchFunc(pl.segments, position, func(s Segment, pos int64) int {
+		if s.End <= pos {
+			return -1
+		}
+		if s.Start > pos {
+			return 1
+		}
+		return 0
+	})
+	var segment Segment
+	if found {
+		segment = pl.segments[i]
+	}
+	pl.mu.RUnlock()
+	if !found {
+		return nil, fmt.Errorf("position %d of %s-%d is not in any segment", position, topic, partition)
+	}
+
+	if !segment.Remote {
+		length := int(min(localReadSize, segment.End-position))
+		data, err := storage.ReadRange(SegmentPath(topic, partition, segment), position-segment.Start, length)
+		if !errors.Is(err, fs.ErrNotExist) {
+			return data, err
+		}
+		// Offloaded since we looked it up
+	}
+	tier := currentRemoteTier()
+	if tier == nil {
+		return nil, fmt.Errorf("segment at %d of %s-%d is remote but no remote tier is configured", segment.Start, topic, partition)
+	}
+	length := int(min(remoteReadSize, segment.End-position))
+	return tier.ReadSegment(ctx, topic, partition, segment, position-segment.Start, length)
+}
+
+// Get the segments of a partition, read from its manifest on first use
+func loadPartitionLog(topic string, partition int) *partitionLog {
+	key := partitionKey(topic, partition)
+	if pl, ok := partitionLogs.Load(key); ok {
+		return pl.(*partitionLog)
+	}
+	partitionLogLock.Lock()
+	defer partitionLogLock.Unlock()
+	if pl, ok := partitionLogs.Load(key); ok {
+		return pl.(*partitionLog)
+	}
+
+	pl := &partitionLog{}
+	data, err := storage.ReadFile(storage.SegmentsPath(topic, partition))
+	if err == nil {
+		if err := json.Unmarshal(data, &pl.segments); err != nil {
+			log.Println("Error decoding segments of", key, err)
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		log.Println("Error reading segments of", key, err)
+	}
+	if n := len(pl.segments); n > 0 {
+		last := pl.segments[n-1]
+		pl.activeBase = last.End
+		// A crash between saving the manifest and renaming the log leaves the segment as the active file
+		logPath := getLogFilePath(topic, partition)
+		if !last.Remote && !storage.Exists(SegmentPath(topic, partition, last)) && storage.Exists(logPath) {
+			log.Println("Finishing interrupted roll of", key)
+			if err := storage.Rename(logPath, SegmentPath(topic, partition, last)); err != nil {
+				log.Println("Error finishing roll:", err)
+			} else if err := storage.WriteFile(logPath, nil); err != nil {
+				log.Println("Error creating log file:", err)
+			}
+		}
+	}
+	partitionLogs.Store(key, pl)
+	return pl
+}
+
+// Turn the active log file into a closed segment. Runs on the log writer
+// thread once everything queued before the roll is written, so the file
+// holds exactly the segment's bytes.
+func rollSegment(ctx context.Context, roll *segmentRoll) {
+	ctx, span := constants.Tracer.Start(ctx, "rollSegment")
+	defer span.End()
+
+	logPath := getLogFilePath(roll.topic, roll.partition)
+	pl := loadPartitionLog(roll.topic, roll.partition)
+	pl.mu.Lock()
+	segment := roll.segment
+	if segment.Start > pl.activeBase {
+		// A roll that failed before left its bytes in the active log file,
+		// this segment takes them along
+		segment.Start = pl.activeBase
+		segment.FirstOffset = 1
+		if n := len(pl.segments); n > 0 {
+			segment.FirstOffset = pl.segments[n-1].LastOffset + 1
+		}
+	}
+	segments := append(slices.Clone(pl.segments), segment)
+	// Manifest first, loadPartitionLog finishes the rename after a crash
+	if err := saveSegments(roll.topic, roll.partition, segments); err != nil {
+		pl.mu.Unlock()
+		log.Println("Error saving segments:", err)
+		return
+	}
+	if err := storage.Rename(logPath, SegmentPath(roll.topic, roll.partition, segment)); err != nil {
+		// The active log file still holds the segment's only copy
+		if err := saveSegments(roll.topic, roll.partition, pl.segments); err != nil {
+			log.Println("Error restoring segments:", err)
+		}
+		pl.mu.Unlock()
+		log.Println("Error rolling log:", err)
+		return
+	}
+	if err := storage.WriteFile(logPath, nil); err != nil {
+		log.Println("Error creating log file:", err)
+	}
+	pl.segments = segments
+	pl.activeBase = segment.End
+	pl.mu.Unlock()
+	log.Println("Rolled segment of", partitionKey(roll.topic, roll.partition), "at offset", segment.LastOffset)
+
+	rollListenersLock.Lock()
+	listeners := slices.Clone(rollListeners)
+	rollListenersLock.Unlock()
+	for _, fn := range listeners {
+		fn(roll.topic, roll.partition, segment)
+	}
+}
+
+func saveSegments(topic string, partition int, segments []Segment) error {
+	jsonData, err := json.MarshalIndent(segments, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding segments: %w", err)
+	}
+	if err := storage.WriteFile(storage.SegmentsPath(topic, partition), jsonData); err != nil {
+		return fmt.Errorf("error writing segments: %w", err)
+	}
+	return nil
+}
+
+// Bytes after which the active log of a topic is rolled
+func segmentBytes(ctx context.Context, topic string) int64 {
+	if config, err := loadConfig(ctx, topic); err == nil && config.SegmentBytes > 0 {
+		return config.SegmentBytes
+	}
+	return DefaultSegmentBytes
+}
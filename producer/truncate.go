@@ -0,0 +1,182 @@
+package producer
+
+import (
+	"FranzMQ/constants"
+	"FranzMQ/storage"
+	"bufio"
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Truncation of the log, or of the index only, handed to the partition
+// goroutine
+type truncation struct {
+	offset int
+	done   chan error
+}
+
+// Truncate drops the entries of a partition from offset on, for a replica
+// whose log diverged from its leader's. It runs in order with the appends
+// of the partition, the next entry gets offset.
+func Truncate(ctx context.Context, topic string, partition int, offset int) error {
+	ctx, span := constants.Tracer.Start(ctx, "Truncate")
+	defer span.End()
+
+	done := make(chan error, 1)
+	if err := sendToPartition(ctx, topic, partition, LogEntry{Ctx: ctx, truncate: &truncation{offset: offset, done: done}}); err != nil {
+		return err
+	}
+	return <-done
+}
+
+// Hand a request to the goroutine of a partition, in order with its appends
+func sendToPartition(ctx context.Context, topic string, partition int, request LogEntry) error {
+	config, err := loadConfig(ctx, topic)
+	if err != nil {
+		return err
+	}
+	sendLock.RLock()
+	defer sendLock.RUnlock()
+	logQueue := getQueue(topic, partition, config.NumOfPartition)
+	if logQueue == nil {
+		return fmt.Errorf("log queue not found for topic %s and partition %d", topic, partition)
+	}
+	logQueue <- request
+	return nil
+}
+
+// Where the active log file of a partition starts, and its first offset
+func activeSegment(topic string, partition int) (int64, int) {
+	pl := loadPartitionLog(topic, partition)
+	pl.mu.RLock()
+	activeBase, n, lastOffset := pl.activeBase, len(pl.segments), 0
+	if n > 0 {
+		lastOffset = pl.segments[n-1].LastOffset
+	}
+	pl.mu.RUnlock()
+	if n > 0 || activeBase == 0 {
+		return activeBase, lastOffset + 1
+	}
+
+	// Retention deleted every closed segment, the active log tells
+	line, err := bufio.NewReader(storage.NewReader(getLogFilePath(topic, partition), 0)).ReadString('\n')
+	if parts := strings.SplitN(line, "--", 4); err == nil && len(parts) == 4 {
+		if offset, err := strconv.Atoi(parts[2]); err == nil {
+			return activeBase, offset
+		}
+	}
+	return activeBase, NextOffset(context.Background(), topic, partition)
+}
+
+// Cut the log and index of a partition before offset. Runs on the partition
+// goroutine, so nothing is appended meanwhile. Closed segments past the cut
+// are removed and the one holding it becomes the active log file again. A
+// remote one goes whole, the log is cut before its first offset instead
+// and the replica fetches it again from the leader.
+func truncateLog(ctx context.Context, topic string, partition int, offset int) error {
+	logPath, indexPath := getLogFilePath(topic, partition), getIndexFilePath(topic, partition)
+	// Everything queued so far lands in the files first
+	closeWriterFile(ctx, GlobalLogWriterQueue, logPath)
+	closeWriterFile(ctx, GlobalIndexWriterQueue, indexPath)
+
+	index, err := storage.ReadFile(indexPath)
+	if err != nil {
+		return fmt.Errorf("error reading index of %s-%d: %w", topic, partition, err)
+	}
+	// The first entry kept may be past offset, when retention deleted the ones before
+	kept, cut, offset := indexCut(index, func(_ int64, entryOffset int) bool { return entryOffset >= offset })
+	if cut < 0 {
+		return nil // Nothing at or after offset
+	}
+
+	pl := loadPartitionLog(topic, partition)
+	pl.mu.Lock()
+	logStart := pl.activeBase
+	if len(pl.segments) > 0 {
+		logStart = pl.segments[0].Start
+	}
+	if cut < logStart {
+		// Retention deleted the segment the cut falls in but did not trim the
+		// index yet, everything kept goes
+		kept, cut, offset = indexCut(index, func(start int64, _ int) bool { return start >= logStart })
+		if cut < 0 {
+			pl.mu.Unlock()
+			return nil
+		}
+	}
+	var dropped []Segment
+	if cut < pl.activeBase {
+		i := slices.IndexFunc(pl.segments, func(s Segment) bool { return s.End > cut })
+		reopened := pl.segments[i]
+		dropped = slices.Clone(pl.segments[i+1:])
+		if reopened.Remote {
+			// A remote segment cannot be cut in place, drop all of it and
+			// let the replica copy it again from its first offset
+			offset = reopened.FirstOffset
+			kept, cut, _ = indexCut(index, func(_ int64, entryOffset int) bool { return entryOffset >= offset })
+			dropped = slices.Insert(dropped, 0, reopened)
+		}
+		if err := saveSegments(topic, partition, pl.segments[:i]); err != nil {
+			pl.mu.Unlock()
+			return err
+		}
+		if err := storage.RemoveAll(logPath); err != nil {
+			pl.mu.Unlock()
+			return fmt.Errorf("error removing log of %s-%d: %w", topic, partition, err)
+		}
+		if reopened.Remote {
+			err = storage.WriteFile(logPath, nil)
+		} else {
+			err = storage.Rename(SegmentPath(topic, partition, reopened), logPath)
+		}
+		if err != nil {
+			pl.mu.Unlock()
+			return fmt.Errorf("error reopening segment of %s-%d: %w", topic, partition, err)
+		}
+		pl.activeBase = reopened.Start
+		pl.segments = slices.Clone(pl.segments[:i])
+	}
+	err = storage.Truncate(logPath, cut-pl.activeBase)
+	pl.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("error truncating log of %s-%d: %w", topic, partition, err)
+	}
+	if err := storage.WriteFile(indexPath, index[:kept]); err != nil {
+		return fmt.Errorf("error truncating index of %s-%d: %w", topic, partition, err)
+	}
+	for _, segment := range dropped {
+		if err := removeSegment(ctx, topic, partition, segment); err != nil {
+			log.Println("Error removing segment:", err)
+		}
+	}
+
+	key := partitionKey(topic, partition)
+	constants.OffsetMap.SET(ctx, key, offset-1)
+	constants.LogSizeMap.SET(ctx, key, int(cut))
+	log.Println("Truncated", key, "before offset", offset)
+	return nil
+}
+
+// Where the index and the log are cut to drop the first entry from matches
+// on: the length of the index kept, the log position and the offset of the
+// entry, -1 when no entry matches
+func indexCut(index []byte, from func(start int64, offset int) bool) (int, int64, int) {
+	kept := 0
+	for _, line := range strings.SplitAfter(string(index), "\n") {
+		// timestamp--start--end--offset
+		parts := strings.Split(strings.TrimSpace(line), "--")
+		if len(parts) == 4 {
+			start, startErr := strconv.ParseInt(parts[1], 10, 64)
+			entryOffset, offsetErr := strconv.Atoi(parts[3])
+			if startErr == nil && offsetErr == nil && from(start, entryOffset) {
+				return kept, start, entryOffset
+			}
+		}
+		kept += len(line)
+	}
+	return kept, -1, -1
+}
@@ -0,0 +1,44 @@
+package protocol
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression codecs for ProduceBatch records
+const (
+	CompressionNone   int16 = 0
+	CompressionGzip   int16 = 1
+	CompressionSnappy int16 = 2
+	CompressionZstd   int16 = 3
+)
+
+func decompress(codec int16, data []byte) ([]byte, error) {
+	switch codec {
+	case CompressionNone:
+		return data, nil
+	case CompressionGzip:
+		reader, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer reader.Close()
+		return io.ReadAll(reader)
+	case CompressionSnappy:
+		return snappy.Decode(nil, data)
+	case CompressionZstd:
+		reader, err := zstd.NewReader(nil)
+		if err != nil {
+			return nil, err
+		}
+		defer reader.Close()
+		return reader.DecodeAll(data, nil)
+	default:
+		return nil, fmt.Errorf("unsupported compression codec %d", codec)
+	}
+}
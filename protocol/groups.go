@@ -0,0 +1,178 @@
+package protocol
+
+import (
+	"FranzMQ/consumer"
+	"context"
+	"errors"
+	"time"
+)
+
+// Group membership runs the coordinator in the consumer package. JoinGroup
+// and SyncGroup block until the rebalance completes, so clients keep them
+// off the connection they fetch on.
+
+// JoinGroup: group string | member string | client string | protocol_type string |
+// session_timeout_ms int32 | rebalance_timeout_ms int32 | count int32 | count * (name string | metadata bytes)
+// => generation int32 | protocol string | leader string | member string | count int32 | count * (member string | metadata bytes)
+func handleJoinGroup(ctx context.Context, d *decoder) ([]byte, int16, error) {
+	req := consumer.JoinGroupRequest{
+		GroupID:          d.string(),
+		MemberID:         d.string(),
+		ClientID:         d.string(),
+		ProtocolType:     d.string(),
+		SessionTimeout:   time.Duration(d.int32()) * time.Millisecond,
+		RebalanceTimeout: time.Duration(d.int32()) * time.Millisecond,
+	}
+	count := int(d.int32())
+	for i := 0; i < count && d.err == nil; i++ {
+		req.Protocols = append(req.Protocols, consumer.GroupProtocol{Name: d.string(), Metadata: d.bytes()})
+	}
+	if d.err != nil {
+		return nil, ErrInvalidRequest, d.err
+	}
+	if err := consumer.ValidateGroupID(req.GroupID); err != nil {
+		return nil, ErrInvalidRequest, err
+	}
+
+	resp, err := consumer.JoinGroup(ctx, req)
+	if err != nil {
+		return nil, groupErrorCode(err), err
+	}
+
+	e := encoder{}
+	e.putInt32(int32(resp.Generation))
+	e.putString(resp.Protocol)
+	e.putString(resp.LeaderID)
+	e.putString(resp.MemberID)
+	e.putInt32(int32(len(resp.Members)))
+	for _, m := range resp.Members {
+		e.putString(m.MemberID)
+		e.putBytes(m.Metadata)
+	}
+	return e.buf, ErrNone, nil
+}
+
+// SyncGroup: group string | generation int32 | member string | count int32 | count * (member string | assignment bytes)
+// => assignment bytes
+func handleSyncGroup(ctx context.Context, d *decoder) ([]byte, int16, error) {
+	groupID, generation, memberID := d.string(), int(d.int32()), d.string()
+	count := int(d.int32())
+	assignments := make(map[string][]byte)
+	for i := 0; i < count && d.err == nil; i++ {
+		assignments[d.string()] = d.bytes()
+	}
+	if d.err != nil {
+		return nil, ErrInvalidRequest, d.err
+	}
+
+	assignment, err := consumer.SyncGroup(ctx, groupID, generation, memberID, assignments)
+	if err != nil {
+		return nil, groupErrorCode(err), err
+	}
+
+	e := encoder{}
+	e.putBytes(assignment)
+	return e.buf, ErrNone, nil
+}
+
+// Heartbeat: group string | generation int32 | member string
+// => empty body
+func handleHeartbeat(ctx context.Context, d *decoder) ([]byte, int16, error) {
+	groupID, generation, memberID := d.string(), int(d.int32()), d.string()
+	if d.err != nil {
+		return nil, ErrInvalidRequest, d.err
+	}
+	if err := consumer.Heartbeat(ctx, groupID, generation, memberID); err != nil {
+		return nil, groupErrorCode(err), err
+	}
+	return nil, ErrNone, nil
+}
+
+// LeaveGroup: group string | member string
+// => empty body
+func handleLeaveGroup(ctx context.Context, d *decoder) ([]byte, int16, error) {
+	groupID, memberID := d.string(), d.string()
+	if d.err != nil {
+		return nil, ErrInvalidRequest, d.err
+	}
+	if err := consumer.LeaveGroup(ctx, groupID, memberID); err != nil {
+		return nil, groupErrorCode(err), err
+	}
+	return nil, ErrNone, nil
+}
+
+// ListGroups: empty body
+// => count int32 | count * group string
+func handleListGroups(ctx context.Context, d *decoder) ([]byte, int16, error) {
+	names, err := consumer.ListGroups(ctx)
+	if err != nil {
+		return nil, ErrUnknown, err
+	}
+
+	e := encoder{}
+	e.putInt32(int32(len(names)))
+	for _, name := range names {
+		e.putString(name)
+	}
+	return e.buf, ErrNone, nil
+}
+
+// DescribeGroup: group string
+// => state string | generation int32 | protocol_type string | protocol string | leader string |
+// count int32 | count * (member string | client string | assignment bytes) |
+// count int32 | count * (topic string | partition int32 | offset int64)
+func handleDescribeGroup(ctx context.Context, d *decoder) ([]byte, int16, error) {
+	groupID := d.string()
+	if d.err != nil {
+		return nil, ErrInvalidRequest, d.err
+	}
+	if err := consumer.ValidateGroupID(groupID); err != nil {
+		return nil, ErrInvalidRequest, err
+	}
+
+	desc, err := consumer.DescribeGroup(ctx, groupID)
+	if err != nil {
+		return nil, ErrInvalidRequest, err
+	}
+
+	e := encoder{}
+	e.putString(desc.State)
+	e.putInt32(int32(desc.Generation))
+	e.putString(desc.ProtocolType)
+	e.putString(desc.Protocol)
+	e.putString(desc.LeaderID)
+	e.putInt32(int32(len(desc.Members)))
+	for _, m := range desc.Members {
+		e.putString(m.MemberID)
+		e.putString(m.ClientID)
+		e.putBytes(m.Assignment)
+	}
+	count := 0
+	for _, partitions := range desc.Offsets {
+		count += len(partitions)
+	}
+	e.putInt32(int32(count))
+	for topicName, partitions := range desc.Offsets {
+		for partition, offset := range partitions {
+			e.putString(topicName)
+			e.putInt32(int32(partition))
+			e.putInt64(int64(offset))
+		}
+	}
+	return e.buf, ErrNone, nil
+}
+
+func groupErrorCode(err error) int16 {
+	switch {
+	case errors.Is(err, consumer.ErrRebalanceInProgress):
+		return ErrRebalanceInProgress
+	case errors.Is(err, consumer.ErrUnknownMemberID):
+		return ErrUnknownMemberID
+	case errors.Is(err, consumer.ErrIllegalGeneration):
+		return ErrIllegalGeneration
+	case errors.Is(err, consumer.ErrInvalidGroupID), errors.Is(err, consumer.ErrInconsistentProtocol):
+		return ErrInvalidRequest
+	default:
+		return ErrUnknown
+	}
+}
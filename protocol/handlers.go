@@ -0,0 +1,905 @@
+package protocol
+
+import (
+	"FranzMQ/constants"
+	"FranzMQ/consumer"
+	"FranzMQ/metadata"
+	"FranzMQ/metrics"
+	"FranzMQ/producer"
+	"FranzMQ/topic"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// API keys
+const (
+	ApiProduce            int16 = 0
+	ApiFetch              int16 = 1
+	ApiMetadata           int16 = 2
+	ApiListOffsets        int16 = 3
+	ApiOffsetCommit       int16 = 4
+	ApiOffsetFetch        int16 = 5
+	ApiProduceBatch       int16 = 6
+	ApiJoinGroup          int16 = 7
+	ApiSyncGroup          int16 = 8
+	ApiHeartbeat          int16 = 9
+	ApiLeaveGroup         int16 = 10
+	ApiCreateTopic        int16 = 11
+	ApiListGroups         int16 = 12
+	ApiDescribeGroup      int16 = 13
+	ApiDeleteTopic        int16 = 14
+	ApiCreatePartitions   int16 = 15
+	ApiDescribeConfigs    int16 = 16
+	ApiAlterConfigs       int16 = 17
+	ApiReplicaFetch       int16 = 18
+	ApiRaftMessage        int16 = 19
+	ApiClusterMetadata    int16 = 20
+	ApiReassignPartitions int16 = 21
+	ApiListReassignments  int16 = 22
+	ApiDecommissionBroker int16 = 23
+	ApiElectLeaders       int16 = 24
+	ApiOffsetForEpoch     int16 = 25
+)
+
+// Endpoint names of the API keys in request metrics
+var apiNames = map[int16]string{
+	ApiProduce:            "Produce",
+	ApiFetch:              "Fetch",
+	ApiMetadata:           "Metadata",
+	ApiListOffsets:        "ListOffsets",
+	ApiOffsetCommit:       "OffsetCommit",
+	ApiOffsetFetch:        "OffsetFetch",
+	ApiProduceBatch:       "ProduceBatch",
+	ApiJoinGroup:          "JoinGroup",
+	ApiSyncGroup:          "SyncGroup",
+	ApiHeartbeat:          "Heartbeat",
+	ApiLeaveGroup:         "LeaveGroup",
+	ApiCreateTopic:        "CreateTopic",
+	ApiListGroups:         "ListGroups",
+	ApiDescribeGroup:      "DescribeGroup",
+	ApiDeleteTopic:        "DeleteTopic",
+	ApiCreatePartitions:   "CreatePartitions",
+	ApiDescribeConfigs:    "DescribeConfigs",
+	ApiAlterConfigs:       "AlterConfigs",
+	ApiReplicaFetch:       "ReplicaFetch",
+	ApiRaftMessage:        "RaftMessage",
+	ApiClusterMetadata:    "ClusterMetadata",
+	ApiReassignPartitions: "ReassignPartitions",
+	ApiListReassignments:  "ListReassignments",
+	ApiDecommissionBroker: "DecommissionBroker",
+	ApiElectLeaders:       "ElectLeaders",
+	ApiOffsetForEpoch:     "OffsetForEpoch",
+}
+
+// Error codes, a non-zero code carries an error message string as body
+const (
+	ErrNone                    int16 = 0
+	ErrUnknown                 int16 = 1
+	ErrInvalidRequest          int16 = 2
+	ErrUnknownTopicOrPartition int16 = 3
+	ErrUnsupportedVersion      int16 = 4
+	ErrRebalanceInProgress     int16 = 5
+	ErrUnknownMemberID         int16 = 6
+	ErrIllegalGeneration       int16 = 7
+	ErrNotLeader               int16 = 8
+	ErrNotEnoughReplicas       int16 = 9
+	ErrFencedLeaderEpoch       int16 = 10
+)
+
+// ListOffsets timestamps
+const (
+	LatestTimestamp   int64 = -1
+	EarliestTimestamp int64 = -2
+)
+
+// Name of an API key, its number for unknown keys
+func apiName(apiKey int16) string {
+	if name, found := apiNames[apiKey]; found {
+		return name
+	}
+	return strconv.Itoa(int(apiKey))
+}
+
+// Run a request and frame its response
+func handle(ctx context.Context, req request) []byte {
+	ctx, span := constants.Tracer.Start(ctx, "protocol.handle")
+	defer span.End()
+	defer metrics.ObserveRequest("binary", apiName(req.apiKey), time.Now())
+
+	if req.apiVersion != 0 {
+		return errorResponse(req.correlationID, ErrUnsupportedVersion, "unsupported api version")
+	}
+
+	d := &decoder{buf: req.body}
+	var (
+		body []byte
+		code int16
+		err  error
+	)
+	switch req.apiKey {
+	case ApiProduce:
+		body, code, err = handleProduce(ctx, d)
+	case ApiFetch:
+		body, code, err = handleFetch(ctx, d)
+	case ApiMetadata:
+		body, code, err = handleMetadata(ctx, d)
+	case ApiListOffsets:
+		body, code, err = handleListOffsets(ctx, d)
+	case ApiOffsetCommit:
+		body, code, err = handleOffsetCommit(ctx, d)
+	case ApiOffsetFetch:
+		body, code, err = handleOffsetFetch(ctx, d)
+	case ApiProduceBatch:
+		body, code, err = handleProduceBatch(ctx, d)
+	case ApiJoinGroup:
+		body, code, err = handleJoinGroup(ctx, d)
+	case ApiSyncGroup:
+		body, code, err = handleSyncGroup(ctx, d)
+	case ApiHeartbeat:
+		body, code, err = handleHeartbeat(ctx, d)
+	case ApiLeaveGroup:
+		body, code, err = handleLeaveGroup(ctx, d)
+	case ApiCreateTopic:
+		body, code, err = handleCreateTopic(ctx, d)
+	case ApiListGroups:
+		body, code, err = handleListGroups(ctx, d)
+	case ApiDescribeGroup:
+		body, code, err = handleDescribeGroup(ctx, d)
+	case ApiDeleteTopic:
+		body, code, err = handleDeleteTopic(ctx, d)
+	case ApiCreatePartitions:
+		body, code, err = handleCreatePartitions(ctx, d)
+	case ApiDescribeConfigs:
+		body, code, err = handleDescribeConfigs(ctx, d)
+	case ApiAlterConfigs:
+		body, code, err = handleAlterConfigs(ctx, d)
+	case ApiReplicaFetch:
+		body, code, err = handleReplicaFetch(ctx, d)
+	case ApiRaftMessage:
+		body, code, err = handleRaftMessage(ctx, d)
+	case ApiClusterMetadata:
+		body, code, err = handleClusterMetadata(ctx, d)
+	case ApiReassignPartitions:
+		body, code, err = handleReassignPartitions(ctx, d)
+	case ApiListReassignments:
+		body, code, err = handleListReassignments(ctx, d)
+	case ApiDecommissionBroker:
+		body, code, err = handleDecommissionBroker(ctx, d)
+	case ApiElectLeaders:
+		body, code, err = handleElectLeaders(ctx, d)
+	case ApiOffsetForEpoch:
+		body, code, err = handleOffsetForEpoch(ctx, d)
+	default:
+		return errorResponse(req.correlationID, ErrUnsupportedVersion, "unsupported api key")
+	}
+	if err != nil {
+		return errorResponse(req.correlationID, code, err.Error())
+	}
+	return response(req.correlationID, ErrNone, body)
+}
+
+func errorResponse(correlationID int32, code int16, message string) []byte {
+	e := encoder{}
+	e.putString(message)
+	return response(correlationID, code, e.buf)
+}
+
+// Produce: topic string | key string | value bytes
+// => partition int32 | offset int64 | timestamp int64
+func handleProduce(ctx context.Context, d *decoder) ([]byte, int16, error) {
+	topicName, key, value := d.string(), d.string(), d.bytes()
+	if d.err != nil {
+		return nil, ErrInvalidRequest, d.err
+	}
+
+	_, metaData, err := producer.ProduceMessage(ctx, topicName, key, toMessage(value))
+	if err != nil {
+		return nil, replicationErrorCode(err, ErrUnknownTopicOrPartition), err
+	}
+
+	e := encoder{}
+	e.putInt32(int32(metaData.Partition))
+	e.putInt64(int64(metaData.Offset))
+	e.putInt64(metaData.TimeStamp)
+	return e.buf, ErrNone, nil
+}
+
+// ProduceBatch: topic string | partition int32 | compression int16 | records bytes
+// where records, once decompressed, are count int32 | count * (key string | value bytes).
+// Partition -1 hashes every key like Produce does. The records of a partition
+// are appended in one step, all of them or none; with keys spread over
+// partitions an error leaves the partitions before the failing one appended.
+// => count int32 | count * (partition int32 | offset int64 | timestamp int64)
+func handleProduceBatch(ctx context.Context, d *decoder) ([]byte, int16, error) {
+	topicName, partition, compression, data := d.string(), int(d.int32()), d.int16(), d.bytes()
+	if d.err != nil {
+		return nil, ErrInvalidRequest, d.err
+	}
+
+	payload, err := decompress(compression, data)
+	if err != nil {
+		return nil, ErrInvalidRequest, err
+	}
+	rd := &decoder{buf: payload}
+	count := int(rd.int32())
+
+	// Records grouped by partition, in the order the partitions first appear
+	partitions := []int{}
+	groups := map[int][]interface{}{}
+	order := []int{}
+	for i := 0; i < count; i++ {
+		key, value := rd.string(), rd.bytes()
+		if rd.err != nil {
+			return nil, ErrInvalidRequest, rd.err
+		}
+		p := partition
+		if p < 0 {
+			if p, err = producer.PartitionForKey(ctx, topicName, key); err != nil {
+				return nil, ErrUnknownTopicOrPartition, err
+			}
+		}
+		if _, found := groups[p]; !found {
+			order = append(order, p)
+		}
+		partitions = append(partitions, p)
+		groups[p] = append(groups[p], toMessage(value))
+	}
+
+	results := map[int]producer.NewMsgProduceResponse{}
+	for _, p := range order {
+		metaData, err := producer.ProduceBatch(ctx, topicName, p, groups[p])
+		if err != nil {
+			return nil, replicationErrorCode(err, ErrUnknownTopicOrPartition), err
+		}
+		results[p] = metaData
+	}
+
+	e := encoder{}
+	e.putInt32(int32(len(partitions)))
+	next := map[int]int{} // Records of each partition acknowledged so far
+	for _, p := range partitions {
+		metaData := results[p]
+		e.putInt32(int32(p))
+		e.putInt64(int64(metaData.Offset + next[p]))
+		e.putInt64(metaData.TimeStamp)
+		next[p]++
+	}
+	return e.buf, ErrNone, nil
+}
+
+// Messages are stored as JSON, anything else is kept as a JSON string
+func toMessage(value []byte) interface{} {
+	if !json.Valid(value) {
+		return string(value)
+	}
+	return json.RawMessage(value)
+}
+
+// Fetch: topic string | partition int32 | offset int64 | max_bytes int32 | min_bytes int32 | max_wait_ms int32
+// => next_offset int64 | count int32 | count * (offset int64 | timestamp int64 | value bytes)
+func handleFetch(ctx context.Context, d *decoder) ([]byte, int16, error) {
+	req := consumer.FetchRequest{
+		Topic:     d.string(),
+		Partition: int(d.int32()),
+		Offset:    int(d.int64()),
+		MaxBytes:  int(d.int32()),
+		MinBytes:  int(d.int32()),
+		MaxWait:   time.Duration(d.int32()) * time.Millisecond,
+	}
+	if d.err != nil {
+		return nil, ErrInvalidRequest, d.err
+	}
+
+	resp, err := consumer.Fetch(ctx, req)
+	if err != nil {
+		return nil, replicationErrorCode(err, ErrUnknownTopicOrPartition), err
+	}
+
+	e := encoder{}
+	e.putInt64(int64(resp.NextOffset))
+	e.putInt32(int32(len(resp.Records)))
+	for _, record := range resp.Records {
+		e.putInt64(int64(record.Offset))
+		e.putInt64(record.TimeStamp)
+		e.putBytes(record.Message)
+	}
+	return e.buf, ErrNone, nil
+}
+
+// ReplicaFetcher serves the fetches followers send to the leader of a partition
+type ReplicaFetcher func(ctx context.Context, replicaID int, req consumer.FetchRequest) (consumer.FetchResponse, error)
+
+var replicaFetcher ReplicaFetcher
+
+// SetReplicaFetcher enables ReplicaFetch requests, used by the replication package
+func SetReplicaFetcher(fetcher ReplicaFetcher) {
+	replicaFetcher = fetcher
+}
+
+// ReplicaFetch: topic string | partition int32 | replica_id int32 | offset int64 | max_bytes int32 | max_wait_ms int32
+// | leader_epoch int32
+// => high_watermark int64 | next_offset int64 | count int32 | count * (offset int64 | timestamp int64 | value bytes)
+// | isr_count int32 | isr_count * replica int32 | epoch_count int32 | epoch_count * (epoch int32 | start_offset int64)
+// Sent by followers to the leader of a partition, they read past the high watermark.
+// A leader_epoch other than the leader's fails with ErrFencedLeaderEpoch.
+func handleReplicaFetch(ctx context.Context, d *decoder) ([]byte, int16, error) {
+	ctx, span := constants.Tracer.Start(ctx, "handleReplicaFetch")
+	defer span.End()
+
+	topicName, partition, replicaID := d.string(), int(d.int32()), int(d.int32())
+	req := consumer.FetchRequest{
+		Topic:     topicName,
+		Partition: partition,
+		Offset:    int(d.int64()),
+		MaxBytes:  int(d.int32()),
+		MaxWait:   time.Duration(d.int32()) * time.Millisecond,
+	}
+	req.LeaderEpoch = int(d.int32())
+	if d.err != nil {
+		return nil, ErrInvalidRequest, d.err
+	}
+
+	if replicaFetcher == nil {
+		return nil, ErrNotLeader, fmt.Errorf("replication is not enabled on this broker")
+	}
+	resp, err := replicaFetcher(ctx, replicaID, req)
+	if err != nil {
+		return nil, replicationErrorCode(err, ErrUnknownTopicOrPartition), err
+	}
+
+	e := encoder{}
+	e.putInt64(int64(resp.HighWatermark))
+	e.putInt64(int64(resp.NextOffset))
+	e.putInt32(int32(len(resp.Records)))
+	for _, record := range resp.Records {
+		// Followers store the entry as the leader has it, side fields included
+		entry, err := producer.JoinEntry(record.Message, record.EntryAttributes)
+		if err != nil {
+			return nil, ErrUnknown, err
+		}
+		e.putInt64(int64(record.Offset))
+		e.putInt64(record.TimeStamp)
+		e.putBytes([]byte(entry))
+	}
+	e.putInt32(int32(len(resp.InSyncReplicas)))
+	for _, id := range resp.InSyncReplicas {
+		e.putInt32(int32(id))
+	}
+	e.putInt32(int32(len(resp.LeaderEpochs)))
+	for _, epoch := range resp.LeaderEpochs {
+		e.putInt32(int32(epoch.Epoch))
+		e.putInt64(int64(epoch.StartOffset))
+	}
+	return e.buf, ErrNone, nil
+}
+
+// EpochOffsetter returns the largest leader epoch of a partition led by this
+// broker not above epoch and the offset it ends at, -1 and -1 without one
+type EpochOffsetter func(topic string, partition, epoch int) (int, int, error)
+
+var epochOffsetter EpochOffsetter
+
+// SetEpochOffsetter enables OffsetForLeaderEpoch requests, used by the replication package
+func SetEpochOffsetter(offsetter EpochOffsetter) {
+	epochOffsetter = offsetter
+}
+
+// OffsetForLeaderEpoch: topic string | partition int32 | leader_epoch int32
+// => leader_epoch int32 | end_offset int64
+// Sent by a replica becoming follower to find where its log parts from the leader's.
+func handleOffsetForEpoch(ctx context.Context, d *decoder) ([]byte, int16, error) {
+	_, span := constants.Tracer.Start(ctx, "handleOffsetForEpoch")
+	defer span.End()
+
+	topicName, partition, epoch := d.string(), int(d.int32()), int(d.int32())
+	if d.err != nil {
+		return nil, ErrInvalidRequest, d.err
+	}
+	if epochOffsetter == nil {
+		return nil, ErrNotLeader, fmt.Errorf("replication is not enabled on this broker")
+	}
+	leaderEpoch, endOffset, err := epochOffsetter(topicName, partition, epoch)
+	if err != nil {
+		return nil, replicationErrorCode(err, ErrUnknownTopicOrPartition), err
+	}
+	e := encoder{}
+	e.putInt32(int32(leaderEpoch))
+	e.putInt64(int64(endOffset))
+	return e.buf, ErrNone, nil
+}
+
+// RaftHandler takes the messages the nodes of the metadata quorum exchange
+type RaftHandler func(ctx context.Context, message []byte) error
+
+var raftHandler RaftHandler
+
+// SetRaftHandler enables RaftMessage requests, used by the quorum package
+func SetRaftHandler(handler RaftHandler) {
+	raftHandler = handler
+}
+
+// RaftMessage: message bytes
+// => empty
+// Sent between the nodes of the built-in metadata quorum.
+func handleRaftMessage(ctx context.Context, d *decoder) ([]byte, int16, error) {
+	message := d.bytes()
+	if d.err != nil {
+		return nil, ErrInvalidRequest, d.err
+	}
+	if raftHandler == nil {
+		return nil, ErrInvalidRequest, fmt.Errorf("the metadata quorum does not run on this broker")
+	}
+	if err := raftHandler(ctx, message); err != nil {
+		return nil, ErrInvalidRequest, err
+	}
+	return nil, ErrNone, nil
+}
+
+// Code of errors replicated partitions fail with, fallback for any other
+func replicationErrorCode(err error, fallback int16) int16 {
+	switch {
+	case errors.Is(err, producer.ErrNotLeader):
+		return ErrNotLeader
+	case errors.Is(err, producer.ErrNotEnoughReplicas):
+		return ErrNotEnoughReplicas
+	case errors.Is(err, producer.ErrFencedLeaderEpoch):
+		return ErrFencedLeaderEpoch
+	}
+	return fallback
+}
+
+// Metadata: count int32 | count * topic string, zero topics means all of them
+// => count int32 | count * (topic string | partitions int32)
+func handleMetadata(ctx context.Context, d *decoder) ([]byte, int16, error) {
+	count := int(d.int32())
+	names := []string{}
+	for i := 0; i < count && d.err == nil; i++ {
+		names = append(names, d.string())
+	}
+	if d.err != nil {
+		return nil, ErrInvalidRequest, d.err
+	}
+
+	if len(names) == 0 {
+		all, err := topic.ListTopics(ctx)
+		if err != nil {
+			return nil, ErrUnknown, err
+		}
+		names = all
+	}
+
+	e := encoder{}
+	e.putInt32(int32(len(names)))
+	for _, name := range names {
+		config, err := topic.LoadConfig(ctx, name)
+		if err != nil {
+			return nil, ErrUnknownTopicOrPartition, err
+		}
+		e.putString(name)
+		e.putInt32(int32(config.NumOfPartition))
+	}
+	return e.buf, ErrNone, nil
+}
+
+// MetadataSource describes the brokers of the cluster and where the
+// partitions of the topics named live, every topic when there are no names
+type MetadataSource func(ctx context.Context, topics []string) (metadata.Cluster, error)
+
+var metadataSource MetadataSource
+
+// SetMetadataSource enables ClusterMetadata requests, used by the replication package
+func SetMetadataSource(source MetadataSource) {
+	metadataSource = source
+}
+
+// ClusterMetadata: count int32 | count * topic string, zero topics means all of them
+// => brokers int32 | brokers * (id int32 | host string | port int32 | rack string)
+// | topics int32 | topics * (topic string | partitions int32 | partitions * (partition int32 | leader int32
+// | replicas int32 | replicas * id int32 | isr int32 | isr * id int32))
+// Clients send produces and fetches to the leaders it returns, and ask again
+// once a broker answers ErrNotLeader.
+func handleClusterMetadata(ctx context.Context, d *decoder) ([]byte, int16, error) {
+	ctx, span := constants.Tracer.Start(ctx, "handleClusterMetadata")
+	defer span.End()
+
+	count := int(d.int32())
+	names := []string{}
+	for i := 0; i < count && d.err == nil; i++ {
+		names = append(names, d.string())
+	}
+	if d.err != nil {
+		return nil, ErrInvalidRequest, d.err
+	}
+	if metadataSource == nil {
+		return nil, ErrInvalidRequest, fmt.Errorf("cluster metadata is not available on this broker")
+	}
+	cluster, err := metadataSource(ctx, names)
+	if err != nil {
+		return nil, ErrUnknownTopicOrPartition, err
+	}
+
+	e := encoder{}
+	e.putInt32(int32(len(cluster.Brokers)))
+	for _, b := range cluster.Brokers {
+		e.putInt32(int32(b.ID))
+		e.putString(b.Host)
+		e.putInt32(int32(b.Port))
+		e.putString(b.Rack)
+	}
+	e.putInt32(int32(len(cluster.Topics)))
+	for _, t := range cluster.Topics {
+		e.putString(t.Name)
+		e.putInt32(int32(len(t.Partitions)))
+		for _, p := range t.Partitions {
+			e.putInt32(int32(p.Partition))
+			e.putInt32(int32(p.Leader))
+			e.putInt32(int32(len(p.Replicas)))
+			for _, id := range p.Replicas {
+				e.putInt32(int32(id))
+			}
+			e.putInt32(int32(len(p.InSyncReplicas)))
+			for _, id := range p.InSyncReplicas {
+				e.putInt32(int32(id))
+			}
+		}
+	}
+	return e.buf, ErrNone, nil
+}
+
+// Reassigner moves partitions between the brokers of a cluster
+type Reassigner interface {
+	Reassign(ctx context.Context, topic string, partitions map[int][]int, throttle int) error
+	Reassignments() []metadata.Reassignment
+	Decommission(ctx context.Context, brokerID, throttle int) (int, error)
+}
+
+var reassigner Reassigner
+
+// SetReassigner enables the reassignment requests, used with the orchestrator
+func SetReassigner(r Reassigner) {
+	reassigner = r
+}
+
+// ReassignPartitions: topic string | throttle int64 | count int32 | count * (partition int32
+// | replicas int32 | replicas * id int32)
+// => empty body
+// The throttle limits the bytes per second the new replicas copy at, 0 for no limit.
+func handleReassignPartitions(ctx context.Context, d *decoder) ([]byte, int16, error) {
+	ctx, span := constants.Tracer.Start(ctx, "handleReassignPartitions")
+	defer span.End()
+
+	name, throttle := d.string(), int(d.int64())
+	count := int(d.int32())
+	partitions := map[int][]int{}
+	for i := 0; i < count && d.err == nil; i++ {
+		partition, replicas := int(d.int32()), int(d.int32())
+		ids := []int{}
+		for j := 0; j < replicas && d.err == nil; j++ {
+			ids = append(ids, int(d.int32()))
+		}
+		partitions[partition] = ids
+	}
+	if d.err != nil {
+		return nil, ErrInvalidRequest, d.err
+	}
+	if reassigner == nil {
+		return nil, ErrInvalidRequest, fmt.Errorf("reassignments need a cluster with etcd or the metadata quorum")
+	}
+	if _, err := topic.LoadConfig(ctx, name); err != nil {
+		return nil, ErrUnknownTopicOrPartition, err
+	}
+	if err := reassigner.Reassign(ctx, name, partitions, throttle); err != nil {
+		return nil, ErrInvalidRequest, err
+	}
+	return nil, ErrNone, nil
+}
+
+// ListReassignments: empty
+// => count int32 | count * (topic string | partition int32 | state string | throttle int64
+// | replicas int32 | replicas * id int32 | target int32 | target * id int32 | adding int32 | adding * id int32
+// | removing int32 | removing * id int32 | isr int32 | isr * id int32)
+func handleListReassignments(ctx context.Context, d *decoder) ([]byte, int16, error) {
+	if reassigner == nil {
+		return nil, ErrInvalidRequest, fmt.Errorf("reassignments need a cluster with etcd or the metadata quorum")
+	}
+	progress := reassigner.Reassignments()
+
+	e := encoder{}
+	ids := func(ids []int) {
+		e.putInt32(int32(len(ids)))
+		for _, id := range ids {
+			e.putInt32(int32(id))
+		}
+	}
+	e.putInt32(int32(len(progress)))
+	for _, r := range progress {
+		e.putString(r.Topic)
+		e.putInt32(int32(r.Partition))
+		e.putString(r.State)
+		e.putInt64(int64(r.Throttle))
+		ids(r.Replicas)
+		ids(r.Target)
+		ids(r.Adding)
+		ids(r.Removing)
+		ids(r.InSyncReplicas)
+	}
+	return e.buf, ErrNone, nil
+}
+
+// DecommissionBroker: broker_id int32 | throttle int64
+// => moved int32, the partitions moved off the broker
+func handleDecommissionBroker(ctx context.Context, d *decoder) ([]byte, int16, error) {
+	ctx, span := constants.Tracer.Start(ctx, "handleDecommissionBroker")
+	defer span.End()
+
+	brokerID, throttle := int(d.int32()), int(d.int64())
+	if d.err != nil {
+		return nil, ErrInvalidRequest, d.err
+	}
+	if reassigner == nil {
+		return nil, ErrInvalidRequest, fmt.Errorf("reassignments need a cluster with etcd or the metadata quorum")
+	}
+	moved, err := reassigner.Decommission(ctx, brokerID, throttle)
+	if err != nil {
+		return nil, ErrInvalidRequest, err
+	}
+	e := encoder{}
+	e.putInt32(int32(moved))
+	return e.buf, ErrNone, nil
+}
+
+// LeaderElector moves leadership of partitions back to their preferred
+// replica, of every topic when topic is empty and of all its partitions
+// when there are none. It returns how many partitions are not led by it.
+type LeaderElector func(ctx context.Context, topic string, partitions []int) (int, error)
+
+var leaderElector LeaderElector
+
+// SetLeaderElector enables ElectLeaders requests, used with the orchestrator
+func SetLeaderElector(elector LeaderElector) {
+	leaderElector = elector
+}
+
+// ElectLeaders: topic string, empty for all | count int32 | count * partition int32, zero for all
+// => elections int32, the partitions not led by their preferred replica
+func handleElectLeaders(ctx context.Context, d *decoder) ([]byte, int16, error) {
+	ctx, span := constants.Tracer.Start(ctx, "handleElectLeaders")
+	defer span.End()
+
+	name := d.string()
+	count := int(d.int32())
+	partitions := []int{}
+	for i := 0; i < count && d.err == nil; i++ {
+		partitions = append(partitions, int(d.int32()))
+	}
+	if d.err != nil {
+		return nil, ErrInvalidRequest, d.err
+	}
+	if leaderElector == nil {
+		return nil, ErrInvalidRequest, fmt.Errorf("leader elections need a cluster with etcd or the metadata quorum")
+	}
+	if name != "" {
+		if _, err := topic.LoadConfig(ctx, name); err != nil {
+			return nil, ErrUnknownTopicOrPartition, err
+		}
+	}
+	elections, err := leaderElector(ctx, name, partitions)
+	if err != nil {
+		return nil, ErrInvalidRequest, err
+	}
+	e := encoder{}
+	e.putInt32(int32(elections))
+	return e.buf, ErrNone, nil
+}
+
+// CreateTopic: name string | partitions int32 | replicas int32 | compression string | data_type string
+// => empty body
+func handleCreateTopic(ctx context.Context, d *decoder) ([]byte, int16, error) {
+	_, span := constants.Tracer.Start(ctx, "handleCreateTopic")
+	defer span.End()
+
+	name := d.string()
+	config := topic.Config{
+		NumOfPartition:     int(d.int32()),
+		Replicas:           int(d.int32()),
+		Compression:        d.string(),
+		DataType:           d.string(),
+		PartitionStratergy: "HASH", // Default strategy
+	}
+	if d.err != nil {
+		return nil, ErrInvalidRequest, d.err
+	}
+	if _, err := topic.CreateAtTopic(name, config); err != nil {
+		return nil, ErrInvalidRequest, err
+	}
+	return nil, ErrNone, nil
+}
+
+// DeleteTopic: name string
+// => empty body
+func handleDeleteTopic(ctx context.Context, d *decoder) ([]byte, int16, error) {
+	ctx, span := constants.Tracer.Start(ctx, "handleDeleteTopic")
+	defer span.End()
+
+	name := d.string()
+	if d.err != nil {
+		return nil, ErrInvalidRequest, d.err
+	}
+	if _, err := topic.LoadConfig(ctx, name); err != nil {
+		return nil, ErrUnknownTopicOrPartition, err
+	}
+	if err := topic.DeleteTopic(ctx, name); err != nil {
+		return nil, ErrUnknown, err
+	}
+	return nil, ErrNone, nil
+}
+
+// CreatePartitions: name string | count int32, the new total
+// => empty body
+func handleCreatePartitions(ctx context.Context, d *decoder) ([]byte, int16, error) {
+	ctx, span := constants.Tracer.Start(ctx, "handleCreatePartitions")
+	defer span.End()
+
+	name, count := d.string(), int(d.int32())
+	if d.err != nil {
+		return nil, ErrInvalidRequest, d.err
+	}
+	if _, err := topic.LoadConfig(ctx, name); err != nil {
+		return nil, ErrUnknownTopicOrPartition, err
+	}
+	if err := topic.AddPartitions(ctx, name, count); err != nil {
+		return nil, ErrInvalidRequest, err
+	}
+	return nil, ErrNone, nil
+}
+
+// Flags of a DescribeConfigs entry
+const (
+	ConfigDefault  int16 = 1
+	ConfigReadOnly int16 = 2
+)
+
+// DescribeConfigs: name string
+// => count int32 | (name string | value string | flags int16 | doc string)
+func handleDescribeConfigs(ctx context.Context, d *decoder) ([]byte, int16, error) {
+	ctx, span := constants.Tracer.Start(ctx, "handleDescribeConfigs")
+	defer span.End()
+
+	name := d.string()
+	if d.err != nil {
+		return nil, ErrInvalidRequest, d.err
+	}
+	entries, err := topic.DescribeConfigs(ctx, name)
+	if err != nil {
+		return nil, ErrUnknownTopicOrPartition, err
+	}
+
+	e := &encoder{}
+	e.putInt32(int32(len(entries)))
+	for _, entry := range entries {
+		flags := int16(0)
+		if entry.Default {
+			flags |= ConfigDefault
+		}
+		if entry.ReadOnly {
+			flags |= ConfigReadOnly
+		}
+		e.putString(entry.Name)
+		e.putString(entry.Value)
+		e.putInt16(flags)
+		e.putString(entry.Doc)
+	}
+	return e.buf, ErrNone, nil
+}
+
+// AlterConfigs: name string | count int32 | (key string | value string), an empty value resets the key
+// => empty body
+func handleAlterConfigs(ctx context.Context, d *decoder) ([]byte, int16, error) {
+	ctx, span := constants.Tracer.Start(ctx, "handleAlterConfigs")
+	defer span.End()
+
+	name := d.string()
+	count := int(d.int32())
+	changes := make(map[string]string)
+	for i := 0; i < count && d.err == nil; i++ {
+		key := d.string()
+		changes[key] = d.string()
+	}
+	if d.err != nil {
+		return nil, ErrInvalidRequest, d.err
+	}
+	if _, err := topic.LoadConfig(ctx, name); err != nil {
+		return nil, ErrUnknownTopicOrPartition, err
+	}
+	if _, err := topic.AlterConfigs(ctx, name, changes); err != nil {
+		return nil, ErrInvalidRequest, err
+	}
+	return nil, ErrNone, nil
+}
+
+// ListOffsets: topic string | partition int32 | timestamp int64 (-1 latest, -2 earliest,
+// otherwise unix nanoseconds)
+// => offset int64, the first record at or after timestamp or the latest offset when there is none
+func handleListOffsets(ctx context.Context, d *decoder) ([]byte, int16, error) {
+	topicName, partition, timestamp := d.string(), int(d.int32()), d.int64()
+	if d.err != nil {
+		return nil, ErrInvalidRequest, d.err
+	}
+
+	var (
+		offset int
+		err    error
+	)
+	switch timestamp {
+	case LatestTimestamp:
+		offset, err = consumer.LatestOffset(ctx, topicName, partition)
+	case EarliestTimestamp:
+		offset, err = consumer.EarliestOffset(ctx, topicName, partition)
+	default:
+		if timestamp < 0 {
+			return nil, ErrInvalidRequest, fmt.Errorf("timestamp must be -1 (latest), -2 (earliest) or a unix timestamp")
+		}
+		var found bool
+		offset, _, found, err = consumer.OffsetForTimestamp(ctx, topicName, partition, timestamp)
+		if err == nil && !found {
+			offset, err = consumer.LatestOffset(ctx, topicName, partition)
+		}
+	}
+	if err != nil {
+		return nil, ErrUnknownTopicOrPartition, err
+	}
+
+	e := encoder{}
+	e.putInt64(int64(offset))
+	return e.buf, ErrNone, nil
+}
+
+// OffsetCommit: group string | generation int32 | member string | topic string | partition int32 | offset int64
+// => empty body
+// Members commit with their generation, generation -1 and an empty member
+// commit without membership, for instance to reset an idle group.
+func handleOffsetCommit(ctx context.Context, d *decoder) ([]byte, int16, error) {
+	groupID, generation, memberID := d.string(), int(d.int32()), d.string()
+	topicName, partition, offset := d.string(), int(d.int32()), int(d.int64())
+	if d.err != nil {
+		return nil, ErrInvalidRequest, d.err
+	}
+	if err := consumer.ValidateGroupID(groupID); err != nil {
+		return nil, ErrInvalidRequest, err
+	}
+	if err := consumer.ValidateGeneration(groupID, generation, memberID); err != nil {
+		return nil, groupErrorCode(err), err
+	}
+	if err := consumer.CommitOffset(ctx, groupID, topicName, partition, offset); err != nil {
+		return nil, ErrUnknown, err
+	}
+	return nil, ErrNone, nil
+}
+
+// OffsetFetch: group string | topic string | partition int32
+// => offset int64, -1 when the group has not committed anything
+func handleOffsetFetch(ctx context.Context, d *decoder) ([]byte, int16, error) {
+	groupID, topicName, partition := d.string(), d.string(), int(d.int32())
+	if d.err != nil {
+		return nil, ErrInvalidRequest, d.err
+	}
+	if err := consumer.ValidateGroupID(groupID); err != nil {
+		return nil, ErrInvalidRequest, err
+	}
+
+	offset, exists, err := consumer.CommittedOffset(ctx, groupID, topicName, partition)
+	if err != nil {
+		return nil, ErrUnknown, err
+	}
+	if !exists {
+		offset = -1
+	}
+
+	e := encoder{}
+	e.putInt64(int64(offset))
+	return e.buf, ErrNone, nil
+}
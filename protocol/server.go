@@ -0,0 +1,169 @@
+// Package protocol serves FranzMQ over a framed binary TCP protocol, a
+// cheaper alternative to the HTTP/JSON endpoints for high volume clients.
+//
+// Every request is framed as
+//
+//	size int32 | api_key int16 | api_version int16 | correlation_id int32 | body
+//
+// and answered with
+//
+//	size int32 | correlation_id int32 | error_code int16 | body
+//
+// where size counts the bytes following it. Clients may pipeline requests on
+// one connection, responses are written back in request order.
+package protocol
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"sync"
+)
+
+const (
+	maxFrameSize = 64 * 1024 * 1024
+	maxInFlight  = 100 // Pipelined requests per connection before reads block
+)
+
+type Server struct {
+	mu       sync.Mutex
+	listener net.Listener
+	conns    map[net.Conn]struct{}
+}
+
+func NewServer() *Server {
+	return &Server{conns: make(map[net.Conn]struct{})}
+}
+
+// ListenAndServe accepts binary protocol connections on addr
+func (s *Server) ListenAndServe(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(listener)
+}
+
+// Serve accepts connections on listener until Close is called
+func (s *Server) Serve(listener net.Listener) error {
+	s.mu.Lock()
+	s.listener = listener
+	s.mu.Unlock()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		s.mu.Lock()
+		s.conns[conn] = struct{}{}
+		s.mu.Unlock()
+		go s.handleConn(conn)
+	}
+}
+
+// Close stops accepting and drops open connections
+func (s *Server) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	if s.listener == nil {
+		return nil
+	}
+	return s.listener.Close()
+}
+
+type request struct {
+	apiKey        int16
+	apiVersion    int16
+	correlationID int32
+	body          []byte
+}
+
+// A reader goroutine decodes frames ahead while requests are handled one at
+// a time, so pipelined produces keep their order and responses go back in
+// the order requests arrived
+func (s *Server) handleConn(conn net.Conn) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer func() {
+		cancel()
+		conn.Close()
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+	}()
+
+	requests := make(chan request, maxInFlight)
+	go func() {
+		defer close(requests)
+		reader := bufio.NewReader(conn)
+		for {
+			req, err := readRequest(reader)
+			if err != nil {
+				if err != io.EOF && !errors.Is(err, net.ErrClosed) {
+					log.Println("Error reading binary protocol request:", err)
+				}
+				return
+			}
+			select {
+			case requests <- req:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	writer := bufio.NewWriter(conn)
+	for req := range requests {
+		if _, err := writer.Write(handle(ctx, req)); err != nil {
+			return
+		}
+		// Only flush when nothing else is queued, so pipelined responses share a write
+		if len(requests) == 0 {
+			if err := writer.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func readRequest(reader *bufio.Reader) (request, error) {
+	var sizeBuf [4]byte
+	if _, err := io.ReadFull(reader, sizeBuf[:]); err != nil {
+		return request{}, err
+	}
+	size := int(binary.BigEndian.Uint32(sizeBuf[:]))
+	if size < 8 || size > maxFrameSize {
+		return request{}, errors.New("invalid frame size")
+	}
+
+	frame := make([]byte, size)
+	if _, err := io.ReadFull(reader, frame); err != nil {
+		return request{}, err
+	}
+	return request{
+		apiKey:        int16(binary.BigEndian.Uint16(frame[0:2])),
+		apiVersion:    int16(binary.BigEndian.Uint16(frame[2:4])),
+		correlationID: int32(binary.BigEndian.Uint32(frame[4:8])),
+		body:          frame[8:],
+	}, nil
+}
+
+// Frame a response body
+func response(correlationID int32, code int16, body []byte) []byte {
+	e := encoder{buf: make([]byte, 0, 10+len(body))}
+	e.putInt32(int32(6 + len(body)))
+	e.putInt32(correlationID)
+	e.putInt16(code)
+	e.buf = append(e.buf, body...)
+	return e.buf
+}
@@ -0,0 +1,273 @@
+package protocol
+
+import (
+	"FranzMQ/constants"
+	"FranzMQ/producer"
+	"FranzMQ/topic"
+	"bufio"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"testing"
+)
+
+func init() {
+	go producer.GlobalWriterThread(producer.GlobalLogWriterQueue)
+	go producer.GlobalWriterThread(producer.GlobalIndexWriterQueue)
+}
+
+func startServer(t *testing.T) net.Conn {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen failed: %v", err)
+	}
+	server := NewServer()
+	go server.Serve(listener)
+	t.Cleanup(func() { server.Close() })
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func writeRequest(t *testing.T, conn net.Conn, apiKey int16, correlationID int32, body []byte) {
+	e := encoder{}
+	e.putInt32(int32(8 + len(body)))
+	e.putInt16(apiKey)
+	e.putInt16(0)
+	e.putInt32(correlationID)
+	e.buf = append(e.buf, body...)
+	if _, err := conn.Write(e.buf); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+}
+
+func readResponse(t *testing.T, reader *bufio.Reader) (int32, int16, *decoder) {
+	var sizeBuf [4]byte
+	if _, err := io.ReadFull(reader, sizeBuf[:]); err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	frame := make([]byte, binary.BigEndian.Uint32(sizeBuf[:]))
+	if _, err := io.ReadFull(reader, frame); err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	d := &decoder{buf: frame}
+	return d.int32(), d.int16(), d
+}
+
+func TestServer_ProduceAndFetch(t *testing.T) {
+	topicName := "binary_protocol_test"
+	os.RemoveAll(constants.FilesDir + topicName)
+	if _, err := topic.CreateAtTopic(topicName, topic.Config{NumOfPartition: 1}); err != nil {
+		t.Fatalf("create topic failed: %v", err)
+	}
+	defer os.RemoveAll(constants.FilesDir + topicName)
+
+	conn := startServer(t)
+	reader := bufio.NewReader(conn)
+
+	// Pipeline two produces before reading anything back
+	for i, value := range []string{`{"n":1}`, "not json"} {
+		e := encoder{}
+		e.putString(topicName)
+		e.putString("key")
+		e.putBytes([]byte(value))
+		writeRequest(t, conn, ApiProduce, int32(i+1), e.buf)
+	}
+	for i := 0; i < 2; i++ {
+		correlationID, code, d := readResponse(t, reader)
+		if correlationID != int32(i+1) || code != ErrNone {
+			t.Fatalf("Expected ok response %d but got %d with code %d", i+1, correlationID, code)
+		}
+		if partition, offset := d.int32(), d.int64(); partition != 0 || offset != int64(i+1) {
+			t.Errorf("Unexpected produce result partition %d offset %d", partition, offset)
+		}
+	}
+
+	e := encoder{}
+	e.putString(topicName)
+	e.putInt32(0)
+	e.putInt64(0)
+	e.putInt32(1024)
+	e.putInt32(1)
+	e.putInt32(1000)
+	writeRequest(t, conn, ApiFetch, 3, e.buf)
+
+	_, code, d := readResponse(t, reader)
+	if code != ErrNone {
+		t.Fatalf("Expected fetch to succeed but got code %d: %s", code, d.string())
+	}
+	nextOffset, count := d.int64(), d.int32()
+	if nextOffset != 3 || count != 2 {
+		t.Fatalf("Expected 2 records and next offset 3 but got %d and %d", count, nextOffset)
+	}
+	d.int64()
+	d.int64()
+	if value := string(d.bytes()); value != `{"n":1}` {
+		t.Errorf("Unexpected first value %s", value)
+	}
+	d.int64()
+	d.int64()
+	if value := string(d.bytes()); value != `"not json"` {
+		t.Errorf("Unexpected second value %s", value)
+	}
+}
+
+func TestServer_ProduceBatchAppendsPartitionsInOneStep(t *testing.T) {
+	topicName := "binary_batch_test"
+	os.RemoveAll(constants.FilesDir + topicName)
+	if _, err := topic.CreateAtTopic(topicName, topic.Config{NumOfPartition: 2, MaxMessageBytes: 64}); err != nil {
+		t.Fatalf("create topic failed: %v", err)
+	}
+	defer os.RemoveAll(constants.FilesDir + topicName)
+
+	conn := startServer(t)
+	reader := bufio.NewReader(conn)
+	produceBatch := func(correlationID int32, partition int32, keys []string, values []string) (int16, *decoder) {
+		t.Helper()
+		records := encoder{}
+		records.putInt32(int32(len(values)))
+		for i, value := range values {
+			records.putString(keys[i])
+			records.putBytes([]byte(value))
+		}
+		e := encoder{}
+		e.putString(topicName)
+		e.putInt32(partition)
+		e.putInt16(0)
+		e.putBytes(records.buf)
+		writeRequest(t, conn, ApiProduceBatch, correlationID, e.buf)
+		_, code, d := readResponse(t, reader)
+		return code, d
+	}
+
+	// Keyed records go to their partitions, offsets follow each other there
+	keys := []string{"a", "b", "a", "b", "a"}
+	code, d := produceBatch(1, -1, keys, []string{"1", "2", "3", "4", "5"})
+	if code != ErrNone {
+		t.Fatalf("Expected the batch to succeed but got code %d: %s", code, d.string())
+	}
+	if count := d.int32(); count != 5 {
+		t.Fatalf("Expected 5 results but got %d", count)
+	}
+	offsets := map[int32][]int64{}
+	for range keys {
+		partition, offset := d.int32(), d.int64()
+		d.int64()
+		offsets[partition] = append(offsets[partition], offset)
+	}
+	for partition, got := range offsets {
+		for i := range got {
+			if got[i] != got[0]+int64(i) {
+				t.Errorf("Expected contiguous offsets in partition %d but got %v", partition, got)
+			}
+		}
+	}
+
+	// A record over max.message.bytes fails the batch before anything is appended
+	before := producer.NextOffset(context.Background(), topicName, 0)
+	code, _ = produceBatch(2, 0, []string{"", "", ""}, []string{"1", strings.Repeat("x", 100), "3"})
+	if code == ErrNone {
+		t.Fatal("Expected the batch with an oversized record to fail")
+	}
+	if after := producer.NextOffset(context.Background(), topicName, 0); after != before {
+		t.Errorf("Expected nothing appended but the next offset moved from %d to %d", before, after)
+	}
+}
+
+func TestServer_ListOffsetsAndCommit(t *testing.T) {
+	topicName := "binary_offsets_test"
+	os.RemoveAll(constants.FilesDir + topicName)
+	if _, err := topic.CreateAtTopic(topicName, topic.Config{NumOfPartition: 1}); err != nil {
+		t.Fatalf("create topic failed: %v", err)
+	}
+	defer os.RemoveAll(constants.FilesDir + topicName)
+	defer os.RemoveAll(constants.GroupsDir)
+
+	conn := startServer(t)
+	reader := bufio.NewReader(conn)
+
+	e := encoder{}
+	e.putString(topicName)
+	e.putInt32(0)
+	e.putInt64(LatestTimestamp)
+	writeRequest(t, conn, ApiListOffsets, 1, e.buf)
+	if _, code, d := readResponse(t, reader); code != ErrNone || d.int64() != 1 {
+		t.Errorf("Expected latest offset 1 on an empty partition")
+	}
+
+	e = encoder{}
+	e.putString("group-a")
+	e.putString(topicName)
+	e.putInt32(0)
+	writeRequest(t, conn, ApiOffsetFetch, 2, e.buf)
+	if _, code, d := readResponse(t, reader); code != ErrNone || d.int64() != -1 {
+		t.Errorf("Expected -1 before anything was committed")
+	}
+
+	e = encoder{}
+	e.putString("group-a")
+	e.putInt32(-1)
+	e.putString("")
+	e.putString(topicName)
+	e.putInt32(0)
+	e.putInt64(42)
+	writeRequest(t, conn, ApiOffsetCommit, 3, e.buf)
+	if _, code, _ := readResponse(t, reader); code != ErrNone {
+		t.Fatalf("Expected commit to succeed but got code %d", code)
+	}
+
+	e = encoder{}
+	e.putString("group-a")
+	e.putString(topicName)
+	e.putInt32(0)
+	writeRequest(t, conn, ApiOffsetFetch, 4, e.buf)
+	if _, code, d := readResponse(t, reader); code != ErrNone || d.int64() != 42 {
+		t.Errorf("Expected committed offset 42")
+	}
+
+	// Group ids name files, ones that would escape the groups directory are refused
+	e = encoder{}
+	e.putString("../topics/" + topicName + "/escaped")
+	e.putInt32(-1)
+	e.putString("")
+	e.putString(topicName)
+	e.putInt32(0)
+	e.putInt64(7)
+	writeRequest(t, conn, ApiOffsetCommit, 5, e.buf)
+	if _, code, _ := readResponse(t, reader); code != ErrInvalidRequest {
+		t.Errorf("Expected an invalid group id to be refused but got code %d", code)
+	}
+	if _, err := os.Stat(constants.FilesDir + topicName + "/escaped.json"); err == nil {
+		t.Errorf("Expected no offsets file outside the groups directory")
+	}
+
+	// Commits of a member are fenced by its generation
+	e = encoder{}
+	e.putString("group-a")
+	e.putInt32(3)
+	e.putString("stale-member")
+	e.putString(topicName)
+	e.putInt32(0)
+	e.putInt64(7)
+	writeRequest(t, conn, ApiOffsetCommit, 6, e.buf)
+	if _, code, _ := readResponse(t, reader); code != ErrUnknownMemberID {
+		t.Errorf("Expected a commit from an unknown member to be fenced but got code %d", code)
+	}
+}
+
+func TestServer_UnknownApiKey(t *testing.T) {
+	conn := startServer(t)
+	writeRequest(t, conn, 99, 7, nil)
+
+	correlationID, code, _ := readResponse(t, bufio.NewReader(conn))
+	if correlationID != 7 || code != ErrUnsupportedVersion {
+		t.Errorf("Expected unsupported error for correlation 7 but got %d with code %d", correlationID, code)
+	}
+}
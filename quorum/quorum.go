@@ -0,0 +1,654 @@
+// Package quorum keeps the cluster metadata in a Raft log replicated across a
+// fixed set of brokers, the voters, so a cluster runs without etcd. Every
+// voter applies the log to the same state: keys with revisions, leases that
+// end when their owner stops renewing them, and the events watches follow.
+// Writes are proposed to the log and wait until they were applied, reads
+// wait until the voter caught up with the leader. Voters talk over the
+// binary protocol. The leader ends the leases not renewed within their TTL.
+//
+// A Node is a store.Store, the orchestrator runs on it the same way it runs
+// on etcd.
+package quorum
+
+import (
+	"FranzMQ/client"
+	"FranzMQ/orchestrator/store"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"go.etcd.io/etcd/raft/v3"
+	"go.etcd.io/etcd/raft/v3/raftpb"
+	"go.etcd.io/etcd/server/v3/etcdserver/api/snap"
+	"go.etcd.io/etcd/server/v3/wal"
+	"go.etcd.io/etcd/server/v3/wal/walpb"
+	"go.uber.org/zap"
+)
+
+const (
+	electionTicks  = 10    // Ticks without a leader before a voter campaigns
+	snapshotEvery  = 1000  // Applied entries between snapshots
+	keptEntries    = 100   // Entries kept after a snapshot for voters a little behind
+	historySize    = 10000 // Events kept for watches starting in the past
+	watchBuffer    = 256   // Responses a watcher may fall behind before it is dropped
+	sendQueue      = 1024  // Messages waiting for a voter before they are dropped
+	requestTimeout = 5 * time.Second
+)
+
+// ErrCompacted fails watches from a revision whose events are gone
+var ErrCompacted = errors.New("revision compacted")
+
+var errLeaseExpired = errors.New("lease expired")
+
+type Settings struct {
+	NodeID       int
+	Voters       map[int]string // Binary listener by node id, this one included
+	Dir          string         // WAL and snapshots, empty keeps the log in memory only
+	TickInterval time.Duration
+	// Send passes a message to another voter, the binary protocol when nil
+	Send func(ctx context.Context, to int, message []byte) error
+}
+
+// raftLogger leaves out the Raft library's info messages, there are many
+type raftLogger struct {
+	*raft.DefaultLogger
+}
+
+func (raftLogger) Info(...interface{})          {}
+func (raftLogger) Infof(string, ...interface{}) {}
+
+// Node is a voter of the quorum
+type Node struct {
+	settings    Settings
+	raft        raft.Node
+	storage     *raft.MemoryStorage
+	wal         *wal.WAL
+	snapshotter *snap.Snapshotter
+	peers       map[uint64]chan raftpb.Message
+	stop        chan struct{}
+	stopped     chan struct{}
+
+	mu            sync.Mutex
+	state         *state
+	applied       uint64 // Index of the last entry applied
+	snapshotIndex uint64
+	confState     raftpb.ConfState
+	leader        bool
+	history       []event
+	compacted     int64 // History lacks the events up to this revision
+	watchers      map[*watcher]bool
+	waiters       map[uint64]chan result
+	reads         map[string]chan uint64 // Read index requests waiting for their index
+	renewed       map[int64]time.Time    // When each lease was last renewed, tracked by the leader
+	revoking      map[int64]time.Time    // When the leader last proposed to end each lease
+	changed       chan struct{}          // Closed whenever an entry was applied
+}
+
+type watcher struct {
+	prefix string
+	ch     chan store.WatchResponse
+}
+
+// Start runs this voter, replaying its WAL if it has one
+func Start(s Settings) (*Node, error) {
+	if _, listed := s.Voters[s.NodeID]; !listed {
+		return nil, fmt.Errorf("node %d is not a voter", s.NodeID)
+	}
+	if s.TickInterval <= 0 {
+		s.TickInterval = 100 * time.Millisecond
+	}
+	n := &Node{
+		settings: s,
+		storage:  raft.NewMemoryStorage(),
+		peers:    map[uint64]chan raftpb.Message{},
+		stop:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+		state:    newState(),
+		watchers: map[*watcher]bool{},
+		waiters:  map[uint64]chan result{},
+		reads:    map[string]chan uint64{},
+		renewed:  map[int64]time.Time{},
+		revoking: map[int64]time.Time{},
+		changed:  make(chan struct{}),
+	}
+	if n.settings.Send == nil {
+		n.settings.Send = n.sendBinary()
+	}
+
+	restart := false
+	if s.Dir != "" {
+		var err error
+		if restart, err = n.openLog(); err != nil {
+			return nil, err
+		}
+	}
+	c := &raft.Config{
+		ID:                        uint64(s.NodeID),
+		ElectionTick:              electionTicks,
+		HeartbeatTick:             1,
+		Storage:                   n.storage,
+		MaxSizePerMsg:             1024 * 1024,
+		MaxInflightMsgs:           256,
+		MaxUncommittedEntriesSize: 1 << 30,
+		CheckQuorum:               true,
+		PreVote:                   true,
+		Logger:                    raftLogger{&raft.DefaultLogger{Logger: log.New(os.Stderr, "raft ", log.LstdFlags)}},
+	}
+	ids := []int{}
+	for id := range s.Voters {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	if restart {
+		n.raft = raft.RestartNode(c)
+	} else {
+		peers := []raft.Peer{}
+		for _, id := range ids {
+			peers = append(peers, raft.Peer{ID: uint64(id)})
+		}
+		n.raft = raft.StartNode(c, peers)
+	}
+	for _, id := range ids {
+		if id != s.NodeID {
+			queue := make(chan raftpb.Message, sendQueue)
+			n.peers[uint64(id)] = queue
+			go n.sendLoop(id, queue)
+		}
+	}
+	go n.run()
+	go n.expireLeases()
+	log.Println("Node", s.NodeID, "runs the metadata quorum with voters", ids)
+	return n, nil
+}
+
+// Stop halts this voter
+func (n *Node) Stop() {
+	select {
+	case <-n.stop:
+		return
+	default:
+	}
+	close(n.stop)
+	<-n.stopped
+	n.raft.Stop()
+	if n.wal != nil {
+		n.wal.Close()
+	}
+}
+
+// Step takes a message another voter sent
+func (n *Node) Step(ctx context.Context, message []byte) error {
+	var m raftpb.Message
+	if err := m.Unmarshal(message); err != nil {
+		return fmt.Errorf("invalid raft message: %w", err)
+	}
+	return n.raft.Step(ctx, m)
+}
+
+// Restore the state from the newest snapshot and the log from the WAL,
+// true when there was one
+func (n *Node) openLog() (bool, error) {
+	lg := zap.NewNop()
+	walDir, snapDir := filepath.Join(n.settings.Dir, "wal"), filepath.Join(n.settings.Dir, "snap")
+	if err := os.MkdirAll(snapDir, 0755); err != nil {
+		return false, fmt.Errorf("error creating snapshot directory: %w", err)
+	}
+	n.snapshotter = snap.New(lg, snapDir)
+
+	if !wal.Exist(walDir) {
+		w, err := wal.Create(lg, walDir, nil)
+		if err != nil {
+			return false, fmt.Errorf("error creating WAL: %w", err)
+		}
+		n.wal = w
+		return false, nil
+	}
+
+	walSnaps, err := wal.ValidSnapshotEntries(lg, walDir)
+	if err != nil {
+		return false, fmt.Errorf("error reading WAL: %w", err)
+	}
+	walSnap := walpb.Snapshot{}
+	snapshot, err := n.snapshotter.LoadNewestAvailable(walSnaps)
+	if err != nil && !errors.Is(err, snap.ErrNoSnapshot) {
+		return false, fmt.Errorf("error loading snapshot: %w", err)
+	}
+	if snapshot != nil {
+		walSnap = walpb.Snapshot{Index: snapshot.Metadata.Index, Term: snapshot.Metadata.Term, ConfState: &snapshot.Metadata.ConfState}
+		if err := n.storage.ApplySnapshot(*snapshot); err != nil {
+			return false, err
+		}
+		if err := n.restore(*snapshot); err != nil {
+			return false, err
+		}
+	}
+	w, err := wal.Open(lg, walDir, walSnap)
+	if err != nil {
+		return false, fmt.Errorf("error opening WAL: %w", err)
+	}
+	_, hardState, entries, err := w.ReadAll()
+	if err != nil {
+		return false, fmt.Errorf("error reading WAL: %w", err)
+	}
+	n.wal = w
+	n.storage.SetHardState(hardState)
+	n.storage.Append(entries)
+	return true, nil
+}
+
+// Drive the Raft node: persist, send, then apply what it hands out
+func (n *Node) run() {
+	defer close(n.stopped)
+	ticker := time.NewTicker(n.settings.TickInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			n.raft.Tick()
+		case rd := <-n.raft.Ready():
+			if n.wal != nil {
+				if !raft.IsEmptySnap(rd.Snapshot) {
+					if err := n.saveSnapshot(rd.Snapshot); err != nil {
+						log.Fatalf("error saving metadata snapshot: %v", err)
+					}
+				}
+				if err := n.wal.Save(rd.HardState, rd.Entries); err != nil {
+					log.Fatalf("error writing metadata WAL: %v", err)
+				}
+			}
+			if !raft.IsEmptySnap(rd.Snapshot) {
+				n.storage.ApplySnapshot(rd.Snapshot)
+				if err := n.restore(rd.Snapshot); err != nil {
+					log.Fatalf("error restoring metadata snapshot: %v", err)
+				}
+			}
+			n.storage.Append(rd.Entries)
+			n.send(rd.Messages)
+			n.apply(rd.CommittedEntries)
+			n.readIndexes(rd.ReadStates)
+			if rd.SoftState != nil {
+				n.setLeader(rd.SoftState.RaftState == raft.StateLeader)
+			}
+			n.maybeSnapshot()
+			n.raft.Advance()
+		case <-n.stop:
+			return
+		}
+	}
+}
+
+func (n *Node) send(messages []raftpb.Message) {
+	for _, m := range messages {
+		select {
+		case n.peers[m.To] <- m:
+		default:
+			n.raft.ReportUnreachable(m.To)
+			if m.Type == raftpb.MsgSnap {
+				n.raft.ReportSnapshot(m.To, raft.SnapshotFailure)
+			}
+		}
+	}
+}
+
+// Send the messages to one voter in order
+func (n *Node) sendLoop(id int, queue chan raftpb.Message) {
+	for {
+		select {
+		case m := <-queue:
+			data, err := m.Marshal()
+			if err != nil {
+				continue
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+			err = n.settings.Send(ctx, id, data)
+			cancel()
+			if err != nil {
+				n.raft.ReportUnreachable(m.To)
+			}
+			if m.Type == raftpb.MsgSnap {
+				status := raft.SnapshotFinish
+				if err != nil {
+					status = raft.SnapshotFailure
+				}
+				n.raft.ReportSnapshot(m.To, status)
+			}
+		case <-n.stop:
+			return
+		}
+	}
+}
+
+// A connection to each voter, used one message at a time by its send loop
+func (n *Node) sendBinary() func(ctx context.Context, to int, message []byte) error {
+	clients := map[int]*client.Client{}
+	for id, addr := range n.settings.Voters {
+		clients[id] = client.NewClient(addr)
+	}
+	return func(ctx context.Context, to int, message []byte) error {
+		return clients[to].RaftMessage(ctx, message)
+	}
+}
+
+func (n *Node) apply(entries []raftpb.Entry) {
+	for _, e := range entries {
+		switch e.Type {
+		case raftpb.EntryNormal:
+			if len(e.Data) > 0 {
+				var cmd command
+				if err := json.Unmarshal(e.Data, &cmd); err != nil {
+					log.Println("Error decoding metadata command at index", e.Index, err)
+				} else {
+					n.applyCommand(cmd)
+				}
+			}
+		case raftpb.EntryConfChange:
+			var cc raftpb.ConfChange
+			if err := cc.Unmarshal(e.Data); err == nil {
+				confState := n.raft.ApplyConfChange(cc)
+				n.mu.Lock()
+				n.confState = *confState
+				n.mu.Unlock()
+			}
+		}
+		n.mu.Lock()
+		n.applied = e.Index
+		n.signal()
+		n.mu.Unlock()
+	}
+}
+
+func (n *Node) applyCommand(cmd command) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	res, events := n.state.apply(cmd)
+	switch {
+	case res.Err != nil:
+	case cmd.Op == opGrant || cmd.Op == opKeepAlive:
+		n.renewed[cmd.Lease] = time.Now()
+	case cmd.Op == opRevoke:
+		delete(n.renewed, cmd.Lease)
+		delete(n.revoking, cmd.Lease)
+	}
+	if waiter, found := n.waiters[cmd.ID]; found {
+		waiter <- res
+		delete(n.waiters, cmd.ID)
+	}
+	if len(events) == 0 {
+		return
+	}
+
+	n.history = append(n.history, events...)
+	if len(n.history) > historySize {
+		drop := len(n.history) - historySize
+		n.compacted = n.history[drop-1].Revision
+		for drop < len(n.history) && n.history[drop].Revision == n.compacted {
+			drop++
+		}
+		n.history = append([]event{}, n.history[drop:]...)
+	}
+	for w := range n.watchers {
+		if resp, matched := watchResponse(w.prefix, events); matched {
+			select {
+			case w.ch <- resp:
+			default:
+				n.dropWatcher(w) // Too far behind, it loads everything again
+			}
+		}
+	}
+}
+
+// The events below prefix
+func watchResponse(prefix string, events []event) (store.WatchResponse, bool) {
+	resp := store.WatchResponse{}
+	for _, e := range events {
+		if len(e.Key) >= len(prefix) && e.Key[:len(prefix)] == prefix {
+			resp.Events = append(resp.Events, e.Event)
+			resp.Revision = e.Revision
+		}
+	}
+	return resp, len(resp.Events) > 0
+}
+
+// Must be called with mu held
+func (n *Node) dropWatcher(w *watcher) {
+	if n.watchers[w] {
+		delete(n.watchers, w)
+		close(w.ch)
+	}
+}
+
+// Wake everyone waiting on an applied entry. Must be called with mu held.
+func (n *Node) signal() {
+	close(n.changed)
+	n.changed = make(chan struct{})
+}
+
+// A new leader gives every lease a full TTL, it cannot know when they were
+// renewed last
+func (n *Node) setLeader(leader bool) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if leader && !n.leader {
+		now := time.Now()
+		for lease := range n.state.Leases {
+			n.renewed[lease] = now
+		}
+		log.Println("Node", n.settings.NodeID, "leads the metadata quorum")
+	}
+	n.leader = leader
+}
+
+// The leader ends the leases not renewed within their TTL
+func (n *Node) expireLeases() {
+	ticker := time.NewTicker(n.settings.TickInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-n.stop:
+			return
+		}
+		now := time.Now()
+		expired := []int64{}
+		n.mu.Lock()
+		if n.leader {
+			for lease, ttl := range n.state.Leases {
+				renewed, known := n.renewed[lease]
+				if !known {
+					n.renewed[lease] = now
+				} else if now.Sub(renewed) > ttl && now.Sub(n.revoking[lease]) > time.Second {
+					n.revoking[lease] = now
+					expired = append(expired, lease)
+				}
+			}
+		}
+		n.mu.Unlock()
+		for _, lease := range expired {
+			go func(lease int64) {
+				ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+				defer cancel()
+				if _, err := n.propose(ctx, command{Op: opRevoke, Lease: lease}); err != nil {
+					log.Println("Error ending expired lease:", err)
+				}
+			}(lease)
+		}
+	}
+}
+
+// Propose a command and wait until it was applied here
+func (n *Node) propose(ctx context.Context, cmd command) (result, error) {
+	if _, hasDeadline := ctx.Deadline(); !hasDeadline {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, requestTimeout)
+		defer cancel()
+	}
+	cmd.ID = rand.Uint64()
+	data, err := json.Marshal(cmd)
+	if err != nil {
+		return result{}, err
+	}
+	waiter := make(chan result, 1)
+	n.mu.Lock()
+	n.waiters[cmd.ID] = waiter
+	n.mu.Unlock()
+	defer func() {
+		n.mu.Lock()
+		delete(n.waiters, cmd.ID)
+		n.mu.Unlock()
+	}()
+
+	// A proposal sent to a leader that just went away is lost, it is proposed
+	// again after an election timeout
+	retry := time.NewTicker(electionTicks * n.settings.TickInterval)
+	defer retry.Stop()
+	for {
+		if err := n.raft.Propose(ctx, data); err != nil && !errors.Is(err, raft.ErrProposalDropped) {
+			return result{}, fmt.Errorf("error proposing to the metadata quorum: %w", err)
+		}
+		select {
+		case res := <-waiter:
+			return res, res.Err
+		case <-retry.C:
+		case <-ctx.Done():
+			return result{}, fmt.Errorf("metadata quorum did not commit: %w", ctx.Err())
+		}
+	}
+}
+
+// Wait until this voter applied everything the leader committed when called
+func (n *Node) sync(ctx context.Context) error {
+	if _, hasDeadline := ctx.Deadline(); !hasDeadline {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, requestTimeout)
+		defer cancel()
+	}
+	id := make([]byte, 8)
+	binary.BigEndian.PutUint64(id, rand.Uint64())
+	ready := make(chan uint64, 1)
+	n.mu.Lock()
+	n.reads[string(id)] = ready
+	n.mu.Unlock()
+	defer func() {
+		n.mu.Lock()
+		delete(n.reads, string(id))
+		n.mu.Unlock()
+	}()
+
+	// Dropped without a leader, ask again until there is one
+	var index uint64
+	for asked := false; !asked; {
+		if err := n.raft.ReadIndex(ctx, id); err != nil {
+			return err
+		}
+		select {
+		case index = <-ready:
+			asked = true
+		case <-time.After(n.settings.TickInterval * electionTicks):
+		case <-ctx.Done():
+			return fmt.Errorf("metadata quorum has no leader: %w", ctx.Err())
+		}
+	}
+	for {
+		n.mu.Lock()
+		applied, changed := n.applied, n.changed
+		n.mu.Unlock()
+		if applied >= index {
+			return nil
+		}
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (n *Node) readIndexes(states []raft.ReadState) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for _, rs := range states {
+		if ready, found := n.reads[string(rs.RequestCtx)]; found {
+			select {
+			case ready <- rs.Index:
+			default:
+			}
+		}
+	}
+}
+
+// Snapshot the state every snapshotEvery entries and drop the log before it
+func (n *Node) maybeSnapshot() {
+	if n.wal == nil {
+		return
+	}
+	n.mu.Lock()
+	if n.applied-n.snapshotIndex < snapshotEvery {
+		n.mu.Unlock()
+		return
+	}
+	data, err := json.Marshal(n.state)
+	applied, confState := n.applied, n.confState
+	n.mu.Unlock()
+	if err != nil {
+		log.Println("Error encoding metadata snapshot:", err)
+		return
+	}
+
+	snapshot, err := n.storage.CreateSnapshot(applied, &confState, data)
+	if err != nil {
+		log.Println("Error creating metadata snapshot:", err)
+		return
+	}
+	if err := n.saveSnapshot(snapshot); err != nil {
+		log.Println("Error saving metadata snapshot:", err)
+		return
+	}
+	if applied > keptEntries {
+		if err := n.storage.Compact(applied - keptEntries); err != nil && !errors.Is(err, raft.ErrCompacted) {
+			log.Println("Error compacting metadata log:", err)
+		}
+	}
+	n.mu.Lock()
+	n.snapshotIndex = applied
+	n.mu.Unlock()
+}
+
+func (n *Node) saveSnapshot(snapshot raftpb.Snapshot) error {
+	walSnap := walpb.Snapshot{Index: snapshot.Metadata.Index, Term: snapshot.Metadata.Term, ConfState: &snapshot.Metadata.ConfState}
+	if err := n.snapshotter.SaveSnap(snapshot); err != nil {
+		return err
+	}
+	if err := n.wal.SaveSnapshot(walSnap); err != nil {
+		return err
+	}
+	return n.wal.ReleaseLockTo(snapshot.Metadata.Index)
+}
+
+// Replace the state with a snapshot. Watchers may have missed events, they
+// load everything again.
+func (n *Node) restore(snapshot raftpb.Snapshot) error {
+	s := newState()
+	if err := json.Unmarshal(snapshot.Data, s); err != nil {
+		return fmt.Errorf("invalid metadata snapshot: %w", err)
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.state = s
+	n.applied, n.snapshotIndex = snapshot.Metadata.Index, snapshot.Metadata.Index
+	n.confState = snapshot.Metadata.ConfState
+	n.history, n.compacted = nil, s.Revision
+	for w := range n.watchers {
+		n.dropWatcher(w)
+	}
+	n.signal()
+	return nil
+}
@@ -0,0 +1,176 @@
+package quorum
+
+import (
+	"FranzMQ/orchestrator/store"
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testQuorum runs voters in the test process, messages pass in memory
+type testQuorum struct {
+	t     *testing.T
+	dir   string
+	mu    sync.Mutex
+	nodes map[int]*Node
+}
+
+func startQuorum(t *testing.T, n int) *testQuorum {
+	q := &testQuorum{t: t, dir: t.TempDir(), nodes: map[int]*Node{}}
+	for id := 1; id <= n; id++ {
+		q.start(id)
+	}
+	t.Cleanup(func() {
+		for id := 1; id <= n; id++ {
+			q.stop(id)
+		}
+	})
+	return q
+}
+
+func (q *testQuorum) start(id int) *Node {
+	q.t.Helper()
+	voters := map[int]string{1: "", 2: "", 3: ""}
+	node, err := Start(Settings{
+		NodeID:       id,
+		Voters:       voters,
+		Dir:          filepath.Join(q.dir, fmt.Sprint(id)),
+		TickInterval: 20 * time.Millisecond,
+		Send: func(ctx context.Context, to int, message []byte) error {
+			q.mu.Lock()
+			peer := q.nodes[to]
+			q.mu.Unlock()
+			if peer == nil {
+				return fmt.Errorf("node %d is down", to)
+			}
+			return peer.Step(ctx, message)
+		},
+	})
+	if err != nil {
+		q.t.Fatal(err)
+	}
+	q.mu.Lock()
+	q.nodes[id] = node
+	q.mu.Unlock()
+	return node
+}
+
+func (q *testQuorum) stop(id int) {
+	q.mu.Lock()
+	node := q.nodes[id]
+	delete(q.nodes, id)
+	q.mu.Unlock()
+	if node != nil {
+		node.Stop()
+	}
+}
+
+func (q *testQuorum) leader() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for id, node := range q.nodes {
+		node.mu.Lock()
+		leader := node.leader
+		node.mu.Unlock()
+		if leader {
+			return id
+		}
+	}
+	return 0
+}
+
+func TestQuorum_ReplicatesAndWatches(t *testing.T) {
+	q := startQuorum(t, 3)
+	ctx := context.Background()
+
+	watch := q.nodes[2].Watch(ctx, "/topics/", 1)
+	if created, err := q.nodes[1].Create(ctx, "/topics/orders", []byte("3")); err != nil || !created {
+		t.Fatalf("Expected the create to succeed, got %v %v", created, err)
+	}
+	if created, _ := q.nodes[3].Create(ctx, "/topics/orders", []byte("4")); created {
+		t.Errorf("Expected a second create on another node to fail")
+	}
+	kvs, _, err := q.nodes[3].Get(ctx, "/topics/")
+	if err != nil || len(kvs) != 1 || string(kvs[0].Value) != "3" {
+		t.Fatalf("Expected every node to read the topic, got %v %v", kvs, err)
+	}
+	select {
+	case resp := <-watch:
+		if len(resp.Events) != 1 || resp.Events[0].Key != "/topics/orders" {
+			t.Errorf("Unexpected watch response %+v", resp)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the watch to see the create")
+	}
+
+	// A majority keeps going without the leader, which catches up from its WAL and the others
+	leader := q.leader()
+	q.stop(leader)
+	other := leader%3 + 1
+	if err := q.nodes[other].Update(ctx, "/topics/orders", []byte("5")); err != nil {
+		t.Fatalf("Expected the update to commit without the leader, got %v", err)
+	}
+	restarted := q.start(leader)
+	kvs, _, err = restarted.Get(ctx, "/topics/")
+	if err != nil || len(kvs) != 1 || string(kvs[0].Value) != "5" {
+		t.Errorf("Expected the restarted node to catch up, got %v %v", kvs, err)
+	}
+}
+
+func TestQuorum_SessionsAndElection(t *testing.T) {
+	q := startQuorum(t, 3)
+	ctx := context.Background()
+
+	first, err := q.nodes[1].NewSession(time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := q.nodes[2].NewSession(time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := first.Create(ctx, "/brokers/1", []byte("a")); err != nil {
+		t.Fatal(err)
+	}
+	held, err := first.Campaign(ctx, "/controller/", "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	elected := make(chan store.Leader, 1)
+	go func() {
+		next, err := second.Campaign(ctx, "/controller/", "2")
+		if err == nil {
+			elected <- next
+		}
+	}()
+	select {
+	case <-elected:
+		t.Fatal("Expected the second campaign to wait for the first leader")
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	// The first session is no longer renewed once its node is gone
+	q.stop(1)
+	var next store.Leader
+	select {
+	case next = <-elected:
+	case <-time.After(10 * time.Second):
+		t.Fatal("Expected the second campaign to win once the first session expired")
+	}
+	kvs, _, err := q.nodes[3].Get(ctx, "/brokers/")
+	if err != nil || len(kvs) != 0 {
+		t.Errorf("Expected the key of the expired session deleted, got %v %v", kvs, err)
+	}
+	if err := next.Put(ctx, "/assignments/orders", []byte("x")); err != nil {
+		t.Errorf("Expected the new leader to write, got %v", err)
+	}
+	stale := *held.(*leader)
+	stale.node = q.nodes[3]
+	if err := stale.Put(ctx, "/assignments/orders", []byte("y")); !errors.Is(err, store.ErrLostElection) {
+		t.Errorf("Expected the old leader's write to be fenced off, got %v", err)
+	}
+}
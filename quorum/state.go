@@ -0,0 +1,184 @@
+package quorum
+
+import (
+	"FranzMQ/orchestrator/store"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Commands proposed to the log
+const (
+	opCreate    = "create"    // Put Key unless it exists, under Lease if set
+	opUpdate    = "update"    // Put Key if it exists
+	opPut       = "put"       // Put Key, only while Fence has FenceRevision if set
+	opDelete    = "delete"    // Delete Key, only while Fence has FenceRevision if set
+	opGrant     = "grant"     // Start Lease, ended by a revoke
+	opKeepAlive = "keepalive" // The owner of Lease is still there
+	opRevoke    = "revoke"    // End Lease and delete its keys
+)
+
+type command struct {
+	ID            uint64        `json:"id"` // Of the proposal, wakes up the proposer
+	Op            string        `json:"op"`
+	Key           string        `json:"key,omitempty"`
+	Value         []byte        `json:"value,omitempty"`
+	Lease         int64         `json:"lease,omitempty"`
+	TTL           time.Duration `json:"ttl,omitempty"`
+	Fence         string        `json:"fence,omitempty"` // Key an election is held by
+	FenceRevision int64         `json:"fence_revision,omitempty"`
+}
+
+type result struct {
+	OK       bool  // False when the condition of the command did not hold
+	Revision int64 // Create revision of the key put by a create
+	Err      error // The command could not be applied
+}
+
+type entry struct {
+	Value          []byte `json:"value"`
+	CreateRevision int64  `json:"create_revision"`
+	Lease          int64  `json:"lease,omitempty"`
+}
+
+// event is a change of a key at a revision
+type event struct {
+	store.Event
+	Revision int64
+}
+
+// Proposals remembered to skip the ones proposed again
+const recentProposals = 1000
+
+var errDuplicate = errors.New("proposal applied before")
+
+// state is the metadata the log builds, every node applies the same commands
+// in the same order. The revision counts the commands that changed keys.
+type state struct {
+	Revision int64                   `json:"revision"`
+	Keys     map[string]*entry       `json:"keys"`
+	Leases   map[int64]time.Duration `json:"leases"` // TTL by lease
+	Recent   []uint64                `json:"recent"` // IDs of the last proposals applied
+}
+
+func newState() *state {
+	return &state{Keys: map[string]*entry{}, Leases: map[int64]time.Duration{}}
+}
+
+// apply runs a command, returning its result and the keys it changed. A
+// proposal committed twice, because its proposer retried, runs once.
+func (s *state) apply(cmd command) (result, []event) {
+	if cmd.ID != 0 {
+		for _, id := range s.Recent {
+			if id == cmd.ID {
+				return result{Err: errDuplicate}, nil
+			}
+		}
+		s.Recent = append(s.Recent, cmd.ID)
+		if len(s.Recent) > recentProposals {
+			s.Recent = s.Recent[len(s.Recent)-recentProposals:]
+		}
+	}
+
+	switch cmd.Op {
+	case opCreate:
+		if _, exists := s.Keys[cmd.Key]; exists {
+			return result{}, nil
+		}
+		if _, alive := s.Leases[cmd.Lease]; cmd.Lease != 0 && !alive {
+			return result{Err: fmt.Errorf("%w: %x", errLeaseExpired, cmd.Lease)}, nil
+		}
+		s.Revision++
+		s.Keys[cmd.Key] = &entry{Value: cmd.Value, CreateRevision: s.Revision, Lease: cmd.Lease}
+		return result{OK: true, Revision: s.Revision}, s.changed(cmd.Key, cmd.Value)
+
+	case opUpdate:
+		e, exists := s.Keys[cmd.Key]
+		if !exists {
+			return result{}, nil
+		}
+		s.Revision++
+		e.Value = cmd.Value
+		return result{OK: true}, s.changed(cmd.Key, cmd.Value)
+
+	case opPut, opDelete:
+		if cmd.Fence != "" {
+			if e, held := s.Keys[cmd.Fence]; !held || e.CreateRevision != cmd.FenceRevision {
+				return result{}, nil
+			}
+		}
+		if cmd.Op == opDelete {
+			if _, exists := s.Keys[cmd.Key]; !exists {
+				return result{OK: true}, nil
+			}
+			s.Revision++
+			return result{OK: true}, s.deleted(cmd.Key)
+		}
+		s.Revision++
+		if e, exists := s.Keys[cmd.Key]; exists {
+			e.Value = cmd.Value
+		} else {
+			s.Keys[cmd.Key] = &entry{Value: cmd.Value, CreateRevision: s.Revision}
+		}
+		return result{OK: true}, s.changed(cmd.Key, cmd.Value)
+
+	case opGrant:
+		s.Leases[cmd.Lease] = cmd.TTL
+		return result{OK: true}, nil
+
+	case opKeepAlive:
+		if _, alive := s.Leases[cmd.Lease]; !alive {
+			return result{Err: fmt.Errorf("%w: %x", errLeaseExpired, cmd.Lease)}, nil
+		}
+		return result{OK: true}, nil
+
+	case opRevoke:
+		if _, alive := s.Leases[cmd.Lease]; !alive {
+			return result{OK: true}, nil
+		}
+		delete(s.Leases, cmd.Lease)
+		var events []event
+		for key, e := range s.Keys {
+			if e.Lease == cmd.Lease {
+				if events == nil {
+					s.Revision++
+				}
+				events = append(events, s.deleted(key)...)
+			}
+		}
+		return result{OK: true}, events
+	}
+	return result{Err: fmt.Errorf("unknown command %q", cmd.Op)}, nil
+}
+
+func (s *state) changed(key string, value []byte) []event {
+	return []event{{Event: store.Event{Key: key, Value: value}, Revision: s.Revision}}
+}
+
+func (s *state) deleted(key string) []event {
+	delete(s.Keys, key)
+	return []event{{Event: store.Event{Key: key, Deleted: true}, Revision: s.Revision}}
+}
+
+// Keys below prefix
+func (s *state) get(prefix string) []store.KV {
+	kvs := []store.KV{}
+	for key, e := range s.Keys {
+		if strings.HasPrefix(key, prefix) {
+			kvs = append(kvs, store.KV{Key: key, Value: e.Value})
+		}
+	}
+	return kvs
+}
+
+// Whether a key below prefix was created before revision, one that leads an
+// election held there before the one created at revision
+func (s *state) createdBefore(prefix string, revision int64) bool {
+	for key, e := range s.Keys {
+		if strings.HasPrefix(key, prefix) && e.CreateRevision < revision {
+			return true
+		}
+	}
+	return false
+}
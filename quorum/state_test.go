@@ -0,0 +1,53 @@
+package quorum
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestState_Apply(t *testing.T) {
+	s := newState()
+	if res, events := s.apply(command{Op: opCreate, Key: "/a", Value: []byte("1")}); !res.OK || res.Revision != 1 || len(events) != 1 {
+		t.Fatalf("Expected /a created at revision 1, got %+v %v", res, events)
+	}
+	if res, _ := s.apply(command{Op: opCreate, Key: "/a", Value: []byte("2")}); res.OK {
+		t.Errorf("Expected a second create of /a to fail")
+	}
+	if res, _ := s.apply(command{ID: 9, Op: opUpdate, Key: "/a", Value: []byte("3")}); !res.OK {
+		t.Errorf("Expected an update of /a to succeed")
+	}
+	if res, events := s.apply(command{ID: 9, Op: opUpdate, Key: "/a", Value: []byte("3")}); !errors.Is(res.Err, errDuplicate) || len(events) != 0 {
+		t.Errorf("Expected a proposal committed twice to run once, got %+v", res)
+	}
+	if res, _ := s.apply(command{Op: opUpdate, Key: "/b", Value: []byte("1")}); res.OK {
+		t.Errorf("Expected an update of a missing key to fail")
+	}
+
+	// Writes fenced by an election key only go through while it is unchanged
+	s.apply(command{Op: opGrant, Lease: 7, TTL: time.Second})
+	res, _ := s.apply(command{Op: opCreate, Key: "/election/7", Lease: 7})
+	fenced := command{Op: opPut, Key: "/assigned", Value: []byte("x"), Fence: "/election/7", FenceRevision: res.Revision}
+	if res, _ := s.apply(fenced); !res.OK {
+		t.Errorf("Expected a write of the election holder to succeed")
+	}
+
+	// Ending the lease deletes its keys in one revision, the fence is gone
+	revision := s.Revision
+	res, events := s.apply(command{Op: opRevoke, Lease: 7})
+	if !res.OK || len(events) != 1 || !events[0].Deleted || events[0].Revision != revision+1 {
+		t.Errorf("Expected the election key deleted at revision %d, got %+v", revision+1, events)
+	}
+	if res, _ := s.apply(fenced); res.OK {
+		t.Errorf("Expected a write after losing the election to fail")
+	}
+	if res, _ := s.apply(command{Op: opKeepAlive, Lease: 7}); !errors.Is(res.Err, errLeaseExpired) {
+		t.Errorf("Expected renewing an ended lease to fail, got %v", res.Err)
+	}
+	if res, _ := s.apply(command{Op: opCreate, Key: "/c", Lease: 7}); res.Err == nil {
+		t.Errorf("Expected a create under an ended lease to fail")
+	}
+	if kvs := s.get("/"); len(kvs) != 2 {
+		t.Errorf("Expected /a and /assigned left, got %v", kvs)
+	}
+}
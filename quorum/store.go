@@ -0,0 +1,218 @@
+package quorum
+
+import (
+	"FranzMQ/orchestrator/store"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var _ store.Store = (*Node)(nil)
+
+// Get reads the keys once this voter caught up with the leader
+func (n *Node) Get(ctx context.Context, prefix string) ([]store.KV, int64, error) {
+	if err := n.sync(ctx); err != nil {
+		return nil, 0, err
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.state.get(prefix), n.state.Revision, nil
+}
+
+// Watch sends the events still in the history first, then the new ones as
+// they are applied here
+func (n *Node) Watch(ctx context.Context, prefix string, rev int64) <-chan store.WatchResponse {
+	w := &watcher{prefix: prefix, ch: make(chan store.WatchResponse, watchBuffer)}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if rev <= n.compacted {
+		w.ch <- store.WatchResponse{Err: fmt.Errorf("%w: %d", ErrCompacted, rev)}
+		close(w.ch)
+		return w.ch
+	}
+	past := []event{}
+	for _, e := range n.history {
+		if e.Revision >= rev {
+			past = append(past, e)
+		}
+	}
+	if resp, matched := watchResponse(prefix, past); matched {
+		w.ch <- resp
+	}
+	n.watchers[w] = true
+	go func() {
+		<-ctx.Done()
+		n.mu.Lock()
+		n.dropWatcher(w)
+		n.mu.Unlock()
+	}()
+	return w.ch
+}
+
+func (n *Node) Create(ctx context.Context, key string, value []byte) (bool, error) {
+	res, err := n.propose(ctx, command{Op: opCreate, Key: key, Value: value})
+	return res.OK, err
+}
+
+func (n *Node) Update(ctx context.Context, key string, value []byte) error {
+	_, err := n.propose(ctx, command{Op: opUpdate, Key: key, Value: value})
+	return err
+}
+
+func (n *Node) Put(ctx context.Context, key string, value []byte) error {
+	_, err := n.propose(ctx, command{Op: opPut, Key: key, Value: value})
+	return err
+}
+
+func (n *Node) Delete(ctx context.Context, key string) error {
+	_, err := n.propose(ctx, command{Op: opDelete, Key: key})
+	return err
+}
+
+// NewSession grants a lease and renews it every third of ttl. The session
+// ends once the leader ended the lease, or when renewing failed for ttl.
+func (n *Node) NewSession(ttl time.Duration) (store.Session, error) {
+	lease := rand.Int63n(1<<62) + 1
+	if _, err := n.propose(context.Background(), command{Op: opGrant, Lease: lease, TTL: ttl}); err != nil {
+		return nil, err
+	}
+	s := &session{node: n, lease: lease, ttl: ttl, done: make(chan struct{}), stop: make(chan struct{})}
+	go s.keepAlive()
+	return s, nil
+}
+
+type session struct {
+	node  *Node
+	lease int64
+	ttl   time.Duration
+	done  chan struct{}
+	stop  chan struct{}
+	once  sync.Once
+}
+
+func (s *session) keepAlive() {
+	ticker := time.NewTicker(s.ttl / 3)
+	defer ticker.Stop()
+	renewed := time.Now()
+	for {
+		select {
+		case <-ticker.C:
+		case <-s.stop:
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), s.ttl/3)
+		_, err := s.node.propose(ctx, command{Op: opKeepAlive, Lease: s.lease})
+		cancel()
+		switch {
+		case errors.Is(err, errLeaseExpired):
+			s.end()
+			return
+		case err == nil:
+			renewed = time.Now()
+		case time.Since(renewed) > s.ttl:
+			log.Println("Session of node", s.node.settings.NodeID, "not renewed in time:", err)
+			s.end()
+			return
+		}
+	}
+}
+
+func (s *session) end() {
+	s.once.Do(func() { close(s.done) })
+}
+
+func (s *session) Done() <-chan struct{} {
+	return s.done
+}
+
+// Close ends the lease, deleting its keys
+func (s *session) Close() error {
+	select {
+	case <-s.stop:
+		return nil
+	default:
+	}
+	close(s.stop)
+	s.end()
+	_, err := s.node.propose(context.Background(), command{Op: opRevoke, Lease: s.lease})
+	return err
+}
+
+func (s *session) Create(ctx context.Context, key string, value []byte) (bool, error) {
+	res, err := s.node.propose(ctx, command{Op: opCreate, Key: key, Value: value, Lease: s.lease})
+	return res.OK, err
+}
+
+// Campaign puts a key of this session below prefix and waits until every
+// key put there before is gone. Canceling gives up the candidacy.
+func (s *session) Campaign(ctx context.Context, prefix, value string) (store.Leader, error) {
+	key := prefix + strconv.FormatInt(s.lease, 16)
+	res, err := s.node.propose(ctx, command{Op: opCreate, Key: key, Value: []byte(value), Lease: s.lease})
+	if err != nil {
+		return nil, err
+	}
+	rev := res.Revision
+	if !res.OK {
+		s.node.mu.Lock()
+		if e, found := s.node.state.Keys[key]; found {
+			rev = e.CreateRevision // Campaigned before
+		}
+		s.node.mu.Unlock()
+	}
+
+	for {
+		s.node.mu.Lock()
+		_, held := s.node.state.Keys[key]
+		waiting := s.node.state.createdBefore(prefix, rev)
+		changed := s.node.changed
+		s.node.mu.Unlock()
+		if !held {
+			return nil, fmt.Errorf("%w: session ended", store.ErrLostElection)
+		}
+		if !waiting {
+			return &leader{node: s.node, key: key, rev: rev}, nil
+		}
+		select {
+		case <-changed:
+		case <-s.done:
+			return nil, fmt.Errorf("%w: session ended", store.ErrLostElection)
+		case <-ctx.Done():
+			resignCtx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+			defer cancel()
+			s.node.propose(resignCtx, command{Op: opDelete, Key: key})
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// leader writes while its election key is the one it created
+type leader struct {
+	node *Node
+	key  string
+	rev  int64
+}
+
+func (l *leader) Put(ctx context.Context, key string, value []byte) error {
+	return l.write(ctx, command{Op: opPut, Key: key, Value: value})
+}
+
+func (l *leader) Delete(ctx context.Context, key string) error {
+	return l.write(ctx, command{Op: opDelete, Key: key})
+}
+
+func (l *leader) write(ctx context.Context, cmd command) error {
+	cmd.Fence, cmd.FenceRevision = l.key, l.rev
+	res, err := l.node.propose(ctx, cmd)
+	if err != nil {
+		return err
+	}
+	if !res.OK {
+		return fmt.Errorf("%w: %s not written", store.ErrLostElection, cmd.Key)
+	}
+	return nil
+}
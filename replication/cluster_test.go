@@ -0,0 +1,145 @@
+package replication
+
+import (
+	"FranzMQ/client"
+	"FranzMQ/replication/clustertest"
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCluster_ReplicatesWithMinInsyncReplicas(t *testing.T) {
+	if testing.Short() {
+		t.Skip("starts broker processes")
+	}
+	brokers := clustertest.Start(t, 3, func(_ int, addrs map[int]string) []string {
+		list := []string{}
+		for id, addr := range addrs {
+			list = append(list, fmt.Sprintf("%d@%s", id, addr))
+		}
+		return []string{"-cluster.brokers", strings.Join(list, ",")}
+	})
+	ctx := context.Background()
+	clients := map[int]*client.Client{}
+	for id, b := range brokers {
+		clients[id] = client.NewClient(b.Addr)
+		defer clients[id].Close()
+	}
+
+	const topicName = "replicated"
+	replicas := Assign([]int{1, 2, 3}, nil, topicName, 0, 3)
+	leader, follower, lagging := replicas[0], replicas[1], replicas[2]
+
+	// Topics and their configs reach every broker
+	if err := clients[follower].CreateTopic(ctx, topicName, client.TopicConfig{Partitions: 1, Replicas: 3}); err != nil {
+		t.Fatalf("create topic failed: %v", err)
+	}
+	if err := clients[follower].AlterConfigs(ctx, topicName, map[string]string{"min.insync.replicas": "3"}); err != nil {
+		t.Fatalf("alter configs failed: %v", err)
+	}
+	clustertest.Eventually(t, "config not passed on to the leader", func() error {
+		entries, err := clients[leader].DescribeConfigs(ctx, topicName)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if entry.Name == "min.insync.replicas" && entry.Value != "3" {
+				return fmt.Errorf("min.insync.replicas is %s", entry.Value)
+			}
+		}
+		return nil
+	})
+
+	// Produces to a follower go to the leader and end up on every replica
+	for i := 1; i <= 5; i++ {
+		meta, err := clients[follower].Produce(ctx, topicName, 0, []byte(fmt.Sprintf(`{"n":%d}`, i)))
+		if err != nil {
+			t.Fatalf("produce %d failed: %v", i, err)
+		}
+		if meta.Offset != i {
+			t.Errorf("Expected offset %d but got %d", i, meta.Offset)
+		}
+	}
+	for id := range brokers {
+		clustertest.Eventually(t, fmt.Sprintf("broker %d does not show the records", id), func() error {
+			records, _, err := clients[id].Fetch(ctx, topicName, 0, 1, time.Second)
+			if err != nil {
+				return err
+			}
+			if len(records) != 5 || string(records[4].Value) != `{"n":5}` {
+				return fmt.Errorf("got %d records", len(records))
+			}
+			return nil
+		})
+	}
+
+	// Without one replica there are too few in sync to acknowledge
+	brokers[lagging].Stop()
+	clustertest.Eventually(t, "produce with a replica down did not fail", func() error {
+		_, err := clients[leader].Produce(ctx, topicName, 0, []byte(`{"n":6}`))
+		if !client.IsNotEnoughReplicas(err) {
+			return fmt.Errorf("expected not enough replicas, got %v", err)
+		}
+		return nil
+	})
+	if err := clients[leader].AlterConfigs(ctx, topicName, map[string]string{"min.insync.replicas": "2"}); err != nil {
+		t.Fatalf("alter configs failed: %v", err)
+	}
+	if _, err := clients[leader].Produce(ctx, topicName, 0, []byte(`{"n":7}`)); err != nil {
+		t.Fatalf("Expected a produce with 2 replicas in sync to succeed, got %v", err)
+	}
+
+	// Followers learn the ISR from the leader, clients learn it from any replica
+	clustertest.Eventually(t, "metadata does not show the shrunk ISR", func() error {
+		m, err := clients[follower].Metadata(ctx, topicName)
+		if err != nil {
+			return err
+		}
+		if len(m.Brokers) != 3 || len(m.Topics) != 1 || len(m.Topics[0].Partitions) != 1 {
+			return fmt.Errorf("got %+v", m)
+		}
+		p := m.Topics[0].Partitions[0]
+		if p.Leader != leader || len(p.Replicas) != 3 || len(p.InSyncReplicas) != 2 {
+			return fmt.Errorf("got %+v", p)
+		}
+		if b, found := m.Broker(leader); !found || b.Addr() != brokers[leader].Addr {
+			return fmt.Errorf("leader at %+v instead of %s", b, brokers[leader].Addr)
+		}
+		return nil
+	})
+
+	// Back up, the replica catches up with the leader
+	brokers[lagging].Start(t)
+	latest, err := clients[leader].ListOffset(ctx, topicName, 0, client.LatestOffset)
+	if err != nil {
+		t.Fatalf("list offset failed: %v", err)
+	}
+	clustertest.Eventually(t, "restarted replica did not catch up", func() error {
+		offset, err := clients[lagging].ListOffset(ctx, topicName, 0, client.LatestOffset)
+		if err != nil {
+			return err
+		}
+		if offset != latest {
+			return fmt.Errorf("at offset %d instead of %d", offset, latest)
+		}
+		return nil
+	})
+
+	if err := clients[leader].DeleteTopic(ctx, topicName); err != nil {
+		t.Fatalf("delete topic failed: %v", err)
+	}
+	clustertest.Eventually(t, "topic not deleted everywhere", func() error {
+		for id := range brokers {
+			topics, err := clients[id].ListTopics(ctx)
+			if err != nil {
+				return err
+			}
+			if _, exists := topics[topicName]; exists {
+				return fmt.Errorf("still on broker %d", id)
+			}
+		}
+		return nil
+	})
+}
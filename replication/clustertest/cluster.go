@@ -0,0 +1,133 @@
+// Package clustertest runs clusters of broker processes on localhost for
+// tests of replication across brokers.
+package clustertest
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Broker is a broker process on localhost
+type Broker struct {
+	ID      int
+	Addr    string // Binary listener
+	args    []string
+	binary  string
+	logPath string
+	cmd     *exec.Cmd
+}
+
+// Start runs the broker and waits for its binary listener
+func (b *Broker) Start(t testing.TB) {
+	t.Helper()
+	logFile, err := os.OpenFile(b.logPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.cmd = exec.Command(b.binary, b.args...)
+	b.cmd.Stdout, b.cmd.Stderr = logFile, logFile
+	if err := b.cmd.Start(); err != nil {
+		t.Fatalf("starting broker %d failed: %v", b.ID, err)
+	}
+	go func() {
+		b.cmd.Wait()
+		logFile.Close()
+	}()
+
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		if conn, err := net.Dial("tcp", b.Addr); err == nil {
+			conn.Close()
+			return
+		}
+		if time.Now().After(deadline) {
+			log, _ := os.ReadFile(b.logPath)
+			t.Fatalf("broker %d did not come up:\n%s", b.ID, log)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// Stop kills the broker
+func (b *Broker) Stop() {
+	if b.cmd != nil && b.cmd.Process != nil {
+		b.cmd.Process.Kill()
+		b.cmd.Process.Wait()
+	}
+}
+
+// Log returns what the broker logged so far
+func (b *Broker) Log() string {
+	log, _ := os.ReadFile(b.logPath)
+	return string(log)
+}
+
+// FreeAddr returns a local address nothing listens on
+func FreeAddr(t testing.TB) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return l.Addr().String()
+}
+
+// Start builds the broker and runs n of them, with ids 1 to n. clusterArgs
+// returns the cluster flags of a broker given the binary listeners of all.
+// The brokers are stopped when the test ends.
+func Start(t testing.TB, n int, clusterArgs func(id int, addrs map[int]string) []string) map[int]*Broker {
+	t.Helper()
+	dir := t.TempDir()
+	binary := filepath.Join(dir, "franzmq")
+	build := exec.Command("go", "build", "-o", binary, "FranzMQ")
+	if out, err := build.CombinedOutput(); err != nil {
+		t.Fatalf("building the broker failed: %v\n%s", err, out)
+	}
+
+	brokers := map[int]*Broker{}
+	addrs := map[int]string{}
+	for id := 1; id <= n; id++ {
+		brokers[id] = &Broker{ID: id, Addr: FreeAddr(t), binary: binary, logPath: filepath.Join(dir, fmt.Sprintf("broker%d.log", id))}
+		addrs[id] = brokers[id].Addr
+	}
+	for id := 1; id <= n; id++ {
+		b := brokers[id]
+		b.args = append([]string{
+			"-listeners.binary", b.Addr,
+			"-listeners.http", FreeAddr(t),
+			"-listeners.grpc", FreeAddr(t),
+			"-listeners.kafka", FreeAddr(t),
+			"-storage.data_dir", filepath.Join(dir, fmt.Sprintf("data%d", id)),
+			"-tracing.endpoint", "",
+			"-cluster.broker_id", fmt.Sprint(id),
+			"-cluster.replica_lag_time_max", "1s",
+			"-cluster.replica_fetch_wait", "100ms",
+			"-cluster.ack_timeout", "10s",
+		}, clusterArgs(id, addrs)...)
+		b.Start(t)
+		t.Cleanup(b.Stop)
+	}
+	return brokers
+}
+
+// Eventually polls fn until it succeeds, failing the test after 15 seconds
+func Eventually(t testing.TB, what string, fn func() error) {
+	t.Helper()
+	deadline := time.Now().Add(15 * time.Second)
+	for {
+		err := fn()
+		if err == nil {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%s: %v", what, err)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
@@ -0,0 +1,142 @@
+package replication
+
+import (
+	"FranzMQ/consumer"
+	"FranzMQ/producer"
+	"FranzMQ/storage"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+)
+
+// epochCache keeps the leader epochs of a partition in the order they
+// started, checkpointed next to its log. A replica coming back compares its
+// last epoch with the leader's to find where their logs part.
+type epochCache struct {
+	topic     string
+	partition int
+
+	mu     sync.Mutex
+	epochs []consumer.LeaderEpoch
+}
+
+var epochCaches sync.Map // Key: partitionKey, Value: *epochCache
+
+// The epoch cache of a partition, read from its checkpoint the first time
+func epochsOf(key partitionKey) *epochCache {
+	if c, found := epochCaches.Load(key); found {
+		return c.(*epochCache)
+	}
+	c := &epochCache{topic: key.topic, partition: key.partition}
+	if data, err := storage.ReadFile(storage.LeaderEpochsPath(key.topic, key.partition)); err == nil {
+		if err := json.Unmarshal(data, &c.epochs); err != nil {
+			log.Println("Error reading leader epochs of", key.topic, key.partition, err)
+		}
+	}
+	actual, _ := epochCaches.LoadOrStore(key, c)
+	return actual.(*epochCache)
+}
+
+// Forget the epoch caches of a deleted topic
+func dropEpochs(topicName string) {
+	epochCaches.Range(func(key, _ any) bool {
+		if key.(partitionKey).topic == topicName {
+			epochCaches.Delete(key)
+		}
+		return true
+	})
+}
+
+func (c *epochCache) all() []consumer.LeaderEpoch {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]consumer.LeaderEpoch{}, c.epochs...)
+}
+
+// latest returns the last epoch, -1 without any
+func (c *epochCache) latest() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.epochs) == 0 {
+		return -1
+	}
+	return c.epochs[len(c.epochs)-1].Epoch
+}
+
+// assign records that epoch starts at offset, unless it is not newer than
+// the last one
+func (c *epochCache) assign(epoch, offset int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if n := len(c.epochs); n > 0 && c.epochs[n-1].Epoch >= epoch {
+		return
+	}
+	c.epochs = append(c.epochs, consumer.LeaderEpoch{Epoch: epoch, StartOffset: offset})
+	c.save()
+}
+
+// adopt takes the epochs of the leader starting before offset, the end of
+// what this replica has
+func (c *epochCache) adopt(epochs []consumer.LeaderEpoch, offset int) {
+	for _, e := range epochs {
+		if e.StartOffset < offset {
+			c.assign(e.Epoch, e.StartOffset)
+		}
+	}
+}
+
+// endOffset returns the largest epoch not above epoch and the offset it ends
+// at: where the next one starts, or leo for the last one. Without such an
+// epoch it returns -1 and -1.
+func (c *epochCache) endOffset(epoch, leo int) (int, int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i := len(c.epochs) - 1; i >= 0; i-- {
+		if c.epochs[i].Epoch > epoch {
+			continue
+		}
+		if i == len(c.epochs)-1 {
+			return c.epochs[i].Epoch, leo
+		}
+		return c.epochs[i].Epoch, c.epochs[i+1].StartOffset
+	}
+	return -1, -1
+}
+
+// truncate drops the epochs after epoch and those starting at offset or later
+func (c *epochCache) truncate(epoch, offset int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	kept := c.epochs[:0]
+	for _, e := range c.epochs {
+		if e.Epoch <= epoch && e.StartOffset < offset {
+			kept = append(kept, e)
+		}
+	}
+	if len(kept) != len(c.epochs) {
+		c.epochs = kept
+		c.save()
+	}
+}
+
+// Must be called with c.mu held
+func (c *epochCache) save() {
+	data, _ := json.Marshal(c.epochs)
+	if err := storage.WriteFile(storage.LeaderEpochsPath(c.topic, c.partition), data); err != nil {
+		log.Println("Error checkpointing leader epochs of", c.topic, c.partition, err)
+	}
+}
+
+// OffsetForLeaderEpoch answers a follower looking for where its log parts
+// from the leader's: the largest epoch of a partition led here not above
+// epoch, and the offset it ends at
+func OffsetForLeaderEpoch(topicName string, partition, epoch int) (int, int, error) {
+	key := partitionKey{topicName, partition}
+	value, isLeader := leaders.Load(key)
+	if !isLeader {
+		return 0, 0, fmt.Errorf("%w: %s-%d", producer.ErrNotLeader, topicName, partition)
+	}
+	leaderEpoch, endOffset := epochsOf(key).endOffset(epoch, value.(*leaderState).leo())
+	return leaderEpoch, endOffset, nil
+}
@@ -0,0 +1,38 @@
+package replication
+
+import (
+	"FranzMQ/consumer"
+	"FranzMQ/storage"
+	"testing"
+)
+
+func TestEpochCache(t *testing.T) {
+	key := partitionKey{"epochs_test", 0}
+	defer storage.RemoveAll(storage.TopicDir(key.topic))
+	defer dropEpochs(key.topic)
+	c := epochsOf(key)
+	c.assign(0, 1)
+	c.assign(2, 5)
+	c.assign(1, 7) // Not newer, ignored
+	c.adopt([]consumer.LeaderEpoch{{Epoch: 2, StartOffset: 5}, {Epoch: 4, StartOffset: 9}, {Epoch: 5, StartOffset: 12}}, 12)
+
+	for _, tc := range []struct{ asked, epoch, end int }{
+		{0, 0, 5},
+		{1, 0, 5},
+		{3, 2, 9},
+		{6, 4, 12},
+		{-1, -1, -1},
+	} {
+		if epoch, end := c.endOffset(tc.asked, 12); epoch != tc.epoch || end != tc.end {
+			t.Errorf("Expected epoch %d to end at %d for %d, got %d and %d", tc.epoch, tc.end, tc.asked, epoch, end)
+		}
+	}
+
+	// A follower cut back to the end of epoch 2 forgets the later epochs,
+	// also once read back from the checkpoint
+	c.truncate(2, 9)
+	dropEpochs(key.topic)
+	if epochs := epochsOf(key).all(); len(epochs) != 2 || epochs[1] != (consumer.LeaderEpoch{Epoch: 2, StartOffset: 5}) {
+		t.Errorf("Expected epochs 0 and 2 left, got %v", epochs)
+	}
+}
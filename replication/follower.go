@@ -0,0 +1,165 @@
+package replication
+
+import (
+	"FranzMQ/client"
+	"FranzMQ/consumer"
+	"FranzMQ/producer"
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// Upper bound on connecting to the leader, on top of the fetch wait
+const dialTimeout = 10 * time.Second
+
+// follower copies a partition from its leader
+type follower struct {
+	topic     string
+	partition int
+	leader    int
+	epoch     int // Leader epoch of the leader
+	ctx       context.Context
+	cancel    context.CancelFunc
+
+	mu            sync.Mutex
+	highWatermark int   // As last reported by the leader
+	isr           []int // As last reported by the leader
+	throttle      int   // Bytes per second copied at most, no limit when 0
+}
+
+func newFollower(topicName string, partition, leader, epoch, throttle int) *follower {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &follower{topic: topicName, partition: partition, leader: leader, epoch: epoch, ctx: ctx, cancel: cancel, highWatermark: 1, throttle: throttle}
+}
+
+// Fetch from the leader and append what it returns until stopped, a
+// connection of its own keeps the long polls of partitions apart. First cut
+// what this replica has past where its log parts from the leader's.
+func (f *follower) run() {
+	leader, err := peerOf(f.leader)
+	if err != nil {
+		log.Println("Error following", f.topic, f.partition, err)
+		return
+	}
+	c := client.NewClient(leader.addr)
+	defer c.Close()
+
+	epochs := epochsOf(partitionKey{f.topic, f.partition})
+	truncated := false
+	for f.ctx.Err() == nil {
+		if !truncated {
+			if err := f.truncateToLeader(c, epochs); err != nil {
+				if f.ctx.Err() == nil {
+					log.Println("Error finding where", f.topic, f.partition, "parts from broker", f.leader, err)
+					f.sleep(settings.FetchWait)
+				}
+				continue
+			}
+			truncated = true
+		}
+
+		offset := producer.NextOffset(f.ctx, f.topic, f.partition)
+		ctx, cancel := context.WithTimeout(f.ctx, settings.FetchWait+dialTimeout)
+		result, err := c.ReplicaFetch(ctx, f.topic, f.partition, settings.BrokerID, f.epoch, offset, settings.FetchWait)
+		cancel()
+		if err != nil {
+			if f.ctx.Err() == nil {
+				log.Println("Error fetching", f.topic, f.partition, "from broker", f.leader, err)
+				f.sleep(settings.FetchWait)
+			}
+			continue
+		}
+
+		bytes := 0
+		for _, record := range result.Records {
+			bytes += len(record.Value)
+			if err := producer.AppendReplicated(f.ctx, f.topic, f.partition, record.Offset, record.Timestamp, string(record.Value)); err != nil {
+				log.Println("Error appending replicated record:", err)
+				f.sleep(settings.FetchWait)
+				break
+			}
+		}
+		next := producer.NextOffset(f.ctx, f.topic, f.partition)
+		leaderEpochs := []consumer.LeaderEpoch{}
+		for _, e := range result.LeaderEpochs {
+			leaderEpochs = append(leaderEpochs, consumer.LeaderEpoch{Epoch: e.Epoch, StartOffset: e.StartOffset})
+		}
+		epochs.adopt(leaderEpochs, next)
+		f.setWatermark(min(result.HighWatermark, next))
+		f.mu.Lock()
+		f.isr = result.InSyncReplicas
+		throttle := f.throttle
+		f.mu.Unlock()
+		if throttle > 0 && bytes > 0 {
+			f.sleep(time.Duration(bytes) * time.Second / time.Duration(throttle))
+		}
+	}
+}
+
+// Ask the leader where the last epoch this replica knows ends and cut the
+// log there, dropping what a leader wrote that the current one never got
+func (f *follower) truncateToLeader(c *client.Client, epochs *epochCache) error {
+	latest := epochs.latest()
+	if latest < 0 {
+		return nil // Nothing written under a known epoch
+	}
+	ctx, cancel := context.WithTimeout(f.ctx, dialTimeout)
+	defer cancel()
+	epoch, endOffset, err := c.OffsetForLeaderEpoch(ctx, f.topic, f.partition, latest)
+	if err != nil || endOffset < 0 {
+		return err
+	}
+	if next := producer.NextOffset(ctx, f.topic, f.partition); endOffset < next {
+		log.Println("Truncating", f.topic, f.partition, "to offset", endOffset, "where it parts from broker", f.leader)
+		if err := producer.Truncate(ctx, f.topic, f.partition, endOffset); err != nil {
+			return err
+		}
+	}
+	epochs.truncate(epoch, endOffset)
+	return nil
+}
+
+func (f *follower) stop() {
+	f.cancel()
+}
+
+func (f *follower) sleep(d time.Duration) {
+	select {
+	case <-time.After(d):
+	case <-f.ctx.Done():
+	}
+}
+
+// Consumers of this replica see up to the leader's high watermark
+func (f *follower) setWatermark(watermark int) {
+	f.mu.Lock()
+	moved := watermark > f.highWatermark
+	if moved {
+		f.highWatermark = watermark
+	}
+	f.mu.Unlock()
+	if moved {
+		producer.NotifyWaiters(f.topic, f.partition)
+	}
+}
+
+func (f *follower) watermark() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.highWatermark
+}
+
+// A replica being added copies the partition at a limited rate, so the
+// move does not take the bandwidth the producers and consumers need
+func (f *follower) setThrottle(throttle int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.throttle = throttle
+}
+
+func (f *follower) inSyncReplicas() []int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.isr
+}
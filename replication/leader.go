@@ -0,0 +1,275 @@
+package replication
+
+import (
+	"FranzMQ/producer"
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// leaderState tracks the followers of a partition this broker leads: the
+// in-sync replicas (ISR) and the high watermark, the first offset not yet on
+// every one of them
+type leaderState struct {
+	topic     string
+	partition int
+	self      int
+	leo       func() int // Log end offset of the leader, the offset the next message gets
+
+	mu            sync.Mutex
+	replicas      []int
+	isr           map[int]bool      // Replicas in sync, the leader included
+	fetchOffset   map[int]int       // Offset each follower fetched last, it has everything before it
+	lastFetchLEO  map[int]int       // Leader log end offset at each follower's previous fetch
+	caughtUp      map[int]time.Time // Last time each follower had everything the leader had
+	sentWatermark map[int]int       // High watermark each follower was told last
+	highWatermark int
+	epoch         int           // Leader epoch, followers fetching under another one are fenced
+	changed       chan struct{} // Closed when the high watermark or the ISR changes
+}
+
+// All replicas start in sync, a follower that does not show up drops out
+// after the replica lag time
+func newLeaderState(topic string, partition, self int, replicas []int, leo func() int, now time.Time) *leaderState {
+	s := &leaderState{
+		topic:         topic,
+		partition:     partition,
+		self:          self,
+		leo:           leo,
+		replicas:      replicas,
+		isr:           map[int]bool{},
+		fetchOffset:   map[int]int{},
+		lastFetchLEO:  map[int]int{},
+		caughtUp:      map[int]time.Time{},
+		sentWatermark: map[int]int{},
+		highWatermark: 1,
+		changed:       make(chan struct{}),
+	}
+	for _, id := range replicas {
+		s.isr[id] = true
+		if id != self {
+			s.fetchOffset[id] = 1
+			s.caughtUp[id] = now
+		}
+	}
+	return s
+}
+
+// followerFetched records that a follower asked for offset, so it holds
+// everything before it. A follower that reached the leader's log end offset
+// of its previous fetch is caught up and rejoins the ISR.
+func (s *leaderState) followerFetched(id, offset int, now time.Time) error {
+	leo := s.leo()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, isFollower := s.fetchOffset[id]; !isFollower {
+		return fmt.Errorf("broker %d is no follower of %s-%d", id, s.topic, s.partition)
+	}
+	s.fetchOffset[id] = offset
+	if offset >= s.lastFetchLEO[id] {
+		s.caughtUp[id] = now
+		if !s.isr[id] {
+			s.isr[id] = true
+			log.Println("Broker", id, "rejoined the in-sync replicas of", s.topic, s.partition)
+			s.signal()
+			notifyISR(s.topic, s.partition, s.inSync())
+		}
+	}
+	s.lastFetchLEO[id] = leo
+	s.advance(leo)
+	return nil
+}
+
+// shrink drops followers that have not been caught up for lagMax out of the ISR
+func (s *leaderState) shrink(now time.Time, lagMax time.Duration) {
+	leo := s.leo()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id := range s.isr {
+		if id != s.self && now.Sub(s.caughtUp[id]) > lagMax {
+			delete(s.isr, id)
+			log.Println("Broker", id, "fell out of the in-sync replicas of", s.topic, s.partition)
+			s.signal()
+			notifyISR(s.topic, s.partition, s.inSync())
+		}
+	}
+	s.advance(leo)
+}
+
+// setReplicas changes the replicas of the partition. New ones join the ISR
+// once they reached the log end offset the leader had when they were added,
+// removed ones leave it.
+func (s *leaderState) setReplicas(replicas []int) {
+	leo := s.leo()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if equalIDs(s.replicas, replicas) {
+		return
+	}
+	for _, id := range replicas {
+		if _, isFollower := s.fetchOffset[id]; !isFollower && id != s.self {
+			s.fetchOffset[id] = 1
+			s.lastFetchLEO[id] = leo
+		}
+	}
+	for id := range s.fetchOffset {
+		if !contains(replicas, id) {
+			delete(s.isr, id)
+			delete(s.fetchOffset, id)
+			delete(s.lastFetchLEO, id)
+			delete(s.caughtUp, id)
+			delete(s.sentWatermark, id)
+		}
+	}
+	s.replicas = replicas
+	log.Println("Broker", s.self, "leads", s.topic, s.partition, "replicated to", replicas)
+	s.signal()
+	notifyISR(s.topic, s.partition, s.inSync())
+	s.advance(leo)
+}
+
+// restrictISR keeps only isr in sync, the replicas the previous leader had
+// in sync, so a new leader does not vouch for replicas that fell behind.
+// The others rejoin once they reach the log end offset.
+func (s *leaderState) restrictISR(isr []int) {
+	leo := s.leo()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id := range s.fetchOffset {
+		if !contains(isr, id) {
+			delete(s.isr, id)
+			s.lastFetchLEO[id] = leo
+		}
+	}
+}
+
+func (s *leaderState) setEpoch(epoch int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.epoch = epoch
+}
+
+// checkEpoch fences followers that know another leader epoch: a stale one
+// follows a leader that is gone, a newer one means this broker no longer leads
+func (s *leaderState) checkEpoch(epoch int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if epoch != s.epoch {
+		return fmt.Errorf("%w: %s-%d is at epoch %d, not %d", producer.ErrFencedLeaderEpoch, s.topic, s.partition, s.epoch, epoch)
+	}
+	return nil
+}
+
+// Move the high watermark up to the lowest offset every in-sync replica has,
+// it never goes back. Must be called with mu held.
+func (s *leaderState) advance(leo int) {
+	watermark := leo
+	for id := range s.isr {
+		if id != s.self {
+			watermark = min(watermark, s.fetchOffset[id])
+		}
+	}
+	if watermark > s.highWatermark {
+		s.highWatermark = watermark
+		s.signal()
+		producer.NotifyWaiters(s.topic, s.partition)
+	}
+}
+
+// Wake everyone waiting on a change. Must be called with mu held.
+func (s *leaderState) signal() {
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+func (s *leaderState) watermark() int {
+	leo := s.leo()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.advance(leo)
+	return s.highWatermark
+}
+
+// checkWritable fails when fewer than minInsync replicas are in sync
+func (s *leaderState) checkWritable(minInsync int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.isr) < minInsync {
+		return fmt.Errorf("%w: %d of %d in sync for %s-%d", producer.ErrNotEnoughReplicas, len(s.isr), minInsync, s.topic, s.partition)
+	}
+	return nil
+}
+
+// waitCommitted blocks until the high watermark passed offset. It fails
+// once the ISR shrinks below minInsync, even if that let the high watermark
+// pass, or after timeout.
+func (s *leaderState) waitCommitted(ctx context.Context, offset, minInsync int, timeout time.Duration) error {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		leo := s.leo()
+		s.mu.Lock()
+		s.advance(leo)
+		committed, inSync, changed := s.highWatermark > offset, len(s.isr), s.changed
+		s.mu.Unlock()
+
+		// Committed by fewer replicas than asked for is not good enough
+		if inSync < minInsync {
+			return fmt.Errorf("%w: offset %d of %s-%d not acknowledged", producer.ErrNotEnoughReplicas, offset, s.topic, s.partition)
+		}
+		if committed {
+			return nil
+		}
+		select {
+		case <-changed:
+		case <-timer.C:
+			return fmt.Errorf("timed out waiting for the replicas of %s-%d to get offset %d", s.topic, s.partition, offset)
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Report the high watermark to a follower if it has not seen it yet
+func (s *leaderState) unsentWatermark(id int) (int, bool) {
+	leo := s.leo()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.advance(leo)
+	if s.sentWatermark[id] == s.highWatermark {
+		return s.highWatermark, false
+	}
+	s.sentWatermark[id] = s.highWatermark
+	return s.highWatermark, true
+}
+
+func (s *leaderState) changes() <-chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.changed
+}
+
+func (s *leaderState) inSyncReplicas() []int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.inSync()
+}
+
+// Must be called with mu held
+func (s *leaderState) inSync() []int {
+	isr := []int{}
+	for _, id := range s.replicas {
+		if s.isr[id] {
+			isr = append(isr, id)
+		}
+	}
+	return isr
+}
@@ -0,0 +1,154 @@
+package replication
+
+import (
+	"FranzMQ/producer"
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestAssign(t *testing.T) {
+	brokers := []int{1, 2, 3}
+	leaders := map[int]int{}
+	for p := 0; p < 6; p++ {
+		replicas := Assign(brokers, nil, "orders", p, 2)
+		if len(replicas) != 2 || replicas[0] == replicas[1] {
+			t.Fatalf("Expected 2 distinct replicas of partition %d, got %v", p, replicas)
+		}
+		leaders[replicas[0]]++
+	}
+	for _, id := range brokers {
+		if leaders[id] != 2 {
+			t.Errorf("Expected leadership spread evenly, got %v", leaders)
+		}
+	}
+	if replicas := Assign(brokers, nil, "orders", 0, 5); len(replicas) != 3 {
+		t.Errorf("Expected no more replicas than brokers, got %v", replicas)
+	}
+}
+
+func TestAssign_SpreadsRacks(t *testing.T) {
+	brokers := []int{1, 2, 3, 4, 5}
+	racks := map[int]string{1: "a", 2: "a", 3: "a", 4: "b", 5: "c"}
+	leaders := map[int]int{}
+	for p := 0; p < 10; p++ {
+		replicas := Assign(brokers, racks, "orders", p, 3)
+		used := map[string]bool{}
+		for _, id := range replicas {
+			used[racks[id]] = true
+		}
+		if len(replicas) != 3 || len(used) != 3 {
+			t.Fatalf("Expected partition %d on 3 racks, got %v", p, replicas)
+		}
+		leaders[replicas[0]]++
+	}
+	if len(leaders) != len(brokers) {
+		t.Errorf("Expected every broker to lead some partitions, got %v", leaders)
+	}
+
+	// More replicas than racks, the rest goes to the brokers left
+	if replicas := Assign(brokers, map[int]string{1: "a", 2: "a", 3: "b"}, "orders", 0, 4); len(replicas) != 4 {
+		t.Errorf("Expected 4 replicas on 2 racks, got %v", replicas)
+	}
+}
+
+func TestLeaderState_HighWatermarkFollowsISR(t *testing.T) {
+	leo := 1
+	now := time.Now()
+	s := newLeaderState("leader_test", 0, 1, []int{1, 2, 3}, func() int { return leo }, now)
+
+	leo = 6 // Leader has offsets 1 to 5
+	if err := s.followerFetched(2, 6, now); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.followerFetched(3, 4, now); err != nil {
+		t.Fatal(err)
+	}
+	if hw := s.watermark(); hw != 4 {
+		t.Errorf("Expected the high watermark at the slowest in-sync replica, 4, got %d", hw)
+	}
+
+	// Follower 3 stops fetching and drops out, the others have everything
+	s.followerFetched(2, 6, now.Add(time.Second))
+	s.shrink(now.Add(time.Second), 500*time.Millisecond)
+	if isr := s.inSyncReplicas(); len(isr) != 2 {
+		t.Errorf("Expected follower 3 out of the ISR, got %v", isr)
+	}
+	if hw := s.watermark(); hw != 6 {
+		t.Errorf("Expected the high watermark at 6, got %d", hw)
+	}
+	if err := s.checkWritable(3); !errors.Is(err, producer.ErrNotEnoughReplicas) {
+		t.Errorf("Expected too few in-sync replicas for 3, got %v", err)
+	}
+
+	// Catching up brings it back without moving the high watermark back
+	s.followerFetched(3, 5, now.Add(2*time.Second))
+	s.followerFetched(3, 6, now.Add(2*time.Second))
+	if isr := s.inSyncReplicas(); len(isr) != 3 {
+		t.Errorf("Expected follower 3 back in the ISR, got %v", isr)
+	}
+	if hw := s.watermark(); hw != 6 {
+		t.Errorf("Expected the high watermark to stay at 6, got %d", hw)
+	}
+	if err := s.followerFetched(4, 1, now); err == nil {
+		t.Errorf("Expected a fetch of a broker that is no replica to fail")
+	}
+}
+
+func TestLeaderState_WaitCommitted(t *testing.T) {
+	leo := 3
+	now := time.Now()
+	s := newLeaderState("leader_test", 0, 1, []int{1, 2}, func() int { return leo }, now)
+	ctx := context.Background()
+
+	done := make(chan error, 1)
+	go func() { done <- s.waitCommitted(ctx, 2, 2, 5*time.Second) }()
+	select {
+	case err := <-done:
+		t.Fatalf("Expected the wait to block until the follower has offset 2, got %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	s.followerFetched(2, 3, now)
+	if err := <-done; err != nil {
+		t.Errorf("Expected offset 2 committed, got %v", err)
+	}
+
+	leo = 4
+	go func() { done <- s.waitCommitted(ctx, 3, 2, 5*time.Second) }()
+	time.Sleep(50 * time.Millisecond)
+	s.shrink(now.Add(time.Minute), time.Second)
+	if err := <-done; !errors.Is(err, producer.ErrNotEnoughReplicas) {
+		t.Errorf("Expected the wait to fail once the ISR shrank, got %v", err)
+	}
+	if err := s.waitCommitted(ctx, 3, 1, 5*time.Second); err != nil {
+		t.Errorf("Expected the leader alone to commit with min.insync.replicas 1, got %v", err)
+	}
+}
+
+func TestLeaderState_SetReplicas(t *testing.T) {
+	leo := 6
+	now := time.Now()
+	s := newLeaderState("leader_test", 0, 1, []int{1, 2}, func() int { return leo }, now)
+	s.followerFetched(2, 6, now)
+
+	// A new replica joins the ISR once it copied what the leader had
+	s.setReplicas([]int{3, 2, 1})
+	if isr := s.inSyncReplicas(); len(isr) != 2 {
+		t.Errorf("Expected broker 3 out of the ISR until caught up, got %v", isr)
+	}
+	s.followerFetched(3, 1, now)
+	s.followerFetched(3, 6, now)
+	if isr := s.inSyncReplicas(); len(isr) != 3 {
+		t.Errorf("Expected broker 3 in the ISR once caught up, got %v", isr)
+	}
+
+	// A removed replica leaves it and can no longer fetch
+	s.setReplicas([]int{1, 3})
+	if isr := s.inSyncReplicas(); len(isr) != 2 || isr[0] != 1 || isr[1] != 3 {
+		t.Errorf("Expected the ISR to be 1 and 3, got %v", isr)
+	}
+	if err := s.followerFetched(2, 6, now); err == nil {
+		t.Errorf("Expected a fetch of a removed replica to fail")
+	}
+}
@@ -0,0 +1,77 @@
+package replication
+
+import (
+	"FranzMQ/metadata"
+	"FranzMQ/topic"
+	"context"
+	"net"
+	"sort"
+	"strconv"
+)
+
+// Standalone describes this broker as the only one of the cluster, for
+// brokers that do not replicate
+func Standalone(brokerID int, addr, rack string) {
+	settings.BrokerID, settings.Rack = brokerID, rack
+	SetBrokers(map[int]string{brokerID: addr})
+	SetRacks(map[int]string{brokerID: rack})
+}
+
+// Describe returns the brokers of the cluster and where the partitions of
+// the topics named live, every topic when there are no names
+func Describe(ctx context.Context, names []string) (metadata.Cluster, error) {
+	if len(names) == 0 {
+		all, err := topic.ListTopics(ctx)
+		if err != nil {
+			return metadata.Cluster{}, err
+		}
+		names = all
+	}
+
+	cluster := metadata.Cluster{Brokers: []metadata.Broker{}, Topics: []metadata.Topic{}}
+	peersLock.RLock()
+	for id, addr := range addrs {
+		host, portStr, _ := net.SplitHostPort(addr)
+		port, _ := strconv.Atoi(portStr)
+		cluster.Brokers = append(cluster.Brokers, metadata.Broker{ID: id, Host: host, Port: port, Rack: racks[id]})
+	}
+	peersLock.RUnlock()
+	sort.Slice(cluster.Brokers, func(i, j int) bool { return cluster.Brokers[i].ID < cluster.Brokers[j].ID })
+
+	for _, name := range names {
+		config, err := topic.LoadConfig(ctx, name)
+		if err != nil {
+			return metadata.Cluster{}, err
+		}
+		t := metadata.Topic{Name: name, Partitions: []metadata.Partition{}}
+		for p := 0; p < config.NumOfPartition; p++ {
+			t.Partitions = append(t.Partitions, describePartition(name, p, config.Replicas))
+		}
+		cluster.Topics = append(cluster.Topics, t)
+	}
+	return cluster, nil
+}
+
+// Without replication this broker is the only one and leads every partition,
+// without a controller it leads its own copy of single-replica topics
+func describePartition(topicName string, partition, replicas int) metadata.Partition {
+	self := []int{settings.BrokerID}
+	if !started || !placed(replicas) {
+		return metadata.Partition{Partition: partition, Leader: settings.BrokerID, Replicas: self, InSyncReplicas: self}
+	}
+	a, assigned := assignmentOf(topicName, partition, replicas)
+	if !assigned {
+		return metadata.Partition{Partition: partition, Leader: NoLeader, Replicas: []int{}, InSyncReplicas: []int{}}
+	}
+	var isr []int
+	key := partitionKey{topicName, partition}
+	if s, isLeader := leaders.Load(key); isLeader {
+		isr = s.(*leaderState).inSyncReplicas()
+	} else if f, isFollower := followers.Load(key); isFollower {
+		isr = f.(*follower).inSyncReplicas()
+	}
+	if isr == nil {
+		isr = []int{}
+	}
+	return metadata.Partition{Partition: partition, Leader: a.Leader, Replicas: a.Replicas, InSyncReplicas: isr}
+}
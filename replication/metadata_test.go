@@ -0,0 +1,19 @@
+package replication
+
+import "testing"
+
+func TestDescribePartition_SingleReplicaStaysLocalWithoutController(t *testing.T) {
+	saved, wasStarted := settings, started
+	defer func() { settings, started = saved, wasStarted }()
+	settings, started = Settings{BrokerID: 2, Brokers: map[int]string{1: "a", 2: "b", 3: "c"}}, true
+
+	p := describePartition("orders", 0, 1)
+	if p.Leader != 2 || len(p.Replicas) != 1 || p.Replicas[0] != 2 {
+		t.Errorf("Expected broker 2 to lead its own copy, got %+v", p)
+	}
+
+	settings.Managed = true
+	if p := describePartition("orders", 0, 1); p.Leader != NoLeader {
+		t.Errorf("Expected an unassigned partition under a controller, got %+v", p)
+	}
+}
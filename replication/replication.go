@@ -0,0 +1,589 @@
+// Package replication places the partitions of topics on the brokers of a
+// cluster and copies them across their replicas. Every partition has a set
+// of replicas, one of them leads: it takes the produces, the followers fetch
+// from it. A message is acknowledged and shown to consumers once every
+// in-sync replica has it, the high watermark, and produces fail while fewer
+// than min.insync.replicas replicas are in sync.
+//
+// With a static broker list the replicas are picked from it and the first
+// one leads, topic creation, deletion and config changes are passed on to
+// every broker. A topic with a single replica stays local there, every
+// broker has its own copy. Managed by a controller, see the orchestrator
+// package, the brokers and assignments are handed in through SetBrokers and
+// SetAssignment, and a topic with a single replica is placed on one broker.
+//
+// Brokers that are not the leader forward produces to it, and fetches too
+// when they hold no replica.
+package replication
+
+import (
+	"FranzMQ/client"
+	"FranzMQ/consumer"
+	"FranzMQ/producer"
+	"FranzMQ/topic"
+	"context"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+type Settings struct {
+	BrokerID          int
+	Rack              string         // Of this broker, the controller hands in those of the others
+	Brokers           map[int]string // Binary listener address by broker id, this broker included
+	Managed           bool           // Brokers and assignments come from a controller instead of Brokers
+	ReplicaLagTimeMax time.Duration  // Followers not caught up for this long leave the ISR
+	FetchWait         time.Duration  // Longest a follower's fetch is parked on the leader
+	AckTimeout        time.Duration  // Longest a produce waits for the in-sync replicas
+}
+
+// NoLeader is the leader of a partition none of whose replicas is up
+const NoLeader = -1
+
+// Assignment places a partition on brokers. While the partition moves to
+// other brokers its replicas are the old and the new ones, the new ones copy
+// the partition at up to Throttle bytes per second. The leader epoch goes up
+// whenever the leader changes.
+type Assignment struct {
+	Replicas []int `json:"replicas"`
+	Leader   int   `json:"leader"`
+	Adding   []int `json:"adding,omitempty"`
+	Removing []int `json:"removing,omitempty"`
+	Throttle int   `json:"throttle,omitempty"` // No limit when 0
+	Epoch    int   `json:"epoch,omitempty"`
+}
+
+var (
+	settings    Settings
+	brokerIDs   []int    // Sorted, of the static broker list
+	assignments sync.Map // Key: topic, Value: []Assignment, when managed
+	leaders     sync.Map // Key: partitionKey, Value: *leaderState
+	followers   sync.Map // Key: partitionKey, Value: *follower
+	rolesLock   sync.Mutex
+
+	peersLock sync.RWMutex
+	peers     = map[int]*peer{}  // Every broker but this one
+	addrs     = map[int]string{} // Of every broker, this one included
+	racks     = map[int]string{} // Of the brokers that have one
+	started   bool
+)
+
+type partitionKey struct {
+	topic     string
+	partition int
+}
+
+// Start replicates the topics across the brokers of s, local topics first,
+// then those only the other brokers know about
+func Start(s Settings) {
+	settings = s
+	brokerIDs = brokerIDs[:0]
+	for id := range s.Brokers {
+		brokerIDs = append(brokerIDs, id)
+	}
+	sort.Ints(brokerIDs)
+	SetBrokers(s.Brokers)
+	SetRacks(map[int]string{s.BrokerID: s.Rack})
+	started = true
+
+	producer.SetReplicator(replicator{}, s.Managed)
+	consumer.SetFetchForwarder(forwardFetch)
+	topic.OnCreate(topicCreated)
+	topic.OnDelete(topicDeleted)
+	topic.OnConfigChange(topicChanged)
+
+	ctx := context.Background()
+	names, err := topic.ListTopics(ctx)
+	if err != nil {
+		log.Println("Error listing topics to replicate:", err)
+	}
+	for _, name := range names {
+		if config, err := topic.LoadConfig(ctx, name); err == nil {
+			syncPartitions(name, config)
+		}
+	}
+	if !s.Managed {
+		go pullTopics()
+	}
+	go shrinkLoop()
+	log.Println("Broker", s.BrokerID, "replicating, managed:", s.Managed)
+}
+
+// SetBrokers replaces the addresses of the brokers of the cluster
+func SetBrokers(brokers map[int]string) {
+	peersLock.Lock()
+	defer peersLock.Unlock()
+	current := peers
+	peers, addrs = map[int]*peer{}, map[int]string{}
+	for id, addr := range brokers {
+		addrs[id] = addr
+		if id == settings.BrokerID {
+			continue
+		}
+		if p, known := current[id]; known && p.addr == addr {
+			peers[id] = p
+			continue
+		}
+		peers[id] = &peer{id: id, addr: addr, idle: make(chan *client.Client, 8)}
+	}
+}
+
+// SetRacks replaces the racks of the brokers of the cluster
+func SetRacks(brokerRacks map[int]string) {
+	peersLock.Lock()
+	defer peersLock.Unlock()
+	racks = map[int]string{}
+	for id, rack := range brokerRacks {
+		if rack != "" {
+			racks[id] = rack
+		}
+	}
+}
+
+// SetAssignment hands in where the partitions of a topic live, nil once the
+// topic is gone. Only used when managed.
+func SetAssignment(topicName string, partitions []Assignment) {
+	if partitions == nil {
+		assignments.Delete(topicName)
+		dropPartitions(topicName)
+		return
+	}
+	assignments.Store(topicName, partitions)
+	if config, err := topic.LoadConfig(context.Background(), topicName); err == nil {
+		syncPartitions(topicName, config) // Otherwise once the topic is created here
+	}
+}
+
+// Replicas returns the brokers of the static broker list holding a
+// partition, its leader first
+func Replicas(topicName string, partition, replicas int) []int {
+	return Assign(brokerIDs, nil, topicName, partition, replicas)
+}
+
+// Assign picks the replicas of a partition from brokers, the preferred
+// leader first. The replicas of consecutive partitions start at consecutive
+// brokers, from a broker that depends on the topic, so leadership is spread
+// evenly. With brokerRacks the brokers take turns by rack and each replica
+// goes to a rack the partition is not on yet, as long as there is one.
+func Assign(brokers []int, brokerRacks map[int]string, topicName string, partition, replicas int) []int {
+	if len(brokers) == 0 {
+		return nil
+	}
+	ordered := alternateRacks(brokers, brokerRacks)
+	h := fnv.New32a()
+	h.Write([]byte(topicName))
+	first := (int(h.Sum32()%uint32(len(ordered))) + partition) % len(ordered)
+	n := min(max(replicas, 1), len(ordered))
+	ids, used := []int{}, map[string]bool{}
+	for _, spread := range []bool{true, false} {
+		for i := 0; i < len(ordered) && len(ids) < n; i++ {
+			id := ordered[(first+i)%len(ordered)]
+			if contains(ids, id) || (spread && used[brokerRacks[id]]) {
+				continue
+			}
+			ids = append(ids, id)
+			used[brokerRacks[id]] = true
+		}
+	}
+	return ids
+}
+
+// Order brokers so the racks take turns: the first broker of every rack,
+// then the second of every rack, and so on. Brokers without a rack share
+// one, so without racks the order stays.
+func alternateRacks(brokers []int, brokerRacks map[int]string) []int {
+	byRack := map[string][]int{}
+	names := []string{}
+	for _, id := range brokers {
+		rack := brokerRacks[id]
+		if _, found := byRack[rack]; !found {
+			names = append(names, rack)
+		}
+		byRack[rack] = append(byRack[rack], id)
+	}
+	sort.Strings(names)
+	ordered := make([]int, 0, len(brokers))
+	for i := 0; len(ordered) < len(brokers); i++ {
+		for _, rack := range names {
+			if i < len(byRack[rack]) {
+				ordered = append(ordered, byRack[rack][i])
+			}
+		}
+	}
+	return ordered
+}
+
+// Whether the partitions of a topic live on the brokers assigned to them.
+// Without a controller a topic with a single replica is on every broker.
+func placed(replicas int) bool {
+	return settings.Managed || replicas > 1
+}
+
+// Where a partition lives, false while a managed topic has no assignment yet
+func assignmentOf(topicName string, partition, replicas int) (Assignment, bool) {
+	if !settings.Managed {
+		ids := Replicas(topicName, partition, replicas)
+		return Assignment{Replicas: ids, Leader: ids[0]}, true
+	}
+	value, assigned := assignments.Load(topicName)
+	if !assigned || partition >= len(value.([]Assignment)) {
+		return Assignment{}, false
+	}
+	return value.([]Assignment)[partition], true
+}
+
+// ISRListener is told the in-sync replicas of a partition this broker leads
+// whenever they change. It runs with the partition locked and must not block.
+type ISRListener func(topicName string, partition int, isr []int)
+
+var isrListeners []ISRListener
+
+// OnISRChange registers a listener of the ISR changes of partitions this broker leads
+func OnISRChange(fn ISRListener) {
+	isrListeners = append(isrListeners, fn)
+}
+
+func notifyISR(topicName string, partition int, isr []int) {
+	for _, fn := range isrListeners {
+		fn(topicName, partition, isr)
+	}
+}
+
+// InSyncReplicas returns the in-sync replicas of a partition this broker leads
+func InSyncReplicas(topicName string, partition int) ([]int, bool) {
+	if s, isLeader := leaders.Load(partitionKey{topicName, partition}); isLeader {
+		return s.(*leaderState).inSyncReplicas(), true
+	}
+	return nil, false
+}
+
+// Take up the role of this broker for every partition of a topic
+func syncPartitions(topicName string, config topic.Config) {
+	if !placed(config.Replicas) {
+		return
+	}
+	rolesLock.Lock()
+	defer rolesLock.Unlock()
+	for p := 0; p < config.NumOfPartition; p++ {
+		key := partitionKey{topicName, p}
+		a, assigned := assignmentOf(topicName, p, config.Replicas)
+		switch {
+		case !assigned:
+		case a.Leader == settings.BrokerID:
+			becomeLeader(key, a.Replicas, a.Epoch)
+		case contains(a.Replicas, settings.BrokerID) && a.Leader != NoLeader:
+			throttle := 0
+			if contains(a.Adding, settings.BrokerID) {
+				throttle = a.Throttle
+			}
+			becomeFollower(key, a.Leader, a.Epoch, throttle)
+		default:
+			leaders.Delete(key)
+			stopFollower(key)
+		}
+	}
+}
+
+// A follower turning leader keeps the high watermark and the in-sync
+// replicas it knew, so consumers keep seeing what they saw. The epoch starts
+// at the log end offset. Must be called with rolesLock held.
+func becomeLeader(key partitionKey, replicas []int, epoch int) {
+	leo := func() int { return producer.NextOffset(context.Background(), key.topic, key.partition) }
+	if s, isLeader := leaders.Load(key); isLeader {
+		s.(*leaderState).setReplicas(replicas)
+		s.(*leaderState).setEpoch(epoch)
+		epochsOf(key).assign(epoch, leo())
+		return
+	}
+	highWatermark, isr := 1, []int(nil)
+	if f, isFollower := followers.Load(key); isFollower {
+		highWatermark, isr = f.(*follower).watermark(), f.(*follower).inSyncReplicas()
+		stopFollower(key)
+	}
+	s := newLeaderState(key.topic, key.partition, settings.BrokerID, replicas, leo, time.Now())
+	s.highWatermark, s.epoch = highWatermark, epoch
+	if isr != nil {
+		s.restrictISR(isr)
+	}
+	epochsOf(key).assign(epoch, leo())
+	leaders.Store(key, s)
+	notifyISR(key.topic, key.partition, s.inSyncReplicas())
+	log.Println("Broker", settings.BrokerID, "leads", key.topic, key.partition, "replicated to", replicas)
+}
+
+// A follower of a new leader or epoch starts over, cutting what it has past
+// where its log parts from the leader's. Must be called with rolesLock held.
+func becomeFollower(key partitionKey, leader, epoch, throttle int) {
+	leaders.Delete(key)
+	if f, isFollower := followers.Load(key); isFollower {
+		if f.(*follower).leader == leader && f.(*follower).epoch == epoch {
+			f.(*follower).setThrottle(throttle)
+			return
+		}
+		stopFollower(key)
+	}
+	f := newFollower(key.topic, key.partition, leader, epoch, throttle)
+	followers.Store(key, f)
+	go f.run()
+}
+
+func stopFollower(key partitionKey) {
+	if f, isFollower := followers.LoadAndDelete(key); isFollower {
+		f.(*follower).stop()
+	}
+}
+
+// Let go of the partitions of a deleted topic
+func dropPartitions(topicName string) {
+	rolesLock.Lock()
+	defer rolesLock.Unlock()
+	leaders.Range(func(key, _ any) bool {
+		if key.(partitionKey).topic == topicName {
+			leaders.Delete(key)
+		}
+		return true
+	})
+	followers.Range(func(key, _ any) bool {
+		if key.(partitionKey).topic == topicName {
+			stopFollower(key.(partitionKey))
+		}
+		return true
+	})
+	dropEpochs(topicName)
+}
+
+// Drop lagging followers out of the ISR of every partition this broker leads
+func shrinkLoop() {
+	ticker := time.NewTicker(settings.ReplicaLagTimeMax / 2)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		leaders.Range(func(_, s any) bool {
+			s.(*leaderState).shrink(now, settings.ReplicaLagTimeMax)
+			return true
+		})
+	}
+}
+
+// ServeReplicaFetch answers a follower's fetch of a partition this broker
+// leads. It records how far the follower got, then returns the records from
+// the requested offset on, past the high watermark, as soon as there are any
+// or the high watermark moved, or after MaxWait. Followers of another leader
+// epoch are fenced.
+func ServeReplicaFetch(ctx context.Context, replicaID int, req consumer.FetchRequest) (consumer.FetchResponse, error) {
+	key := partitionKey{req.Topic, req.Partition}
+	value, isLeader := leaders.Load(key)
+	if !isLeader {
+		return consumer.FetchResponse{}, fmt.Errorf("%w: %s-%d", producer.ErrNotLeader, req.Topic, req.Partition)
+	}
+	s := value.(*leaderState)
+	if err := s.checkEpoch(req.LeaderEpoch); err != nil {
+		return consumer.FetchResponse{}, err
+	}
+	if err := s.followerFetched(replicaID, req.Offset, time.Now()); err != nil {
+		return consumer.FetchResponse{}, err
+	}
+
+	timer := time.NewTimer(min(req.MaxWait, consumer.MaxFetchWait))
+	defer timer.Stop()
+	read := req
+	read.Replica, read.MaxWait = true, 0
+	for {
+		appended, changed := producer.AppendNotifier(req.Topic, req.Partition), s.changes()
+		resp, err := consumer.Fetch(ctx, read)
+		if err != nil {
+			return consumer.FetchResponse{}, err
+		}
+		watermark, moved := s.unsentWatermark(replicaID)
+		resp.HighWatermark, resp.InSyncReplicas, resp.LeaderEpochs = watermark, s.inSyncReplicas(), epochsOf(key).all()
+		if len(resp.Records) > 0 || moved {
+			return resp, nil
+		}
+		select {
+		case <-appended:
+		case <-changed:
+		case <-timer.C:
+			return resp, nil
+		case <-ctx.Done():
+			return resp, nil
+		}
+	}
+}
+
+// replicator plugs the partition states into the producer
+type replicator struct{}
+
+func (replicator) IsLeader(topicName string, partition int) bool {
+	_, isLeader := leaders.Load(partitionKey{topicName, partition})
+	return isLeader
+}
+
+func (replicator) Forward(ctx context.Context, topicName string, partition int, values []string) (producer.NewMsgProduceResponse, error) {
+	leader, err := leaderOf(ctx, topicName, partition)
+	if err != nil {
+		return producer.NewMsgProduceResponse{}, err
+	}
+	batch := make([][]byte, 0, len(values))
+	for _, value := range values {
+		batch = append(batch, []byte(value))
+	}
+	var results []client.RecordMetadata
+	err = leader.do(func(c *client.Client) error {
+		results, err = c.ProduceBatch(ctx, topicName, partition, batch)
+		return err
+	})
+	if err != nil {
+		return producer.NewMsgProduceResponse{}, fromBroker(leader.id, err)
+	}
+	meta := results[0]
+	return producer.NewMsgProduceResponse{Offset: meta.Offset, Partition: meta.Partition, TimeStamp: meta.Timestamp}, nil
+}
+
+func (replicator) CheckWritable(topicName string, partition int, minInsync int) error {
+	s, isLeader := leaders.Load(partitionKey{topicName, partition})
+	if !isLeader {
+		return fmt.Errorf("%w: %s-%d", producer.ErrNotLeader, topicName, partition)
+	}
+	return s.(*leaderState).checkWritable(minInsync)
+}
+
+func (replicator) WaitCommitted(ctx context.Context, topicName string, partition int, offset int, minInsync int) error {
+	s, isLeader := leaders.Load(partitionKey{topicName, partition})
+	if !isLeader {
+		return fmt.Errorf("%w: %s-%d", producer.ErrNotLeader, topicName, partition)
+	}
+	return s.(*leaderState).waitCommitted(ctx, offset, minInsync, settings.AckTimeout)
+}
+
+func (replicator) HighWatermark(topicName string, partition int) int {
+	key := partitionKey{topicName, partition}
+	if s, isLeader := leaders.Load(key); isLeader {
+		return s.(*leaderState).watermark()
+	}
+	if f, isFollower := followers.Load(key); isFollower {
+		return f.(*follower).watermark()
+	}
+	return 1 // No replica here, fetches are forwarded
+}
+
+// Fetch partitions without a replica on this broker from their leader
+func forwardFetch(ctx context.Context, req consumer.FetchRequest) (consumer.FetchResponse, bool, error) {
+	config, err := topic.LoadConfig(ctx, req.Topic)
+	if err != nil || !placed(config.Replicas) {
+		return consumer.FetchResponse{}, false, nil
+	}
+	if a, assigned := assignmentOf(req.Topic, req.Partition, config.Replicas); assigned && contains(a.Replicas, settings.BrokerID) {
+		return consumer.FetchResponse{}, false, nil
+	}
+
+	leader, err := leaderOf(ctx, req.Topic, req.Partition)
+	if err != nil {
+		return consumer.FetchResponse{}, true, err
+	}
+	var records []client.Record
+	var next int
+	err = leader.do(func(c *client.Client) error {
+		records, next, err = c.Fetch(ctx, req.Topic, req.Partition, req.Offset, req.MaxWait)
+		return err
+	})
+	if err != nil {
+		return consumer.FetchResponse{}, true, fromBroker(leader.id, err)
+	}
+	resp := consumer.FetchResponse{Records: []consumer.Record{}, NextOffset: next}
+	for _, r := range records {
+		resp.Records = append(resp.Records, consumer.Record{Offset: r.Offset, Partition: r.Partition, TimeStamp: r.Timestamp, Message: r.Value})
+		resp.Bytes += len(r.Value)
+	}
+	return resp, true, nil
+}
+
+// The broker to send requests for a partition led elsewhere to
+func leaderOf(ctx context.Context, topicName string, partition int) (*peer, error) {
+	config, err := topic.LoadConfig(ctx, topicName)
+	if err != nil {
+		return nil, err
+	}
+	a, assigned := assignmentOf(topicName, partition, config.Replicas)
+	if !assigned || a.Leader == NoLeader {
+		return nil, fmt.Errorf("%w: %s-%d has no leader", producer.ErrNotLeader, topicName, partition)
+	}
+	return peerOf(a.Leader)
+}
+
+// Turn errors of another broker back into the producer's
+func fromBroker(id int, err error) error {
+	switch {
+	case client.IsNotEnoughReplicas(err):
+		return fmt.Errorf("%w: broker %d: %v", producer.ErrNotEnoughReplicas, id, err)
+	case client.IsNotLeader(err):
+		return fmt.Errorf("%w: broker %d: %v", producer.ErrNotLeader, id, err)
+	}
+	return fmt.Errorf("broker %d: %w", id, err)
+}
+
+func contains(ids []int, id int) bool {
+	for _, candidate := range ids {
+		if candidate == id {
+			return true
+		}
+	}
+	return false
+}
+
+func equalIDs(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// peer keeps idle connections to another broker, each runs one request at a time
+type peer struct {
+	id   int
+	addr string
+	idle chan *client.Client
+}
+
+func peerOf(id int) (*peer, error) {
+	peersLock.RLock()
+	defer peersLock.RUnlock()
+	p, found := peers[id]
+	if !found {
+		return nil, fmt.Errorf("%w: broker %d leads the partition but is not reachable", producer.ErrNotLeader, id)
+	}
+	return p, nil
+}
+
+// Every other broker
+func allPeers() []*peer {
+	peersLock.RLock()
+	defer peersLock.RUnlock()
+	all := make([]*peer, 0, len(peers))
+	for _, p := range peers {
+		all = append(all, p)
+	}
+	return all
+}
+
+func (p *peer) do(fn func(c *client.Client) error) error {
+	var c *client.Client
+	select {
+	case c = <-p.idle:
+	default:
+		c = client.NewClient(p.addr)
+	}
+	err := fn(c)
+	select {
+	case p.idle <- c:
+	default:
+		c.Close()
+	}
+	return err
+}
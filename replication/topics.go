@@ -0,0 +1,196 @@
+package replication
+
+import (
+	"FranzMQ/client"
+	"FranzMQ/topic"
+	"context"
+	"errors"
+	"log"
+	"strconv"
+	"time"
+)
+
+// Pass a topic created here on to the other brokers. They pass it on as
+// well, which the brokers that already have it refuse.
+func topicCreated(ctx context.Context, name string, config topic.Config) {
+	syncPartitions(name, config)
+	if settings.Managed {
+		return // The controller passes topics on
+	}
+
+	for _, p := range allPeers() {
+		err := p.do(func(c *client.Client) error {
+			return c.CreateTopic(ctx, name, client.TopicConfig{
+				Partitions:  config.NumOfPartition,
+				Replicas:    config.Replicas,
+				Compression: config.Compression,
+				DataType:    config.DataType,
+			})
+		})
+		if err != nil && !refused(err) {
+			log.Println("Error creating topic", name, "on broker", p.id, err)
+		}
+	}
+	pushConfigs(ctx, name, false)
+}
+
+// Topic changes are locked while listeners run, and the other brokers call
+// back, so deletions and config changes are passed on in the background
+func topicDeleted(ctx context.Context, name string) {
+	dropPartitions(name)
+	if settings.Managed {
+		return
+	}
+
+	go func() {
+		for _, p := range allPeers() {
+			err := p.do(func(c *client.Client) error { return c.DeleteTopic(context.Background(), name) })
+			if err != nil && !refused(err) {
+				log.Println("Error deleting topic", name, "on broker", p.id, err)
+			}
+		}
+	}()
+}
+
+func topicChanged(ctx context.Context, name string, config topic.Config) {
+	syncPartitions(name, config)
+	if !settings.Managed {
+		go pushConfigs(context.Background(), name, true)
+	}
+}
+
+// Bring the partition count and dynamic settings of a topic on the other
+// brokers in line with this one. Only differences are sent, so brokers
+// passing the change on stop once everyone agrees. Settings left at the
+// default here are only reset elsewhere with resets, a broker that just got
+// the topic has nothing but defaults yet.
+func pushConfigs(ctx context.Context, name string, resets bool) {
+	local, err := topic.DescribeConfigs(ctx, name)
+	if err != nil {
+		return // Deleted meanwhile
+	}
+	for _, p := range allPeers() {
+		err := p.do(func(c *client.Client) error {
+			remote, err := c.DescribeConfigs(ctx, name)
+			if err != nil {
+				return err
+			}
+			remoteValues := map[string]string{}
+			for _, entry := range remote {
+				remoteValues[entry.Name] = settingValue(entry.Value, entry.Default)
+			}
+
+			changes := map[string]string{}
+			for _, entry := range local {
+				value := settingValue(entry.Value, entry.Default)
+				switch {
+				case entry.Name == "partitions":
+					if entry.Value != remoteValues[entry.Name] {
+						count, _ := strconv.Atoi(entry.Value)
+						remoteCount, _ := strconv.Atoi(remoteValues[entry.Name])
+						if count > remoteCount {
+							if err := c.CreatePartitions(ctx, name, count); err != nil {
+								return err
+							}
+						}
+					}
+				case !entry.ReadOnly && value != remoteValues[entry.Name] && (resets || value != ""):
+					changes[entry.Name] = value
+				}
+			}
+			if len(changes) == 0 {
+				return nil
+			}
+			return c.AlterConfigs(ctx, name, changes)
+		})
+		if err != nil && !refused(err) {
+			log.Println("Error passing on the config of topic", name, "to broker", p.id, err)
+		}
+	}
+}
+
+// Value to set for a setting, empty for the broker default
+func settingValue(value string, isDefault bool) string {
+	if isDefault {
+		return ""
+	}
+	return value
+}
+
+// Create the topics the other brokers have and this one is missing, for
+// example because they were created while it was down. Brokers that cannot
+// be reached yet are tried again until each answered once.
+func pullTopics() {
+	pending := map[int]*peer{}
+	for _, p := range allPeers() {
+		pending[p.id] = p
+	}
+	for len(pending) > 0 {
+		for id, p := range pending {
+			if err := pullTopicsFrom(p); err != nil {
+				continue
+			}
+			delete(pending, id)
+		}
+		if len(pending) > 0 {
+			time.Sleep(time.Second)
+		}
+	}
+}
+
+func pullTopicsFrom(p *peer) error {
+	ctx := context.Background()
+	var names map[string]int
+	err := p.do(func(c *client.Client) (err error) {
+		names, err = c.ListTopics(ctx)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	for name := range names {
+		if _, err := topic.LoadConfig(ctx, name); err == nil {
+			continue
+		}
+		var entries []client.ConfigEntry
+		err := p.do(func(c *client.Client) (err error) {
+			entries, err = c.DescribeConfigs(ctx, name)
+			return err
+		})
+		if err != nil {
+			log.Println("Error describing topic", name, "on broker", p.id, err)
+			continue
+		}
+
+		config := topic.Config{PartitionStratergy: "HASH"}
+		changes := map[string]string{}
+		for _, entry := range entries {
+			switch {
+			case entry.Name == "partitions":
+				config.NumOfPartition, _ = strconv.Atoi(entry.Value)
+			case entry.Name == "replicas":
+				config.Replicas, _ = strconv.Atoi(entry.Value)
+			case !entry.ReadOnly && !entry.Default:
+				changes[entry.Name] = entry.Value
+			}
+		}
+		if _, err := topic.CreateAtTopic(name, config); err != nil {
+			continue // Created meanwhile
+		}
+		if len(changes) > 0 {
+			if _, err := topic.AlterConfigs(ctx, name, changes); err != nil {
+				log.Println("Error applying the config of topic", name, err)
+			}
+		}
+		log.Println("Created topic", name, "known to broker", p.id)
+	}
+	return nil
+}
+
+// The other broker got the request and turned it down, mostly because it
+// already made the change
+func refused(err error) bool {
+	var brokerErr *client.BrokerError
+	return errors.As(err, &brokerErr)
+}
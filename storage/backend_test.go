@@ -0,0 +1,98 @@
+package storage
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"testing"
+)
+
+func TestBackends(t *testing.T) {
+	for name, b := range map[string]Backend{
+		"file":   NewFileBackend(),
+		"memory": NewMemoryBackend(),
+	} {
+		t.Run(name, func(t *testing.T) {
+			testBackend(t, b, t.TempDir())
+		})
+	}
+}
+
+func testBackend(t *testing.T, b Backend, dir string) {
+	SetBackend(b)
+	defer SetBackend(NewFileBackend())
+
+	log := dir + "/topic/topic-0.log"
+	if err := b.MkdirAll(dir + "/topic/index"); err != nil {
+		t.Fatalf("mkdir failed: %v", err)
+	}
+	if _, err := b.ReadFile(log); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Expected a missing file to match fs.ErrNotExist, got %v", err)
+	}
+
+	for _, entry := range []string{"1--0--1--a\n", "2--0--2--b\n", "3--0--3--c"} {
+		if err := b.Append(log, []byte(entry)); err != nil {
+			t.Fatalf("append failed: %v", err)
+		}
+	}
+	if err := b.Sync(log); err != nil {
+		t.Fatalf("sync failed: %v", err)
+	}
+	if data, _ := b.ReadRange(log, 11, 11); string(data) != "2--0--2--b\n" {
+		t.Errorf("Expected the second entry, got %q", data)
+	}
+	if data, _ := b.ReadRange(log, 25, 100); string(data) != "0--3--c" {
+		t.Errorf("Expected a short read at the end of the file, got %q", data)
+	}
+	if data, _ := io.ReadAll(NewReader(log, 22)); string(data) != "3--0--3--c" {
+		t.Errorf("Expected the reader to start at its offset, got %q", data)
+	}
+
+	if err := b.Truncate(log, 22); err != nil {
+		t.Fatalf("truncate failed: %v", err)
+	}
+	if size, _ := b.Size(log); size != 22 {
+		t.Errorf("Expected 22 bytes after truncating, got %d", size)
+	}
+	// Appends after a close land behind the truncated content
+	b.Close(log)
+	b.Append(log, []byte("3--0--3--d\n"))
+	if data, _ := b.ReadFile(log); string(data) != "1--0--1--a\n2--0--2--b\n3--0--3--d\n" {
+		t.Errorf("Unexpected log after truncate and append: %q", data)
+	}
+
+	b.WriteFile(log+".1", []byte("rolled"))
+	b.WriteFile(dir+"/topic/topic-1.log", nil)
+	if segments, _ := b.Segments(log); len(segments) != 2 || segments[0] != log || segments[1] != log+".1" {
+		t.Errorf("Expected the log and its rolled segment, got %v", segments)
+	}
+
+	entries, err := b.List(dir + "/topic")
+	if err != nil {
+		t.Fatalf("list failed: %v", err)
+	}
+	dirs, files := 0, 0
+	for _, entry := range entries {
+		if entry.Dir {
+			dirs++
+		} else {
+			files++
+		}
+	}
+	if dirs != 1 || files != 3 {
+		t.Errorf("Expected 1 dir and 3 files, got %v", entries)
+	}
+
+	if err := b.Rename(dir+"/topic", dir+"/moved"); err != nil {
+		t.Fatalf("rename failed: %v", err)
+	}
+	if b.Exists(log) || !b.Exists(dir+"/moved/topic-0.log") || !b.Exists(dir+"/moved/index") {
+		t.Errorf("Expected files and dirs to move with their parent")
+	}
+	if err := b.RemoveAll(dir + "/moved"); err != nil {
+		t.Fatalf("remove failed: %v", err)
+	}
+	if b.Exists(dir + "/moved/topic-0.log") {
+		t.Errorf("Expected the file to be removed with its dir")
+	}
+}
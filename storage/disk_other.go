@@ -0,0 +1,8 @@
+//go:build !linux && !darwin
+
+package storage
+
+// Free space is unknown here, partitions all go to the first log dir
+func diskFree(dir string) (int64, error) {
+	return 0, nil
+}
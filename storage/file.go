@@ -0,0 +1,144 @@
+package storage
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// FileBackend keeps files on the local filesystem, with the files being
+// appended to held open
+type FileBackend struct {
+	mu      sync.Mutex
+	handles map[string]*os.File
+}
+
+func NewFileBackend() *FileBackend {
+	return &FileBackend{handles: make(map[string]*os.File)}
+}
+
+func (b *FileBackend) Append(path string, data []byte) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	file, open := b.handles[path]
+	if !open {
+		var err error
+		if file, err = os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0666); err != nil {
+			return err
+		}
+		b.handles[path] = file
+	}
+	_, err := file.Write(data)
+	return err
+}
+
+func (b *FileBackend) ReadRange(path string, offset int64, length int) ([]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	buf := make([]byte, length)
+	n, err := file.ReadAt(buf, offset)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	return buf[:n], nil
+}
+
+func (b *FileBackend) Size(path string) (int64, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+func (b *FileBackend) Truncate(path string, size int64) error {
+	return os.Truncate(path, size)
+}
+
+func (b *FileBackend) Segments(path string) ([]string, error) {
+	matches, err := filepath.Glob(path + "*")
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(matches)
+	return matches, nil
+}
+
+func (b *FileBackend) Sync(path string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if file, open := b.handles[path]; open {
+		return file.Sync()
+	}
+	return nil
+}
+
+func (b *FileBackend) Close(path string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	file, open := b.handles[path]
+	if !open {
+		return nil
+	}
+	delete(b.handles, path)
+	return file.Close()
+}
+
+func (b *FileBackend) ReadFile(path string) ([]byte, error) {
+	return os.ReadFile(path)
+}
+
+// Written to a temp file first so a crash never leaves half a file
+func (b *FileBackend) WriteFile(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path+".tmp", data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+func (b *FileBackend) Exists(path string) bool {
+	_, err := os.Stat(path)
+	if err != nil && !os.IsNotExist(err) {
+		fmt.Println("Error checking file:", err)
+	}
+	return err == nil || !os.IsNotExist(err)
+}
+
+func (b *FileBackend) MkdirAll(dir string) error {
+	return os.MkdirAll(dir, 0755)
+}
+
+func (b *FileBackend) List(dir string) ([]Entry, error) {
+	dirEntries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]Entry, 0, len(dirEntries))
+	for _, e := range dirEntries {
+		entries = append(entries, Entry{Name: e.Name(), Dir: e.IsDir()})
+	}
+	return entries, nil
+}
+
+func (b *FileBackend) Rename(from, to string) error {
+	return os.Rename(from, to)
+}
+
+func (b *FileBackend) RemoveAll(path string) error {
+	return os.RemoveAll(path)
+}
+
+func (b *FileBackend) Free(dir string) (int64, error) {
+	return diskFree(dir)
+}
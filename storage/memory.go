@@ -0,0 +1,215 @@
+package storage
+
+import (
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// MemoryBackend keeps every file in memory, for tests and brokers whose data
+// may go away with the process
+type MemoryBackend struct {
+	mu    sync.RWMutex
+	files map[string][]byte
+	dirs  map[string]bool
+}
+
+func NewMemoryBackend() *MemoryBackend {
+	return &MemoryBackend{files: make(map[string][]byte), dirs: make(map[string]bool)}
+}
+
+func (b *MemoryBackend) Append(p string, data []byte) error {
+	p = path.Clean(p)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.addParents(p)
+	b.files[p] = append(b.files[p], data...)
+	return nil
+}
+
+func (b *MemoryBackend) ReadRange(p string, offset int64, length int) ([]byte, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	data, exists := b.files[path.Clean(p)]
+	if !exists {
+		return nil, notExist("read", p)
+	}
+	if offset >= int64(len(data)) {
+		return []byte{}, nil
+	}
+	end := min(offset+int64(length), int64(len(data)))
+	return append([]byte{}, data[offset:end]...), nil
+}
+
+func (b *MemoryBackend) Size(p string) (int64, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	data, exists := b.files[path.Clean(p)]
+	if !exists {
+		return 0, notExist("stat", p)
+	}
+	return int64(len(data)), nil
+}
+
+func (b *MemoryBackend) Truncate(p string, size int64) error {
+	p = path.Clean(p)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	data, exists := b.files[p]
+	if !exists {
+		return notExist("truncate", p)
+	}
+	if size < int64(len(data)) {
+		// Copy so readers holding the old slice keep what they read
+		b.files[p] = append([]byte{}, data[:size]...)
+	}
+	return nil
+}
+
+func (b *MemoryBackend) Segments(p string) ([]string, error) {
+	p = path.Clean(p)
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	segments := []string{}
+	for name := range b.files {
+		if strings.HasPrefix(name, p) {
+			segments = append(segments, name)
+		}
+	}
+	sort.Strings(segments)
+	return segments, nil
+}
+
+func (b *MemoryBackend) Sync(string) error  { return nil }
+func (b *MemoryBackend) Close(string) error { return nil }
+
+func (b *MemoryBackend) ReadFile(p string) ([]byte, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	data, exists := b.files[path.Clean(p)]
+	if !exists {
+		return nil, notExist("open", p)
+	}
+	return append([]byte{}, data...), nil
+}
+
+func (b *MemoryBackend) WriteFile(p string, data []byte) error {
+	p = path.Clean(p)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.addParents(p)
+	b.files[p] = append([]byte{}, data...)
+	return nil
+}
+
+func (b *MemoryBackend) Exists(p string) bool {
+	p = path.Clean(p)
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	_, isFile := b.files[p]
+	return isFile || b.dirs[p]
+}
+
+func (b *MemoryBackend) MkdirAll(dir string) error {
+	dir = path.Clean(dir)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.dirs[dir] = true
+	b.addParents(dir)
+	return nil
+}
+
+func (b *MemoryBackend) List(dir string) ([]Entry, error) {
+	dir = path.Clean(dir)
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if !b.dirs[dir] {
+		return nil, notExist("open", dir)
+	}
+
+	children := map[string]bool{} // Name → is a directory
+	for name := range b.files {
+		if rest, found := strings.CutPrefix(name, dir+"/"); found && !strings.Contains(rest, "/") {
+			children[rest] = false
+		}
+	}
+	for name := range b.dirs {
+		if rest, found := strings.CutPrefix(name, dir+"/"); found && !strings.Contains(rest, "/") {
+			children[rest] = true
+		}
+	}
+	entries := make([]Entry, 0, len(children))
+	for name, isDir := range children {
+		entries = append(entries, Entry{Name: name, Dir: isDir})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+	return entries, nil
+}
+
+func (b *MemoryBackend) Rename(from, to string) error {
+	from, to = path.Clean(from), path.Clean(to)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	_, isFile := b.files[from]
+	if !isFile && !b.dirs[from] {
+		return notExist("rename", from)
+	}
+	moved := map[string][]byte{}
+	for name, data := range b.files {
+		if name == from || strings.HasPrefix(name, from+"/") {
+			delete(b.files, name)
+			moved[to+strings.TrimPrefix(name, from)] = data
+		}
+	}
+	for name, data := range moved {
+		b.files[name] = data
+	}
+	movedDirs := []string{}
+	for name := range b.dirs {
+		if name == from || strings.HasPrefix(name, from+"/") {
+			delete(b.dirs, name)
+			movedDirs = append(movedDirs, to+strings.TrimPrefix(name, from))
+		}
+	}
+	for _, name := range movedDirs {
+		b.dirs[name] = true
+	}
+	b.addParents(to)
+	return nil
+}
+
+func (b *MemoryBackend) RemoveAll(p string) error {
+	p = path.Clean(p)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for name := range b.files {
+		if name == p || strings.HasPrefix(name, p+"/") {
+			delete(b.files, name)
+		}
+	}
+	for name := range b.dirs {
+		if name == p || strings.HasPrefix(name, p+"/") {
+			delete(b.dirs, name)
+		}
+	}
+	return nil
+}
+
+// Memory has no free space to compare, placement falls back to partition counts
+func (b *MemoryBackend) Free(string) (int64, error) {
+	return 0, nil
+}
+
+// Must be called with b.mu held
+func (b *MemoryBackend) addParents(p string) {
+	for dir := path.Dir(p); dir != "." && dir != "/" && !b.dirs[dir]; dir = path.Dir(dir) {
+		b.dirs[dir] = true
+	}
+}
+
+func notExist(op, p string) error {
+	return &fs.PathError{Op: op, Path: p, Err: fs.ErrNotExist}
+}
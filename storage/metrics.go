@@ -0,0 +1,50 @@
+package storage
+
+import (
+	"FranzMQ/metrics"
+	"strings"
+)
+
+func init() {
+	metrics.RegisterGauges("franzmq_topic_disk_bytes", "Bytes the files of a topic take across the log dirs",
+		[]string{"topic"}, topicSizes)
+}
+
+// Size of every topic's files, local segments included
+func topicSizes() []metrics.Sample {
+	sizes := map[string]int64{}
+	for _, dir := range LogDirs() {
+		topics, err := List(dir)
+		if err != nil {
+			continue
+		}
+		for _, t := range topics {
+			if !t.Dir || strings.HasPrefix(t.Name, ".") || !Exists(ConfigPath(t.Name)) {
+				continue
+			}
+			sizes[t.Name] += dirSize(dir + t.Name + "/")
+		}
+	}
+	samples := make([]metrics.Sample, 0, len(sizes))
+	for name, size := range sizes {
+		samples = append(samples, metrics.Sample{Labels: []string{name}, Value: float64(size)})
+	}
+	return samples
+}
+
+func dirSize(dir string) int64 {
+	entries, err := List(dir)
+	if err != nil {
+		return 0
+	}
+	var total int64
+	for _, e := range entries {
+		if e.Dir {
+			continue
+		}
+		if size, err := Size(dir + e.Name); err == nil {
+			total += size
+		}
+	}
+	return total
+}
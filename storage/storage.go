@@ -0,0 +1,198 @@
+// Package storage decides where topic files live. Every topic has a directory
+// in the metadata dir (constants.FilesDir) holding its config, and each
+// partition keeps its log, index and meta files in <logDir>/<topic>/ of one of
+// the log dirs. Without configured log dirs the metadata dir is the only one,
+// so everything of a topic sits in a single directory.
+package storage
+
+import (
+	"FranzMQ/constants"
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const deletedDirName = ".deleted" // Inside each log dir, topics waiting for their files to be removed
+
+var (
+	logDirsLock sync.RWMutex
+	logDirs     []string // Each ends in a slash, empty means constants.FilesDir only
+
+	placement sync.Map // Key: topic-partition, Value: log dir hosting it
+	freeSpace = backendFree
+)
+
+// SetLogDirs sets the directories partitions are spread across. It must run
+// before any topic is used.
+func SetLogDirs(dirs []string) {
+	logDirsLock.Lock()
+	defer logDirsLock.Unlock()
+	logDirs = nil
+	for _, dir := range dirs {
+		if dir != "" {
+			logDirs = append(logDirs, strings.TrimSuffix(dir, "/")+"/")
+		}
+	}
+}
+
+// LogDirs returns the directories partitions are spread across
+func LogDirs() []string {
+	logDirsLock.RLock()
+	defer logDirsLock.RUnlock()
+	if len(logDirs) == 0 {
+		return []string{constants.FilesDir}
+	}
+	return append([]string{}, logDirs...)
+}
+
+// TopicDir returns the metadata directory of a topic
+func TopicDir(topic string) string {
+	return constants.FilesDir + topic + "/"
+}
+
+// ConfigPath returns the file a topic's config is stored in
+func ConfigPath(topic string) string {
+	return TopicDir(topic) + topic + ".json"
+}
+
+// LogPath returns the log file of a partition
+func LogPath(topic string, partition int) string {
+	return partitionDir(topic, partition) + topic + "-" + strconv.Itoa(partition) + ".log"
+}
+
+// IndexPath returns the index file of a partition
+func IndexPath(topic string, partition int) string {
+	return partitionDir(topic, partition) + "index/" + topic + "-" + strconv.Itoa(partition) + ".index"
+}
+
+// MetaPath returns the meta file of a partition
+func MetaPath(topic string, partition int) string {
+	return partitionDir(topic, partition) + "meta/" + topic + "-" + strconv.Itoa(partition) + ".json"
+}
+
+// SegmentsPath returns the manifest of a partition's closed segments
+func SegmentsPath(topic string, partition int) string {
+	return partitionDir(topic, partition) + "meta/" + topic + "-" + strconv.Itoa(partition) + ".segments"
+}
+
+// LeaderEpochsPath returns the checkpoint of the offsets each leader epoch of
+// a partition starts at
+func LeaderEpochsPath(topic string, partition int) string {
+	return partitionDir(topic, partition) + topic + "-" + strconv.Itoa(partition) + ".leader-epoch-checkpoint"
+}
+
+// PlacePartition picks the log dir with the most free space for a new
+// partition and creates its directories there
+func PlacePartition(ctx context.Context, topic string, partition int) (string, error) {
+	_, span := constants.Tracer.Start(ctx, "PlacePartition")
+	defer span.End()
+
+	// Dirs sharing a filesystem report the same free space, the one with fewer partitions wins
+	placed := map[string]int{}
+	placement.Range(func(_, dir interface{}) bool {
+		placed[dir.(string)]++
+		return true
+	})
+
+	dirs := LogDirs()
+	best, bestFree := dirs[0], int64(-1)
+	for _, dir := range dirs {
+		if err := MkdirAll(dir); err != nil {
+			log.Println("Skipping log dir", dir, err)
+			continue
+		}
+		free, err := freeSpace(dir)
+		if err != nil {
+			log.Println("Error reading free space of", dir, err)
+			continue
+		}
+		if free > bestFree || (free == bestFree && placed[dir] < placed[best]) {
+			best, bestFree = dir, free
+		}
+	}
+
+	topicDir := best + topic + "/"
+	for _, path := range []string{topicDir + "meta", topicDir + "index"} {
+		if err := MkdirAll(path); err != nil {
+			return "", fmt.Errorf("error creating directory: %s", path)
+		}
+	}
+	placement.Store(partitionKey(topic, partition), best)
+	return topicDir, nil
+}
+
+// MarkDeleted moves the partition directories of a topic out of the way in
+// every log dir other than the metadata dir, which the caller handles
+func MarkDeleted(ctx context.Context, topic string) error {
+	_, span := constants.Tracer.Start(ctx, "MarkDeleted")
+	defer span.End()
+
+	suffix := "-" + strconv.FormatInt(time.Now().UnixNano(), 10)
+	for _, dir := range LogDirs() {
+		if dir == constants.FilesDir {
+			continue
+		}
+		if !Exists(dir + topic) {
+			continue
+		}
+		if err := MkdirAll(dir + deletedDirName); err != nil {
+			return fmt.Errorf("error creating deleted topics directory: %w", err)
+		}
+		if err := Rename(dir+topic, dir+deletedDirName+"/"+topic+suffix); err != nil {
+			return fmt.Errorf("error marking topic for deletion: %w", err)
+		}
+	}
+	return nil
+}
+
+// Forget drops the remembered placement of a topic's partitions
+func Forget(topic string) {
+	placement.Range(func(key, _ interface{}) bool {
+		if rest, found := strings.CutPrefix(key.(string), topic+"-"); found {
+			if _, err := strconv.Atoi(rest); err == nil {
+				placement.Delete(key)
+			}
+		}
+		return true
+	})
+}
+
+// PurgeDeleted removes the partition files MarkDeleted moved away
+func PurgeDeleted() {
+	for _, dir := range LogDirs() {
+		if err := RemoveAll(dir + deletedDirName); err != nil {
+			log.Println("Error purging deleted topics in", dir, err)
+		}
+	}
+}
+
+// Find the topic directory hosting a partition, remembered once found. A
+// partition not on disk resolves to the first log dir.
+func partitionDir(topic string, partition int) string {
+	key := partitionKey(topic, partition)
+	if dir, found := placement.Load(key); found {
+		return dir.(string) + topic + "/"
+	}
+
+	dirs := LogDirs()
+	name := topic + "-" + strconv.Itoa(partition) + ".log"
+	for _, dir := range dirs {
+		if Exists(dir + topic + "/" + name) {
+			placement.Store(key, dir)
+			return dir + topic + "/"
+		}
+	}
+	return dirs[0] + topic + "/"
+}
+
+func backendFree(dir string) (int64, error) {
+	return current().Free(dir)
+}
+
+func partitionKey(topic string, partition int) string {
+	return topic + "-" + strconv.Itoa(partition)
+}
@@ -0,0 +1,84 @@
+package storage
+
+import (
+	"FranzMQ/constants"
+	"context"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestPlacePartition_SpreadsByFreeSpace(t *testing.T) {
+	small, large := t.TempDir()+"/", t.TempDir()+"/"
+	SetLogDirs([]string{small, large})
+	defer SetLogDirs(nil)
+	defer Forget("jbod_topic")
+	freeSpace = func(dir string) (int64, error) {
+		if dir == large {
+			return 1 << 30, nil
+		}
+		return 1 << 20, nil
+	}
+	defer func() { freeSpace = backendFree }()
+
+	if _, err := PlacePartition(context.Background(), "jbod_topic", 0); err != nil {
+		t.Fatalf("place failed: %v", err)
+	}
+	if path := LogPath("jbod_topic", 0); !strings.HasPrefix(path, large+"jbod_topic/") {
+		t.Errorf("Expected the partition in the dir with more free space, got %s", path)
+	}
+
+	// Same free space everywhere, the dir with fewer partitions wins
+	freeSpace = func(string) (int64, error) { return 1 << 30, nil }
+	if _, err := PlacePartition(context.Background(), "jbod_topic", 1); err != nil {
+		t.Fatalf("place failed: %v", err)
+	}
+	if path := IndexPath("jbod_topic", 1); !strings.HasPrefix(path, small+"jbod_topic/index/") {
+		t.Errorf("Expected the partition in the emptier dir, got %s", path)
+	}
+
+	// After a restart partitions are found by looking at the disks
+	WriteFile(LogPath("jbod_topic", 1), nil)
+	Forget("jbod_topic")
+	if path := LogPath("jbod_topic", 1); !strings.HasPrefix(path, small) {
+		t.Errorf("Expected the partition to be found in %s, got %s", small, path)
+	}
+
+	if err := MarkDeleted(context.Background(), "jbod_topic"); err != nil {
+		t.Fatalf("mark deleted failed: %v", err)
+	}
+	if _, err := os.Stat(small + "jbod_topic"); !os.IsNotExist(err) {
+		t.Errorf("Expected the partition directory to be moved away, got %v", err)
+	}
+	PurgeDeleted()
+	if _, err := os.Stat(small + deletedDirName); !os.IsNotExist(err) {
+		t.Errorf("Expected deleted partitions to be purged, got %v", err)
+	}
+}
+
+func TestTopicSizes_SumsFilesAcrossLogDirs(t *testing.T) {
+	dataDir, first, second := t.TempDir(), t.TempDir()+"/", t.TempDir()+"/"
+	filesDir, groupsDir, deletedDir := constants.FilesDir, constants.GroupsDir, constants.DeletedDir
+	constants.SetDataDir(dataDir)
+	defer func() {
+		constants.FilesDir, constants.GroupsDir, constants.DeletedDir = filesDir, groupsDir, deletedDir
+	}()
+	SetLogDirs([]string{first, second})
+	defer SetLogDirs(nil)
+	defer Forget("sized_topic")
+
+	WriteFile(ConfigPath("sized_topic"), []byte("{}"))
+	for partition, dir := range []string{first, second} {
+		placement.Store("sized_topic-"+strconv.Itoa(partition), dir)
+		WriteFile(LogPath("sized_topic", partition), make([]byte, 100))
+		WriteFile(IndexPath("sized_topic", partition), make([]byte, 10))
+	}
+	// Directories of topics without a config are not counted
+	WriteFile(first+"stray/stray-0.log", make([]byte, 50))
+
+	samples := topicSizes()
+	if len(samples) != 1 || samples[0].Labels[0] != "sized_topic" || samples[0].Value != 200 {
+		t.Errorf("Expected only sized_topic with the 200 bytes of its logs, got %+v", samples)
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"FranzMQ/constants"
+	"FranzMQ/consumer"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+var streamHeartbeatInterval = 15 * time.Second
+
+// streamMessages pushes records of a topic partition to the client as
+// server-sent events. Every event carries its offset as the event id, so a
+// reconnecting EventSource resumes after the last record it saw through the
+// Last-Event-ID header.
+//
+// GET /stream?topic=<name>&partition=<n>&offset=<n>
+func streamMessages(w http.ResponseWriter, r *http.Request) {
+	ctx, span := constants.Tracer.Start(r.Context(), "streamMessages GET")
+	defer span.End()
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	topicName := query.Get("topic")
+	partition, err := queryInt(query.Get("partition"), 0)
+	if err != nil {
+		jsonResponse(w, http.StatusBadRequest, "Invalid partition")
+		return
+	}
+	offset, err := queryInt(query.Get("offset"), 0)
+	if err != nil {
+		jsonResponse(w, http.StatusBadRequest, "Invalid offset")
+		return
+	}
+	if lastEventID := r.Header.Get("Last-Event-ID"); lastEventID != "" {
+		lastOffset, err := strconv.Atoi(lastEventID)
+		if err != nil {
+			jsonResponse(w, http.StatusBadRequest, "Invalid Last-Event-ID")
+			return
+		}
+		offset = lastOffset + 1
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		jsonResponse(w, http.StatusInternalServerError, "Streaming not supported")
+		return
+	}
+
+	// Fail fast on unknown topic or partition before switching to a stream
+	if _, err := consumer.Fetch(ctx, consumer.FetchRequest{Topic: topicName, Partition: partition, Offset: offset, MaxBytes: 1}); err != nil {
+		jsonResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	log.Println("Streaming topic:", topicName, "partition:", partition, "from offset:", offset)
+	for ctx.Err() == nil {
+		resp, err := consumer.Fetch(ctx, consumer.FetchRequest{
+			Topic:     topicName,
+			Partition: partition,
+			Offset:    offset,
+			MinBytes:  1,
+			MaxWait:   streamHeartbeatInterval,
+		})
+		if err != nil {
+			fmt.Fprintf(w, "event: error\ndata: %s\n\n", err.Error())
+			flusher.Flush()
+			return
+		}
+
+		if len(resp.Records) == 0 {
+			// Keep proxies and the browser from timing out an idle stream
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+			continue
+		}
+
+		for _, record := range resp.Records {
+			data, err := json.Marshal(record)
+			if err != nil {
+				log.Println("Error encoding record:", err)
+				return
+			}
+			if _, err := fmt.Fprintf(w, "id: %d\ndata: %s\n\n", record.Offset, data); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+		offset = resp.NextOffset
+	}
+}
+
+// Parse an optional integer query parameter
+func queryInt(value string, fallback int) (int, error) {
+	if value == "" {
+		return fallback, nil
+	}
+	return strconv.Atoi(value)
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"FranzMQ/constants"
+	"FranzMQ/producer"
+	"FranzMQ/storage"
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func init() {
+	storage.SetBackend(storage.NewMemoryBackend())
+	go producer.GlobalWriterThread(producer.GlobalLogWriterQueue)
+	go producer.GlobalWriterThread(producer.GlobalIndexWriterQueue)
+}
+
+func setupStreamTopic(topic string) {
+	storage.MkdirAll(constants.FilesDir + topic + "/meta")
+	storage.MkdirAll(constants.FilesDir + topic + "/index")
+	configData, _ := json.Marshal(map[string]interface{}{"NumOfPartition": 1})
+	storage.WriteFile(constants.FilesDir+topic+"/"+topic+".json", configData)
+	storage.WriteFile(constants.FilesDir+topic+"/"+topic+"-0.log", []byte(""))
+	storage.WriteFile(constants.FilesDir+topic+"/index/"+topic+"-0.index", []byte("timestamp--start--end--offset\n"))
+}
+
+// Open the stream of a topic, the body is read line by line
+func openStream(t *testing.T, ctx context.Context, url string, lastEventID string) *bufio.Scanner {
+	t.Helper()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("stream request failed: %v", err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("Expected an event stream, got %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	return bufio.NewScanner(resp.Body)
+}
+
+// The next line of the stream that is not blank
+func nextLine(t *testing.T, lines *bufio.Scanner) string {
+	t.Helper()
+	for lines.Scan() {
+		if lines.Text() != "" {
+			return lines.Text()
+		}
+	}
+	t.Fatalf("stream ended: %v", lines.Err())
+	return ""
+}
+
+func TestStreamMessages_ResumesAfterLastEventID(t *testing.T) {
+	topic := "stream_resume_test"
+	setupStreamTopic(topic)
+	defer storage.RemoveAll(constants.FilesDir + topic)
+	server := httptest.NewServer(http.HandlerFunc(streamMessages))
+	defer server.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel() // Before the server closes, it waits for the stream to end
+
+	for i := 1; i <= 3; i++ {
+		if _, _, err := producer.ProduceMessage(ctx, topic, "key", "msg-"+strconv.Itoa(i)); err != nil {
+			t.Fatalf("produce failed: %v", err)
+		}
+	}
+
+	lines := openStream(t, ctx, server.URL+"?topic="+topic+"&partition=0&offset=1", "1")
+	for _, offset := range []int{2, 3} {
+		if line := nextLine(t, lines); line != "id: "+strconv.Itoa(offset) {
+			t.Fatalf("Expected the event of offset %d, got %q", offset, line)
+		}
+		line := nextLine(t, lines)
+		if !strings.HasPrefix(line, "data: ") || !strings.Contains(line, `"msg-`+strconv.Itoa(offset)+`"`) {
+			t.Errorf("Expected msg-%d as the data of offset %d, got %q", offset, offset, line)
+		}
+	}
+}
+
+func TestStreamMessages_SendsHeartbeatsWhenIdle(t *testing.T) {
+	topic := "stream_heartbeat_test"
+	setupStreamTopic(topic)
+	defer storage.RemoveAll(constants.FilesDir + topic)
+	defer func(interval time.Duration) { streamHeartbeatInterval = interval }(streamHeartbeatInterval)
+	streamHeartbeatInterval = 20 * time.Millisecond
+	server := httptest.NewServer(http.HandlerFunc(streamMessages))
+	defer server.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	lines := openStream(t, ctx, server.URL+"?topic="+topic+"&partition=0", "")
+	for i := 0; i < 2; i++ {
+		if line := nextLine(t, lines); line != ": heartbeat" {
+			t.Fatalf("Expected a heartbeat on an idle stream, got %q", line)
+		}
+	}
+}
+
+func TestStreamMessages_StopsWhenClientDisconnects(t *testing.T) {
+	topic := "stream_disconnect_test"
+	setupStreamTopic(topic)
+	defer storage.RemoveAll(constants.FilesDir + topic)
+
+	done := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer close(done)
+		streamMessages(w, r)
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	openStream(t, ctx, server.URL+"?topic="+topic+"&partition=0", "")
+	cancel()
+
+	// The fetch waits a heartbeat interval for records, the disconnect ends it
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the stream to end once the client went away")
+	}
+}
@@ -0,0 +1,150 @@
+// Package s3test runs a small in-memory S3 compatible server, a stand-in for
+// MinIO in unit tests of code using tiered.S3Store. It speaks path style
+// PutObject, GetObject with ranges, DeleteObject and ListObjectsV2, and
+// checks requests carry a signature of its access key.
+package s3test
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+const (
+	Bucket    = "franzmq-test"
+	AccessKey = "franzmq"
+	SecretKey = "franzmq-secret"
+	Region    = "us-east-1"
+)
+
+// Server holds the objects of Bucket
+type Server struct {
+	server  *httptest.Server
+	mu      sync.Mutex
+	objects map[string][]byte // Key → content
+}
+
+// NewServer starts a server that is stopped when the test ends
+func NewServer(t testing.TB) *Server {
+	t.Helper()
+	s := &Server{objects: make(map[string][]byte)}
+	s.server = httptest.NewServer(http.HandlerFunc(s.handle))
+	t.Cleanup(s.server.Close)
+	return s
+}
+
+// URL is the endpoint to pass to tiered.NewS3Store
+func (s *Server) URL() string {
+	return s.server.URL
+}
+
+// Keys returns the keys of all stored objects, sorted
+func (s *Server) Keys() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keys := make([]string, 0, len(s.objects))
+	for key := range s.objects {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential="+AccessKey+"/") {
+		s.error(w, http.StatusForbidden, "AccessDenied")
+		return
+	}
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if bucket != Bucket {
+		s.error(w, http.StatusNotFound, "NoSuchBucket")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch {
+	case key == "" && r.Method == http.MethodGet:
+		s.list(w, r.URL.Query().Get("prefix"))
+	case r.Method == http.MethodPut:
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			s.error(w, http.StatusBadRequest, "IncompleteBody")
+			return
+		}
+		s.objects[key] = data
+	case r.Method == http.MethodGet:
+		data, exists := s.objects[key]
+		if !exists {
+			s.error(w, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		s.get(w, r, data)
+	case r.Method == http.MethodDelete:
+		delete(s.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		s.error(w, http.StatusMethodNotAllowed, "MethodNotAllowed")
+	}
+}
+
+// Serve data or the part a "bytes=first-last" range asks for
+func (s *Server) get(w http.ResponseWriter, r *http.Request, data []byte) {
+	spec, isRange := strings.CutPrefix(r.Header.Get("Range"), "bytes=")
+	if !isRange {
+		w.Write(data)
+		return
+	}
+	firstStr, lastStr, _ := strings.Cut(spec, "-")
+	first, err := strconv.Atoi(firstStr)
+	if err != nil {
+		s.error(w, http.StatusBadRequest, "InvalidRange")
+		return
+	}
+	if first >= len(data) {
+		s.error(w, http.StatusRequestedRangeNotSatisfiable, "InvalidRange")
+		return
+	}
+	last := len(data) - 1
+	if n, err := strconv.Atoi(lastStr); err == nil && n < last {
+		last = n
+	}
+	w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", first, last, len(data)))
+	w.WriteHeader(http.StatusPartialContent)
+	w.Write(data[first : last+1])
+}
+
+func (s *Server) list(w http.ResponseWriter, prefix string) {
+	type object struct {
+		Key  string `xml:"Key"`
+		Size int    `xml:"Size"`
+	}
+	result := struct {
+		XMLName     xml.Name `xml:"ListBucketResult"`
+		Name        string   `xml:"Name"`
+		Prefix      string   `xml:"Prefix"`
+		IsTruncated bool     `xml:"IsTruncated"`
+		Contents    []object `xml:"Contents"`
+	}{Name: Bucket, Prefix: prefix}
+	for key, data := range s.objects {
+		if strings.HasPrefix(key, prefix) {
+			result.Contents = append(result.Contents, object{Key: key, Size: len(data)})
+		}
+	}
+	sort.Slice(result.Contents, func(i, j int) bool { return result.Contents[i].Key < result.Contents[j].Key })
+	w.Header().Set("Content-Type", "application/xml")
+	xml.NewEncoder(w).Encode(result)
+}
+
+func (s *Server) error(w http.ResponseWriter, status int, code string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, "<Error><Code>%s</Code></Error>", code)
+}
@@ -0,0 +1,187 @@
+// Package tiered moves closed log segments off the broker's disks. Every
+// segment the producer rolls is uploaded to an object store and then removed
+// locally; fetches of old offsets read it back through producer.OpenLog.
+// Brokers may share a bucket: every broker keeps its replicas' segments
+// under its own id and only ever deletes those.
+package tiered
+
+import (
+	"FranzMQ/constants"
+	"FranzMQ/producer"
+	"FranzMQ/storage"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ObjectStore keeps uploaded segments by key. GetRange returns fewer bytes at
+// the end of an object, List returns keys sorted.
+type ObjectStore interface {
+	Put(ctx context.Context, key string, body io.Reader, size int64) error
+	GetRange(ctx context.Context, key string, offset int64, length int) ([]byte, error)
+	Delete(ctx context.Context, key string) error
+	List(ctx context.Context, prefix string) ([]string, error)
+}
+
+type partitionRef struct {
+	topic     string
+	partition int
+}
+
+var (
+	storeLock     sync.RWMutex
+	store         ObjectStore // Nil until Start
+	brokerID      int
+	retryInterval = 30 * time.Second
+
+	uploads = make(chan partitionRef, 10000)
+)
+
+// Start offloads closed segments to s from now on, under the id of this
+// broker, retrying failed uploads after retry. Segments rolled before the
+// broker started are picked up with Enqueue.
+func Start(s ObjectStore, broker int, retry time.Duration) {
+	storeLock.Lock()
+	store, brokerID = s, broker
+	if retry > 0 {
+		retryInterval = retry
+	}
+	storeLock.Unlock()
+
+	producer.SetRemoteTier(remoteTier{})
+	producer.OnSegmentRolled(func(topic string, partition int, _ producer.Segment) {
+		Enqueue(topic, partition)
+	})
+	go uploader()
+}
+
+// Enqueue schedules the local closed segments of a partition for upload
+func Enqueue(topic string, partition int) {
+	select {
+	case uploads <- partitionRef{topic: topic, partition: partition}:
+	default:
+		// Full, the partition is retried with the others once the queue drains
+		time.AfterFunc(currentRetryInterval(), func() { Enqueue(topic, partition) })
+	}
+}
+
+func currentStore() ObjectStore {
+	storeLock.RLock()
+	defer storeLock.RUnlock()
+	return store
+}
+
+func currentBrokerID() int {
+	storeLock.RLock()
+	defer storeLock.RUnlock()
+	return brokerID
+}
+
+func currentRetryInterval() time.Duration {
+	storeLock.RLock()
+	defer storeLock.RUnlock()
+	return retryInterval
+}
+
+func uploader() {
+	for ref := range uploads {
+		if err := Offload(context.Background(), ref.topic, ref.partition); err != nil {
+			log.Println("Error offloading segments of", ref.topic, ref.partition, err)
+			time.AfterFunc(currentRetryInterval(), func() { Enqueue(ref.topic, ref.partition) })
+		}
+	}
+}
+
+// Offload uploads the local closed segments of a partition and removes them
+// from the local disk
+func Offload(ctx context.Context, topic string, partition int) error {
+	ctx, span := constants.Tracer.Start(ctx, "Offload")
+	defer span.End()
+
+	s := currentStore()
+	if s == nil {
+		return fmt.Errorf("tiered storage is not started")
+	}
+	for _, segment := range producer.Segments(topic, partition) {
+		if segment.Remote {
+			continue
+		}
+		key := objectKey(currentBrokerID(), topic, partition, segment)
+		path := producer.SegmentPath(topic, partition, segment)
+		if err := s.Put(ctx, key, storage.NewReader(path, 0), segment.End-segment.Start); err != nil {
+			return fmt.Errorf("error uploading %s: %w", path, err)
+		}
+		if err := producer.MarkRemote(ctx, topic, partition, segment.Start); err != nil {
+			// Most likely the topic was deleted meanwhile, don't leave the object behind
+			if deleteErr := s.Delete(ctx, key); deleteErr != nil {
+				log.Println("Error removing orphaned segment", key, deleteErr)
+			}
+			return err
+		}
+		log.Println("Offloaded segment", key)
+	}
+	return nil
+}
+
+// Object key of a segment, <topic>/<broker>/<partition>/<start>.log with
+// the start zero padded so keys sort like the segments
+func objectKey(broker int, topic string, partition int, segment producer.Segment) string {
+	return brokerPrefix(broker, topic) + strconv.Itoa(partition) + "/" + fmt.Sprintf("%020d", segment.Start) + ".log"
+}
+
+// Prefix of the objects a broker uploaded for a topic
+func brokerPrefix(broker int, topic string) string {
+	return topic + "/" + strconv.Itoa(broker) + "/"
+}
+
+// remoteTier serves producer.OpenLog reads of offloaded segments
+type remoteTier struct{}
+
+func (remoteTier) ReadSegment(ctx context.Context, topic string, partition int, segment producer.Segment, offset int64, length int) ([]byte, error) {
+	ctx, span := constants.Tracer.Start(ctx, "ReadSegment")
+	defer span.End()
+
+	s := currentStore()
+	if s == nil {
+		return nil, fmt.Errorf("tiered storage is not started")
+	}
+	return s.GetRange(ctx, objectKey(currentBrokerID(), topic, partition, segment), offset, length)
+}
+
+// DeleteSegment deletes an uploaded segment that retention dropped
+func (remoteTier) DeleteSegment(ctx context.Context, topic string, partition int, segment producer.Segment) error {
+	ctx, span := constants.Tracer.Start(ctx, "DeleteSegment")
+	defer span.End()
+
+	s := currentStore()
+	if s == nil {
+		return fmt.Errorf("tiered storage is not started")
+	}
+	return s.Delete(ctx, objectKey(currentBrokerID(), topic, partition, segment))
+}
+
+// RemoveTopic deletes the segments this broker uploaded for a deleted topic,
+// every other broker removes its own
+func (remoteTier) RemoveTopic(ctx context.Context, topic string) error {
+	ctx, span := constants.Tracer.Start(ctx, "RemoveTopic")
+	defer span.End()
+
+	s := currentStore()
+	if s == nil {
+		return nil
+	}
+	keys, err := s.List(ctx, brokerPrefix(currentBrokerID(), topic))
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if err := s.Delete(ctx, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
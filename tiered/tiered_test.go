@@ -0,0 +1,99 @@
+package tiered
+
+import (
+	"FranzMQ/consumer"
+	"FranzMQ/producer"
+	"FranzMQ/storage"
+	"FranzMQ/topic"
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func init() {
+	storage.SetBackend(storage.NewMemoryBackend())
+	go producer.GlobalWriterThread(producer.GlobalLogWriterQueue)
+	go producer.GlobalWriterThread(producer.GlobalIndexWriterQueue)
+}
+
+func TestOffloadAndFetchFromRemote(t *testing.T) {
+	store := NewLocalStore(t.TempDir())
+	Start(store, 1, 100*time.Millisecond)
+	ctx := context.Background()
+
+	topicName := "tiered_test"
+	if _, err := topic.CreateAtTopic(topicName, topic.Config{NumOfPartition: 1, SegmentBytes: 1024 * 1024}); err != nil {
+		t.Fatalf("create topic failed: %v", err)
+	}
+	defer topic.DeleteTopic(ctx, topicName)
+
+	// Two messages fill a segment
+	value := strings.Repeat("x", 600*1024)
+	for i := 0; i < 5; i++ {
+		if _, _, err := producer.ProduceMessage(ctx, topicName, "key", map[string]string{"v": value}); err != nil {
+			t.Fatalf("produce failed: %v", err)
+		}
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		segments := producer.Segments(topicName, 0)
+		if len(segments) == 2 && segments[0].Remote && segments[1].Remote {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected 2 offloaded segments, got %+v", segments)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	segments := producer.Segments(topicName, 0)
+	if segments[0].FirstOffset != 1 || segments[0].LastOffset != 2 || segments[1].FirstOffset != 3 {
+		t.Errorf("Unexpected segment offsets %+v", segments)
+	}
+	for _, segment := range segments {
+		if storage.Exists(producer.SegmentPath(topicName, 0, segment)) {
+			t.Errorf("Expected the offloaded segment at %d to be gone locally", segment.Start)
+		}
+	}
+	if keys, _ := store.List(ctx, topicName+"/"); len(keys) != 2 {
+		t.Errorf("Expected 2 objects, got %v", keys)
+	}
+
+	// Old offsets are read back from the store, newer ones from the active log
+	resp, err := consumer.Fetch(ctx, consumer.FetchRequest{Topic: topicName, Offset: 1, MaxBytes: 10 * 1024 * 1024, MinBytes: 5 * 600 * 1024, MaxWait: 2 * time.Second})
+	if err != nil {
+		t.Fatalf("fetch failed: %v", err)
+	}
+	if len(resp.Records) != 5 {
+		t.Fatalf("Expected 5 records, got %d", len(resp.Records))
+	}
+	for i, record := range resp.Records {
+		if record.Offset != i+1 {
+			t.Errorf("Expected offset %d but got %d", i+1, record.Offset)
+		}
+	}
+	if earliest, _ := consumer.EarliestOffset(ctx, topicName, 0); earliest != 1 {
+		t.Errorf("Expected earliest offset 1 but got %d", earliest)
+	}
+
+	desc, err := topic.Describe(ctx, topicName)
+	if err != nil {
+		t.Fatalf("describe failed: %v", err)
+	}
+	if p := desc.Partitions[0]; p.Segments != 3 || p.RemoteSegments != 2 {
+		t.Errorf("Expected 3 segments with 2 remote, got %+v", p)
+	}
+
+	// Another broker sharing the bucket keeps its own objects
+	otherKey := objectKey(2, topicName, 0, segments[0])
+	if err := store.Put(ctx, otherKey, strings.NewReader("other"), 5); err != nil {
+		t.Fatalf("put failed: %v", err)
+	}
+	if err := topic.DeleteTopic(ctx, topicName); err != nil {
+		t.Fatalf("delete failed: %v", err)
+	}
+	if keys, _ := store.List(ctx, topicName+"/"); len(keys) != 1 || keys[0] != otherKey {
+		t.Errorf("Expected only the other broker's object left, got %v", keys)
+	}
+}
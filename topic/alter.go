@@ -0,0 +1,73 @@
+package topic
+
+import (
+	"FranzMQ/constants"
+	"FranzMQ/consumer"
+	"FranzMQ/producer"
+	"FranzMQ/storage"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+)
+
+var alterLock sync.Mutex // Serializes config changes
+
+// MaxPartitions is the most partitions AddPartitions grows a topic to, each
+// one takes files and a writer goroutine
+const MaxPartitions = 1024
+
+// AddPartitions grows a topic to count partitions, at most MaxPartitions.
+// Existing partitions and their messages are untouched, keys may hash to a
+// different partition from now on. Consumer groups are rebalanced so the new
+// partitions get assigned.
+func AddPartitions(ctx context.Context, name string, count int) error {
+	ctx, span := constants.Tracer.Start(ctx, "AddPartitions")
+	defer span.End()
+
+	if count > MaxPartitions {
+		return fmt.Errorf("a topic can have at most %d partitions, %d asked for", MaxPartitions, count)
+	}
+	alterLock.Lock()
+	defer alterLock.Unlock()
+
+	config, err := LoadConfig(ctx, name)
+	if err != nil {
+		return err
+	}
+	if count <= config.NumOfPartition {
+		return fmt.Errorf("topic %s already has %d partitions, partitions can only be added", name, config.NumOfPartition)
+	}
+
+	for i := config.NumOfPartition; i < count; i++ {
+		if err := createPartitionFiles(name, i); err != nil {
+			return fmt.Errorf("error creating partition %d: %w", i, err)
+		}
+	}
+	forgetCachedFiles(name)
+	// Queues first, the producer picks partitions from the config
+	producer.InitQueues(name, count)
+
+	config.NumOfPartition = count
+	if err := saveConfig(name, config); err != nil {
+		return err
+	}
+	log.Println("Topic", name, "now has", count, "partitions")
+	notifyConfigChange(ctx, name, config)
+
+	consumer.RebalanceGroups(ctx)
+	return nil
+}
+
+// Replace a topic config, storage makes sure readers never see half of it
+func saveConfig(name string, config Config) error {
+	jsonData, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding topic config: %w", err)
+	}
+	if err := storage.WriteFile(storage.ConfigPath(name), jsonData); err != nil {
+		return fmt.Errorf("error writing topic config: %w", err)
+	}
+	return nil
+}
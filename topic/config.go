@@ -1,9 +1,19 @@
 package topic
 
+// Config is stored as <topic>.json. Zero values of the dynamic settings mean
+// the broker default, see configKeys.
 type Config struct {
 	Compression        string
 	DataType           string
-	Replicas           int    // TODO: use this to replicate
+	Replicas           int    // Brokers holding a copy of each partition, see the replication package
 	NumOfPartition     int    // 0
 	PartitionStratergy string // round robin, hash based
+	RetentionMs        int64  `json:",omitempty"` // -1 keeps messages forever
+	RetentionBytes     int64  `json:",omitempty"` // Per partition, -1 for no limit
+	SegmentBytes       int64  `json:",omitempty"`
+	MaxMessageBytes    int    `json:",omitempty"`
+	CleanupPolicy      string `json:",omitempty"` // Only delete, compaction is not implemented
+	MinInsyncReplicas  int    `json:",omitempty"` // Replicas that must have a message before it is acknowledged
+	// Elect a replica out of sync when no in-sync one is up
+	UncleanLeaderElection bool `json:",omitempty"`
 }
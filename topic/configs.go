@@ -0,0 +1,252 @@
+package topic
+
+import (
+	"FranzMQ/constants"
+	"FranzMQ/producer"
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// ConfigEntry is one setting of a topic as shown by DescribeConfigs
+type ConfigEntry struct {
+	Name     string `json:"name"`
+	Value    string `json:"value"`
+	Default  bool   `json:"default"`   // Not set on the topic, Value is the broker default
+	ReadOnly bool   `json:"read_only"` // Only changed through a dedicated API, like partitions
+	Doc      string `json:"doc"`
+}
+
+// A setting of the config schema. set gets a validated value, "" resets it to the default.
+type configKey struct {
+	name     string
+	doc      string
+	def      string
+	readOnly bool
+	validate func(string) error
+	get      func(Config) string
+	set      func(*Config, string)
+}
+
+var configKeys = []configKey{
+	{
+		name: "cleanup.policy", doc: "What happens to old segments, only delete is supported: compaction is not implemented", def: "delete",
+		validate: oneOf("delete"),
+		get:      func(c Config) string { return c.CleanupPolicy },
+		set:      func(c *Config, v string) { c.CleanupPolicy = v },
+	},
+	{
+		name: "compression", doc: "Codec label for clients: none, gzip, snappy or zstd. Not enforced, messages are stored uncompressed", def: "none",
+		validate: oneOf("none", "gzip", "snappy", "zstd"),
+		get:      func(c Config) string { return c.Compression },
+		set:      func(c *Config, v string) { c.Compression = v },
+	},
+	{
+		name: "max.message.bytes", doc: "Largest message accepted by a produce", def: strconv.Itoa(producer.DefaultMaxMessageBytes),
+		validate: intAtLeast(1),
+		get:      func(c Config) string { return formatNonZero(int64(c.MaxMessageBytes)) },
+		set:      func(c *Config, v string) { n, _ := strconv.Atoi(v); c.MaxMessageBytes = n },
+	},
+	{
+		name: "min.insync.replicas", doc: "Replicas that must be in sync for a produce to a replicated topic to succeed", def: "1",
+		validate: intAtLeast(1),
+		get:      func(c Config) string { return formatNonZero(int64(c.MinInsyncReplicas)) },
+		set:      func(c *Config, v string) { n, _ := strconv.Atoi(v); c.MinInsyncReplicas = n },
+	},
+	{
+		name: "partitions", doc: "Number of partitions, grown with AddPartitions", readOnly: true,
+		get: func(c Config) string { return strconv.Itoa(c.NumOfPartition) },
+	},
+	{
+		name: "replicas", doc: "Replication factor", readOnly: true,
+		get: func(c Config) string { return strconv.Itoa(c.Replicas) },
+	},
+	{
+		name: "retention.bytes", doc: "Size a partition may grow to before its oldest closed segments are deleted, -1 for no limit", def: "-1",
+		validate: intAtLeast(-1),
+		get:      func(c Config) string { return formatNonZero(c.RetentionBytes) },
+		set:      func(c *Config, v string) { c.RetentionBytes, _ = strconv.ParseInt(v, 10, 64) },
+	},
+	{
+		name: "retention.ms", doc: "Age after which closed segments are deleted, -1 keeps messages forever", def: "-1",
+		validate: intAtLeast(-1),
+		get:      func(c Config) string { return formatNonZero(c.RetentionMs) },
+		set:      func(c *Config, v string) { c.RetentionMs, _ = strconv.ParseInt(v, 10, 64) },
+	},
+	{
+		name: "segment.bytes", doc: "Size at which the active log segment is rolled", def: "1073741824",
+		validate: intAtLeast(1024 * 1024),
+		get:      func(c Config) string { return formatNonZero(c.SegmentBytes) },
+		set:      func(c *Config, v string) { c.SegmentBytes, _ = strconv.ParseInt(v, 10, 64) },
+	},
+	{
+		name: "unclean.leader.election.enable", doc: "Let a replica out of sync lead when no in-sync one is up, losing the messages it misses", def: "false",
+		validate: oneOf("true", "false"),
+		get: func(c Config) string {
+			if c.UncleanLeaderElection {
+				return "true"
+			}
+			return ""
+		},
+		set: func(c *Config, v string) { c.UncleanLeaderElection = v == "true" },
+	},
+}
+
+var (
+	configListenersLock sync.Mutex
+	configListeners     []func(ctx context.Context, name string, config Config)
+)
+
+// OnConfigChange registers fn to run after a topic's config changed, with
+// the new config. Like OnDelete it runs while topic changes are locked.
+func OnConfigChange(fn func(ctx context.Context, name string, config Config)) {
+	configListenersLock.Lock()
+	defer configListenersLock.Unlock()
+	configListeners = append(configListeners, fn)
+}
+
+// DescribeConfigs returns every setting of a topic, sorted by name
+func DescribeConfigs(ctx context.Context, name string) ([]ConfigEntry, error) {
+	ctx, span := constants.Tracer.Start(ctx, "DescribeConfigs")
+	defer span.End()
+
+	config, err := LoadConfig(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]ConfigEntry, 0, len(configKeys))
+	for _, key := range configKeys {
+		entry := ConfigEntry{Name: key.name, Value: key.get(config), ReadOnly: key.readOnly, Doc: key.doc}
+		if entry.Value == "" {
+			entry.Value, entry.Default = key.def, true
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// AlterConfigs changes settings of a topic, an empty value resets a setting
+// to its default. Nothing is changed unless every value is valid.
+func AlterConfigs(ctx context.Context, name string, changes map[string]string) (Config, error) {
+	ctx, span := constants.Tracer.Start(ctx, "AlterConfigs")
+	defer span.End()
+
+	alterLock.Lock()
+	defer alterLock.Unlock()
+
+	config, err := LoadConfig(ctx, name)
+	if err != nil {
+		return Config{}, err
+	}
+	names := make([]string, 0, len(changes))
+	for key := range changes {
+		names = append(names, key)
+	}
+	sort.Strings(names) // Report errors in a stable order
+	for _, keyName := range names {
+		key, found := findConfigKey(keyName)
+		if !found {
+			return Config{}, fmt.Errorf("unknown config %s", keyName)
+		}
+		if key.readOnly {
+			return Config{}, fmt.Errorf("config %s cannot be altered", keyName)
+		}
+		value := changes[keyName]
+		if value != "" {
+			if err := key.validate(value); err != nil {
+				return Config{}, fmt.Errorf("invalid value %q for %s: %w", value, keyName, err)
+			}
+		}
+		key.set(&config, value)
+	}
+
+	if err := saveConfig(name, config); err != nil {
+		return Config{}, err
+	}
+	log.Println("Altered config of topic", name, changes)
+	notifyConfigChange(ctx, name, config)
+	return config, nil
+}
+
+// Validate checks the dynamic settings of a config hold allowed values
+func (c Config) Validate() error {
+	for _, key := range configKeys {
+		if key.readOnly {
+			continue
+		}
+		if value := key.get(c); value != "" {
+			if err := key.validate(value); err != nil {
+				return fmt.Errorf("invalid value %q for %s: %w", value, key.name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// ConfigChanges returns the dynamic settings to alter to turn from into to,
+// an empty value for a setting to reset
+func ConfigChanges(from, to Config) map[string]string {
+	changes := map[string]string{}
+	for _, key := range configKeys {
+		if !key.readOnly && key.get(from) != key.get(to) {
+			changes[key.name] = key.get(to)
+		}
+	}
+	return changes
+}
+
+// Let running components pick up a changed config right away
+func notifyConfigChange(ctx context.Context, name string, config Config) {
+	producer.InvalidateConfig(name)
+
+	configListenersLock.Lock()
+	listeners := append([]func(context.Context, string, Config){}, configListeners...)
+	configListenersLock.Unlock()
+	for _, fn := range listeners {
+		fn(ctx, name, config)
+	}
+}
+
+func findConfigKey(name string) (configKey, bool) {
+	for _, key := range configKeys {
+		if key.name == name {
+			return key, true
+		}
+	}
+	return configKey{}, false
+}
+
+func oneOf(allowed ...string) func(string) error {
+	return func(value string) error {
+		for _, a := range allowed {
+			if value == a {
+				return nil
+			}
+		}
+		return fmt.Errorf("must be one of %v", allowed)
+	}
+}
+
+func intAtLeast(minimum int64) func(string) error {
+	return func(value string) error {
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("not an integer")
+		}
+		if n < minimum {
+			return fmt.Errorf("must be at least %d", minimum)
+		}
+		return nil
+	}
+}
+
+// Zero means unset for numeric settings
+func formatNonZero(n int64) string {
+	if n == 0 {
+		return ""
+	}
+	return strconv.FormatInt(n, 10)
+}
@@ -0,0 +1,103 @@
+package topic
+
+import (
+	"FranzMQ/constants"
+	"FranzMQ/consumer"
+	"FranzMQ/producer"
+	"FranzMQ/storage"
+	"FranzMQ/utils"
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	deleteListenersLock sync.Mutex
+	deleteListeners     []func(ctx context.Context, name string)
+)
+
+// OnDelete registers fn to run after a topic was deleted. It runs while
+// topic changes are locked, so it must not wait on other topic changes.
+func OnDelete(fn func(ctx context.Context, name string)) {
+	deleteListenersLock.Lock()
+	defer deleteListenersLock.Unlock()
+	deleteListeners = append(deleteListeners, fn)
+}
+
+// DeleteTopic removes a topic. Its directory is first moved under
+// constants.DeletedDir, and its partitions in other log dirs to their deleted
+// dirs, so the topic disappears at once for produce and fetch,
+// then the producer state, caches and committed offsets are dropped and the
+// files removed. A crash in between leaves the files to PurgeDeleted.
+func DeleteTopic(ctx context.Context, name string) error {
+	ctx, span := constants.Tracer.Start(ctx, "DeleteTopic")
+	defer span.End()
+
+	if name == "" || strings.ContainsAny(name, "/\\") || name == "." || name == ".." {
+		return fmt.Errorf("invalid topic name %q", name)
+	}
+	alterLock.Lock()
+	defer alterLock.Unlock()
+
+	config, err := LoadConfig(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	if err := storage.MkdirAll(constants.DeletedDir); err != nil {
+		return fmt.Errorf("error creating deleted topics directory: %w", err)
+	}
+	markedDir := constants.DeletedDir + name + "-" + strconv.FormatInt(time.Now().UnixNano(), 10)
+	if err := storage.Rename(constants.FilesDir+name, markedDir); err != nil {
+		return fmt.Errorf("error marking topic for deletion: %w", err)
+	}
+	if err := storage.MarkDeleted(ctx, name); err != nil {
+		log.Println("Error moving partitions of deleted topic out of their log dirs:", err)
+	}
+	log.Println("Topic marked for deletion:", name)
+
+	producer.RemoveTopic(ctx, name, config.NumOfPartition)
+	storage.Forget(name)
+	forgetCachedFiles(name)
+	if err := consumer.RemoveTopicOffsets(ctx, name); err != nil {
+		log.Println("Error removing committed offsets of deleted topic:", err)
+	}
+
+	if err := storage.RemoveAll(markedDir); err != nil {
+		log.Println("Error removing files of deleted topic, they are purged on next start:", err)
+	}
+	storage.PurgeDeleted()
+
+	deleteListenersLock.Lock()
+	listeners := append([]func(context.Context, string){}, deleteListeners...)
+	deleteListenersLock.Unlock()
+	for _, fn := range listeners {
+		fn(ctx, name)
+	}
+	return nil
+}
+
+// PurgeDeleted removes the files of topics whose deletion was interrupted
+func PurgeDeleted() {
+	_, span := constants.Tracer.Start(context.Background(), "PurgeDeleted")
+	defer span.End()
+
+	if err := storage.RemoveAll(constants.DeletedDir); err != nil {
+		log.Println("Error purging deleted topics:", err)
+	}
+	storage.PurgeDeleted()
+}
+
+// Drop the cached existence checks of a topic's directory and files
+func forgetCachedFiles(name string) {
+	utils.FileCache.Range(func(key, _ interface{}) bool {
+		if path := key.(string); path == constants.FilesDir+name || strings.HasPrefix(path, constants.FilesDir+name+"/") {
+			utils.FileCache.Delete(key)
+		}
+		return true
+	})
+}
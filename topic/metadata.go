@@ -0,0 +1,109 @@
+package topic
+
+import (
+	"FranzMQ/constants"
+	"FranzMQ/consumer"
+	"FranzMQ/producer"
+	"FranzMQ/storage"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+)
+
+type PartitionDescription struct {
+	Partition      int   `json:"partition"`
+	LogSize        int64 `json:"log_size"` // Bytes
+	EarliestOffset int   `json:"earliest_offset"`
+	LatestOffset   int   `json:"latest_offset"`   // Offset the next message will get
+	Segments       int   `json:"segments"`        // Including the active one
+	RemoteSegments int   `json:"remote_segments"` // Moved to the remote tier
+}
+
+type Description struct {
+	Name       string                 `json:"name"`
+	Config     Config                 `json:"config"`
+	Partitions []PartitionDescription `json:"partitions,omitempty"`
+}
+
+// ListTopics returns the names of all topics on disk, sorted
+func ListTopics(ctx context.Context) ([]string, error) {
+	_, span := constants.Tracer.Start(ctx, "ListTopics")
+	defer span.End()
+
+	entries, err := storage.List(constants.FilesDir)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return []string{}, nil
+		}
+		return nil, fmt.Errorf("error listing topics: %w", err)
+	}
+
+	names := []string{}
+	for _, entry := range entries {
+		if entry.Dir {
+			names = append(names, entry.Name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// LoadConfig reads the stored config of a topic
+func LoadConfig(ctx context.Context, name string) (Config, error) {
+	_, span := constants.Tracer.Start(ctx, "LoadConfig")
+	defer span.End()
+
+	data, err := storage.ReadFile(storage.ConfigPath(name))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return Config{}, fmt.Errorf("topic does not exist")
+		}
+		return Config{}, fmt.Errorf("error reading topic config: %w", err)
+	}
+
+	var config Config
+	if err := json.Unmarshal(data, &config); err != nil {
+		return Config{}, fmt.Errorf("error decoding topic config: %w", err)
+	}
+	return config, nil
+}
+
+// Describe returns the config of a topic and the size and offset range of
+// every partition
+func Describe(ctx context.Context, name string) (Description, error) {
+	ctx, span := constants.Tracer.Start(ctx, "Describe")
+	defer span.End()
+
+	config, err := LoadConfig(ctx, name)
+	if err != nil {
+		return Description{}, err
+	}
+
+	desc := Description{Name: name, Config: config, Partitions: []PartitionDescription{}}
+	for p := 0; p < config.NumOfPartition; p++ {
+		partition := PartitionDescription{Partition: p}
+		if partition.LogSize, err = producer.LogSize(name, p); err != nil {
+			return Description{}, fmt.Errorf("error reading partition %d: %w", p, err)
+		}
+
+		segments := producer.Segments(name, p)
+		partition.Segments = len(segments) + 1
+		for _, segment := range segments {
+			if segment.Remote {
+				partition.RemoteSegments++
+			}
+		}
+
+		if partition.EarliestOffset, err = consumer.EarliestOffset(ctx, name, p); err != nil {
+			return Description{}, err
+		}
+		if partition.LatestOffset, err = consumer.LatestOffset(ctx, name, p); err != nil {
+			return Description{}, err
+		}
+		desc.Partitions = append(desc.Partitions, partition)
+	}
+	return desc, nil
+}
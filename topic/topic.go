@@ -3,15 +3,28 @@ package topic
 import (
 	"FranzMQ/constants"
 	"FranzMQ/producer"
+	"FranzMQ/storage"
 	"FranzMQ/utils"
 	"context"
 	"encoding/json"
 	"fmt"
 	"log"
-	"os"
 	"strconv"
+	"sync"
 )
 
+var (
+	createListenersLock sync.Mutex
+	createListeners     []func(ctx context.Context, name string, config Config)
+)
+
+// OnCreate registers fn to run after a topic was created
+func OnCreate(fn func(ctx context.Context, name string, config Config)) {
+	createListenersLock.Lock()
+	defer createListenersLock.Unlock()
+	createListeners = append(createListeners, fn)
+}
+
 func CreateAtTopic(name string, config Config) (bool, error) {
 	_, span := constants.Tracer.Start(context.Background(), "CreateAtTopic")
 	defer span.End()
@@ -23,6 +36,9 @@ func CreateAtTopic(name string, config Config) (bool, error) {
 	if config.NumOfPartition < 1 {
 		return false, fmt.Errorf("minimum number of partition is 1, it should be minimum above 0")
 	}
+	if err := config.Validate(); err != nil {
+		return false, err
+	}
 	err := createTopicDirectories(name)
 	if err != nil {
 		log.Println("Error creating topic directories:", err)
@@ -41,20 +57,20 @@ func CreateAtTopic(name string, config Config) (bool, error) {
 		return false, fmt.Errorf("error while converting config into json")
 	}
 
-	file, err := os.Create(constants.FilesDir + name + "/" + name + ".json")
-	if err != nil {
-		fmt.Println("Error creating file:", err)
-		return false, fmt.Errorf("error while converting config into json")
-	}
-	defer file.Close() // Ensure file closes after writing
-
-	_, err = file.Write(jsonData)
+	err = storage.WriteFile(storage.ConfigPath(name), jsonData)
 	if err != nil {
 		fmt.Println("Error writing JSON to file:", err)
 		return false, fmt.Errorf("error writing JSON to file")
 	}
 	producer.InitQueues(name, config.NumOfPartition)
 	utils.FileCache.Delete(constants.FilesDir + name)
+
+	createListenersLock.Lock()
+	listeners := append([]func(context.Context, string, Config){}, createListeners...)
+	createListenersLock.Unlock()
+	for _, fn := range listeners {
+		fn(context.Background(), name, config)
+	}
 	return true, nil
 }
 
@@ -62,44 +78,51 @@ func createFiles(config Config, name string) (bool, error) {
 	_, span := constants.Tracer.Start(context.Background(), "createFiles")
 	defer span.End()
 	for i := 0; i < config.NumOfPartition; i++ {
-		file, err := os.Create(constants.FilesDir + name + "/" + name + "-" + strconv.Itoa(i) + ".log")
-		if err != nil {
-			log.Println("Error creating topic file:", err)
-			return false, err
-		}
-		OffsetFile, OffsetFileErr := os.Create(constants.FilesDir + name + "/" + "meta" + "/" + name + "-" + strconv.Itoa(i) + ".json")
-		offsetData := map[string]int{"Offset": 0}
-		jsonData, err := json.MarshalIndent(offsetData, "", "  ")
-		OffsetFile.Write(jsonData)
-		if err != nil || OffsetFileErr != nil {
-			log.Println("Error creating meta file:", err)
+		if err := createPartitionFiles(name, i); err != nil {
 			return false, err
 		}
-		IndexFile, IndexFileErr := os.Create(constants.FilesDir + name + "/" + "index" + "/" + name + "-" + strconv.Itoa(i) + ".index")
-		_, er := IndexFile.WriteString("timestamp--start--end--offset\n")
-		if er != nil || IndexFileErr != nil {
-			log.Println("Error creating meta file:", err)
-			return false, err
-		}
-		defer IndexFile.Close()
-		defer OffsetFile.Close()
-		defer file.Close()
-		log.Println("File created successfully" + name + "-" + strconv.Itoa(i))
 	}
 	return true, nil
 }
 
+// Create the log, meta and index files of one partition in the log dir storage picks
+func createPartitionFiles(name string, partition int) error {
+	if _, err := storage.PlacePartition(context.Background(), name, partition); err != nil {
+		log.Println("Error creating partition directories:", err)
+		return err
+	}
+	if err := storage.WriteFile(storage.LogPath(name, partition), nil); err != nil {
+		log.Println("Error creating topic file:", err)
+		return err
+	}
+	offsetData := map[string]int{"Offset": 0}
+	jsonData, err := json.MarshalIndent(offsetData, "", "  ")
+	if err != nil {
+		log.Println("Error creating meta file:", err)
+		return err
+	}
+	if err := storage.WriteFile(storage.MetaPath(name, partition), jsonData); err != nil {
+		log.Println("Error creating meta file:", err)
+		return err
+	}
+	if err := storage.WriteFile(storage.IndexPath(name, partition), []byte("timestamp--start--end--offset\n")); err != nil {
+		log.Println("Error creating index file:", err)
+		return err
+	}
+	log.Println("File created successfully" + name + "-" + strconv.Itoa(partition))
+	return nil
+}
+
 func createTopicDirectories(name string) error {
 	_, span := constants.Tracer.Start(context.Background(), "createTopicDirectories")
 	defer span.End()
+	// Partition directories are made by storage.PlacePartition
 	paths := []string{
-		constants.FilesDir + name,
-		constants.FilesDir + name + "/meta",
-		constants.FilesDir + name + "/index",
+		storage.TopicDir(name),
 	}
 
 	for _, path := range paths {
-		if err := os.MkdirAll(path, 0755); err != nil {
+		if err := storage.MkdirAll(path); err != nil {
 			log.Println(err)
 			return fmt.Errorf("error creating directory: %s", path)
 		}
@@ -110,13 +133,5 @@ func createTopicDirectories(name string) error {
 func fileExists(name string) bool {
 	_, span := constants.Tracer.Start(context.Background(), "fileExists")
 	defer span.End()
-	_, err := os.Stat(constants.FilesDir + name)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return false // File does not exist
-		}
-		log.Println("Error checking file:", err) // Other errors (e.g., permission issues)
-		return false
-	}
-	return true // File exists
+	return storage.Exists(constants.FilesDir + name)
 }
@@ -2,12 +2,20 @@ package topic
 
 import (
 	"FranzMQ/constants"
+	"FranzMQ/consumer"
+	"FranzMQ/producer"
+	"context"
 	"os"
 	"path/filepath"
 	"strconv"
 	"testing"
 )
 
+func init() {
+	go producer.GlobalWriterThread(producer.GlobalLogWriterQueue)
+	go producer.GlobalWriterThread(producer.GlobalIndexWriterQueue)
+}
+
 // TestCreateAtTopic verifies that topics are correctly created and deleted.
 func TestCreateAtTopic(t *testing.T) {
 	topicName := "test_topic"
@@ -60,3 +68,199 @@ func TestCreateAtTopic(t *testing.T) {
 		t.Errorf("Expected topic directory %s to be deleted, but it still exists", topicPath)
 	}
 }
+
+func TestDescribe(t *testing.T) {
+	topicName := "describe_test_topic"
+	_ = os.RemoveAll(filepath.Join(constants.FilesDir, topicName))
+	defer os.RemoveAll(filepath.Join(constants.FilesDir, topicName))
+
+	if _, err := CreateAtTopic(topicName, Config{NumOfPartition: 2}); err != nil {
+		t.Fatalf("Expected topic creation to succeed, got error: %v", err)
+	}
+
+	desc, err := Describe(context.Background(), topicName)
+	if err != nil {
+		t.Fatalf("Expected describe to succeed, got error: %v", err)
+	}
+	if desc.Config.NumOfPartition != 2 || len(desc.Partitions) != 2 {
+		t.Fatalf("Expected 2 partitions, got %+v", desc)
+	}
+	for _, p := range desc.Partitions {
+		if p.LogSize != 0 || p.EarliestOffset != 1 || p.LatestOffset != 1 || p.Segments != 1 {
+			t.Errorf("Unexpected description of empty partition %+v", p)
+		}
+	}
+
+	if _, err := Describe(context.Background(), "missing_describe_topic"); err == nil {
+		t.Errorf("Expected describing a missing topic to fail")
+	}
+}
+
+func TestDeleteTopic(t *testing.T) {
+	topicName := "delete_test_topic"
+	groupID := "delete-test-group"
+	ctx := context.Background()
+	_ = os.RemoveAll(filepath.Join(constants.FilesDir, topicName))
+	// DeleteTopic closes the writer's file handles, which a plain RemoveAll would race with
+	defer DeleteTopic(ctx, topicName)
+	defer os.Remove(constants.GroupsDir + groupID + ".json")
+
+	if _, err := CreateAtTopic(topicName, Config{NumOfPartition: 2}); err != nil {
+		t.Fatalf("Expected topic creation to succeed, got error: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		if _, _, err := producer.ProduceToPartition(ctx, topicName, 0, "message"); err != nil {
+			t.Fatalf("produce failed: %v", err)
+		}
+	}
+	if err := consumer.CommitOffset(ctx, groupID, topicName, 0, 3); err != nil {
+		t.Fatalf("commit failed: %v", err)
+	}
+
+	if err := DeleteTopic(ctx, topicName); err != nil {
+		t.Fatalf("Expected delete to succeed, got error: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(constants.FilesDir, topicName)); !os.IsNotExist(err) {
+		t.Errorf("Expected topic directory to be gone, got %v", err)
+	}
+	if _, _, err := producer.ProduceToPartition(ctx, topicName, 0, "message"); err == nil {
+		t.Errorf("Expected producing to a deleted topic to fail")
+	}
+	if _, exists, _ := consumer.CommittedOffset(ctx, groupID, topicName, 0); exists {
+		t.Errorf("Expected committed offsets of the deleted topic to be removed")
+	}
+	if err := DeleteTopic(ctx, topicName); err == nil {
+		t.Errorf("Expected deleting a missing topic to fail")
+	}
+
+	// A topic recreated under the same name starts from scratch
+	if _, err := CreateAtTopic(topicName, Config{NumOfPartition: 1}); err != nil {
+		t.Fatalf("Expected topic recreation to succeed, got error: %v", err)
+	}
+	_, resp, err := producer.ProduceToPartition(ctx, topicName, 0, "message")
+	if err != nil {
+		t.Fatalf("produce failed: %v", err)
+	}
+	if resp.Offset != 1 {
+		t.Errorf("Expected the recreated topic to start at offset 1, got %d", resp.Offset)
+	}
+}
+
+func TestAddPartitions(t *testing.T) {
+	topicName := "alter_test_topic"
+	ctx := context.Background()
+	_ = os.RemoveAll(filepath.Join(constants.FilesDir, topicName))
+	defer DeleteTopic(ctx, topicName)
+
+	if _, err := CreateAtTopic(topicName, Config{NumOfPartition: 2}); err != nil {
+		t.Fatalf("Expected topic creation to succeed, got error: %v", err)
+	}
+	joined, err := consumer.JoinGroup(ctx, consumer.JoinGroupRequest{
+		GroupID:   "alter-test-group",
+		Protocols: []consumer.GroupProtocol{{Name: "range"}},
+	})
+	if err != nil {
+		t.Fatalf("join failed: %v", err)
+	}
+	defer consumer.LeaveGroup(ctx, "alter-test-group", joined.MemberID)
+	if _, err := consumer.SyncGroup(ctx, "alter-test-group", joined.Generation, joined.MemberID, nil); err != nil {
+		t.Fatalf("sync failed: %v", err)
+	}
+
+	if err := AddPartitions(ctx, topicName, 4); err != nil {
+		t.Fatalf("Expected adding partitions to succeed, got error: %v", err)
+	}
+	desc, err := Describe(ctx, topicName)
+	if err != nil || desc.Config.NumOfPartition != 4 || len(desc.Partitions) != 4 {
+		t.Fatalf("Expected 4 partitions, got %+v, %v", desc, err)
+	}
+	_, resp, err := producer.ProduceToPartition(ctx, topicName, 3, "message")
+	if err != nil || resp.Offset != 1 {
+		t.Errorf("Expected offset 1 on a new partition, got %d, %v", resp.Offset, err)
+	}
+	if err := consumer.Heartbeat(ctx, "alter-test-group", joined.Generation, joined.MemberID); err != consumer.ErrRebalanceInProgress {
+		t.Errorf("Expected groups to rebalance after adding partitions, got %v", err)
+	}
+
+	if err := AddPartitions(ctx, topicName, 3); err == nil {
+		t.Errorf("Expected shrinking a topic to fail")
+	}
+	if err := AddPartitions(ctx, topicName, MaxPartitions+1); err == nil {
+		t.Errorf("Expected more than %d partitions to be rejected", MaxPartitions)
+	}
+}
+
+func TestAlterConfigs(t *testing.T) {
+	topicName := "configs_test_topic"
+	ctx := context.Background()
+	_ = os.RemoveAll(filepath.Join(constants.FilesDir, topicName))
+	defer DeleteTopic(ctx, topicName)
+
+	if _, err := CreateAtTopic(topicName, Config{NumOfPartition: 1, Compression: "brotli"}); err == nil {
+		t.Fatalf("Expected an unknown compression to be rejected")
+	}
+	if _, err := CreateAtTopic(topicName, Config{NumOfPartition: 1}); err != nil {
+		t.Fatalf("Expected topic creation to succeed, got error: %v", err)
+	}
+	changed := make(chan Config, 1)
+	OnConfigChange(func(_ context.Context, name string, config Config) {
+		if name == topicName {
+			changed <- config
+		}
+	})
+	// Warm the producer's config cache
+	if _, _, err := producer.ProduceToPartition(ctx, topicName, 0, "a message of some length"); err != nil {
+		t.Fatalf("produce failed: %v", err)
+	}
+
+	if _, err := AlterConfigs(ctx, topicName, map[string]string{"retention.ms": "60000", "segment.bytes": "1"}); err == nil {
+		t.Errorf("Expected a too small segment.bytes to be rejected")
+	}
+	if _, err := AlterConfigs(ctx, topicName, map[string]string{"partitions": "3"}); err == nil {
+		t.Errorf("Expected partitions to be read only")
+	}
+	if _, err := AlterConfigs(ctx, topicName, map[string]string{"retention.ms": "60000", "max.message.bytes": "10"}); err != nil {
+		t.Fatalf("Expected alter to succeed, got error: %v", err)
+	}
+	if config := <-changed; config.RetentionMs != 60000 || config.SegmentBytes != 0 {
+		t.Errorf("Expected only the valid change to be applied, got %+v", config)
+	}
+	if _, _, err := producer.ProduceToPartition(ctx, topicName, 0, "a message of some length"); err == nil {
+		t.Errorf("Expected the new max.message.bytes to apply right away")
+	}
+
+	entries, err := DescribeConfigs(ctx, topicName)
+	if err != nil {
+		t.Fatalf("describe configs failed: %v", err)
+	}
+	values := map[string]ConfigEntry{}
+	for _, entry := range entries {
+		values[entry.Name] = entry
+	}
+	if e := values["retention.ms"]; e.Value != "60000" || e.Default {
+		t.Errorf("Unexpected retention.ms entry %+v", e)
+	}
+	if e := values["cleanup.policy"]; e.Value != "delete" || !e.Default {
+		t.Errorf("Unexpected cleanup.policy entry %+v", e)
+	}
+
+	if _, err := AlterConfigs(ctx, topicName, map[string]string{"max.message.bytes": ""}); err != nil {
+		t.Fatalf("Expected reset to succeed, got error: %v", err)
+	}
+	<-changed
+	if _, _, err := producer.ProduceToPartition(ctx, topicName, 0, "a message of some length"); err != nil {
+		t.Errorf("Expected produce to succeed after the reset, got %v", err)
+	}
+}
+
+func TestConfigChanges(t *testing.T) {
+	from := Config{NumOfPartition: 1, RetentionMs: 60000, Compression: "gzip"}
+	to := Config{NumOfPartition: 3, Compression: "gzip", MinInsyncReplicas: 2}
+	changes := ConfigChanges(from, to)
+	if len(changes) != 2 || changes["retention.ms"] != "" || changes["min.insync.replicas"] != "2" {
+		t.Errorf("Expected retention.ms reset and min.insync.replicas set, got %v", changes)
+	}
+	if _, reset := changes["retention.ms"]; !reset {
+		t.Errorf("Expected retention.ms to be reset, got %v", changes)
+	}
+}
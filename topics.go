@@ -0,0 +1,186 @@
+package main
+
+import (
+	"FranzMQ/constants"
+	"FranzMQ/replication"
+	"FranzMQ/topic"
+	"encoding/json"
+	"net/http"
+)
+
+// listTopics returns the config of every topic
+//
+// GET /topics
+func listTopics(w http.ResponseWriter, r *http.Request) {
+	ctx, span := constants.Tracer.Start(r.Context(), "listTopics GET")
+	defer span.End()
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	names, err := topic.ListTopics(ctx)
+	if err != nil {
+		jsonResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	topics := []topic.Description{}
+	for _, name := range names {
+		config, err := topic.LoadConfig(ctx, name)
+		if err != nil {
+			continue // Half created or foreign directory
+		}
+		topics = append(topics, topic.Description{Name: name, Config: config})
+	}
+	jsonResponse(w, http.StatusOK, topics)
+}
+
+// clusterMetadata returns the brokers of the cluster and the leader,
+// replicas and in-sync replicas of each partition of the topics named, of
+// every topic without names
+//
+// GET /metadata?topic=orders&topic=payments
+func clusterMetadata(w http.ResponseWriter, r *http.Request) {
+	ctx, span := constants.Tracer.Start(r.Context(), "clusterMetadata GET")
+	defer span.End()
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	cluster, err := replication.Describe(ctx, r.URL.Query()["topic"])
+	if err != nil {
+		jsonResponse(w, http.StatusNotFound, err.Error())
+		return
+	}
+	jsonResponse(w, http.StatusOK, cluster)
+}
+
+// describeTopic returns the config of a topic with the log size, offset
+// range and segment count of each partition
+//
+// GET /topics/{name}
+func describeTopic(w http.ResponseWriter, r *http.Request) {
+	ctx, span := constants.Tracer.Start(r.Context(), "describeTopic GET")
+	defer span.End()
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	desc, err := topic.Describe(ctx, r.PathValue("name"))
+	if err != nil {
+		jsonResponse(w, http.StatusNotFound, err.Error())
+		return
+	}
+	jsonResponse(w, http.StatusOK, desc)
+}
+
+// deleteTopic removes a topic with all its messages and committed offsets
+//
+// DELETE /topics/{name}
+func deleteTopic(w http.ResponseWriter, r *http.Request) {
+	ctx, span := constants.Tracer.Start(r.Context(), "deleteTopic DELETE")
+	defer span.End()
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := r.PathValue("name")
+	if _, err := topic.LoadConfig(ctx, name); err != nil {
+		jsonResponse(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err := topic.DeleteTopic(ctx, name); err != nil {
+		jsonResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	jsonResponse(w, http.StatusOK, "Topic deleted")
+}
+
+type alterTopicRequest struct {
+	Partitions int `json:"partitions"` // New total, only growing is supported
+}
+
+// alterTopic adds partitions to a topic
+//
+// PATCH /topics/{name}
+func alterTopic(w http.ResponseWriter, r *http.Request) {
+	ctx, span := constants.Tracer.Start(r.Context(), "alterTopic PATCH")
+	defer span.End()
+	if r.Method != http.MethodPatch {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req alterTopicRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonResponse(w, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+	name := r.PathValue("name")
+	if _, err := topic.LoadConfig(ctx, name); err != nil {
+		jsonResponse(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err := topic.AddPartitions(ctx, name, req.Partitions); err != nil {
+		jsonResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	jsonResponse(w, http.StatusOK, "Topic altered")
+}
+
+// topicByName routes /topics/{name} by method
+func topicByName(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodDelete:
+		deleteTopic(w, r)
+	case http.MethodPatch:
+		alterTopic(w, r)
+	default:
+		describeTopic(w, r)
+	}
+}
+
+type alterConfigsRequest struct {
+	Configs map[string]string `json:"configs"` // An empty value resets the key to its default
+}
+
+// topicConfigs returns the settings of a topic or changes some of them
+//
+// GET /topics/{name}/configs
+// PATCH /topics/{name}/configs
+func topicConfigs(w http.ResponseWriter, r *http.Request) {
+	ctx, span := constants.Tracer.Start(r.Context(), "topicConfigs "+r.Method)
+	defer span.End()
+
+	name := r.PathValue("name")
+	switch r.Method {
+	case http.MethodGet:
+		entries, err := topic.DescribeConfigs(ctx, name)
+		if err != nil {
+			jsonResponse(w, http.StatusNotFound, err.Error())
+			return
+		}
+		jsonResponse(w, http.StatusOK, entries)
+	case http.MethodPatch:
+		var req alterConfigsRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			jsonResponse(w, http.StatusBadRequest, "Invalid JSON")
+			return
+		}
+		if _, err := topic.LoadConfig(ctx, name); err != nil {
+			jsonResponse(w, http.StatusNotFound, err.Error())
+			return
+		}
+		if _, err := topic.AlterConfigs(ctx, name, req.Configs); err != nil {
+			jsonResponse(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		jsonResponse(w, http.StatusOK, "Topic configs altered")
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
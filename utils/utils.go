@@ -2,11 +2,11 @@ package utils
 
 import (
 	"FranzMQ/constants"
+	"FranzMQ/storage"
 	"context"
 	"encoding/json"
 	"fmt"
 	"hash/fnv"
-	"os"
 	"sync"
 	"time"
 
@@ -19,11 +19,32 @@ var (
 	once       sync.Once
 )
 
+// Etcd returns the client of the etcd cluster at endpoints, connected on
+// the first call. Later calls share it whatever endpoints they pass.
+func Etcd(endpoints []string) (*clientv3.Client, error) {
+	var err error
+	once.Do(func() {
+		etcdClient, err = clientv3.New(clientv3.Config{Endpoints: endpoints, DialTimeout: 5 * time.Second})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to etcd: %w", err)
+	}
+	if etcdClient == nil {
+		return nil, fmt.Errorf("etcd client failed to connect earlier")
+	}
+	return etcdClient, nil
+}
+
 var (
 	FileCache   sync.Map // Stores file existence: key -> exists (bool)
 	cacheExpiry = 60 * time.Second
 )
 
+// SetFileCacheExpiry sets how long FileExists trusts a cached result
+func SetFileCacheExpiry(d time.Duration) {
+	cacheExpiry = d
+}
+
 // FileCacheEntry represents a cached file check result
 type FileCacheEntry struct {
 	exists     bool
@@ -46,13 +67,7 @@ func FileExists(ctx context.Context, name string) bool {
 	}
 
 	// Perform actual file check
-	_, err := os.Stat(filePath)
-	exists := err == nil || !os.IsNotExist(err)
-
-	// Log errors (but don't cache them)
-	if err != nil && !os.IsNotExist(err) {
-		fmt.Println("Error checking file:", err)
-	}
+	exists := storage.Exists(filePath)
 
 	// Cache result
 	FileCache.Store(filePath, FileCacheEntry{exists: exists, lastUpdate: now})